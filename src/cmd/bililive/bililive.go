@@ -17,14 +17,21 @@ import (
 	"github.com/bililive-go/bililive-go/src/configs"
 	"github.com/bililive-go/bililive-go/src/consts"
 	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/jobs"
 	"github.com/bililive-go/bililive-go/src/listeners"
 	"github.com/bililive-go/bililive-go/src/live"
 	"github.com/bililive-go/bililive-go/src/log"
 	"github.com/bililive-go/bililive-go/src/metrics"
+	"github.com/bililive-go/bililive-go/src/pkg/bandwidth"
 	"github.com/bililive-go/bililive-go/src/pkg/events"
+	"github.com/bililive-go/bililive-go/src/pkg/restream"
 	"github.com/bililive-go/bililive-go/src/pkg/utils"
 	"github.com/bililive-go/bililive-go/src/recorders"
+	"github.com/bililive-go/bililive-go/src/relay"
+	"github.com/bililive-go/bililive-go/src/retention"
+	"github.com/bililive-go/bililive-go/src/scheduler"
 	"github.com/bililive-go/bililive-go/src/servers"
+	"github.com/bililive-go/bililive-go/src/storage"
 	"github.com/bililive-go/bililive-go/src/tools"
 	"github.com/bililive-go/bililive-go/src/types"
 )
@@ -72,6 +79,13 @@ func main() {
 		}
 		os.Exit(0)
 	}
+	if flag.Command == flag.Danmaku2Ass.FullCommand() {
+		if err := danmaku2Ass(); err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
 	config, err := getConfig()
 	if err != nil {
@@ -144,6 +158,13 @@ func main() {
 		room.LiveId = l.GetLiveId()
 	}
 
+	jm := jobs.NewManager(ctx)
+	sm := storage.NewMonitor(ctx)
+	rs := retention.NewSweeper(ctx)
+	sc := scheduler.NewScheduler(ctx)
+	restream.NewRegistry(ctx)
+	bandwidth.NewLimiter(ctx)
+	rl := relay.NewRelay(ctx)
 	lm := listeners.NewManager(ctx)
 	rm := recorders.NewManager(ctx)
 	if err = lm.Start(ctx); err != nil {
@@ -152,6 +173,22 @@ func main() {
 	if err = rm.Start(ctx); err != nil {
 		logger.Fatalf("failed to init recorder manager, error: %s", err)
 	}
+	if err = sm.Start(ctx); err != nil {
+		logger.Fatalf("failed to init storage monitor, error: %s", err)
+	}
+	if err = rs.Start(ctx); err != nil {
+		logger.Fatalf("failed to init retention sweeper, error: %s", err)
+	}
+	if err = sc.Start(ctx); err != nil {
+		logger.Fatalf("failed to init scheduler, error: %s", err)
+	}
+	if err = rl.Start(ctx); err != nil {
+		logger.Fatalf("failed to init relay, error: %s", err)
+	}
+	// 任务处理函数在各模块 Start 时注册，需要最后启动
+	if err = jm.Start(ctx); err != nil {
+		logger.Fatalf("failed to init job manager, error: %s", err)
+	}
 
 	if err = metrics.NewCollector(ctx).Start(ctx); err != nil {
 		logger.Fatalf("failed to init metrics collector, error: %s", err)
@@ -185,8 +222,15 @@ func main() {
 		if inst.Config.RPC.Enable {
 			inst.Server.Close(ctx)
 		}
+		inst.RetentionSweeper.Close(ctx)
+		inst.Scheduler.Close(ctx)
+		inst.StorageMonitor.Close(ctx)
 		inst.ListenerManager.Close(ctx)
 		inst.RecorderManager.Close(ctx)
+		inst.Relay.Close(ctx)
+		inst.Restream.Close(ctx)
+		inst.Bandwidth.Close(ctx)
+		inst.JobManager.Close(ctx)
 	}()
 
 	if inst.Config.Debug {
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bililive-go/bililive-go/src/cmd/bililive/internal/flag"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+	"github.com/bililive-go/bililive-go/src/postprocess"
+)
+
+// 查找弹幕文件旁的视频文件时依次尝试的扩展名
+var videoExts = []string{".flv", ".mp4", ".ts", ".mkv"}
+
+// danmaku2Ass 将命令行指定的弹幕文件转换为同名的 ASS 字幕，分辨率优先从视频读取
+func danmaku2Ass() error {
+	ffmpeg := *flag.FfmpegPath
+	if ffmpeg == "" {
+		ffmpeg, _ = exec.LookPath("ffmpeg")
+	}
+	for _, input := range *flag.Danmaku2AssFiles {
+		opts := danmaku.ASSOptions{
+			Width:          *flag.Danmaku2AssWidth,
+			Height:         *flag.Danmaku2AssHeight,
+			FontName:       *flag.Danmaku2AssFontName,
+			FontSize:       *flag.Danmaku2AssFontSize,
+			Opacity:        *flag.Danmaku2AssOpacity,
+			ScrollDuration: *flag.Danmaku2AssScroll,
+			FixedDuration:  *flag.Danmaku2AssFixed,
+			ScrollArea:     *flag.Danmaku2AssScrollArea,
+			Density:        *flag.Danmaku2AssDensity,
+			Blocklist:      *flag.Danmaku2AssBlocklist,
+		}
+		stem := strings.TrimSuffix(input, filepath.Ext(input))
+		video := *flag.Danmaku2AssVideo
+		if video == "" {
+			for _, ext := range videoExts {
+				if _, err := os.Stat(stem + ext); err == nil {
+					video = stem + ext
+					break
+				}
+			}
+		}
+		if video != "" {
+			if w, h, err := postprocess.ProbeResolution(context.Background(), ffmpeg, video); err == nil {
+				opts.Width, opts.Height = w, h
+			} else {
+				fmt.Fprintf(os.Stderr, "failed to probe resolution of %s: %v\n", video, err)
+			}
+		}
+		output := stem + ".ass"
+		count, err := danmaku.ConvertToASS(input, output, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+		fmt.Printf("%s -> %s: %d danmaku, %dx%d\n", input, output, count, opts.Width, opts.Height)
+	}
+	return nil
+}
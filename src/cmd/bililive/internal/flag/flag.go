@@ -23,14 +23,35 @@ var (
 	RPC             = app.Flag("enable-rpc", "Enable RPC server.").Default("false").Bool()
 	RPCBind         = app.Flag("rpc-bind", "RPC server bind address").Default(":8080").String()
 	NativeFlvParser = app.Flag("native-flv-parser", "use native flv parser").Default("false").Bool()
+	NativeHlsParser = app.Flag("native-hls-parser", "use native hls parser").Default("false").Bool()
 	OutputFileTmpl  = app.Flag("output-file-tmpl", "output file name template").Default("").String()
 	SplitStrategies = app.Flag("split-strategies", "video split strategies, support\"on_room_name_changed\", \"max_duration:(duration)\"").Strings()
 	// 同步（仅保留）容器内置的外部工具到目标目录，然后退出（用于 Docker 镜像构建阶段）
 	SyncBuiltInToolsToPath = app.Flag("sync-built-in-tools-to-path", "Sync built-in tools into the target folder (remove others), then exit.").Default("").String()
+
+	// 不指定子命令时录制直播
+	_ = app.Command("record", "Record live streams (default).").Default()
+	// 将弹幕文件转换为同名的 ASS 字幕，然后退出
+	Danmaku2Ass           = app.Command("danmaku2ass", "Convert danmaku xml/jsonl files to ASS subtitles besides them, then exit.")
+	Danmaku2AssFiles      = Danmaku2Ass.Arg("files", "Danmaku files.").Required().ExistingFiles()
+	Danmaku2AssVideo      = Danmaku2Ass.Flag("video", "Read the resolution from this video (default: the video besides the danmaku file).").String()
+	Danmaku2AssWidth      = Danmaku2Ass.Flag("width", "Subtitle width, used when the resolution is unknown.").Default("1920").Int()
+	Danmaku2AssHeight     = Danmaku2Ass.Flag("height", "Subtitle height, used when the resolution is unknown.").Default("1080").Int()
+	Danmaku2AssFontName   = Danmaku2Ass.Flag("font-name", "Font name.").Default("Microsoft YaHei").String()
+	Danmaku2AssFontSize   = Danmaku2Ass.Flag("font-size", "Font size in pixels (default: 1/28 of the height).").Int()
+	Danmaku2AssOpacity    = Danmaku2Ass.Flag("opacity", "Opacity between 0 and 1.").Default("0.8").Float64()
+	Danmaku2AssScroll     = Danmaku2Ass.Flag("scroll-duration", "Duration of scrolling danmaku.").Default("12s").Duration()
+	Danmaku2AssFixed      = Danmaku2Ass.Flag("fixed-duration", "Duration of top and bottom danmaku.").Default("5s").Duration()
+	Danmaku2AssScrollArea = Danmaku2Ass.Flag("scroll-area", "Ratio of the screen height used by scrolling danmaku.").Default("1").Float64()
+	Danmaku2AssDensity    = Danmaku2Ass.Flag("density", "Max danmaku on screen, 0 for unlimited.").Default("0").Int()
+	Danmaku2AssBlocklist  = Danmaku2Ass.Flag("block", "Hide danmaku containing this keyword, can be repeated.").Strings()
+
+	// Command 是解析出的子命令
+	Command string
 )
 
 func init() {
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	Command = kingpin.MustParse(app.Parse(os.Args[1:]))
 }
 
 // GenConfigFromFlags generates configuration by parsing command line parameters.
@@ -48,6 +69,7 @@ func GenConfigFromFlags() *configs.Config {
 	cfg.LiveRooms = configs.NewLiveRoomsWithStrings(*Input)
 	cfg.Feature = configs.Feature{
 		UseNativeFlvParser: *NativeFlvParser,
+		UseNativeHlsParser: *NativeHlsParser,
 	}
 
 	if SplitStrategies != nil && len(*SplitStrategies) > 0 {
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
 	"github.com/bililive-go/bililive-go/src/types"
 	"gopkg.in/yaml.v2"
 )
@@ -40,22 +41,99 @@ func (r *RPC) verify() error {
 // Feature info.
 type Feature struct {
 	UseNativeFlvParser         bool `yaml:"use_native_flv_parser"`
+	UseNativeHlsParser         bool `yaml:"use_native_hls_parser"`
 	RemoveSymbolOtherCharacter bool `yaml:"remove_symbol_other_character"`
 }
 
 // VideoSplitStrategies info.
 type VideoSplitStrategies struct {
-	OnRoomNameChanged bool          `yaml:"on_room_name_changed"`
-	MaxDuration       time.Duration `yaml:"max_duration"`
-	MaxFileSize       int           `yaml:"max_file_size"`
+	OnRoomNameChanged bool          `yaml:"on_room_name_changed" json:"on_room_name_changed"`
+	MaxDuration       time.Duration `yaml:"max_duration" json:"max_duration"`
+	MaxFileSize       int           `yaml:"max_file_size" json:"max_file_size"`
+	// 重启录制时先启动新的录制器，收到数据后再结束旧的录制器
+	Handover bool `yaml:"handover" json:"handover"`
+}
+
+// StreamSelector 多线路（CDN）选择策略
+type StreamSelector struct {
+	Enable          bool          `yaml:"enable"`
+	ProbeTimeout    time.Duration `yaml:"probe_timeout"`
+	BadHostCooldown time.Duration `yaml:"bad_host_cooldown"`
+}
+
+// Restream 在本地转播正在录制的直播流，需要使用原生 flv 解析器
+type Restream struct {
+	Enable bool `yaml:"enable"`
+	// BufferSize 每个观看者最多缓存的 tag 数量，跟不上直播流时断开该观看者
+	BufferSize int `yaml:"buffer_size"`
+	// HLS 同时提供 HLS，在有人观看时由 ffmpeg 封装
+	HLS bool `yaml:"hls"`
+}
+
+// Danmaku 录制弹幕，保存在每个视频文件旁的同名 xml 或 jsonl 文件中
+type Danmaku struct {
+	Enable bool   `yaml:"enable"`
+	Format string `yaml:"format"`
+}
+
+// Highlight 场次结束后根据弹幕、礼物与醒目留言的密度检测高能片段，需要同时开启弹幕录制
+type Highlight struct {
+	Enable bool `yaml:"enable"`
+	// 活跃度曲线中每个点统计的时长
+	Interval time.Duration `yaml:"interval"`
+	// 最多选取的片段数量
+	TopN int `yaml:"top_n"`
+	// 片段在峰值前后保留的时长
+	Before time.Duration `yaml:"before"`
+	After  time.Duration `yaml:"after"`
+	// 峰值至少为平均分数的倍数
+	MinRatio float64 `yaml:"min_ratio"`
+	// 弹幕包含关键词时额外增加的分数
+	Keywords        map[string]float64 `yaml:"keywords,omitempty"`
+	GiftWeight      float64            `yaml:"gift_weight"`
+	SuperChatWeight float64            `yaml:"super_chat_weight"`
+	PriceWeight     float64            `yaml:"price_weight"`
+	// 使用 ffmpeg 以流复制的方式导出片段
+	ExportClips bool `yaml:"export_clips"`
 }
 
 // On record finished actions.
 type OnRecordFinished struct {
-	ConvertToMp4          bool   `yaml:"convert_to_mp4"`
-	DeleteFlvAfterConvert bool   `yaml:"delete_flv_after_convert"`
-	CustomCommandline     string `yaml:"custom_commandline"`
-	FixFlvAtFirst         bool   `yaml:"fix_flv_at_first"`
+	ConvertToMp4           bool   `yaml:"convert_to_mp4" json:"convert_to_mp4"`
+	DeleteFlvAfterConvert  bool   `yaml:"delete_flv_after_convert" json:"delete_flv_after_convert"`
+	CustomCommandline      string `yaml:"custom_commandline" json:"custom_commandline"`
+	CustomCommandlineScope string `yaml:"custom_commandline_scope" json:"custom_commandline_scope"`
+	FixFlvAtFirst          bool   `yaml:"fix_flv_at_first" json:"fix_flv_at_first"`
+	// Pipeline 不为空时按顺序执行其中的步骤，以上选项不再生效
+	Pipeline []PostProcessStep `yaml:"pipeline,omitempty" json:"pipeline,omitempty"`
+}
+
+// custom_commandline 的执行方式
+const (
+	// CommandlineScopeFile 每个输出文件执行一次
+	CommandlineScopeFile = "file"
+	// CommandlineScopeSession 场次结束后对全部文件执行一次
+	CommandlineScopeSession = "session"
+)
+
+// StorageMonitor 监控 out_put_path 所在磁盘的剩余空间，单位为字节
+type StorageMonitor struct {
+	Enable            bool          `yaml:"enable"`
+	CheckInterval     time.Duration `yaml:"check_interval"`
+	WarningFreeSpace  int64         `yaml:"warning_free_space"`
+	CriticalFreeSpace int64         `yaml:"critical_free_space"`
+	// 优先级不低于该值的直播间在空间不足时继续录制
+	ProtectedPriority int `yaml:"protected_priority"`
+}
+
+// Jobs 后处理等后台任务的队列设置
+type Jobs struct {
+	Workers     int           `yaml:"workers"`
+	MaxAttempts int           `yaml:"max_attempts"`
+	RetryDelay  time.Duration `yaml:"retry_delay"`
+	// 已结束（成功、失败或取消）的任务最多保留的数量与时间，超出后删除任务记录与日志，0 为不限制
+	MaxFinished int           `yaml:"max_finished"`
+	Retention   time.Duration `yaml:"retention"`
 }
 
 type Log struct {
@@ -99,8 +177,17 @@ type Config struct {
 	LiveRooms            []LiveRoom           `yaml:"live_rooms"`
 	OutputTmpl           string               `yaml:"out_put_tmpl"`
 	VideoSplitStrategies VideoSplitStrategies `yaml:"video_split_strategies"`
+	StreamSelector       StreamSelector       `yaml:"stream_selector"`
+	QualityPolicy        QualityPolicy        `yaml:"quality_policy"`
+	Restream             Restream             `yaml:"restream"`
+	Limits               Limits               `yaml:"limits"`
+	Danmaku              Danmaku              `yaml:"danmaku"`
+	Highlight            Highlight            `yaml:"highlight"`
 	Cookies              map[string]string    `yaml:"cookies"`
 	OnRecordFinished     OnRecordFinished     `yaml:"on_record_finished"`
+	Jobs                 Jobs                 `yaml:"jobs"`
+	StorageMonitor       StorageMonitor       `yaml:"storage_monitor"`
+	Retention            Retention            `yaml:"retention"`
 	TimeoutInUs          int                  `yaml:"timeout_in_us"`
 	Notify               Notify               `yaml:"notify"` // 通知服务配置
 	AppDataPath          string               `yaml:"app_data_path"`
@@ -109,6 +196,10 @@ type Config struct {
 	// 可写工具目录：若指定，则外部工具将下载到该目录。
 	// 场景：当 OutPutPath/AppDataPath 位于 exfat/ntfs/cifs 等不支持可执行权限的卷上时，可以将此目录单独挂载到 ext4/xfs 卷。
 	ToolRootFolder string `yaml:"tool_root_folder"`
+	// RemoteStorages 后处理 remote_upload 步骤使用的远程存储，按名称引用
+	RemoteStorages map[string]RemoteStorage `yaml:"remote_storages,omitempty"`
+	// Platforms 按直播间地址的 host 覆盖全局设置，如 live.bilibili.com、douyu.com
+	Platforms map[string]Overrides `yaml:"platforms,omitempty"`
 
 	liveRoomIndexCache map[string]int
 }
@@ -130,6 +221,20 @@ type LiveRoom struct {
 	Quality     int          `yaml:"quality,omitempty"`
 	AudioOnly   bool         `yaml:"audio_only,omitempty"`
 	NickName    string       `yaml:"nick_name,omitempty"`
+	// Priority 越大越重要，磁盘空间不足时优先停止低优先级的录制，超出并发数与带宽上限时优先录制高优先级的直播间
+	Priority int `yaml:"priority,omitempty"`
+	// Pipeline 覆盖全局的后处理流水线
+	Pipeline []PostProcessStep `yaml:"pipeline,omitempty"`
+	// Retention 覆盖全局的保留规则
+	Retention *RetentionRule `yaml:"retention,omitempty"`
+	// Danmaku 覆盖全局的弹幕录制开关
+	Danmaku *bool `yaml:"danmaku,omitempty"`
+	// Schedule 录制时间表，未设置时开播即录制
+	Schedule *Schedule `yaml:"schedule,omitempty"`
+	// Relay 录制时推流到 RTMP 服务器
+	Relay *Relay `yaml:"relay,omitempty"`
+	// Overrides 覆盖全局与平台的输出、切分与后处理设置
+	Overrides `yaml:",inline"`
 }
 
 type liveRoomAlias LiveRoom
@@ -177,6 +282,7 @@ var defaultConfig = Config{
 	},
 	Feature: Feature{
 		UseNativeFlvParser:         false,
+		UseNativeHlsParser:         false,
 		RemoveSymbolOtherCharacter: false,
 	},
 	LiveRooms:          []LiveRoom{},
@@ -185,10 +291,56 @@ var defaultConfig = Config{
 	VideoSplitStrategies: VideoSplitStrategies{
 		OnRoomNameChanged: false,
 	},
+	StreamSelector: StreamSelector{
+		Enable:          true,
+		ProbeTimeout:    5 * time.Second,
+		BadHostCooldown: 10 * time.Minute,
+	},
+	Restream: Restream{
+		BufferSize: 1024,
+	},
+	Limits: Limits{
+		OverBudget: OverBudgetDowngrade,
+	},
+	Danmaku: Danmaku{
+		Format: danmaku.FormatXML,
+	},
+	Highlight: Highlight{
+		Interval:        10 * time.Second,
+		TopN:            5,
+		Before:          40 * time.Second,
+		After:           20 * time.Second,
+		MinRatio:        2,
+		GiftWeight:      1,
+		SuperChatWeight: 5,
+		PriceWeight:     0.1,
+		ExportClips:     true,
+	},
 	OnRecordFinished: OnRecordFinished{
-		ConvertToMp4:          false,
-		DeleteFlvAfterConvert: false,
-		FixFlvAtFirst:         true,
+		ConvertToMp4:           false,
+		DeleteFlvAfterConvert:  false,
+		CustomCommandlineScope: CommandlineScopeFile,
+		FixFlvAtFirst:          true,
+	},
+	Jobs: Jobs{
+		Workers:     1,
+		MaxAttempts: 3,
+		RetryDelay:  30 * time.Second,
+		MaxFinished: 500,
+		Retention:   30 * 24 * time.Hour,
+	},
+	StorageMonitor: StorageMonitor{
+		Enable:            true,
+		CheckInterval:     30 * time.Second,
+		WarningFreeSpace:  5 << 30,
+		CriticalFreeSpace: 1 << 30,
+		ProtectedPriority: 1,
+	},
+	Retention: Retention{
+		CheckInterval: time.Hour,
+		RetentionRule: RetentionRule{
+			MinAge: 24 * time.Hour,
+		},
 	},
 	TimeoutInUs: 60000000,
 	Notify: Notify{
@@ -229,6 +381,22 @@ func newConfigPostProcess(c *Config) {
 	}
 }
 
+// DanmakuEnabled 返回直播间是否录制弹幕，直播间的设置优先
+func (c *Config) DanmakuEnabled(url string) bool {
+	if room, err := c.GetLiveRoomByUrl(url); err == nil && room.Danmaku != nil {
+		return *room.Danmaku
+	}
+	return c.Danmaku.Enable
+}
+
+// GetDanmakuFormat 返回弹幕文件的格式，未设置时为 xml
+func (c *Config) GetDanmakuFormat() string {
+	if c.Danmaku.Format == "" {
+		return danmaku.FormatXML
+	}
+	return c.Danmaku.Format
+}
+
 // Verify will return an error when this config has problem.
 func (c *Config) Verify() error {
 	if c == nil {
@@ -246,6 +414,61 @@ func (c *Config) Verify() error {
 	if maxDur := c.VideoSplitStrategies.MaxDuration; maxDur > 0 && maxDur < time.Minute {
 		return fmt.Errorf("the minimum value of max_duration is one minute")
 	}
+	if sm := c.StorageMonitor; sm.Enable && sm.CriticalFreeSpace > sm.WarningFreeSpace {
+		return fmt.Errorf("the critical_free_space can not be greater than warning_free_space")
+	}
+	if f := c.Danmaku.Format; f != "" && !danmaku.ValidFormat(f) {
+		return fmt.Errorf(`unknown danmaku format "%s"`, f)
+	}
+	if h := c.Highlight; h.Interval < 0 || h.TopN < 0 || h.Before < 0 || h.After < 0 {
+		return fmt.Errorf("the interval, top_n, before and after of highlight can not be negative")
+	}
+	if err := c.QualityPolicy.verify(); err != nil {
+		return err
+	}
+	if c.Restream.Enable && c.Restream.BufferSize <= 0 {
+		return fmt.Errorf("the buffer_size of restream must be positive")
+	}
+	if err := c.Limits.verify(); err != nil {
+		return err
+	}
+	if err := verifyRemoteStorages(c.RemoteStorages); err != nil {
+		return err
+	}
+	if err := verifyPipeline(c.OnRecordFinished.Pipeline, c.RemoteStorages); err != nil {
+		return err
+	}
+	if err := c.Retention.verify(); err != nil {
+		return err
+	}
+	for platform, o := range c.Platforms {
+		if err := o.verify(c.RemoteStorages); err != nil {
+			return fmt.Errorf("platform %s: %w", platform, err)
+		}
+	}
+	for _, room := range c.LiveRooms {
+		if err := verifyPipeline(room.Pipeline, c.RemoteStorages); err != nil {
+			return fmt.Errorf("%s: %w", room.Url, err)
+		}
+		if err := room.Overrides.verify(c.RemoteStorages); err != nil {
+			return fmt.Errorf("%s: %w", room.Url, err)
+		}
+		if room.Retention != nil {
+			if err := room.Retention.verify(); err != nil {
+				return fmt.Errorf("%s: %w", room.Url, err)
+			}
+		}
+		if room.Schedule != nil {
+			if err := room.Schedule.verify(); err != nil {
+				return fmt.Errorf("%s: %w", room.Url, err)
+			}
+		}
+		if room.Relay != nil {
+			if err := room.Relay.verify(); err != nil {
+				return fmt.Errorf("%s: %w", room.Url, err)
+			}
+		}
+	}
 	if !c.RPC.Enable && len(c.LiveRooms) == 0 {
 		return fmt.Errorf("the RPC is not enabled, and no live room is set. the program has nothing to do using this setting")
 	}
@@ -1,8 +1,10 @@
 package configs
 
 import (
+	"encoding/json"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,3 +44,243 @@ func TestConfig_Verify(t *testing.T) {
 	cfg.RPC.Enable = false
 	assert.Error(t, cfg.Verify())
 }
+
+func TestConfig_VerifyPipeline(t *testing.T) {
+	cfg := &Config{
+		RPC:        defaultRPC,
+		Interval:   30,
+		OutPutPath: os.TempDir(),
+	}
+	cfg.OnRecordFinished.Pipeline = []PostProcessStep{
+		{Type: StepRemux, Format: "mkv"},
+		{Type: StepMove, Dir: "/tmp", OnFailure: OnFailureIgnore},
+	}
+	assert.NoError(t, cfg.Verify())
+	cfg.OnRecordFinished.Pipeline[0].Format = "avi"
+	assert.Error(t, cfg.Verify())
+	cfg.OnRecordFinished.Pipeline[0].Format = "mp4"
+	cfg.OnRecordFinished.Pipeline[1].OnFailure = "retry"
+	assert.Error(t, cfg.Verify())
+	cfg.OnRecordFinished.Pipeline = []PostProcessStep{{Type: StepDanmakuASS, ASS: DanmakuASS{Opacity: 0.5}}}
+	assert.NoError(t, cfg.Verify())
+	cfg.OnRecordFinished.Pipeline[0].ASS.Opacity = 1.5
+	assert.Error(t, cfg.Verify())
+	cfg.OnRecordFinished.Pipeline = nil
+	cfg.LiveRooms = []LiveRoom{{Url: "https://live.bilibili.com/1", Pipeline: []PostProcessStep{{Type: "unknown"}}}}
+	assert.Error(t, cfg.Verify())
+}
+
+func TestConfig_VerifyRemoteStorages(t *testing.T) {
+	cfg := &Config{
+		RPC:        defaultRPC,
+		Interval:   30,
+		OutPutPath: os.TempDir(),
+		RemoteStorages: map[string]RemoteStorage{
+			"server": {Type: RemoteStorageSFTP, Host: "127.0.0.1:22", Username: "user"},
+		},
+	}
+	// sftp 必须设置 host_key
+	assert.Error(t, cfg.Verify())
+	cfg.RemoteStorages["server"] = RemoteStorage{
+		Type: RemoteStorageSFTP, Host: "127.0.0.1:22", Username: "user", HostKey: "ssh-ed25519 AAAA",
+	}
+	assert.NoError(t, cfg.Verify())
+	retries := -1
+	cfg.RemoteStorages["nas"] = RemoteStorage{Type: RemoteStorageWebDAV, Url: "http://127.0.0.1/dav", Retries: &retries}
+	assert.Error(t, cfg.Verify())
+}
+
+func TestConfig_GetPipeline(t *testing.T) {
+	global := []PostProcessStep{{Type: StepFix}}
+	room := []PostProcessStep{{Type: StepChecksum}}
+	cfg := &Config{
+		OnRecordFinished: OnRecordFinished{Pipeline: global},
+		LiveRooms: []LiveRoom{
+			{Url: "https://live.bilibili.com/1", Pipeline: room},
+			{Url: "https://live.bilibili.com/2"},
+		},
+		liveRoomIndexCache: map[string]int{},
+	}
+	assert.Equal(t, room, cfg.GetPipeline("https://live.bilibili.com/1"))
+	assert.Equal(t, global, cfg.GetPipeline("https://live.bilibili.com/2"))
+	assert.Equal(t, global, cfg.GetPipeline("https://live.bilibili.com/3"))
+}
+
+func TestConfig_GetRetentionRule(t *testing.T) {
+	room := &RetentionRule{KeepSessions: 3}
+	cfg := &Config{
+		RPC:        defaultRPC,
+		Interval:   30,
+		OutPutPath: os.TempDir(),
+		Retention:  Retention{RetentionRule: RetentionRule{MaxAge: time.Hour, MinAge: time.Minute}},
+		LiveRooms: []LiveRoom{
+			{Url: "https://live.bilibili.com/1", Retention: room},
+			{Url: "https://live.bilibili.com/2"},
+		},
+		liveRoomIndexCache: map[string]int{},
+	}
+	assert.Equal(t, *room, cfg.GetRetentionRule("https://live.bilibili.com/1"))
+	assert.Equal(t, cfg.Retention.RetentionRule, cfg.GetRetentionRule("https://live.bilibili.com/2"))
+
+	assert.NoError(t, cfg.Verify())
+	cfg.LiveRooms[1].Retention = &RetentionRule{MaxRoomSize: -1}
+	assert.Error(t, cfg.Verify())
+}
+
+func TestConfig_GetSchedule(t *testing.T) {
+	cfg := &Config{
+		RPC:        defaultRPC,
+		Interval:   30,
+		OutPutPath: os.TempDir(),
+		LiveRooms: []LiveRoom{
+			{Url: "https://live.bilibili.com/1", Schedule: &Schedule{Timezone: "Asia/Shanghai", Windows: []string{"mon-fri 20:00-02:00"}}},
+			{Url: "https://live.bilibili.com/2"},
+		},
+		liveRoomIndexCache: map[string]int{},
+	}
+	room, s := cfg.GetSchedule("https://live.bilibili.com/1")
+	assert.Equal(t, cfg.LiveRooms[0].Schedule, room)
+	assert.Len(t, s.Windows, 1)
+	room, s = cfg.GetSchedule("https://live.bilibili.com/2")
+	assert.Nil(t, room)
+	assert.Nil(t, s)
+
+	assert.NoError(t, cfg.Verify())
+	cfg.LiveRooms[0].Schedule.OnWindowClose = "pause"
+	assert.Error(t, cfg.Verify())
+	cfg.LiveRooms[0].Schedule.OnWindowClose = WindowCloseStop
+	cfg.LiveRooms[0].Schedule.Windows = []string{"mon 20:00"}
+	assert.Error(t, cfg.Verify())
+}
+
+func TestConfig_GetRelay(t *testing.T) {
+	cfg := &Config{
+		RPC:        defaultRPC,
+		Interval:   30,
+		OutPutPath: os.TempDir(),
+		LiveRooms: []LiveRoom{
+			{Url: "https://live.bilibili.com/1", Relay: &Relay{Url: "rtmp://127.0.0.1/live/1"}},
+			{Url: "https://live.bilibili.com/2"},
+		},
+		liveRoomIndexCache: map[string]int{},
+	}
+	assert.Equal(t, cfg.LiveRooms[0].Relay, cfg.GetRelay("https://live.bilibili.com/1"))
+	assert.Equal(t, DefaultRelayMaxBackoff, cfg.GetRelay("https://live.bilibili.com/1").GetMaxBackoff())
+	assert.True(t, cfg.RestreamEnabled("https://live.bilibili.com/1"))
+	assert.Nil(t, cfg.GetRelay("https://live.bilibili.com/2"))
+	assert.False(t, cfg.RestreamEnabled("https://live.bilibili.com/2"))
+
+	assert.NoError(t, cfg.Verify())
+	cfg.LiveRooms[0].Relay.Url = "http://127.0.0.1/live/1"
+	assert.Error(t, cfg.Verify())
+}
+
+func TestConfig_Limits(t *testing.T) {
+	cfg := NewConfig()
+	cfg.OutPutPath = os.TempDir()
+	cfg.LiveRooms = []LiveRoom{{Url: "https://live.bilibili.com/1", Priority: 2}}
+	assert.Equal(t, 2, cfg.GetPriority("https://live.bilibili.com/1"))
+	assert.Equal(t, 0, cfg.GetPriority("https://live.bilibili.com/2"))
+
+	cfg.Limits.MaxBandwidth = 100
+	assert.Equal(t, int64(12500000), cfg.Limits.BandwidthLimit())
+	assert.NoError(t, cfg.Verify())
+	cfg.Limits.OverBudget = "drop"
+	assert.Error(t, cfg.Verify())
+	cfg.Limits.OverBudget = OverBudgetWait
+	cfg.Limits.MaxConcurrentRecordings = -1
+	assert.Error(t, cfg.Verify())
+}
+
+func TestConfig_GetRoomConfig(t *testing.T) {
+	hour, tmpl, size := time.Hour, "{{ .HostName }}.flv", 1024
+	disk, convert := "/mnt/disk2", true
+	cfg, err := NewConfigWithBytes([]byte(`
+out_put_path: /tmp
+out_put_tmpl: ""
+timeout_in_us: 60000000
+video_split_strategies:
+  max_duration: 2h
+  max_file_size: 0
+on_record_finished:
+  convert_to_mp4: false
+  pipeline:
+    - type: checksum
+platforms:
+  bilibili.com:
+    video_split_strategies:
+      max_file_size: 1024
+    out_put_tmpl: "{{ .HostName }}.flv"
+  live.bilibili.com:
+    video_split_strategies:
+      max_duration: 1h
+    on_record_finished:
+      convert_to_mp4: true
+live_rooms:
+  - url: https://live.bilibili.com/1
+    out_put_path: /mnt/disk2
+    video_split_strategies:
+      max_duration: 0s
+  - url: https://live.bilibili.com/2
+    pipeline:
+      - type: remux
+  - https://www.douyu.com/3
+`))
+	assert.NoError(t, err)
+
+	rc := cfg.GetRoomConfig("https://live.bilibili.com/1")
+	assert.Equal(t, []string{"global", "platform:bilibili.com", "platform:live.bilibili.com", "room"}, rc.Sources)
+	assert.Equal(t, disk, rc.OutPutPath)
+	assert.Equal(t, tmpl, rc.OutputTmpl)
+	assert.Equal(t, 60000000, rc.TimeoutInUs)
+	assert.Equal(t, VideoSplitStrategies{MaxDuration: 0, MaxFileSize: size}, rc.VideoSplitStrategies)
+	assert.Equal(t, convert, rc.OnRecordFinished.ConvertToMp4)
+	assert.Equal(t, StepChecksum, rc.OnRecordFinished.Pipeline[0].Type)
+
+	rc = cfg.GetRoomConfig("https://live.bilibili.com/2")
+	assert.Equal(t, hour, rc.VideoSplitStrategies.MaxDuration)
+	assert.Equal(t, StepRemux, cfg.GetPipeline("https://live.bilibili.com/2")[0].Type)
+
+	rc = cfg.GetRoomConfig("https://www.douyu.com/3")
+	assert.Equal(t, []string{"global", "room"}, rc.Sources)
+	assert.Equal(t, "/tmp", rc.OutPutPath)
+	assert.Equal(t, 2*hour, rc.VideoSplitStrategies.MaxDuration)
+
+	cfg.Platforms["douyu.com"] = Overrides{QualityPolicy: &QualityPolicy{Codec: "hevc", MaxResolution: 1080}}
+	assert.NoError(t, cfg.Verify())
+	assert.Equal(t, 1080, cfg.GetRoomConfig("https://www.douyu.com/3").QualityPolicy.MaxResolution)
+	cfg.Platforms["douyu.com"].QualityPolicy.Codec = "vp9"
+	assert.Error(t, cfg.Verify())
+
+	cfg.Platforms["douyu.com"] = Overrides{VideoSplitStrategies: &VideoSplitStrategiesOverride{MaxDuration: new(time.Duration)}}
+	*cfg.Platforms["douyu.com"].VideoSplitStrategies.MaxDuration = time.Second
+	assert.Error(t, cfg.Verify())
+}
+
+func TestRoomConfig_MarshalJSON(t *testing.T) {
+	rc := RoomConfig{
+		OutPutPath:           "/tmp",
+		VideoSplitStrategies: VideoSplitStrategies{MaxDuration: time.Hour},
+		OnRecordFinished: OnRecordFinished{Pipeline: []PostProcessStep{
+			{Type: StepThumbnail, Offset: 10 * time.Second, When: StepCondition{MinDuration: time.Minute}},
+			{Type: StepDanmakuASS, ASS: DanmakuASS{ScrollDuration: 12 * time.Second}},
+		}},
+		Sources: []string{"global"},
+	}
+	b, err := json.Marshal(rc)
+	assert.NoError(t, err)
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(b, &m))
+	// 与配置文件的字段名相同，时长为字符串
+	assert.Equal(t, "/tmp", m["out_put_path"])
+	split := m["video_split_strategies"].(map[string]any)
+	assert.Equal(t, "1h0m0s", split["max_duration"])
+	assert.Equal(t, false, split["handover"])
+	steps := m["on_record_finished"].(map[string]any)["pipeline"].([]any)
+	assert.Equal(t, "10s", steps[0].(map[string]any)["offset"])
+	assert.Equal(t, "1m0s", steps[0].(map[string]any)["when"].(map[string]any)["min_duration"])
+	ass := steps[1].(map[string]any)["ass"].(map[string]any)
+	assert.Equal(t, "12s", ass["scroll_duration"])
+	assert.NotContains(t, ass, "fixed_duration")
+	assert.NotContains(t, string(b), "OutPutPath")
+}
@@ -0,0 +1,48 @@
+package configs
+
+import "fmt"
+
+// 超出带宽上限时低优先级直播间的处理方式
+const (
+	OverBudgetDowngrade = "downgrade"
+	OverBudgetWait      = "wait"
+)
+
+// Limits 全部录制器共享的并发数与下载带宽上限，为 0 时不限制
+//
+// 直播间按 priority 排序：达到并发数上限时，优先级更高的直播间会停止优先级最低的录制，
+// 其余直播间等待空位；带宽不足时优先满足高优先级直播间的下载速度
+type Limits struct {
+	// MaxConcurrentRecordings 同时录制的直播间数量上限，手动开始的录制不受限制
+	MaxConcurrentRecordings int `yaml:"max_concurrent_recordings"`
+	// MaxBandwidth 全部录制器的总下载带宽上限（Mbps）
+	MaxBandwidth float64 `yaml:"max_bandwidth"`
+	// OverBudget 剩余带宽不足时，downgrade 降低新连接的清晰度，wait 等待带宽空闲后再开始录制
+	OverBudget string `yaml:"over_budget"`
+}
+
+// BandwidthLimit 返回总下载带宽上限（字节每秒），0 为不限制
+func (l *Limits) BandwidthLimit() int64 {
+	return int64(l.MaxBandwidth * 1000 * 1000 / 8)
+}
+
+func (l *Limits) verify() error {
+	if l.MaxConcurrentRecordings < 0 || l.MaxBandwidth < 0 {
+		return fmt.Errorf("the max_concurrent_recordings and max_bandwidth of limits can not be negative")
+	}
+	switch l.OverBudget {
+	case "", OverBudgetDowngrade, OverBudgetWait:
+	default:
+		return fmt.Errorf(`unknown over_budget "%s" of limits`, l.OverBudget)
+	}
+	return nil
+}
+
+// GetPriority 返回直播间的优先级，不在配置中的直播间为 0
+func (c *Config) GetPriority(url string) int {
+	room, err := c.GetLiveRoomByUrl(url)
+	if err != nil {
+		return 0
+	}
+	return room.Priority
+}
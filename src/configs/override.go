@@ -0,0 +1,193 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VideoSplitStrategiesOverride 覆盖 video_split_strategies 中设置了的字段
+type VideoSplitStrategiesOverride struct {
+	OnRoomNameChanged *bool          `yaml:"on_room_name_changed,omitempty"`
+	MaxDuration       *time.Duration `yaml:"max_duration,omitempty"`
+	MaxFileSize       *int           `yaml:"max_file_size,omitempty"`
+	Handover          *bool          `yaml:"handover,omitempty"`
+}
+
+// OnRecordFinishedOverride 覆盖 on_record_finished 中设置了的字段，pipeline 整体替换
+type OnRecordFinishedOverride struct {
+	ConvertToMp4           *bool             `yaml:"convert_to_mp4,omitempty"`
+	DeleteFlvAfterConvert  *bool             `yaml:"delete_flv_after_convert,omitempty"`
+	CustomCommandline      *string           `yaml:"custom_commandline,omitempty"`
+	CustomCommandlineScope *string           `yaml:"custom_commandline_scope,omitempty"`
+	FixFlvAtFirst          *bool             `yaml:"fix_flv_at_first,omitempty"`
+	Pipeline               []PostProcessStep `yaml:"pipeline,omitempty"`
+}
+
+// Overrides 可以按平台或直播间覆盖的全局设置，只覆盖设置了的字段
+type Overrides struct {
+	OutPutPath           *string                       `yaml:"out_put_path,omitempty"`
+	OutputTmpl           *string                       `yaml:"out_put_tmpl,omitempty"`
+	TimeoutInUs          *int                          `yaml:"timeout_in_us,omitempty"`
+	VideoSplitStrategies *VideoSplitStrategiesOverride `yaml:"video_split_strategies,omitempty"`
+	OnRecordFinished     *OnRecordFinishedOverride     `yaml:"on_record_finished,omitempty"`
+	// QualityPolicy 整体替换上一级的线路选择策略
+	QualityPolicy *QualityPolicy `yaml:"quality_policy,omitempty"`
+}
+
+// RoomConfig 直播间生效的设置，通过 /api/lives/{id} 返回时使用与配置文件相同的字段名
+type RoomConfig struct {
+	OutPutPath           string               `json:"out_put_path"`
+	OutputTmpl           string               `json:"out_put_tmpl"`
+	TimeoutInUs          int                  `json:"timeout_in_us"`
+	VideoSplitStrategies VideoSplitStrategies `json:"video_split_strategies"`
+	OnRecordFinished     OnRecordFinished     `json:"on_record_finished"`
+	QualityPolicy        QualityPolicy        `json:"quality_policy"`
+	// Sources 依次合并的设置来源，如 global、platform:live.bilibili.com、room
+	Sources []string `json:"sources"`
+}
+
+// 以下类型在 json 中与配置文件一样把时长输出为 1h0m0s 形式的字符串
+
+// durationString 为 0 时返回空字符串，配合 omitempty 省略未设置的时长
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func (v VideoSplitStrategies) MarshalJSON() ([]byte, error) {
+	type alias VideoSplitStrategies
+	return json.Marshal(struct {
+		alias
+		MaxDuration string `json:"max_duration"`
+	}{alias(v), v.MaxDuration.String()})
+}
+
+func (c StepCondition) MarshalJSON() ([]byte, error) {
+	type alias StepCondition
+	return json.Marshal(struct {
+		alias
+		MinDuration string `json:"min_duration,omitempty"`
+	}{alias(c), durationString(c.MinDuration)})
+}
+
+func (a DanmakuASS) MarshalJSON() ([]byte, error) {
+	type alias DanmakuASS
+	return json.Marshal(struct {
+		alias
+		ScrollDuration string `json:"scroll_duration,omitempty"`
+		FixedDuration  string `json:"fixed_duration,omitempty"`
+	}{alias(a), durationString(a.ScrollDuration), durationString(a.FixedDuration)})
+}
+
+func (s PostProcessStep) MarshalJSON() ([]byte, error) {
+	type alias PostProcessStep
+	return json.Marshal(struct {
+		alias
+		Offset string `json:"offset,omitempty"`
+	}{alias(s), durationString(s.Offset)})
+}
+
+func set[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func (o *Overrides) apply(rc *RoomConfig) {
+	set(&rc.OutPutPath, o.OutPutPath)
+	set(&rc.OutputTmpl, o.OutputTmpl)
+	set(&rc.TimeoutInUs, o.TimeoutInUs)
+	if v := o.VideoSplitStrategies; v != nil {
+		set(&rc.VideoSplitStrategies.OnRoomNameChanged, v.OnRoomNameChanged)
+		set(&rc.VideoSplitStrategies.MaxDuration, v.MaxDuration)
+		set(&rc.VideoSplitStrategies.MaxFileSize, v.MaxFileSize)
+		set(&rc.VideoSplitStrategies.Handover, v.Handover)
+	}
+	if v := o.OnRecordFinished; v != nil {
+		set(&rc.OnRecordFinished.ConvertToMp4, v.ConvertToMp4)
+		set(&rc.OnRecordFinished.DeleteFlvAfterConvert, v.DeleteFlvAfterConvert)
+		set(&rc.OnRecordFinished.CustomCommandline, v.CustomCommandline)
+		set(&rc.OnRecordFinished.CustomCommandlineScope, v.CustomCommandlineScope)
+		set(&rc.OnRecordFinished.FixFlvAtFirst, v.FixFlvAtFirst)
+		if len(v.Pipeline) > 0 {
+			rc.OnRecordFinished.Pipeline = v.Pipeline
+		}
+	}
+	set(&rc.QualityPolicy, o.QualityPolicy)
+}
+
+func (o *Overrides) verify(remotes map[string]RemoteStorage) error {
+	if o.OutPutPath != nil && *o.OutPutPath == "" {
+		return fmt.Errorf("the out_put_path can not be empty")
+	}
+	if v := o.VideoSplitStrategies; v != nil && v.MaxDuration != nil && *v.MaxDuration > 0 && *v.MaxDuration < time.Minute {
+		return fmt.Errorf("the minimum value of max_duration is one minute")
+	}
+	if v := o.OnRecordFinished; v != nil {
+		if s := v.CustomCommandlineScope; s != nil && *s != "" && *s != CommandlineScopeFile && *s != CommandlineScopeSession {
+			return fmt.Errorf(`unknown custom_commandline_scope "%s"`, *s)
+		}
+		if err := verifyPipeline(v.Pipeline, remotes); err != nil {
+			return err
+		}
+	}
+	if o.QualityPolicy != nil {
+		return o.QualityPolicy.verify()
+	}
+	return nil
+}
+
+// matchPlatform 返回直播间地址的 host 是否为 platform 或其子域名
+func matchPlatform(host, platform string) bool {
+	platform = strings.ToLower(platform)
+	return host == platform || strings.HasSuffix(host, "."+platform)
+}
+
+// GetRoomConfig 返回直播间生效的设置，按 全局设置、platforms 中匹配直播间 host 的设置、直播间的设置 的顺序合并，
+// 后者覆盖前者中设置了的字段，直播间的 pipeline 最后覆盖
+func (c *Config) GetRoomConfig(liveUrl string) *RoomConfig {
+	rc := &RoomConfig{
+		OutPutPath:           c.OutPutPath,
+		OutputTmpl:           c.OutputTmpl,
+		TimeoutInUs:          c.TimeoutInUs,
+		VideoSplitStrategies: c.VideoSplitStrategies,
+		OnRecordFinished:     c.OnRecordFinished,
+		QualityPolicy:        c.QualityPolicy,
+		Sources:              []string{"global"},
+	}
+	if u, err := url.Parse(liveUrl); err == nil && u.Host != "" {
+		host := strings.ToLower(u.Hostname())
+		var matched []string
+		for platform := range c.Platforms {
+			if matchPlatform(host, platform) {
+				matched = append(matched, platform)
+			}
+		}
+		// 较短（更宽泛）的先合并，长度相同时按字典序，保证合并顺序稳定
+		sort.Slice(matched, func(i, j int) bool {
+			if len(matched[i]) != len(matched[j]) {
+				return len(matched[i]) < len(matched[j])
+			}
+			return matched[i] < matched[j]
+		})
+		for _, platform := range matched {
+			o := c.Platforms[platform]
+			o.apply(rc)
+			rc.Sources = append(rc.Sources, "platform:"+platform)
+		}
+	}
+	if room, err := c.GetLiveRoomByUrl(liveUrl); err == nil {
+		room.Overrides.apply(rc)
+		if len(room.Pipeline) > 0 {
+			rc.OnRecordFinished.Pipeline = room.Pipeline
+		}
+		rc.Sources = append(rc.Sources, "room")
+	}
+	return rc
+}
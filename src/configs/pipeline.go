@@ -0,0 +1,164 @@
+package configs
+
+import (
+	"fmt"
+	"time"
+)
+
+// 后处理流水线的步骤类型
+const (
+	// StepFix 使用 bililive-recorder 修复 flv 文件
+	StepFix = "fix"
+	// StepRemux 使用 ffmpeg 转封装为 mp4、mkv 或 fmp4
+	StepRemux = "remux"
+	// StepExtractAudio 提取音轨
+	StepExtractAudio = "extract_audio"
+	// StepThumbnail 截取一帧作为封面
+	StepThumbnail = "thumbnail"
+	// StepChecksum 计算校验和并写入同名文件
+	StepChecksum = "checksum"
+	// StepMove 移动到其他目录
+	StepMove = "move"
+	// StepUpload 通过 HTTP PUT 上传
+	StepUpload = "upload"
+	// StepCommand 执行自定义命令
+	StepCommand = "command"
+	// StepRemoteUpload 上传到 remote_storages 中配置的远程存储
+	StepRemoteUpload = "remote_upload"
+	// StepDanmakuASS 将弹幕文件转换为 ASS 字幕
+	StepDanmakuASS = "danmaku_ass"
+)
+
+// 步骤失败后的处理方式
+const (
+	// OnFailureAbort 停止流水线，任务失败并按任务队列的设置重试
+	OnFailureAbort = "abort"
+	// OnFailureContinue 继续执行后续步骤，任务最终仍标记为失败
+	OnFailureContinue = "continue"
+	// OnFailureIgnore 只记录日志，不影响任务结果
+	OnFailureIgnore = "ignore"
+)
+
+// StepCondition 步骤的执行条件，不满足条件的文件跳过该步骤
+type StepCondition struct {
+	MinDuration time.Duration `yaml:"min_duration,omitempty" json:"min_duration,omitempty"`
+	// 单位为字节
+	MinSize int64 `yaml:"min_size,omitempty" json:"min_size,omitempty"`
+	// 如 [".flv", ".ts"]，为空时不限制
+	Extensions []string `yaml:"extensions,omitempty" json:"extensions,omitempty"`
+}
+
+// DanmakuASS 弹幕转换为 ASS 字幕的选项，为零值的字段使用默认值，分辨率从视频文件读取
+type DanmakuASS struct {
+	FontName string `yaml:"font_name,omitempty" json:"font_name,omitempty"`
+	// 标准字号弹幕的像素大小，默认为视频高度的 1/28
+	FontSize int `yaml:"font_size,omitempty" json:"font_size,omitempty"`
+	// 不透明度，0 ~ 1，默认为 0.8
+	Opacity float64 `yaml:"opacity,omitempty" json:"opacity,omitempty"`
+	// 默认分别为 12s、5s
+	ScrollDuration time.Duration `yaml:"scroll_duration,omitempty" json:"scroll_duration,omitempty"`
+	FixedDuration  time.Duration `yaml:"fixed_duration,omitempty" json:"fixed_duration,omitempty"`
+	// 滚动弹幕占屏幕高度的比例，0 ~ 1，默认为 1
+	ScrollArea float64 `yaml:"scroll_area,omitempty" json:"scroll_area,omitempty"`
+	// 同屏最多显示的弹幕数量，0 为不限制
+	Density   int      `yaml:"density,omitempty" json:"density,omitempty"`
+	Blocklist []string `yaml:"blocklist,omitempty" json:"blocklist,omitempty"`
+}
+
+// PostProcessStep 后处理流水线中的一个步骤，不同类型的步骤使用不同的字段
+type PostProcessStep struct {
+	Type string        `yaml:"type" json:"type"`
+	When StepCondition `yaml:"when,omitempty" json:"when,omitempty"`
+	// 为空时为 abort
+	OnFailure string `yaml:"on_failure,omitempty" json:"on_failure,omitempty"`
+
+	// remux: mp4、mkv、fmp4；extract_audio: m4a、mp3；thumbnail: jpg、png
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+	// remux 为 mp4 时把 moov 移到文件开头
+	Faststart bool `yaml:"faststart,omitempty" json:"faststart,omitempty"`
+	// remux、extract_audio 成功后删除原文件
+	DeleteSource bool `yaml:"delete_source,omitempty" json:"delete_source,omitempty"`
+	// thumbnail 截图的时间点
+	Offset time.Duration `yaml:"offset,omitempty" json:"offset,omitempty"`
+	// checksum: sha256、sha1、md5
+	Algorithm string `yaml:"algorithm,omitempty" json:"algorithm,omitempty"`
+	// move 的目标目录，upload 的地址，command 的命令，均为模板
+	Dir     string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	Url     string `yaml:"url,omitempty" json:"url,omitempty"`
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+	// remote_upload 的目标名称与远程路径模板，路径为空时使用文件相对 out_put_path 的路径；
+	// 设置 delete_source 时上传成功后删除本地文件及附属文件
+	Target string `yaml:"target,omitempty" json:"target,omitempty"`
+	Key    string `yaml:"key,omitempty" json:"key,omitempty"`
+	// danmaku_ass 的选项
+	ASS DanmakuASS `yaml:"ass,omitempty" json:"ass,omitempty"`
+}
+
+func (s *PostProcessStep) verify(storages map[string]RemoteStorage) error {
+	switch s.OnFailure {
+	case "", OnFailureAbort, OnFailureContinue, OnFailureIgnore:
+	default:
+		return fmt.Errorf("unknown on_failure %q of %s step", s.OnFailure, s.Type)
+	}
+	switch s.Type {
+	case StepFix, StepChecksum:
+	case StepRemux:
+		switch s.Format {
+		case "", "mp4", "mkv", "fmp4":
+		default:
+			return fmt.Errorf("unsupported remux format %q", s.Format)
+		}
+	case StepExtractAudio:
+		switch s.Format {
+		case "", "m4a", "mp3":
+		default:
+			return fmt.Errorf("unsupported audio format %q", s.Format)
+		}
+	case StepThumbnail:
+		switch s.Format {
+		case "", "jpg", "png":
+		default:
+			return fmt.Errorf("unsupported thumbnail format %q", s.Format)
+		}
+	case StepMove:
+		if s.Dir == "" {
+			return fmt.Errorf("the dir of move step can not be empty")
+		}
+	case StepUpload:
+		if s.Url == "" {
+			return fmt.Errorf("the url of upload step can not be empty")
+		}
+	case StepCommand:
+		if s.Command == "" {
+			return fmt.Errorf("the command of command step can not be empty")
+		}
+	case StepRemoteUpload:
+		if _, ok := storages[s.Target]; !ok {
+			return fmt.Errorf("remote storage %q of remote_upload step is not exist", s.Target)
+		}
+	case StepDanmakuASS:
+		if s.ASS.Opacity < 0 || s.ASS.Opacity > 1 {
+			return fmt.Errorf("the opacity of danmaku_ass step must be between 0 and 1")
+		}
+		if s.ASS.ScrollArea < 0 || s.ASS.ScrollArea > 1 {
+			return fmt.Errorf("the scroll_area of danmaku_ass step must be between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("unknown post process step %q", s.Type)
+	}
+	return nil
+}
+
+func verifyPipeline(steps []PostProcessStep, storages map[string]RemoteStorage) error {
+	for i := range steps {
+		if err := steps[i].verify(storages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPipeline 返回直播间的后处理流水线，按 GetRoomConfig 的顺序合并，都为空时使用 on_record_finished 中的旧选项
+func (c *Config) GetPipeline(url string) []PostProcessStep {
+	return c.GetRoomConfig(url).OnRecordFinished.Pipeline
+}
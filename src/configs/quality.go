@@ -0,0 +1,34 @@
+package configs
+
+import "fmt"
+
+// QualityPolicy 与平台无关的线路选择策略，为零值的字段不限制，没有满足条件的线路时仍然使用最接近的线路
+type QualityPolicy struct {
+	// Codec 优先的视频编码：avc、hevc 或 av1
+	Codec string `yaml:"codec,omitempty" json:"codec,omitempty"`
+	// MaxResolution 最大的视频高度，如 1080
+	MaxResolution int `yaml:"max_resolution,omitempty" json:"max_resolution,omitempty"`
+	// MinBitrate 最低的视频码率（kbps）
+	MinBitrate int `yaml:"min_bitrate,omitempty" json:"min_bitrate,omitempty"`
+	// Container 优先的封装格式：flv 或 hls
+	Container string `yaml:"container,omitempty" json:"container,omitempty"`
+	// AudioOnly 只录制音频，与直播间的 audio_only 相同，需要平台支持
+	AudioOnly bool `yaml:"audio_only,omitempty" json:"audio_only,omitempty"`
+}
+
+func (q *QualityPolicy) verify() error {
+	switch q.Codec {
+	case "", "avc", "hevc", "av1":
+	default:
+		return fmt.Errorf(`unknown codec "%s" of quality_policy`, q.Codec)
+	}
+	switch q.Container {
+	case "", "flv", "hls":
+	default:
+		return fmt.Errorf(`unknown container "%s" of quality_policy`, q.Container)
+	}
+	if q.MaxResolution < 0 || q.MinBitrate < 0 {
+		return fmt.Errorf("the max_resolution and min_bitrate of quality_policy can not be negative")
+	}
+	return nil
+}
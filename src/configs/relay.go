@@ -0,0 +1,54 @@
+package configs
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DefaultRelayMaxBackoff 推流失败后重试的默认最长间隔
+const DefaultRelayMaxBackoff = time.Minute
+
+// Relay 录制时把直播流推送到 RTMP 服务器，需要使用原生 flv 解析器
+type Relay struct {
+	// Url 推流地址，如 rtmp://127.0.0.1/live/room1
+	Url string `yaml:"url"`
+	// MaxBackoff 推流失败后重试的最长间隔，默认为 1m
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
+}
+
+// GetMaxBackoff 返回推流失败后重试的最长间隔
+func (r *Relay) GetMaxBackoff() time.Duration {
+	if r.MaxBackoff <= 0 {
+		return DefaultRelayMaxBackoff
+	}
+	return r.MaxBackoff
+}
+
+func (r *Relay) verify() error {
+	u, err := url.Parse(r.Url)
+	if err != nil {
+		return fmt.Errorf("invalid relay url: %w", err)
+	}
+	if u.Scheme != "rtmp" && u.Scheme != "rtmps" || u.Host == "" {
+		return fmt.Errorf(`the relay url "%s" must be a rtmp or rtmps url`, r.Url)
+	}
+	if r.MaxBackoff < 0 {
+		return fmt.Errorf("the max_backoff of relay can not be negative")
+	}
+	return nil
+}
+
+// GetRelay 返回直播间的推流设置，未设置时返回 nil
+func (c *Config) GetRelay(url string) *Relay {
+	room, err := c.GetLiveRoomByUrl(url)
+	if err != nil {
+		return nil
+	}
+	return room.Relay
+}
+
+// RestreamEnabled 返回录制直播间时是否需要转播直播流，开启了本地转播或设置了推流时为 true
+func (c *Config) RestreamEnabled(url string) bool {
+	return c.Restream.Enable || c.GetRelay(url) != nil
+}
@@ -0,0 +1,95 @@
+package configs
+
+import (
+	"fmt"
+)
+
+// 远程存储的类型
+const (
+	// RemoteStorageS3 兼容 S3 协议的对象存储，如 MinIO
+	RemoteStorageS3 = "s3"
+	// RemoteStorageWebDAV WebDAV 共享，如 Nextcloud
+	RemoteStorageWebDAV = "webdav"
+	// RemoteStorageSFTP 通过 SSH 连接的 SFTP 服务器
+	RemoteStorageSFTP = "sftp"
+)
+
+// RemoteStorage 后处理上传的目标，在 remote_storages 中按名称配置，不同类型使用不同的字段
+type RemoteStorage struct {
+	Type string `yaml:"type"`
+
+	// s3: 如 http://127.0.0.1:9000
+	Endpoint  string `yaml:"endpoint,omitempty"`
+	Region    string `yaml:"region,omitempty"`
+	Bucket    string `yaml:"bucket,omitempty"`
+	AccessKey string `yaml:"access_key,omitempty"`
+	SecretKey string `yaml:"secret_key,omitempty"`
+	// PathStyle 使用 endpoint/bucket/key 形式的地址，MinIO 需要开启
+	PathStyle bool `yaml:"path_style,omitempty"`
+
+	// webdav: 如 https://cloud.example.com/remote.php/dav/files/user/recordings
+	Url string `yaml:"url,omitempty"`
+	// sftp: 如 192.168.1.2:22
+	Host string `yaml:"host,omitempty"`
+	// sftp: 远程路径的根目录
+	Dir string `yaml:"dir,omitempty"`
+	// webdav、sftp 的认证信息，sftp 可以使用私钥文件
+	Username   string `yaml:"username,omitempty"`
+	Password   string `yaml:"password,omitempty"`
+	PrivateKey string `yaml:"private_key,omitempty"`
+	// sftp: 服务器公钥，authorized_keys 格式，如 ssh-keyscan 输出中主机名之后的部分
+	HostKey string `yaml:"host_key,omitempty"`
+
+	// MaxUploads 同时上传到该目标的文件数，超出的上传排队等待，默认 1
+	MaxUploads int `yaml:"max_uploads,omitempty"`
+	// Retries 上传失败后立即重试的次数，未设置时为 3，为 0 时不重试
+	Retries *int `yaml:"retries,omitempty"`
+	// PartSize 分片上传的分片大小（字节），大于该值的文件使用分片上传，默认 16MiB
+	PartSize int64 `yaml:"part_size,omitempty"`
+	// Concurrency 每个文件同时上传的分片数，默认 4
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// BandwidthLimit 该目标所有上传共享的带宽限制（字节/秒），为 0 时不限制
+	BandwidthLimit int64 `yaml:"bandwidth_limit,omitempty"`
+}
+
+// s3 要求除最后一个分片外每个分片不小于 5MiB
+const minPartSize = 5 << 20
+
+func (r *RemoteStorage) verify() error {
+	switch r.Type {
+	case RemoteStorageS3:
+		if r.Endpoint == "" || r.Bucket == "" {
+			return fmt.Errorf("the endpoint and bucket of s3 storage can not be empty")
+		}
+		if r.PartSize != 0 && r.PartSize < minPartSize {
+			return fmt.Errorf("the part_size of s3 storage can not be less than %d", minPartSize)
+		}
+	case RemoteStorageWebDAV:
+		if r.Url == "" {
+			return fmt.Errorf("the url of webdav storage can not be empty")
+		}
+	case RemoteStorageSFTP:
+		if r.Host == "" || r.Username == "" {
+			return fmt.Errorf("the host and username of sftp storage can not be empty")
+		}
+		// 不校验服务器公钥时中间人可以获取登录凭据与上传的录像
+		if r.HostKey == "" {
+			return fmt.Errorf("the host_key of sftp storage can not be empty")
+		}
+	default:
+		return fmt.Errorf("unknown remote storage type %q", r.Type)
+	}
+	if r.Concurrency < 0 || r.BandwidthLimit < 0 || r.MaxUploads < 0 || (r.Retries != nil && *r.Retries < 0) {
+		return fmt.Errorf("the concurrency, bandwidth_limit, max_uploads and retries can not be negative")
+	}
+	return nil
+}
+
+func verifyRemoteStorages(storages map[string]RemoteStorage) error {
+	for name, storage := range storages {
+		if err := storage.verify(); err != nil {
+			return fmt.Errorf("remote storage %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package configs
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetentionRule 录制文件的保留规则，值为 0 时不限制
+type RetentionRule struct {
+	// MaxAge 删除结束时间早于该时长的场次
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+	// MaxRoomSize 每个直播间保留的文件总大小（字节），超出时从最早的场次开始删除
+	MaxRoomSize int64 `yaml:"max_room_size,omitempty"`
+	// KeepSessions 每个直播间保留最近的场次数
+	KeepSessions int `yaml:"keep_sessions,omitempty"`
+	// MinAge 修改时间晚于该时长的文件不会被删除
+	MinAge time.Duration `yaml:"min_age,omitempty"`
+}
+
+func (r *RetentionRule) verify() error {
+	if r.MaxAge < 0 || r.MaxRoomSize < 0 || r.KeepSessions < 0 || r.MinAge < 0 {
+		return fmt.Errorf("retention rule can not be negative")
+	}
+	return nil
+}
+
+// Retention 按规则定期清理录制文件
+type Retention struct {
+	Enable        bool          `yaml:"enable"`
+	CheckInterval time.Duration `yaml:"check_interval"`
+	RetentionRule `yaml:",inline"`
+	// MaxPlatformSize 每个平台保留的文件总大小（字节），只能全局设置
+	MaxPlatformSize int64 `yaml:"max_platform_size,omitempty"`
+}
+
+func (r *Retention) verify() error {
+	if r.MaxPlatformSize < 0 {
+		return fmt.Errorf("retention rule can not be negative")
+	}
+	return r.RetentionRule.verify()
+}
+
+// GetRetentionRule 返回直播间的保留规则，直播间设置的规则整体替换全局规则
+func (c *Config) GetRetentionRule(url string) RetentionRule {
+	if room, err := c.GetLiveRoomByUrl(url); err == nil && room.Retention != nil {
+		return *room.Retention
+	}
+	return c.Retention.RetentionRule
+}
@@ -0,0 +1,70 @@
+package configs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/pkg/schedule"
+)
+
+// 时间段结束时对进行中的录制的处理
+const (
+	// WindowCloseFinish 继续录制到直播结束
+	WindowCloseFinish = "finish"
+	// WindowCloseStop 立即停止录制
+	WindowCloseStop = "stop"
+)
+
+// Schedule 直播间的录制时间表，不在时间段内时不开始录制
+type Schedule struct {
+	// Timezone 如 Asia/Shanghai，为空时使用本地时区
+	Timezone string `yaml:"timezone,omitempty"`
+	// Windows 允许录制的时间段，如 "mon-fri 20:00-02:00"，为空时全天允许
+	Windows []string `yaml:"windows,omitempty"`
+	// Exclude 不允许录制的时间段，优先于 Windows，如 "sun"
+	Exclude []string `yaml:"exclude,omitempty"`
+	// MaxDailyDuration 每天最多录制的时长，达到后停止录制，为 0 时不限制
+	MaxDailyDuration time.Duration `yaml:"max_daily_duration,omitempty"`
+	// OnWindowClose 时间段结束时的处理，finish 或 stop，默认为 finish
+	OnWindowClose string `yaml:"on_window_close,omitempty"`
+	// NotifyOutside 不在时间段内时仍然发送开播与下播通知
+	NotifyOutside bool `yaml:"notify_outside,omitempty"`
+}
+
+// Compile 解析时区与时间段
+func (s *Schedule) Compile() (*schedule.Schedule, error) {
+	return schedule.New(s.Timezone, s.Windows, s.Exclude)
+}
+
+// StopOnWindowClose 返回时间段结束时是否立即停止录制
+func (s *Schedule) StopOnWindowClose() bool {
+	return s.OnWindowClose == WindowCloseStop
+}
+
+func (s *Schedule) verify() error {
+	if _, err := s.Compile(); err != nil {
+		return err
+	}
+	if s.MaxDailyDuration < 0 {
+		return fmt.Errorf("the max_daily_duration of schedule can not be negative")
+	}
+	switch s.OnWindowClose {
+	case "", WindowCloseFinish, WindowCloseStop:
+	default:
+		return fmt.Errorf(`unknown on_window_close "%s"`, s.OnWindowClose)
+	}
+	return nil
+}
+
+// GetSchedule 返回直播间的录制时间表，未设置或无法解析时返回 nil
+func (c *Config) GetSchedule(url string) (*Schedule, *schedule.Schedule) {
+	room, err := c.GetLiveRoomByUrl(url)
+	if err != nil || room.Schedule == nil {
+		return nil, nil
+	}
+	s, err := room.Schedule.Compile()
+	if err != nil {
+		return nil, nil
+	}
+	return room.Schedule, s
+}
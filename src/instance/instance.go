@@ -21,4 +21,16 @@ type Instance struct {
 	EventDispatcher interfaces.Module
 	ListenerManager interfaces.Module
 	RecorderManager interfaces.Module
+	JobManager      interfaces.Module
+	StorageMonitor  interfaces.Module
+	// RetentionSweeper 按保留规则清理录制文件
+	RetentionSweeper interfaces.Module
+	// Scheduler 按直播间的录制时间表开始与停止录制
+	Scheduler interfaces.Module
+	// Restream 在本地转播正在录制的直播流
+	Restream interfaces.Module
+	// Relay 录制时把直播流推送到 RTMP 服务器
+	Relay interfaces.Module
+	// Bandwidth 限制全部录制器的总下载带宽
+	Bandwidth interfaces.Module
 }
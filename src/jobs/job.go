@@ -0,0 +1,117 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+)
+
+// Job 是一个持久化的后台任务，Payload 由对应类型的 Handler 解析
+type Job struct {
+	Id          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	State       State           `json:"state"`
+	Progress    float64         `json:"progress"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  time.Time       `json:"finished_at"`
+	// 失败重试前需要等待到该时间
+	NotBefore time.Time `json:"not_before"`
+	// DependsOn 中的任务全部结束后才开始执行，不要求执行成功
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+func (j *Job) finished() bool {
+	return j.State == StateSucceeded || j.State == StateFailed || j.State == StateCanceled
+}
+
+// Handler 执行一个任务，ctx 在任务被取消或程序退出时结束
+type Handler func(ctx context.Context, task *Task) error
+
+// Task 是 Handler 访问任务数据、写入日志与更新进度的入口
+type Task struct {
+	job *Job
+	m   *manager
+
+	logLock sync.Mutex
+	log     *os.File
+}
+
+func (t *Task) Id() string {
+	return t.job.Id
+}
+
+func (t *Task) Attempt() int {
+	return t.job.Attempts
+}
+
+// Payload 将任务的 Payload 解析到 v
+func (t *Task) Payload(v any) error {
+	return json.Unmarshal(t.job.Payload, v)
+}
+
+// SetPayload 替换并保存任务的 Payload，用于记录处理进度，重试时 Handler 读取到新的 Payload
+func (t *Task) SetPayload(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.job.Payload = b
+	t.m.update(t.job.Id, func(j *Job) { j.Payload = b })
+	return nil
+}
+
+// Logf 写入一行任务日志
+func (t *Task) Logf(format string, args ...any) {
+	t.logLock.Lock()
+	defer t.logLock.Unlock()
+	if t.log != nil {
+		fmt.Fprintf(t.log, "%s %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+	}
+}
+
+// LogWriter 返回写入任务日志的 io.Writer，用于收集外部命令的输出
+func (t *Task) LogWriter() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		t.logLock.Lock()
+		defer t.logLock.Unlock()
+		if t.log == nil {
+			return len(p), nil
+		}
+		return t.log.Write(p)
+	})
+}
+
+// SetProgress 更新任务进度，取值范围为 0 到 1
+func (t *Task) SetProgress(progress float64) {
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+	t.m.update(t.job.Id, func(j *Job) { j.Progress = progress })
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,403 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+)
+
+var (
+	ErrJobNotExist     = errors.New("job is not exist")
+	ErrInvalidJobState = errors.New("invalid job state for this operation")
+)
+
+// for test
+var pollInterval = time.Second
+
+func NewManager(ctx context.Context) Manager {
+	inst := instance.GetInstance(ctx)
+	m := &manager{
+		handlers: make(map[string]Handler),
+		jobs:     make(map[string]*Job),
+		running:  make(map[string]context.CancelFunc),
+		notify:   make(chan struct{}, 1),
+		store:    &store{dir: filepath.Join(inst.Config.AppDataPath, "jobs")},
+	}
+	inst.JobManager = m
+	return m
+}
+
+type Manager interface {
+	interfaces.Module
+	// Register 注册任务类型的处理函数，需要在 Start 之前调用
+	Register(jobType string, handler Handler)
+	Submit(ctx context.Context, jobType string, payload any) (*Job, error)
+	// SubmitAfter 提交在 after 中的任务全部结束后才开始执行的任务
+	SubmitAfter(ctx context.Context, jobType string, payload any, after []string) (*Job, error)
+	// GetJobs 返回全部任务，按创建时间倒序排列
+	GetJobs(ctx context.Context) []*Job
+	GetJob(ctx context.Context, id string) (*Job, error)
+	GetLog(ctx context.Context, id string) ([]byte, error)
+	Cancel(ctx context.Context, id string) error
+	Retry(ctx context.Context, id string) error
+}
+
+type manager struct {
+	lock     sync.Mutex
+	handlers map[string]Handler
+	jobs     map[string]*Job
+	running  map[string]context.CancelFunc
+	// 被用户取消、正在等待 Handler 返回的任务
+	canceling map[string]bool
+	store     *store
+	notify    chan struct{}
+	// 已结束任务的保留数量与时间
+	maxFinished int
+	retention   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (m *manager) Register(jobType string, handler Handler) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.handlers[jobType] = handler
+}
+
+func (m *manager) Start(ctx context.Context) error {
+	inst := instance.GetInstance(ctx)
+	jobs, err := m.store.loadAll()
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	m.canceling = make(map[string]bool)
+	for _, j := range jobs {
+		if _, ok := m.jobs[j.Id]; ok {
+			continue
+		}
+		if j.State == StateRunning {
+			// 上次退出时未完成的任务重新执行
+			j.State = StatePending
+			m.store.save(j)
+		}
+		m.jobs[j.Id] = j
+	}
+	m.maxFinished, m.retention = inst.Config.Jobs.MaxFinished, inst.Config.Jobs.Retention
+	m.prune()
+	m.lock.Unlock()
+
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	workers := inst.Config.Jobs.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	inst.WaitGroup.Add(1)
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return nil
+}
+
+func (m *manager) Close(ctx context.Context) {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.wg.Wait()
+	instance.GetInstance(ctx).WaitGroup.Done()
+}
+
+func (m *manager) Submit(ctx context.Context, jobType string, payload any) (*Job, error) {
+	return m.SubmitAfter(ctx, jobType, payload, nil)
+}
+
+func (m *manager) SubmitAfter(ctx context.Context, jobType string, payload any, after []string) (*Job, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	maxAttempts := 1
+	if inst := instance.GetInstance(ctx); inst != nil && inst.Config.Jobs.MaxAttempts > 0 {
+		maxAttempts = inst.Config.Jobs.MaxAttempts
+	}
+	j := &Job{
+		Id:          uuid.Must(uuid.NewV4()).String(),
+		Type:        jobType,
+		Payload:     b,
+		State:       StatePending,
+		MaxAttempts: maxAttempts,
+		CreatedAt:   time.Now(),
+		DependsOn:   after,
+	}
+	m.lock.Lock()
+	m.jobs[j.Id] = j
+	err = m.store.save(j)
+	c := *j
+	m.lock.Unlock()
+	m.wakeUp()
+	return &c, err
+}
+
+func (m *manager) GetJobs(ctx context.Context) []*Job {
+	m.lock.Lock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		c := *j
+		jobs = append(jobs, &c)
+	}
+	m.lock.Unlock()
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].CreatedAt.After(jobs[k].CreatedAt)
+	})
+	return jobs
+}
+
+func (m *manager) GetJob(ctx context.Context, id string) (*Job, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotExist
+	}
+	c := *j
+	return &c, nil
+}
+
+func (m *manager) GetLog(ctx context.Context, id string) ([]byte, error) {
+	if _, err := m.GetJob(ctx, id); err != nil {
+		return nil, err
+	}
+	return m.store.readLog(id)
+}
+
+func (m *manager) Cancel(ctx context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return ErrJobNotExist
+	}
+	switch j.State {
+	case StatePending:
+		j.State = StateCanceled
+		j.FinishedAt = time.Now()
+		err := m.store.save(j)
+		m.prune()
+		return err
+	case StateRunning:
+		m.canceling[id] = true
+		m.running[id]()
+		return nil
+	default:
+		return ErrInvalidJobState
+	}
+}
+
+func (m *manager) Retry(ctx context.Context, id string) error {
+	m.lock.Lock()
+	j, ok := m.jobs[id]
+	if !ok {
+		m.lock.Unlock()
+		return ErrJobNotExist
+	}
+	if j.State != StateFailed && j.State != StateCanceled {
+		m.lock.Unlock()
+		return ErrInvalidJobState
+	}
+	j.State = StatePending
+	j.Attempts = 0
+	j.Progress = 0
+	j.Error = ""
+	j.NotBefore = time.Time{}
+	j.FinishedAt = time.Time{}
+	err := m.store.save(j)
+	m.lock.Unlock()
+	m.wakeUp()
+	return err
+}
+
+func (m *manager) wakeUp() {
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (m *manager) update(id string, fn func(j *Job)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if j, ok := m.jobs[id]; ok {
+		fn(j)
+		m.store.save(j)
+	}
+}
+
+func (m *manager) work() {
+	defer m.wg.Done()
+	for {
+		if m.ctx.Err() != nil {
+			return
+		}
+		if task, jobCtx, handler := m.next(); task != nil {
+			m.run(jobCtx, task, handler)
+			continue
+		}
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.notify:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// next 取出最早创建的可执行任务并标记为运行中
+func (m *manager) next() (*Task, context.Context, Handler) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	var next *Job
+	for _, j := range m.jobs {
+		if j.State != StatePending || j.NotBefore.After(now) || m.waiting(j) {
+			continue
+		}
+		if next == nil || j.CreatedAt.Before(next.CreatedAt) {
+			next = j
+		}
+	}
+	if next == nil {
+		return nil, nil, nil
+	}
+	handler, ok := m.handlers[next.Type]
+	if !ok {
+		next.State = StateFailed
+		next.Error = fmt.Sprintf("no handler for job type %s", next.Type)
+		next.FinishedAt = now
+		m.store.save(next)
+		m.prune()
+		return nil, nil, nil
+	}
+	next.State = StateRunning
+	next.Attempts++
+	next.StartedAt = now
+	next.Error = ""
+	m.store.save(next)
+
+	jobCtx, cancel := context.WithCancel(m.ctx)
+	m.running[next.Id] = cancel
+	c := *next
+	return &Task{job: &c, m: m}, jobCtx, handler
+}
+
+// waiting 需要在持有锁的情况下调用，返回 j 依赖的任务是否还没有结束，已经被清理的任务视为已结束
+func (m *manager) waiting(j *Job) bool {
+	for _, id := range j.DependsOn {
+		if dep, ok := m.jobs[id]; ok && !dep.finished() {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *manager) run(ctx context.Context, task *Task, handler Handler) {
+	if f, err := m.store.openLog(task.Id()); err == nil {
+		task.log = f
+	}
+	task.Logf("start %s job, attempt %d/%d", task.job.Type, task.job.Attempts, task.job.MaxAttempts)
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return handler(ctx, task)
+	}()
+	if err != nil {
+		task.Logf("job failed: %v", err)
+	} else {
+		task.Logf("job succeeded")
+	}
+
+	m.lock.Lock()
+	m.running[task.Id()]()
+	delete(m.running, task.Id())
+	canceled := m.canceling[task.Id()]
+	delete(m.canceling, task.Id())
+	j := m.jobs[task.Id()]
+	now := time.Now()
+	switch {
+	case canceled:
+		j.State = StateCanceled
+		j.FinishedAt = now
+	case err == nil:
+		j.State = StateSucceeded
+		j.Progress = 1
+		j.FinishedAt = now
+	case m.ctx.Err() != nil:
+		// 程序退出导致的中断不计入重试次数，下次启动时继续执行
+		j.State = StatePending
+		j.Attempts--
+	case j.Attempts < j.MaxAttempts:
+		j.State = StatePending
+		j.Error = err.Error()
+		j.NotBefore = now.Add(retryDelay(ctx) * time.Duration(j.Attempts))
+	default:
+		j.State = StateFailed
+		j.Error = err.Error()
+		j.FinishedAt = now
+	}
+	m.store.save(j)
+	m.prune()
+	m.lock.Unlock()
+
+	task.logLock.Lock()
+	if task.log != nil {
+		task.log.Close()
+		task.log = nil
+	}
+	task.logLock.Unlock()
+}
+
+// prune 需要在持有锁的情况下调用，删除超出保留数量或保留时间的已结束任务
+func (m *manager) prune() {
+	if m.maxFinished <= 0 && m.retention <= 0 {
+		return
+	}
+	finished := make([]*Job, 0)
+	for _, j := range m.jobs {
+		if j.finished() {
+			finished = append(finished, j)
+		}
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].FinishedAt.After(finished[k].FinishedAt)
+	})
+	now := time.Now()
+	for i, j := range finished {
+		if (m.maxFinished > 0 && i >= m.maxFinished) || (m.retention > 0 && now.Sub(j.FinishedAt) > m.retention) {
+			delete(m.jobs, j.Id)
+			m.store.remove(j.Id)
+		}
+	}
+}
+
+func retryDelay(ctx context.Context) time.Duration {
+	if inst := instance.GetInstance(ctx); inst != nil && inst.Config.Jobs.RetryDelay > 0 {
+		return inst.Config.Jobs.RetryDelay
+	}
+	return 0
+}
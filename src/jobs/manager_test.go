@@ -0,0 +1,238 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+)
+
+func newTestContext(t *testing.T, dir string) context.Context {
+	backup := pollInterval
+	pollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { pollInterval = backup })
+	return context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+		Config: &configs.Config{
+			AppDataPath: dir,
+			Jobs:        configs.Jobs{Workers: 1, MaxAttempts: 2},
+		},
+	})
+}
+
+func waitState(t *testing.T, m Manager, id string, state State) *Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := m.GetJob(context.Background(), id)
+		assert.NoError(t, err)
+		if j.State == state {
+			return j
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach state %s", id, state)
+	return nil
+}
+
+func TestSubmit(t *testing.T) {
+	ctx := newTestContext(t, t.TempDir())
+	m := NewManager(ctx)
+	attempts := 0
+	m.Register("test", func(ctx context.Context, task *Task) error {
+		var payload map[string]string
+		assert.NoError(t, task.Payload(&payload))
+		attempts = task.Attempt()
+		task.Logf("file %s", payload["file"])
+		task.SetProgress(0.5)
+		if task.Attempt() == 1 {
+			return errors.New("first attempt failed")
+		}
+		return nil
+	})
+	m.Register("fail", func(ctx context.Context, task *Task) error {
+		return errors.New("always failed")
+	})
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+
+	j, err := m.Submit(ctx, "test", map[string]string{"file": "a.flv"})
+	assert.NoError(t, err)
+	j = waitState(t, m, j.Id, StateSucceeded)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 2, j.Attempts)
+	assert.Equal(t, float64(1), j.Progress)
+	assert.Empty(t, j.Error)
+	log, err := m.GetLog(ctx, j.Id)
+	assert.NoError(t, err)
+	assert.Contains(t, string(log), "first attempt failed")
+	assert.Contains(t, string(log), "file a.flv")
+
+	j, err = m.Submit(ctx, "fail", nil)
+	assert.NoError(t, err)
+	j = waitState(t, m, j.Id, StateFailed)
+	assert.Equal(t, 2, j.Attempts)
+	assert.Equal(t, "always failed", j.Error)
+
+	j, err = m.Submit(ctx, "unknown", nil)
+	assert.NoError(t, err)
+	j = waitState(t, m, j.Id, StateFailed)
+	assert.Equal(t, 0, j.Attempts)
+
+	_, err = m.GetJob(ctx, "not-exist")
+	assert.Equal(t, ErrJobNotExist, err)
+	assert.Len(t, m.GetJobs(ctx), 3)
+}
+
+func TestCancelAndRetry(t *testing.T) {
+	ctx := newTestContext(t, t.TempDir())
+	m := NewManager(ctx)
+	started := make(chan struct{}, 1)
+	m.Register("block", func(ctx context.Context, task *Task) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+
+	running, err := m.Submit(ctx, "block", nil)
+	assert.NoError(t, err)
+	<-started
+	// 只有一个 worker，第二个任务保持等待状态
+	pending, err := m.Submit(ctx, "block", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Cancel(ctx, pending.Id))
+	waitState(t, m, pending.Id, StateCanceled)
+
+	assert.NoError(t, m.Cancel(ctx, running.Id))
+	j := waitState(t, m, running.Id, StateCanceled)
+	assert.Equal(t, 1, j.Attempts)
+	assert.Equal(t, ErrInvalidJobState, m.Cancel(ctx, running.Id))
+
+	assert.NoError(t, m.Retry(ctx, running.Id))
+	<-started
+	waitState(t, m, running.Id, StateRunning)
+	assert.Equal(t, ErrInvalidJobState, m.Retry(ctx, running.Id))
+	assert.Equal(t, ErrJobNotExist, m.Retry(ctx, "not-exist"))
+}
+
+func TestSubmitAfter(t *testing.T) {
+	ctx := newTestContext(t, t.TempDir())
+	instance.GetInstance(ctx).Config.Jobs.Workers = 2
+	m := NewManager(ctx)
+	release := make(chan struct{})
+	m.Register("first", func(ctx context.Context, task *Task) error {
+		<-release
+		return errors.New("failed")
+	})
+	m.Register("second", func(ctx context.Context, task *Task) error {
+		return nil
+	})
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+
+	first, err := m.Submit(ctx, "first", nil)
+	assert.NoError(t, err)
+	second, err := m.SubmitAfter(ctx, "second", nil, []string{first.Id, "pruned"})
+	assert.NoError(t, err)
+	waitState(t, m, first.Id, StateRunning)
+	// 有空闲的 worker，但依赖的任务还没有结束
+	time.Sleep(50 * time.Millisecond)
+	j, err := m.GetJob(ctx, second.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatePending, j.State)
+
+	// 依赖的任务失败重试期间继续等待，最终失败后开始执行
+	close(release)
+	waitState(t, m, first.Id, StateFailed)
+	waitState(t, m, second.Id, StateSucceeded)
+}
+
+func TestResumeAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := newTestContext(t, dir)
+	m := NewManager(ctx)
+	started := make(chan struct{}, 1)
+	m.Register("test", func(ctx context.Context, task *Task) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.NoError(t, m.Start(ctx))
+	j, err := m.Submit(ctx, "test", nil)
+	assert.NoError(t, err)
+	<-started
+	m.Close(ctx)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "jobs"))
+	assert.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, j.Id+".json,"+j.Id+".log", strings.Join(names, ","))
+
+	// 重启后继续执行被中断的任务，中断不计入尝试次数
+	m = NewManager(ctx)
+	m.Register("test", func(ctx context.Context, task *Task) error {
+		return nil
+	})
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+	j = waitState(t, m, j.Id, StateSucceeded)
+	assert.Equal(t, 1, j.Attempts)
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	ctx := newTestContext(t, dir)
+	cfg := instance.GetInstance(ctx).Config
+	cfg.Jobs.MaxFinished = 2
+	cfg.Jobs.Retention = 24 * time.Hour
+	s := &store{dir: filepath.Join(dir, "jobs")}
+	now := time.Now()
+	for i, j := range []*Job{
+		{Id: "a", State: StateSucceeded, FinishedAt: now.Add(-time.Hour)},
+		{Id: "b", State: StateFailed, FinishedAt: now.Add(-2 * time.Hour)},
+		{Id: "c", State: StateCanceled, FinishedAt: now.Add(-3 * time.Hour)},
+		{Id: "d", State: StateSucceeded, FinishedAt: now.Add(-48 * time.Hour)},
+		{Id: "e", State: StatePending, NotBefore: now.Add(time.Hour)},
+	} {
+		j.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		assert.NoError(t, s.save(j))
+		f, err := s.openLog(j.Id)
+		assert.NoError(t, err)
+		f.Close()
+	}
+
+	// 超出数量的 c 与超出保留时间的 d 被删除，未结束的任务不受影响
+	m := NewManager(ctx)
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+	ids := make([]string, 0)
+	for _, j := range m.GetJobs(ctx) {
+		ids = append(ids, j.Id)
+	}
+	assert.Equal(t, []string{"e", "b", "a"}, ids)
+	for _, id := range []string{"c", "d"} {
+		_, err := os.Stat(s.jobFile(id))
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(s.logFile(id))
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// 取消任务后同样按保留数量删除最早结束的任务
+	assert.NoError(t, m.Cancel(ctx, "e"))
+	_, err := m.GetJob(ctx, "b")
+	assert.Equal(t, ErrJobNotExist, err)
+}
@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// store 将任务保存在 AppDataPath/jobs 目录下，每个任务一个 json 文件与一个日志文件
+type store struct {
+	dir string
+}
+
+func (s *store) jobFile(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *store) logFile(id string) string {
+	return filepath.Join(s.dir, id+".log")
+}
+
+func (s *store) save(j *Job) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.jobFile(j.Id) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.jobFile(j.Id))
+}
+
+// remove 删除任务记录与日志
+func (s *store) remove(id string) {
+	os.Remove(s.jobFile(id))
+	os.Remove(s.logFile(id))
+}
+
+func (s *store) loadAll() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		j := new(Job)
+		if err := json.Unmarshal(b, j); err != nil {
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+func (s *store) openLog(id string) (*os.File, error) {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(s.logFile(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func (s *store) readLog(id string) ([]byte, error) {
+	b, err := os.ReadFile(s.logFile(id))
+	if os.IsNotExist(err) {
+		return []byte{}, nil
+	}
+	return b, err
+}
@@ -75,8 +75,11 @@ func (l *listener) Close() {
 	close(l.stop)
 }
 
-// sendLiveNotification 发送直播状态变更通知
+// sendLiveNotification 发送直播状态变更通知，不在录制时间段内时只有设置了 notify_outside 才发送
 func (l *listener) sendLiveNotification(hostName, status string) {
+	if room, s := l.config.GetSchedule(l.Live.GetRawUrl()); s != nil && !room.NotifyOutside && !s.Active(time.Now()) {
+		return
+	}
 	// 创建context用于日志记录
 	ctx := context.Background()
 	// 发送通知
@@ -133,7 +136,7 @@ func (l *listener) refresh() {
 		// 发送结束直播提醒和录像通知
 		l.sendLiveNotification(hostName, consts.LiveStatusStop)
 	case roomNameChangedEvt:
-		if !l.config.VideoSplitStrategies.OnRoomNameChanged {
+		if !l.config.GetRoomConfig(l.Live.GetRawUrl()).VideoSplitStrategies.OnRoomNameChanged {
 			return
 		}
 		evtTyp = RoomNameChanged
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -12,7 +13,6 @@ import (
 
 	"github.com/bililive-go/bililive-go/src/live"
 	"github.com/bililive-go/bililive-go/src/live/internal"
-	"github.com/bililive-go/bililive-go/src/pkg/utils"
 )
 
 const (
@@ -129,19 +129,23 @@ func (l *Live) GetInfo() (info *live.Info, err error) {
 	return info, nil
 }
 
-func (l *Live) GetStreamInfos() (infos []*live.StreamUrlInfo, err error) {
-	if l.realID == "" {
-		if err := l.parseRealId(); err != nil {
-			return nil, err
-		}
-	}
+// qnResolutions 清晰度对应的视频高度，原画的分辨率与主播推流一致，记为未知
+var qnResolutions = map[int64]int{
+	20000: 2160,
+	400:   1080,
+	250:   720,
+	150:   480,
+	80:    360,
+}
+
+func (l *Live) getPlayInfo(qn int64) ([]byte, error) {
 	cookies := l.Options.Cookies.Cookies(l.Url)
 	cookieKVs := make(map[string]string)
 	for _, item := range cookies {
 		cookieKVs[item.Name] = item.Value
 	}
 	apiUrl := liveApiUrlv2
-	query := fmt.Sprintf("?room_id=%s&protocol=0,1&format=0,1,2&codec=0,1&qn=10000&platform=web&ptype=8&dolby=5&panorama=1", l.realID)
+	query := fmt.Sprintf("?room_id=%s&protocol=0,1&format=0,1,2&codec=0,1,2&qn=%d&platform=web&ptype=8&dolby=5&panorama=1", l.realID, qn)
 	agent := live.CommonUserAgent
 	// for audio only use android api
 	if l.Options.AudioOnly {
@@ -173,33 +177,124 @@ func (l *Live) GetStreamInfos() (infos []*live.StreamUrlInfo, err error) {
 	if resp.StatusCode != http.StatusOK {
 		return nil, live.ErrRoomNotExist
 	}
-	body, err := resp.Bytes()
-	if err != nil {
-		return nil, err
-	}
-	urlStrings := make([]string, 0, 4)
-	addr := ""
-
-	if l.Options.Quality == 0 && gjson.GetBytes(body, "data.playurl_info.playurl.stream.1.format.1.codec.#").Int() > 1 {
-		addr = "data.playurl_info.playurl.stream.1.format.1.codec.1" // hevc m3u8
-	} else {
-		addr = "data.playurl_info.playurl.stream.0.format.0.codec.0" // avc flv
-	}
+	return resp.Bytes()
+}
 
-	baseURL := gjson.GetBytes(body, addr+".base_url").String()
-	gjson.GetBytes(body, addr+".url_info").ForEach(func(_, value gjson.Result) bool {
-		hosts := gjson.Get(value.String(), "host").String()
-		queries := gjson.Get(value.String(), "extra").String()
-		urlStrings = append(urlStrings, hosts+baseURL+queries)
+// parsePlayInfo 返回响应中全部协议、格式与编码的线路，以及可以选择的清晰度
+// 请求的清晰度不存在时会返回其他清晰度，seen 中已经解析过的清晰度会被跳过，解析后的清晰度加入 seen
+func (l *Live) parsePlayInfo(body []byte, seen map[int64]bool) (infos []*live.StreamUrlInfo, acceptQns []int64, err error) {
+	current := make(map[int64]bool)
+	defer func() {
+		for qn := range current {
+			seen[qn] = true
+		}
+	}()
+	playurl := gjson.GetBytes(body, "data.playurl_info.playurl")
+	qnDesc := make(map[int64]string)
+	playurl.Get("g_qn_desc").ForEach(func(_, value gjson.Result) bool {
+		qnDesc[value.Get("qn").Int()] = value.Get("desc").String()
 		return true
 	})
+	headers := l.getHeadersForDownloader()
+	playurl.Get("stream").ForEach(func(_, stream gjson.Result) bool {
+		container := live.ContainerFLV
+		if stream.Get("protocol_name").String() == "http_hls" {
+			container = live.ContainerHLS
+		}
+		stream.Get("format").ForEach(func(_, format gjson.Result) bool {
+			format.Get("codec").ForEach(func(_, codec gjson.Result) bool {
+				qn := codec.Get("current_qn").Int()
+				for _, accept := range codec.Get("accept_qn").Array() {
+					acceptQns = append(acceptQns, accept.Int())
+				}
+				if seen[qn] {
+					return true
+				}
+				current[qn] = true
+				baseURL := codec.Get("base_url").String()
+				codec.Get("url_info").ForEach(func(_, value gjson.Result) bool {
+					u, parseErr := url.Parse(value.Get("host").String() + baseURL + value.Get("extra").String())
+					if parseErr != nil {
+						err = parseErr
+						return false
+					}
+					infos = append(infos, &live.StreamUrlInfo{
+						Url:                  u,
+						Name:                 qnDesc[qn],
+						Description:          format.Get("format_name").String(),
+						Resolution:           qnResolutions[qn],
+						Codec:                codec.Get("codec_name").String(),
+						Container:            container,
+						AudioOnly:            l.Options.AudioOnly,
+						HeadersForDownloader: headers,
+					})
+					return true
+				})
+				return err == nil
+			})
+			return err == nil
+		})
+		return err == nil
+	})
+	return
+}
+
+// GetStreamInfos 只请求一次，返回最高清晰度的全部编码与格式的线路
+// quality 为 0 时 HEVC 排在前面，否则 AVC 排在前面，线路选择策略没有要求时按此顺序录制
+func (l *Live) GetStreamInfos() ([]*live.StreamUrlInfo, error) {
+	return l.getStreamInfos(false)
+}
 
-	urls, err := utils.GenUrls(urlStrings...)
+// GetAllStreamInfos 返回全部清晰度的线路，每个清晰度需要单独请求一次，频繁调用容易被限流
+func (l *Live) GetAllStreamInfos() ([]*live.StreamUrlInfo, error) {
+	return l.getStreamInfos(true)
+}
+
+func (l *Live) getStreamInfos(all bool) (infos []*live.StreamUrlInfo, err error) {
+	if l.realID == "" {
+		if err := l.parseRealId(); err != nil {
+			return nil, err
+		}
+	}
+	body, err := l.getPlayInfo(10000)
 	if err != nil {
 		return nil, err
 	}
-	infos = utils.GenUrlInfos(urls, l.getHeadersForDownloader())
-	return
+	seen := make(map[int64]bool)
+	infos, acceptQns, err := l.parsePlayInfo(body, seen)
+	if err != nil {
+		return nil, err
+	}
+	// 只录音频时只有一种清晰度
+	if !all || l.Options.AudioOnly {
+		acceptQns = nil
+	}
+	requested := map[int64]bool{10000: true}
+	for _, qn := range acceptQns {
+		if seen[qn] || requested[qn] {
+			continue
+		}
+		requested[qn] = true
+		// 其他清晰度获取失败时不影响录制
+		body, err := l.getPlayInfo(qn)
+		if err != nil {
+			break
+		}
+		if more, _, err := l.parsePlayInfo(body, seen); err == nil {
+			infos = append(infos, more...)
+		}
+	}
+	preferred := live.CodecAVC
+	if l.Options.Quality == 0 {
+		preferred = live.CodecHEVC
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Codec == preferred && infos[j].Codec != preferred
+	})
+	if len(infos) == 0 {
+		return nil, live.ErrInternalError
+	}
+	return infos, nil
 }
 
 func (l *Live) GetPlatformCNName() string {
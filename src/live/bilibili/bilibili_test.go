@@ -0,0 +1,100 @@
+package bilibili
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hr3lxphr6j/requests"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/live/internal"
+)
+
+// 抓取的 getRoomPlayInfo 响应，省略了与解析无关的字段，%d 为当前清晰度
+const playInfoFixture = `{"code":0,"data":{"playurl_info":{"playurl":{
+"g_qn_desc":[{"qn":10000,"desc":"原画"},{"qn":400,"desc":"蓝光"},{"qn":250,"desc":"超清"}],
+"stream":[
+{"protocol_name":"http_stream","format":[{"format_name":"flv","codec":[
+	{"codec_name":"avc","current_qn":%[1]d,"accept_qn":[10000,400,250],"base_url":"/live-bvc/%[1]d/live.flv?","url_info":[
+		{"host":"https://cn-a.bilivideo.com","extra":"expires=1"},
+		{"host":"https://cn-b.bilivideo.com","extra":"expires=1"}]}]}]},
+{"protocol_name":"http_hls","format":[{"format_name":"fmp4","codec":[
+	{"codec_name":"hevc","current_qn":%[1]d,"accept_qn":[10000,400,250],"base_url":"/live-bvc/%[1]d/index.m3u8?","url_info":[
+		{"host":"https://cn-a.bilivideo.com","extra":"expires=1"}]}]}]}
+]}}}}`
+
+type playInfoTransport struct {
+	qns []string
+}
+
+func (t *playInfoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	qn := req.URL.Query().Get("qn")
+	t.qns = append(t.qns, qn)
+	var n int
+	fmt.Sscan(qn, &n)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(fmt.Sprintf(playInfoFixture, n))),
+		Request:    req,
+	}, nil
+}
+
+func newTestLive() (*Live, *playInfoTransport) {
+	u, _ := url.Parse("https://live.bilibili.com/1")
+	tr := new(playInfoTransport)
+	l := &Live{BaseLive: internal.NewBaseLive(u), realID: "1"}
+	l.RequestSession = requests.NewSession(&http.Client{Transport: tr})
+	l.Options = live.MustNewOptions()
+	return l, tr
+}
+
+func TestParsePlayInfo(t *testing.T) {
+	l, _ := newTestLive()
+	seen := make(map[int64]bool)
+	infos, acceptQns, err := l.parsePlayInfo([]byte(fmt.Sprintf(playInfoFixture, 10000)), seen)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{10000, 400, 250, 10000, 400, 250}, acceptQns)
+	assert.True(t, seen[10000])
+	if assert.Len(t, infos, 3) {
+		assert.Equal(t, "原画", infos[0].Name)
+		assert.Equal(t, "flv", infos[0].Description)
+		assert.Equal(t, live.CodecAVC, infos[0].Codec)
+		assert.Equal(t, live.ContainerFLV, infos[0].Container)
+		assert.Equal(t, "https://cn-a.bilivideo.com/live-bvc/10000/live.flv?expires=1", infos[0].Url.String())
+		assert.Equal(t, "cn-b.bilivideo.com", infos[1].Url.Host)
+		assert.Equal(t, live.CodecHEVC, infos[2].Codec)
+		assert.Equal(t, live.ContainerHLS, infos[2].Container)
+	}
+
+	// 已经解析过的清晰度被跳过
+	infos, _, err = l.parsePlayInfo([]byte(fmt.Sprintf(playInfoFixture, 10000)), seen)
+	assert.NoError(t, err)
+	assert.Empty(t, infos)
+}
+
+func TestGetStreamInfos(t *testing.T) {
+	l, tr := newTestLive()
+	infos, err := l.GetStreamInfos()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000"}, tr.qns)
+	assert.Len(t, infos, 3)
+	// quality 为 0 时 HEVC 排在前面
+	assert.Equal(t, live.CodecHEVC, infos[0].Codec)
+
+	l, tr = newTestLive()
+	infos, err = l.GetAllStreamInfos()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10000", "400", "250"}, tr.qns)
+	assert.Len(t, infos, 9)
+	names := make(map[string]bool)
+	for _, info := range infos {
+		names[info.Name] = true
+	}
+	assert.Equal(t, map[string]bool{"原画": true, "蓝光": true, "超清": true}, names)
+}
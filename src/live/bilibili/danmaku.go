@@ -0,0 +1,382 @@
+package bilibili
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
+	"github.com/hr3lxphr6j/requests"
+	"github.com/tidwall/gjson"
+
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/live/internal"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+// for test
+var (
+	danmuInfoApiUrl = "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo"
+	navApiUrl       = "https://api.bilibili.com/x/web-interface/nav"
+	danmakuUrl      = func(host string, port int64) string {
+		return fmt.Sprintf("wss://%s:%d/sub", host, port)
+	}
+	heartbeatInterval = 30 * time.Second
+)
+
+// 弹幕服务器数据包头部中的操作码与协议版本
+const (
+	wsHeaderLen = 16
+
+	wsOpHeartbeat = 2
+	wsOpMessage   = 5
+	wsOpAuth      = 7
+	wsOpAuthReply = 8
+
+	wsVerInt    = 1
+	wsVerZlib   = 2
+	wsVerBrotli = 3
+)
+
+type wsPacket struct {
+	op   uint32
+	body []byte
+}
+
+func encodePacket(op uint32, body []byte) []byte {
+	b := make([]byte, wsHeaderLen, wsHeaderLen+len(body))
+	binary.BigEndian.PutUint32(b[0:], uint32(wsHeaderLen+len(body)))
+	binary.BigEndian.PutUint16(b[4:], wsHeaderLen)
+	binary.BigEndian.PutUint16(b[6:], wsVerInt)
+	binary.BigEndian.PutUint32(b[8:], op)
+	binary.BigEndian.PutUint32(b[12:], 1)
+	return append(b, body...)
+}
+
+// decodePackets 解析一条 websocket 消息中的全部数据包，压缩的数据包解压后递归解析
+func decodePackets(b []byte) ([]wsPacket, error) {
+	packets := make([]wsPacket, 0, 1)
+	for len(b) > 0 {
+		if len(b) < wsHeaderLen {
+			return nil, io.ErrUnexpectedEOF
+		}
+		length := binary.BigEndian.Uint32(b[0:])
+		headerLen := binary.BigEndian.Uint16(b[4:])
+		// 头部长度小于 16 或总长度为 0 时无法前进，视为损坏的数据包
+		if headerLen < wsHeaderLen || length < uint32(headerLen) || uint32(len(b)) < length {
+			return nil, fmt.Errorf("invalid packet length %d", length)
+		}
+		ver := binary.BigEndian.Uint16(b[6:])
+		op := binary.BigEndian.Uint32(b[8:])
+		body := b[headerLen:length]
+		b = b[length:]
+
+		var r io.Reader
+		switch ver {
+		case wsVerZlib:
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			r = zr
+		case wsVerBrotli:
+			r = brotli.NewReader(bytes.NewReader(body))
+		default:
+			packets = append(packets, wsPacket{op: op, body: body})
+			continue
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		inner, err := decodePackets(data)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, inner...)
+	}
+	return packets, nil
+}
+
+// parseMessage 将 DANMU_MSG、SEND_GIFT、SUPER_CHAT_MESSAGE、GUARD_BUY 转换为弹幕消息，其他命令返回 nil
+func parseMessage(body []byte, now time.Time) *danmaku.Message {
+	cmd, _, _ := strings.Cut(gjson.GetBytes(body, "cmd").String(), ":")
+	switch cmd {
+	case "DANMU_MSG":
+		info := gjson.GetBytes(body, "info")
+		return &danmaku.Message{
+			Type:     danmaku.TypeDanmaku,
+			Time:     now,
+			UserId:   info.Get("2.0").String(),
+			UserName: info.Get("2.1").String(),
+			Content:  info.Get("1").String(),
+			Mode:     int(info.Get("0.1").Int()),
+			FontSize: int(info.Get("0.2").Int()),
+			Color:    int(info.Get("0.3").Int()),
+		}
+	case "SEND_GIFT":
+		data := gjson.GetBytes(body, "data")
+		m := &danmaku.Message{
+			Type:     danmaku.TypeGift,
+			Time:     now,
+			UserId:   data.Get("uid").String(),
+			UserName: data.Get("uname").String(),
+			GiftName: data.Get("giftName").String(),
+			Count:    int(data.Get("num").Int()),
+		}
+		// 银瓜子礼物没有价值，金瓜子 1000 个为 1 元
+		if data.Get("coin_type").String() == "gold" {
+			m.Price = float64(data.Get("total_coin").Int()) / 1000
+		}
+		return m
+	case "SUPER_CHAT_MESSAGE":
+		data := gjson.GetBytes(body, "data")
+		return &danmaku.Message{
+			Type:     danmaku.TypeSuperChat,
+			Time:     now,
+			UserId:   data.Get("uid").String(),
+			UserName: data.Get("user_info.uname").String(),
+			Content:  data.Get("message").String(),
+			Price:    data.Get("price").Float(),
+			Duration: int(data.Get("time").Int()),
+		}
+	case "GUARD_BUY":
+		data := gjson.GetBytes(body, "data")
+		count := data.Get("num").Int()
+		return &danmaku.Message{
+			Type:       danmaku.TypeGuard,
+			Time:       now,
+			UserId:     data.Get("uid").String(),
+			UserName:   data.Get("username").String(),
+			GiftName:   data.Get("gift_name").String(),
+			Count:      int(count),
+			Price:      float64(data.Get("price").Int()*count) / 1000,
+			GuardLevel: int(data.Get("guard_level").Int()),
+		}
+	}
+	return nil
+}
+
+var mixinKeyEncTab = []int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35, 27, 43, 5, 49,
+	33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13, 37, 48, 7, 16, 24, 55, 40,
+	61, 26, 17, 0, 1, 60, 51, 30, 4, 22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11,
+	36, 20, 34, 44, 52,
+}
+
+var (
+	wbiLock      sync.Mutex
+	wbiMixinKey  string
+	wbiUpdatedAt time.Time
+)
+
+// getWbiMixinKey 从 nav 接口获取 wbi 签名使用的 key，缓存一小时
+func (l *Live) getWbiMixinKey(cookies map[string]string) (string, error) {
+	wbiLock.Lock()
+	defer wbiLock.Unlock()
+	if wbiMixinKey != "" && time.Since(wbiUpdatedAt) < time.Hour {
+		return wbiMixinKey, nil
+	}
+	resp, err := l.RequestSession.Get(navApiUrl, live.CommonUserAgent, requests.Cookies(cookies))
+	if err != nil {
+		return "", err
+	}
+	body, err := resp.Bytes()
+	if err != nil {
+		return "", err
+	}
+	key := func(u string) string {
+		return strings.TrimSuffix(path.Base(u), path.Ext(u))
+	}
+	raw := key(gjson.GetBytes(body, "data.wbi_img.img_url").String()) +
+		key(gjson.GetBytes(body, "data.wbi_img.sub_url").String())
+	if len(raw) < len(mixinKeyEncTab) {
+		return "", errors.New("failed to get wbi key")
+	}
+	var b strings.Builder
+	for _, i := range mixinKeyEncTab {
+		b.WriteByte(raw[i])
+	}
+	wbiMixinKey, wbiUpdatedAt = b.String()[:32], time.Now()
+	return wbiMixinKey, nil
+}
+
+// signWbi 为请求参数添加 wts 与 w_rid
+func signWbi(query url.Values, mixinKey string, now time.Time) string {
+	query.Set("wts", strconv.FormatInt(now.Unix(), 10))
+	for k, v := range query {
+		for i := range v {
+			v[i] = strings.Map(func(r rune) rune {
+				if strings.ContainsRune("!'()*", r) {
+					return -1
+				}
+				return r
+			}, v[i])
+		}
+		query[k] = v
+	}
+	encoded := strings.ReplaceAll(query.Encode(), "+", "%20")
+	sum := md5.Sum([]byte(encoded + mixinKey))
+	return encoded + "&w_rid=" + hex.EncodeToString(sum[:])
+}
+
+type danmuInfo struct {
+	token string
+	urls  []string
+}
+
+func (l *Live) getDanmuInfo(cookies map[string]string) (*danmuInfo, error) {
+	query := url.Values{"id": {l.realID}, "type": {"0"}}
+	rawQuery := query.Encode()
+	if mixinKey, err := l.getWbiMixinKey(cookies); err == nil {
+		rawQuery = signWbi(query, mixinKey, time.Now())
+	}
+	resp, err := l.RequestSession.Get(danmuInfoApiUrl+"?"+rawQuery, live.CommonUserAgent, requests.Cookies(cookies))
+	if err != nil {
+		return nil, err
+	}
+	body, err := resp.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if code := gjson.GetBytes(body, "code").Int(); code != 0 {
+		return nil, fmt.Errorf("failed to get danmu info: code %d, %s", code, gjson.GetBytes(body, "message").String())
+	}
+	info := &danmuInfo{token: gjson.GetBytes(body, "data.token").String()}
+	gjson.GetBytes(body, "data.host_list").ForEach(func(_, value gjson.Result) bool {
+		info.urls = append(info.urls, danmakuUrl(value.Get("host").String(), value.Get("wss_port").Int()))
+		return true
+	})
+	if len(info.urls) == 0 {
+		return nil, errors.New("no danmaku server available")
+	}
+	return info, nil
+}
+
+// Danmaku 连接直播间的弹幕服务器，断开后自动重连，ctx 结束后关闭返回的 channel
+func (l *Live) Danmaku(ctx context.Context) (<-chan *danmaku.Message, error) {
+	if l.realID == "" {
+		if err := l.parseRealId(); err != nil {
+			return nil, err
+		}
+	}
+	return internal.ReceiveDanmaku(ctx, l.GetRawUrl(), l.receiveDanmaku), nil
+}
+
+// receiveDanmaku 连接一次弹幕服务器并接收消息，直到连接断开或 ctx 结束
+func (l *Live) receiveDanmaku(ctx context.Context, ch chan<- *danmaku.Message) error {
+	cookies := make(map[string]string)
+	for _, item := range l.Options.Cookies.Cookies(l.Url) {
+		cookies[item.Name] = item.Value
+	}
+	info, err := l.getDanmuInfo(cookies)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("User-Agent", biliWebAgent)
+	header.Set("Origin", "https://"+domain)
+	var conn *websocket.Conn
+	for _, u := range info.urls {
+		if conn, _, err = websocket.DefaultDialer.DialContext(ctx, u, header); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	roomId, _ := strconv.ParseInt(l.realID, 10, 64)
+	uid, _ := strconv.ParseInt(cookies["DedeUserID"], 10, 64)
+	auth, _ := json.Marshal(map[string]any{
+		"uid":      uid,
+		"roomid":   roomId,
+		"protover": wsVerBrotli,
+		"buvid":    cookies["buvid3"],
+		"platform": "web",
+		"type":     2,
+		"key":      info.token,
+	})
+	// 写入只在这里与心跳协程中进行，认证完成前不会发送心跳
+	if err := conn.WriteMessage(websocket.BinaryMessage, encodePacket(wsOpAuth, auth)); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	authorized := false
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		packets, err := decodePackets(b)
+		if err != nil {
+			return err
+		}
+		for _, p := range packets {
+			switch p.op {
+			case wsOpAuthReply:
+				if code := gjson.GetBytes(p.body, "code").Int(); code != 0 {
+					return fmt.Errorf("danmaku auth failed: code %d", code)
+				}
+				if !authorized {
+					authorized = true
+					go l.heartbeat(conn, done)
+				}
+			case wsOpMessage:
+				m := parseMessage(p.body, time.Now())
+				if m == nil {
+					continue
+				}
+				select {
+				case ch <- m:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+func (l *Live) heartbeat(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if err := conn.WriteMessage(websocket.BinaryMessage, encodePacket(wsOpHeartbeat, []byte("[object Object]"))); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
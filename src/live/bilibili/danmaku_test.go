@@ -0,0 +1,184 @@
+package bilibili
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/live/internal"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+// 抓取的弹幕服务器消息，省略了与解析无关的字段
+var capturedMessages = [][]string{
+	{
+		`{"cmd":"DANMU_MSG:4:0:2:2:2:0","info":[[0,1,25,16777215,1704110400000,1704110400,0,"abc",0,0,0,"",0],"草",[12345,"观众A",0,0,0,10000,1,""],[],[0,0,9868950,">50000",0],["",""],0,0,null,{"ts":1704110400,"ct":"abc"},0,0,null,null,0,105]}`,
+		`{"cmd":"SEND_GIFT","data":{"giftName":"小心心","num":2,"uname":"观众B","uid":23456,"coin_type":"silver","total_coin":0,"price":0}}`,
+		`{"cmd":"INTERACT_WORD","data":{"uname":"观众C"}}`,
+	},
+	{
+		`{"cmd":"SUPER_CHAT_MESSAGE","data":{"message":"主播好","price":30,"time":60,"uid":34567,"user_info":{"uname":"观众D"}}}`,
+		`{"cmd":"GUARD_BUY","data":{"uid":45678,"username":"观众E","guard_level":3,"num":1,"price":198000,"gift_name":"舰长"}}`,
+		`{"cmd":"SEND_GIFT","data":{"giftName":"粉丝团灯牌","num":1,"uname":"观众F","uid":56789,"coin_type":"gold","total_coin":1000}}`,
+	},
+}
+
+func packet(ver uint16, op uint32, body []byte) []byte {
+	b := make([]byte, wsHeaderLen)
+	binary.BigEndian.PutUint32(b[0:], uint32(wsHeaderLen+len(body)))
+	binary.BigEndian.PutUint16(b[4:], wsHeaderLen)
+	binary.BigEndian.PutUint16(b[6:], ver)
+	binary.BigEndian.PutUint32(b[8:], op)
+	return append(b, body...)
+}
+
+func compress(ver uint16, messages []string) []byte {
+	var inner []byte
+	for _, m := range messages {
+		inner = append(inner, packet(0, wsOpMessage, []byte(m))...)
+	}
+	buf := new(bytes.Buffer)
+	switch ver {
+	case wsVerZlib:
+		w := zlib.NewWriter(buf)
+		w.Write(inner)
+		w.Close()
+	case wsVerBrotli:
+		w := brotli.NewWriter(buf)
+		w.Write(inner)
+		w.Close()
+	}
+	return packet(ver, wsOpMessage, buf.Bytes())
+}
+
+func TestDanmaku(t *testing.T) {
+	var connections atomic.Int32
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://live.bilibili.com"
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nav", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":-101,"data":{"wbi_img":{"img_url":"https://i0.hdslb.com/bfs/wbi/7cd084941338484aae1ad9425b84077c.png","sub_url":"https://i0.hdslb.com/bfs/wbi/4932caff0ff746eab6f01bf08b70ac45.png"}}}`)
+	})
+	mux.HandleFunc("/getDanmuInfo", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("id"))
+		assert.NotEmpty(t, r.URL.Query().Get("w_rid"))
+		host, port, _ := strings.Cut(r.Host, ":")
+		fmt.Fprintf(w, `{"code":0,"data":{"token":"token","host_list":[{"host":"%s","wss_port":%s}]}}`, host, port)
+	})
+	mux.HandleFunc("/sub", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		_, b, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		packets, err := decodePackets(b)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(wsOpAuth), packets[0].op)
+		assert.Equal(t, "token", gjson.GetBytes(packets[0].body, "key").String())
+		assert.Equal(t, int64(1), gjson.GetBytes(packets[0].body, "roomid").Int())
+
+		connections.Add(1)
+		conn.WriteMessage(websocket.BinaryMessage, packet(wsVerInt, wsOpAuthReply, []byte(`{"code":0}`)))
+		// 认证后立即发送心跳
+		_, b, err = conn.ReadMessage()
+		assert.NoError(t, err)
+		packets, _ = decodePackets(b)
+		assert.Equal(t, uint32(wsOpHeartbeat), packets[0].op)
+		conn.WriteMessage(websocket.BinaryMessage, compress(wsVerBrotli, capturedMessages[0]))
+		conn.WriteMessage(websocket.BinaryMessage, compress(wsVerZlib, capturedMessages[1]))
+		// 断开连接，客户端应该重新连接
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	backup := []any{danmuInfoApiUrl, navApiUrl, danmakuUrl, internal.DanmakuReconnectDelay}
+	defer func() {
+		danmuInfoApiUrl = backup[0].(string)
+		navApiUrl = backup[1].(string)
+		danmakuUrl = backup[2].(func(string, int64) string)
+		internal.DanmakuReconnectDelay = backup[3].(time.Duration)
+	}()
+	danmuInfoApiUrl = server.URL + "/getDanmuInfo"
+	navApiUrl = server.URL + "/nav"
+	danmakuUrl = func(host string, port int64) string {
+		return fmt.Sprintf("ws://%s:%d/sub", host, port)
+	}
+	internal.DanmakuReconnectDelay = 0
+
+	u, _ := url.Parse("https://live.bilibili.com/1")
+	l := &Live{BaseLive: internal.NewBaseLive(u), realID: "1"}
+	l.Options = live.MustNewOptions()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := l.Danmaku(ctx)
+	assert.NoError(t, err)
+
+	var messages []*danmaku.Message
+	timeout := time.After(10 * time.Second)
+	for len(messages) < 10 {
+		select {
+		case m := <-ch:
+			m.Time = time.Time{}
+			messages = append(messages, m)
+		case <-timeout:
+			t.Fatal("timeout waiting for danmaku")
+		}
+	}
+	assert.GreaterOrEqual(t, connections.Load(), int32(2))
+	assert.Equal(t, "ea1db124af3c7062474693fa704f4ff8", wbiMixinKey)
+	cancel()
+	for range ch {
+	}
+
+	assert.Equal(t, []*danmaku.Message{
+		{Type: danmaku.TypeDanmaku, UserId: "12345", UserName: "观众A", Content: "草", Mode: 1, FontSize: 25, Color: 16777215},
+		{Type: danmaku.TypeGift, UserId: "23456", UserName: "观众B", GiftName: "小心心", Count: 2},
+		{Type: danmaku.TypeSuperChat, UserId: "34567", UserName: "观众D", Content: "主播好", Price: 30, Duration: 60},
+		{Type: danmaku.TypeGuard, UserId: "45678", UserName: "观众E", GiftName: "舰长", Count: 1, Price: 198, GuardLevel: 3},
+		{Type: danmaku.TypeGift, UserId: "56789", UserName: "观众F", GiftName: "粉丝团灯牌", Count: 1, Price: 1},
+	}, messages[:5])
+	assert.Equal(t, messages[:5], messages[5:])
+}
+
+func TestSignWbi(t *testing.T) {
+	query := url.Values{"foo": {"114"}, "bar": {"514"}, "zab": {"1919810"}}
+	signed := signWbi(query, "ea1db124af3c7062474693fa704f4ff8", time.Unix(1702204169, 0))
+	assert.Equal(t, "bar=514&foo=114&wts=1702204169&zab=1919810&w_rid=8f6f2b5b3d485fe1886cec6a0be8c5d4", signed)
+}
+
+func TestDecodeInvalidPackets(t *testing.T) {
+	zero := make([]byte, wsHeaderLen)
+	_, err := decodePackets(zero)
+	assert.Error(t, err)
+
+	// 头部长度小于 16 时 body 会与头部重叠
+	b := packet(wsVerInt, wsOpMessage, []byte("{}"))
+	binary.BigEndian.PutUint16(b[4:], 4)
+	_, err = decodePackets(b)
+	assert.Error(t, err)
+
+	// 压缩的数据包中包含长度为 0 的数据包
+	buf := new(bytes.Buffer)
+	w := zlib.NewWriter(buf)
+	w.Write(zero)
+	w.Close()
+	_, err = decodePackets(packet(wsVerZlib, wsOpMessage, buf.Bytes()))
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package live
+
+import (
+	"context"
+
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+// DanmakuProvider 由支持弹幕的直播平台实现
+type DanmakuProvider interface {
+	// Danmaku 连接直播间的弹幕服务器，断开后自动重连，ctx 结束后关闭返回的 channel
+	Danmaku(ctx context.Context) (<-chan *danmaku.Message, error)
+}
+
+// GetDanmakuProvider 返回直播间的弹幕接口，平台不支持弹幕时返回 false
+func GetDanmakuProvider(l Live) (DanmakuProvider, bool) {
+	if w, ok := l.(*WrappedLive); ok {
+		l = w.Live
+	}
+	p, ok := l.(DanmakuProvider)
+	return p, ok
+}
@@ -0,0 +1,230 @@
+package douyu
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bililive-go/bililive-go/src/live/internal"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+// for test
+var (
+	danmakuUrl        = "wss://danmuproxy.douyu.com:8506/"
+	heartbeatInterval = 45 * time.Second
+)
+
+// 客户端发送的数据包类型，服务器发送的为 690
+const sttTypeClient = 689
+
+// 弹幕颜色编号对应的 RGB 颜色
+var danmakuColors = map[string]int{
+	"1": 0xff0000,
+	"2": 0x1e87f0,
+	"3": 0x7ac84b,
+	"4": 0xff7f00,
+	"5": 0x9b39f4,
+	"6": 0xff69b4,
+}
+
+// 贵族等级对应的名称
+var nobleNames = map[string]string{
+	"1": "骑士",
+	"2": "子爵",
+	"3": "伯爵",
+	"4": "公爵",
+	"5": "国王",
+	"6": "皇帝",
+	"7": "游侠",
+}
+
+var sttEscaper = strings.NewReplacer("@", "@A", "/", "@S")
+var sttUnescaper = strings.NewReplacer("@S", "/", "@A", "@")
+
+// encodeSTT 将键值对序列化为 STT 格式：key@=value/
+func encodeSTT(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		b.WriteString(sttEscaper.Replace(kv[i]))
+		b.WriteString("@=")
+		b.WriteString(sttEscaper.Replace(kv[i+1]))
+		b.WriteByte('/')
+	}
+	return b.String()
+}
+
+// decodeSTT 解析一层 STT 格式的键值对，嵌套的值保持转义后的原样
+func decodeSTT(s string) map[string]string {
+	m := make(map[string]string)
+	for _, item := range strings.Split(s, "/") {
+		k, v, ok := strings.Cut(item, "@=")
+		if !ok {
+			continue
+		}
+		m[sttUnescaper.Replace(k)] = sttUnescaper.Replace(v)
+	}
+	return m
+}
+
+// encodePacket 按斗鱼的格式封装数据包：两次小端序长度、类型、加密与保留字节，正文以 \0 结尾
+func encodePacket(typ uint16, body string) []byte {
+	b := make([]byte, 12, 12+len(body)+1)
+	length := uint32(8 + len(body) + 1)
+	binary.LittleEndian.PutUint32(b[0:], length)
+	binary.LittleEndian.PutUint32(b[4:], length)
+	binary.LittleEndian.PutUint16(b[8:], typ)
+	b = append(b, body...)
+	return append(b, 0)
+}
+
+// decodePackets 拆分一条 websocket 消息中的全部数据包，返回正文
+func decodePackets(b []byte) ([]string, error) {
+	var bodies []string
+	for len(b) > 0 {
+		if len(b) < 12 {
+			return nil, errors.New("invalid danmaku packet")
+		}
+		length := int(binary.LittleEndian.Uint32(b[0:]))
+		if length < 9 || len(b) < 4+length {
+			return nil, errors.New("invalid danmaku packet length")
+		}
+		body := b[12 : 4+length]
+		bodies = append(bodies, string(bytes.TrimRight(body, "\x00")))
+		b = b[4+length:]
+	}
+	return bodies, nil
+}
+
+// parseMessage 将服务器消息转为弹幕消息，不关心的消息返回 nil
+func parseMessage(body string, now time.Time) *danmaku.Message {
+	m := decodeSTT(body)
+	switch m["type"] {
+	case "chatmsg":
+		return &danmaku.Message{
+			Type:     danmaku.TypeDanmaku,
+			Time:     now,
+			UserId:   m["uid"],
+			UserName: m["nn"],
+			Content:  m["txt"],
+			Color:    danmakuColors[m["col"]],
+		}
+	case "dgb":
+		name := m["gfn"]
+		if name == "" {
+			name = "礼物" + m["gfid"]
+		}
+		count, _ := strconv.Atoi(m["gfcnt"])
+		if count == 0 {
+			count = 1
+		}
+		return &danmaku.Message{
+			Type:     danmaku.TypeGift,
+			Time:     now,
+			UserId:   m["uid"],
+			UserName: m["nn"],
+			GiftName: name,
+			Count:    count,
+		}
+	case "anbc":
+		return &danmaku.Message{
+			Type:     danmaku.TypeGuard,
+			Time:     now,
+			UserId:   m["uid"],
+			UserName: m["unk"],
+			GiftName: nobleNames[m["nl"]],
+			Count:    1,
+		}
+	}
+	return nil
+}
+
+// Danmaku 接收弹幕，连接断开后自动重连，ctx 结束后关闭返回的 channel
+func (l *Live) Danmaku(ctx context.Context) (<-chan *danmaku.Message, error) {
+	if err := l.fetchRoomID(); err != nil {
+		return nil, err
+	}
+	return internal.ReceiveDanmaku(ctx, l.GetRawUrl(), l.receiveDanmaku), nil
+}
+
+func (l *Live) receiveDanmaku(ctx context.Context, ch chan<- *danmaku.Message) error {
+	header := http.Header{}
+	header.Set("Origin", "https://"+domain)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, danmakuUrl, header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, body := range []string{
+		encodeSTT("type", "loginreq", "roomid", l.roomID),
+		encodeSTT("type", "joingroup", "rid", l.roomID, "gid", "-9999"),
+	} {
+		if err := conn.WriteMessage(websocket.BinaryMessage, encodePacket(sttTypeClient, body)); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	// 登录后的写入只在心跳协程中进行
+	go heartbeat(conn, done)
+
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		bodies, err := decodePackets(b)
+		if err != nil {
+			return err
+		}
+		for _, body := range bodies {
+			if strings.HasPrefix(body, "type@=error/") {
+				return fmt.Errorf("danmaku server error: %s", body)
+			}
+			m := parseMessage(body, time.Now())
+			if m == nil {
+				continue
+			}
+			select {
+			case ch <- m:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func heartbeat(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, encodePacket(sttTypeClient, encodeSTT("type", "mrkl"))); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package douyu
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/live/internal"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+// 抓取的弹幕服务器消息，省略了与解析无关的字段
+var capturedMessages = []string{
+	`type@=loginres/userid@=0/roomgroup@=0/`,
+	`type@=chatmsg/rid@=9999/uid@=12345/nn@=观众A/txt@=666@S@A/col@=2/level@=20/`,
+	`type@=dgb/rid@=9999/gfid@=824/gfn@=荧光棒/gfcnt@=5/uid@=23456/nn@=观众B/`,
+	`type@=uenter/rid@=9999/uid@=34567/nn@=观众C/`,
+	`type@=anbc/uid@=45678/unk@=观众D/nl@=3/`,
+}
+
+func TestDanmaku(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://www.douyu.com"
+	}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		for _, expected := range []string{"type@=loginreq/roomid@=9999/", "type@=joingroup/rid@=9999/gid@=-9999/"} {
+			_, b, err := conn.ReadMessage()
+			assert.NoError(t, err)
+			bodies, err := decodePackets(b)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{expected}, bodies)
+		}
+		_, b, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		bodies, _ := decodePackets(b)
+		assert.Equal(t, []string{"type@=mrkl/"}, bodies)
+		// 多个数据包可能在同一条消息中
+		var msg []byte
+		for _, m := range capturedMessages {
+			msg = append(msg, encodePacket(690, m)...)
+		}
+		conn.WriteMessage(websocket.BinaryMessage, msg)
+		// 断开连接，客户端应该重新连接
+	}))
+	defer server.Close()
+
+	backup := []any{danmakuUrl, heartbeatInterval, internal.DanmakuReconnectDelay}
+	defer func() {
+		danmakuUrl = backup[0].(string)
+		heartbeatInterval = backup[1].(time.Duration)
+		internal.DanmakuReconnectDelay = backup[2].(time.Duration)
+	}()
+	danmakuUrl = "ws" + strings.TrimPrefix(server.URL, "http")
+	heartbeatInterval = 10 * time.Millisecond
+	internal.DanmakuReconnectDelay = 0
+
+	u, _ := url.Parse("https://www.douyu.com/9999")
+	l := &Live{BaseLive: internal.NewBaseLive(u), roomID: "9999"}
+	l.Options = live.MustNewOptions()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := l.Danmaku(ctx)
+	assert.NoError(t, err)
+
+	var messages []*danmaku.Message
+	timeout := time.After(10 * time.Second)
+	for len(messages) < 6 {
+		select {
+		case m := <-ch:
+			m.Time = time.Time{}
+			messages = append(messages, m)
+		case <-timeout:
+			t.Fatal("timeout waiting for danmaku")
+		}
+	}
+	cancel()
+	for range ch {
+	}
+
+	assert.Equal(t, []*danmaku.Message{
+		{Type: danmaku.TypeDanmaku, UserId: "12345", UserName: "观众A", Content: "666/@", Color: 0x1e87f0},
+		{Type: danmaku.TypeGift, UserId: "23456", UserName: "观众B", GiftName: "荧光棒", Count: 5},
+		{Type: danmaku.TypeGuard, UserId: "45678", UserName: "观众D", GiftName: "伯爵", Count: 1},
+	}, messages[:3])
+	assert.Equal(t, messages[:3], messages[3:])
+}
+
+func TestSTT(t *testing.T) {
+	s := encodeSTT("type", "chatmsg", "txt", "a/b@c")
+	assert.Equal(t, "type@=chatmsg/txt@=a@Sb@Ac/", s)
+	assert.Equal(t, map[string]string{"type": "chatmsg", "txt": "a/b@c"}, decodeSTT(s))
+}
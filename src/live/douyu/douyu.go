@@ -308,6 +308,24 @@ func (l *Live) getSignParams() (map[string]string, error) {
 }
 
 func (l *Live) GetStreamUrls() (us []*url.URL, err error) {
+	infos, err := l.getStreamInfos(false)
+	if err != nil {
+		return nil, err
+	}
+	return []*url.URL{infos[0].Url}, nil
+}
+
+// GetStreamInfos 返回默认画质（原画）的线路
+func (l *Live) GetStreamInfos() ([]*live.StreamUrlInfo, error) {
+	return l.getStreamInfos(false)
+}
+
+// GetAllStreamInfos 依次请求 multirates 中的每个画质
+func (l *Live) GetAllStreamInfos() ([]*live.StreamUrlInfo, error) {
+	return l.getStreamInfos(true)
+}
+
+func (l *Live) getStreamInfos(all bool) ([]*live.StreamUrlInfo, error) {
 	if err := l.fetchRoomID(); err != nil {
 		return nil, err
 	}
@@ -315,6 +333,37 @@ func (l *Live) GetStreamUrls() (us []*url.URL, err error) {
 	if err != nil {
 		return nil, err
 	}
+	body, err := l.getPlay(params)
+	if err != nil {
+		return nil, err
+	}
+	info, rates, err := parsePlay(body)
+	if err != nil {
+		return nil, err
+	}
+	infos := []*live.StreamUrlInfo{info}
+	if !all {
+		return infos, nil
+	}
+	current := params["rate"]
+	for _, rate := range rates {
+		if rate == current {
+			continue
+		}
+		params["rate"] = rate
+		// 其他画质获取失败时不影响录制
+		body, err := l.getPlay(params)
+		if err != nil {
+			break
+		}
+		if info, _, err := parsePlay(body); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func (l *Live) getPlay(params map[string]string) ([]byte, error) {
 	resp, err := l.RequestSession.Post(
 		fmt.Sprintf("%s/%s", liveAPIUrl, l.roomID),
 		requests.Form(params),
@@ -328,19 +377,35 @@ func (l *Live) GetStreamUrls() (us []*url.URL, err error) {
 	if resp.StatusCode != http.StatusOK {
 		return nil, live.ErrInternalError
 	}
-	body, err := resp.Bytes()
-	if err != nil {
-		return nil, err
-	}
+	return resp.Bytes()
+}
+
+// parsePlay 解析 getH5Play 的响应，返回当前画质的线路与全部画质的 rate，
+// 画质名称与码率来自 multirates 中 rate 相同的一项
+func parsePlay(body []byte) (*live.StreamUrlInfo, []string, error) {
 	if errorInt := gjson.GetBytes(body, "error").Int(); errorInt != 0 {
-		return nil, fmt.Errorf("GetStreamUrls() failed, error: %d", errorInt)
+		return nil, nil, fmt.Errorf("GetStreamUrls() failed, error: %d", errorInt)
 	}
-	return utils.GenUrls(
+	urls, err := utils.GenUrls(
 		fmt.Sprintf("%s/%s",
 			gjson.GetBytes(body, "data.rtmp_url").String(),
 			gjson.GetBytes(body, "data.rtmp_live").String(),
 		),
 	)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &live.StreamUrlInfo{Url: urls[0]}
+	current := gjson.GetBytes(body, "data.rate").Int()
+	var rates []string
+	for _, rate := range gjson.GetBytes(body, "data.multirates").Array() {
+		rates = append(rates, rate.Get("rate").String())
+		if rate.Get("rate").Int() == current {
+			info.Name = rate.Get("name").String()
+			info.Vbitrate = int(rate.Get("bit").Int())
+		}
+	}
+	return info, rates, nil
 }
 
 func (l *Live) GetPlatformCNName() string {
@@ -0,0 +1,23 @@
+package douyu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 抓取的 getH5Play 响应，省略了与解析无关的字段
+const playFixture = `{"error":0,"data":{"room_id":9999,"rtmp_url":"https://hw-tct.douyucdn.cn/live","rtmp_live":"9999rDfrUgSsCKSr_900.flv?wsAuth=abc","rate":2,
+"multirates":[{"name":"原画","rate":0,"highBit":1,"bit":8000},{"name":"超清","rate":2,"highBit":0,"bit":2000},{"name":"高清","rate":1,"highBit":0,"bit":900}]}}`
+
+func TestParsePlay(t *testing.T) {
+	info, rates, err := parsePlay([]byte(playFixture))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", "2", "1"}, rates)
+	assert.Equal(t, "https://hw-tct.douyucdn.cn/live/9999rDfrUgSsCKSr_900.flv?wsAuth=abc", info.Url.String())
+	assert.Equal(t, "超清", info.Name)
+	assert.Equal(t, 2000, info.Vbitrate)
+
+	_, _, err = parsePlay([]byte(`{"error":-5,"msg":"room offline"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,202 @@
+package huya
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bililive-go/bililive-go/src/live/internal"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+	"github.com/bililive-go/bililive-go/src/pkg/utils"
+)
+
+// for test
+var (
+	danmakuUrl        = "wss://cdnws.api.huya.com"
+	heartbeatInterval = 60 * time.Second
+)
+
+// WebSocketCommand 的命令类型
+const (
+	wsCmdRegisterReq = 1
+	wsCmdHeartBeat   = 5
+	wsCmdMsgPushReq  = 7
+)
+
+// 推送消息的 uri
+const (
+	uriMessageNotice = 1400
+	uriSendItem      = 6501
+)
+
+// danmakuRoom 注册弹幕连接需要的主播与频道 id
+type danmakuRoom struct {
+	yyid, tid, sid int64
+}
+
+func (l *Live) getDanmakuRoom() (*danmakuRoom, error) {
+	body, err := l.GetHtmlBody()
+	if err != nil {
+		return nil, err
+	}
+	yyid := utils.Match1(`lYyid"\s*:\s*"?(\d+)`, body)
+	if yyid == "" {
+		yyid = utils.Match1(`yyid"\s*:\s*"?(\d+)`, body)
+	}
+	room := new(danmakuRoom)
+	room.yyid, _ = strconv.ParseInt(yyid, 10, 64)
+	room.tid, _ = strconv.ParseInt(utils.Match1(`lChannelId"\s*:\s*"?(\d+)`, body), 10, 64)
+	room.sid, _ = strconv.ParseInt(utils.Match1(`lSubChannelId"\s*:\s*"?(\d+)`, body), 10, 64)
+	if room.yyid == 0 {
+		return nil, errors.New("failed to get yyid of the room")
+	}
+	return room, nil
+}
+
+func encodeCommand(cmd int64, data []byte) []byte {
+	w := new(tarsWriter)
+	w.Int(0, cmd)
+	w.Bytes(1, data)
+	return w.Data()
+}
+
+// encodeRegister 以匿名用户身份注册到直播间的频道
+func encodeRegister(room *danmakuRoom) []byte {
+	info := new(tarsWriter)
+	info.Int(0, room.yyid)
+	info.Bool(1, true)
+	info.String(2, "")
+	info.String(3, "")
+	info.Int(4, room.tid)
+	info.Int(5, room.sid)
+	info.Int(6, 0)
+	info.Int(7, 0)
+	return encodeCommand(wsCmdRegisterReq, info.Data())
+}
+
+// parseMessage 将服务器推送的消息转为弹幕消息，不关心的消息返回 nil
+func parseMessage(b []byte, now time.Time) (*danmaku.Message, error) {
+	cmd, err := decodeTars(b)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Int(0) != wsCmdMsgPushReq {
+		return nil, nil
+	}
+	push, err := decodeTars(cmd.Bytes(1))
+	if err != nil {
+		return nil, err
+	}
+	uri := push.Int(1)
+	if uri != uriMessageNotice && uri != uriSendItem {
+		return nil, nil
+	}
+	msg, err := decodeTars(push.Bytes(2))
+	if err != nil {
+		return nil, err
+	}
+	switch uri {
+	case uriMessageNotice:
+		sender := msg.Struct(0)
+		m := &danmaku.Message{
+			Type:     danmaku.TypeDanmaku,
+			Time:     now,
+			UserId:   strconv.FormatInt(sender.Int(0), 10),
+			UserName: sender.String(2),
+			Content:  msg.String(3),
+		}
+		// 颜色为 -1 时使用默认颜色
+		if color := msg.Struct(6).Int(0); color > 0 {
+			m.Color = int(color)
+		}
+		return m, nil
+	default:
+		count := int(msg.Int(2))
+		if count == 0 {
+			count = 1
+		}
+		return &danmaku.Message{
+			Type:     danmaku.TypeGift,
+			Time:     now,
+			UserId:   strconv.FormatInt(msg.Int(4), 10),
+			UserName: msg.String(6),
+			GiftName: "礼物" + strconv.FormatInt(msg.Int(0), 10),
+			Count:    count,
+		}, nil
+	}
+}
+
+// Danmaku 接收弹幕，连接断开后自动重连，ctx 结束后关闭返回的 channel
+func (l *Live) Danmaku(ctx context.Context) (<-chan *danmaku.Message, error) {
+	return internal.ReceiveDanmaku(ctx, l.GetRawUrl(), l.receiveDanmaku), nil
+}
+
+func (l *Live) receiveDanmaku(ctx context.Context, ch chan<- *danmaku.Message) error {
+	room, err := l.getDanmakuRoom()
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Origin", "https://"+domain)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, danmakuUrl, header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.BinaryMessage, encodeRegister(room)); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	// 注册后的写入只在心跳协程中进行
+	go heartbeat(conn, done)
+
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		m, err := parseMessage(b, time.Now())
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			continue
+		}
+		select {
+		case ch <- m:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func heartbeat(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, encodeCommand(wsCmdHeartBeat, nil)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package huya
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/live/internal"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+func pushMessage(uri int64, msg func(w *tarsWriter)) []byte {
+	m := new(tarsWriter)
+	msg(m)
+	push := new(tarsWriter)
+	push.Int(0, 0)
+	push.Int(1, uri)
+	push.Bytes(2, m.Data())
+	return encodeCommand(wsCmdMsgPushReq, push.Data())
+}
+
+var pushedMessages = [][]byte{
+	pushMessage(uriMessageNotice, func(w *tarsWriter) {
+		w.Struct(0, func(w *tarsWriter) {
+			w.Int(0, 1234567890123)
+			w.Int(1, 0)
+			w.String(2, "观众A")
+		})
+		w.Int(1, 0)
+		w.String(3, "666")
+		w.Struct(6, func(w *tarsWriter) {
+			w.Int(0, -1)
+			w.Int(1, 4)
+		})
+	}),
+	// 不关心的消息
+	pushMessage(1002, func(w *tarsWriter) { w.String(0, "ignored") }),
+	pushMessage(uriSendItem, func(w *tarsWriter) {
+		w.Int(0, 4)
+		w.String(1, "pay")
+		w.Int(2, 10)
+		w.Int(3, 1)
+		w.Int(4, 23456)
+		w.String(5, "主播")
+		w.String(6, "观众B")
+	}),
+	pushMessage(uriMessageNotice, func(w *tarsWriter) {
+		w.Struct(0, func(w *tarsWriter) {
+			w.Int(0, 34567)
+			w.String(2, "观众C")
+		})
+		w.String(3, strings.Repeat("长", 100))
+		w.Struct(6, func(w *tarsWriter) { w.Int(0, 0xff0000) })
+	}),
+}
+
+func TestDanmaku(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://www.huya.com"
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/123", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<script>var TT_ROOM_DATA = {"lChannelId":"111","lSubChannelId":"222"};var TT_PROFILE_INFO = {"lYyid":333};</script>`)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		_, b, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		cmd, err := decodeTars(b)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(wsCmdRegisterReq), cmd.Int(0))
+		info, err := decodeTars(cmd.Bytes(1))
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{333, 1, 111, 222}, []int64{info.Int(0), info.Int(1), info.Int(4), info.Int(5)})
+		_, b, err = conn.ReadMessage()
+		assert.NoError(t, err)
+		cmd, _ = decodeTars(b)
+		assert.Equal(t, int64(wsCmdHeartBeat), cmd.Int(0))
+		for _, m := range pushedMessages {
+			conn.WriteMessage(websocket.BinaryMessage, m)
+		}
+		// 断开连接，客户端应该重新连接
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	backup := []any{danmakuUrl, heartbeatInterval, internal.DanmakuReconnectDelay}
+	defer func() {
+		danmakuUrl = backup[0].(string)
+		heartbeatInterval = backup[1].(time.Duration)
+		internal.DanmakuReconnectDelay = backup[2].(time.Duration)
+	}()
+	danmakuUrl = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	heartbeatInterval = 10 * time.Millisecond
+	internal.DanmakuReconnectDelay = 0
+
+	u, _ := url.Parse(server.URL + "/123")
+	l := &Live{BaseLive: internal.NewBaseLive(u)}
+	l.Options = live.MustNewOptions()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := l.Danmaku(ctx)
+	assert.NoError(t, err)
+
+	var messages []*danmaku.Message
+	timeout := time.After(10 * time.Second)
+	for len(messages) < 6 {
+		select {
+		case m := <-ch:
+			m.Time = time.Time{}
+			messages = append(messages, m)
+		case <-timeout:
+			t.Fatal("timeout waiting for danmaku")
+		}
+	}
+	cancel()
+	for range ch {
+	}
+
+	assert.Equal(t, []*danmaku.Message{
+		{Type: danmaku.TypeDanmaku, UserId: "1234567890123", UserName: "观众A", Content: "666"},
+		{Type: danmaku.TypeGift, UserId: "23456", UserName: "观众B", GiftName: "礼物4", Count: 10},
+		{Type: danmaku.TypeDanmaku, UserId: "34567", UserName: "观众C", Content: strings.Repeat("长", 100), Color: 0xff0000},
+	}, messages[:3])
+	assert.Equal(t, messages[:3], messages[3:])
+}
+
+func TestTars(t *testing.T) {
+	w := new(tarsWriter)
+	w.Int(0, 1)
+	w.Int(1, -200)
+	w.Int(2, 1<<20)
+	w.Int(20, 1<<40)
+	w.String(3, "abc")
+	w.Bool(4, true)
+	w.Bytes(5, []byte{1, 2, 3})
+	w.Struct(6, func(w *tarsWriter) { w.String(0, "nested") })
+	// list<int> 与 map<string, int>，由服务器发送，手工编码
+	w.head(7, tarsList)
+	w.Int(0, 2)
+	w.Int(0, 5)
+	w.Int(0, 6)
+	w.head(8, tarsMap)
+	w.Int(0, 1)
+	w.String(0, "k")
+	w.Int(1, 7)
+
+	s, err := decodeTars(w.Data())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), s.Int(0))
+	assert.Equal(t, int64(-200), s.Int(1))
+	assert.Equal(t, int64(1<<20), s.Int(2))
+	assert.Equal(t, int64(1<<40), s.Int(20))
+	assert.Equal(t, "abc", s.String(3))
+	assert.Equal(t, int64(1), s.Int(4))
+	assert.Equal(t, []byte{1, 2, 3}, s.Bytes(5))
+	assert.Equal(t, "nested", s.Struct(6).String(0))
+	assert.Equal(t, []any{int64(5), int64(6)}, s[7])
+	assert.Equal(t, map[any]any{"k": int64(7)}, s[8])
+
+	_, err = decodeTars(w.Data()[:len(w.Data())-1])
+	assert.Error(t, err)
+}
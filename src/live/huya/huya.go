@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
+	"github.com/tidwall/gjson"
+
 	"github.com/bililive-go/bililive-go/src/live"
 	"github.com/bililive-go/bililive-go/src/live/internal"
 	"github.com/bililive-go/bililive-go/src/pkg/utils"
@@ -120,3 +123,25 @@ func getGeneralHeadersForDownloader() map[string]string {
 		"Accept-Language": `zh-CN,zh;q=0.8,en-US;q=0.5,en;q=0.3`,
 	}
 }
+
+// rateInfos 每个码率是一个变体，iBitRate 为 0 的是原画
+func rateInfos(rates []gjson.Result, urls []*url.URL, headers map[string]string) []*live.StreamUrlInfo {
+	infos := make([]*live.StreamUrlInfo, 0, len(rates)*len(urls))
+	for _, rate := range rates {
+		bitrate := int(rate.Get("iBitRate").Int())
+		for _, u := range urls {
+			variantUrl := *u
+			if bitrate > 0 {
+				variantUrl.RawQuery += "&ratio=" + strconv.Itoa(bitrate)
+			}
+			infos = append(infos, &live.StreamUrlInfo{
+				Url:                  &variantUrl,
+				Name:                 rate.Get("sDisplayName").String(),
+				Vbitrate:             bitrate,
+				Container:            live.ContainerFLV,
+				HeadersForDownloader: headers,
+			})
+		}
+	}
+	return infos
+}
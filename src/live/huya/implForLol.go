@@ -94,7 +94,7 @@ func GetStreamInfos_ForLol(l *Live) (infos []*live.StreamUrlInfo, err error) {
 	if err != nil {
 		return nil, err
 	}
-	return utils.GenUrlInfos(urls, downloaderHeadersForLol), nil
+	return rateInfos(vMultiStreamInfoJson, urls, downloaderHeadersForLol), nil
 }
 
 func getStreamUrlsFromGameStreamInfoJson(gameStreamInfoJson gjson.Result) (us []*url.URL, err error) {
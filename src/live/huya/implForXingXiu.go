@@ -87,6 +87,9 @@ func GetStreamInfos_ForXingXiu(l *Live) (infos []*live.StreamUrlInfo, err error)
 	if err != nil {
 		return nil, err
 	}
+	if rates := data.Get("data.stream.flv.rateArray").Array(); len(rates) > 0 {
+		return rateInfos(rates, res, downloaderHeadersForXingXiu), nil
+	}
 	infos = utils.GenUrlInfos(res, downloaderHeadersForXingXiu)
 	return infos, nil
 }
@@ -0,0 +1,326 @@
+package huya
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// TARS 编码中字段头部的类型
+const (
+	tarsInt8 = iota
+	tarsInt16
+	tarsInt32
+	tarsInt64
+	tarsFloat
+	tarsDouble
+	tarsString1
+	tarsString4
+	tarsMap
+	tarsList
+	tarsStructBegin
+	tarsStructEnd
+	tarsZero
+	tarsSimpleList
+)
+
+var errTarsEOF = errors.New("tars: unexpected end of data")
+
+// tarsWriter 按 TARS 格式编码字段，只实现弹幕协议用到的类型
+type tarsWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *tarsWriter) head(tag, typ byte) {
+	if tag < 15 {
+		w.buf.WriteByte(tag<<4 | typ)
+		return
+	}
+	w.buf.WriteByte(0xf0 | typ)
+	w.buf.WriteByte(tag)
+}
+
+func (w *tarsWriter) Int(tag byte, v int64) {
+	switch {
+	case v == 0:
+		w.head(tag, tarsZero)
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		w.head(tag, tarsInt8)
+		w.buf.WriteByte(byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		w.head(tag, tarsInt16)
+		binary.Write(&w.buf, binary.BigEndian, int16(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		w.head(tag, tarsInt32)
+		binary.Write(&w.buf, binary.BigEndian, int32(v))
+	default:
+		w.head(tag, tarsInt64)
+		binary.Write(&w.buf, binary.BigEndian, v)
+	}
+}
+
+func (w *tarsWriter) Bool(tag byte, v bool) {
+	if v {
+		w.Int(tag, 1)
+	} else {
+		w.Int(tag, 0)
+	}
+}
+
+func (w *tarsWriter) String(tag byte, v string) {
+	if len(v) <= math.MaxUint8 {
+		w.head(tag, tarsString1)
+		w.buf.WriteByte(byte(len(v)))
+	} else {
+		w.head(tag, tarsString4)
+		binary.Write(&w.buf, binary.BigEndian, uint32(len(v)))
+	}
+	w.buf.WriteString(v)
+}
+
+// Bytes 写入 vector<byte>，编码为 simple list
+func (w *tarsWriter) Bytes(tag byte, v []byte) {
+	w.head(tag, tarsSimpleList)
+	w.head(0, tarsInt8)
+	w.Int(0, int64(len(v)))
+	w.buf.Write(v)
+}
+
+// Struct 写入嵌套的结构体
+func (w *tarsWriter) Struct(tag byte, f func(w *tarsWriter)) {
+	w.head(tag, tarsStructBegin)
+	f(w)
+	w.head(0, tarsStructEnd)
+}
+
+func (w *tarsWriter) Data() []byte {
+	return w.buf.Bytes()
+}
+
+// tarsStruct 是解码后的结构体，按 tag 保存字段：整数为 int64，浮点数为 float64，
+// 字符串为 string，simple list 为 []byte，list 为 []any，map 为 map[any]any，结构体为 tarsStruct
+type tarsStruct map[byte]any
+
+func (s tarsStruct) Int(tag byte) int64 {
+	v, _ := s[tag].(int64)
+	return v
+}
+
+func (s tarsStruct) String(tag byte) string {
+	switch v := s[tag].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+func (s tarsStruct) Bytes(tag byte) []byte {
+	switch v := s[tag].(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+func (s tarsStruct) Struct(tag byte) tarsStruct {
+	v, _ := s[tag].(tarsStruct)
+	return v
+}
+
+type tarsReader struct {
+	b []byte
+}
+
+// decodeTars 解码一段结构体的全部字段
+func decodeTars(b []byte) (tarsStruct, error) {
+	r := &tarsReader{b: b}
+	s := make(tarsStruct)
+	for len(r.b) > 0 {
+		tag, typ, err := r.head()
+		if err != nil {
+			return nil, err
+		}
+		if typ == tarsStructEnd {
+			return nil, errors.New("tars: unexpected struct end")
+		}
+		if s[tag], err = r.value(typ); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (r *tarsReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.b) < n {
+		return nil, errTarsEOF
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b, nil
+}
+
+func (r *tarsReader) head() (tag, typ byte, err error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	tag, typ = b[0]>>4, b[0]&0x0f
+	if tag == 15 {
+		if b, err = r.next(1); err != nil {
+			return 0, 0, err
+		}
+		tag = b[0]
+	}
+	return tag, typ, nil
+}
+
+// int 读取一个带头部的整数，用于 list、map 等的长度
+func (r *tarsReader) int() (int64, error) {
+	_, typ, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	v, err := r.value(typ)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("tars: expect int, got type %d", typ)
+	}
+	return n, nil
+}
+
+func (r *tarsReader) value(typ byte) (any, error) {
+	switch typ {
+	case tarsInt8:
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int8(b[0])), nil
+	case tarsInt16:
+		b, err := r.next(2)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case tarsInt32:
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	case tarsInt64:
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case tarsFloat:
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case tarsDouble:
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case tarsString1:
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.next(int(b[0]))
+		return string(s), err
+	case tarsString4:
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.next(int(binary.BigEndian.Uint32(b)))
+		return string(s), err
+	case tarsMap:
+		n, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[any]any)
+		for i := int64(0); i < n; i++ {
+			var k, v any
+			if k, err = r.field(); err != nil {
+				return nil, err
+			}
+			if v, err = r.field(); err != nil {
+				return nil, err
+			}
+			// list、map 等不可比较的键无法保存，协议中不会出现
+			switch k.(type) {
+			case int64, float64, string:
+				m[k] = v
+			}
+		}
+		return m, nil
+	case tarsList:
+		n, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n > int64(len(r.b)) {
+			return nil, errTarsEOF
+		}
+		l := make([]any, 0, n)
+		for i := int64(0); i < n; i++ {
+			v, err := r.field()
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	case tarsStructBegin:
+		s := make(tarsStruct)
+		for {
+			tag, typ, err := r.head()
+			if err != nil {
+				return nil, err
+			}
+			if typ == tarsStructEnd {
+				return s, nil
+			}
+			if s[tag], err = r.value(typ); err != nil {
+				return nil, err
+			}
+		}
+	case tarsZero:
+		return int64(0), nil
+	case tarsSimpleList:
+		if _, _, err := r.head(); err != nil {
+			return nil, err
+		}
+		n, err := r.int()
+		if err != nil {
+			return nil, err
+		}
+		return r.next(int(n))
+	}
+	return nil, fmt.Errorf("tars: unknown type %d", typ)
+}
+
+// field 读取一个带头部的值，忽略 tag
+func (r *tarsReader) field() (any, error) {
+	_, typ, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	return r.value(typ)
+}
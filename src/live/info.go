@@ -3,6 +3,7 @@ package live
 import (
 	"encoding/json"
 
+	"github.com/bililive-go/bililive-go/src/configs"
 	"github.com/bililive-go/bililive-go/src/types"
 )
 
@@ -14,6 +15,12 @@ type Info struct {
 	Initializing         bool
 	CustomLiveId         string
 	AudioOnly            bool
+	// 手动控制录制的状态，见 recorders.Manager
+	ManualRecording, RecordPaused, RecordSuppressed bool
+	// RecordWaiting 超出并发数或带宽上限，等待开始录制
+	RecordWaiting bool
+	// Config 直播间生效的设置，只在查询单个直播间时返回
+	Config *configs.RoomConfig
 }
 
 type InfoCookie struct {
@@ -24,31 +31,41 @@ type InfoCookie struct {
 
 func (i *Info) MarshalJSON() ([]byte, error) {
 	t := struct {
-		Id                types.LiveID `json:"id"`
-		LiveUrl           string       `json:"live_url"`
-		PlatformCNName    string       `json:"platform_cn_name"`
-		HostName          string       `json:"host_name"`
-		RoomName          string       `json:"room_name"`
-		Status            bool         `json:"status"`
-		Listening         bool         `json:"listening"`
-		Recording         bool         `json:"recording"`
-		Initializing      bool         `json:"initializing"`
-		LastStartTime     string       `json:"last_start_time,omitempty"`
-		LastStartTimeUnix int64        `json:"last_start_time_unix,omitempty"`
-		AudioOnly         bool         `json:"audio_only"`
-		NickName          string       `json:"nick_name"`
+		Id                types.LiveID        `json:"id"`
+		LiveUrl           string              `json:"live_url"`
+		PlatformCNName    string              `json:"platform_cn_name"`
+		HostName          string              `json:"host_name"`
+		RoomName          string              `json:"room_name"`
+		Status            bool                `json:"status"`
+		Listening         bool                `json:"listening"`
+		Recording         bool                `json:"recording"`
+		ManualRecording   bool                `json:"manual_recording"`
+		RecordPaused      bool                `json:"record_paused"`
+		RecordSuppressed  bool                `json:"record_suppressed"`
+		RecordWaiting     bool                `json:"record_waiting"`
+		Initializing      bool                `json:"initializing"`
+		LastStartTime     string              `json:"last_start_time,omitempty"`
+		LastStartTimeUnix int64               `json:"last_start_time_unix,omitempty"`
+		AudioOnly         bool                `json:"audio_only"`
+		NickName          string              `json:"nick_name"`
+		Config            *configs.RoomConfig `json:"config,omitempty"`
 	}{
-		Id:             i.Live.GetLiveId(),
-		LiveUrl:        i.Live.GetRawUrl(),
-		PlatformCNName: i.Live.GetPlatformCNName(),
-		HostName:       i.HostName,
-		RoomName:       i.RoomName,
-		Status:         i.Status,
-		Listening:      i.Listening,
-		Recording:      i.Recording,
-		Initializing:   i.Initializing,
-		AudioOnly:      i.AudioOnly,
-		NickName:       i.Live.GetOptions().NickName,
+		Id:               i.Live.GetLiveId(),
+		LiveUrl:          i.Live.GetRawUrl(),
+		PlatformCNName:   i.Live.GetPlatformCNName(),
+		HostName:         i.HostName,
+		RoomName:         i.RoomName,
+		Status:           i.Status,
+		Listening:        i.Listening,
+		Recording:        i.Recording,
+		ManualRecording:  i.ManualRecording,
+		RecordPaused:     i.RecordPaused,
+		RecordSuppressed: i.RecordSuppressed,
+		RecordWaiting:    i.RecordWaiting,
+		Initializing:     i.Initializing,
+		AudioOnly:        i.AudioOnly,
+		NickName:         i.Live.GetOptions().NickName,
+		Config:           i.Config,
 	}
 	if !i.Live.GetLastStartTime().IsZero() {
 		t.LastStartTime = i.Live.GetLastStartTime().Format("2006-01-02 15:04:05")
@@ -55,7 +55,7 @@ func (a *BaseLive) UpdateLiveOptionsbyConfig(ctx context.Context, room *configs.
 		opts = append(opts, live.WithKVStringCookies(url, v))
 	}
 	opts = append(opts, live.WithQuality(room.Quality))
-	opts = append(opts, live.WithAudioOnly(room.AudioOnly))
+	opts = append(opts, live.WithAudioOnly(room.AudioOnly || inst.Config.GetRoomConfig(room.Url).QualityPolicy.AudioOnly))
 	opts = append(opts, live.WithNickName(room.NickName))
 	a.Options = live.MustNewOptions(opts...)
 	return
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+// for test
+var DanmakuReconnectDelay = 5 * time.Second
+
+// ReceiveDanmaku 在 ctx 结束前反复调用 connect 接收弹幕，connect 返回后等待一段时间重新连接，
+// ctx 结束后关闭返回的 channel
+func ReceiveDanmaku(ctx context.Context, name string, connect func(ctx context.Context, ch chan<- *danmaku.Message) error) <-chan *danmaku.Message {
+	ch := make(chan *danmaku.Message, 256)
+	go func() {
+		defer close(ch)
+		for {
+			err := connect(ctx, ch)
+			if ctx.Err() != nil {
+				return
+			}
+			if inst := instance.GetInstance(ctx); inst != nil {
+				inst.Logger.WithError(err).WithField("room", name).Warn("danmaku connection closed, reconnecting...")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(DanmakuReconnectDelay):
+			}
+		}
+	}()
+	return ch
+}
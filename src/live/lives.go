@@ -107,15 +107,65 @@ func WithNickName(nickName string) Option {
 	}
 }
 
+// 线路的视频编码
+const (
+	CodecAVC  = "avc"
+	CodecHEVC = "hevc"
+	CodecAV1  = "av1"
+)
+
+// 线路的封装格式
+const (
+	ContainerFLV = "flv"
+	ContainerHLS = "hls"
+)
+
+// StreamUrlInfo 一条可录制的线路，同一清晰度、编码与格式的不同 CDN 节点是不同的线路
 type StreamUrlInfo struct {
-	Url                  *url.URL
-	Name                 string
-	Description          string
-	Resolution           int
-	Vbitrate             int
+	Url         *url.URL
+	Name        string
+	Description string
+	// Resolution 视频高度，如 1080，0 为未知（通常是原画）
+	Resolution int
+	// Vbitrate 视频码率（kbps），0 为未知
+	Vbitrate int
+	// Codec 视频编码，为空时未知
+	Codec string
+	// Container 封装格式，为空时根据地址判断
+	Container            string
+	AudioOnly            bool
 	HeadersForDownloader map[string]string
 }
 
+// GetContainer 返回线路的封装格式，插件没有设置时根据地址判断，无法判断时返回空字符串
+func (i *StreamUrlInfo) GetContainer() string {
+	switch {
+	case i.Container != "":
+		return i.Container
+	case strings.Contains(i.Url.Path, ".m3u8"):
+		return ContainerHLS
+	case strings.Contains(i.Url.Path, ".flv"):
+		return ContainerFLV
+	}
+	return ""
+}
+
+// QualityLister 由每个清晰度需要单独请求的平台实现（目前为B站与斗鱼），此时 GetStreamInfos 只返回一个清晰度；
+// 其它平台在 GetStreamInfos 中返回接口一次能获取到的全部线路，抖音等只返回一条没有画质信息的线路
+type QualityLister interface {
+	// GetAllStreamInfos 返回全部清晰度的线路，需要多次请求，只在线路选择策略需要其它清晰度时调用
+	GetAllStreamInfos() ([]*StreamUrlInfo, error)
+}
+
+// GetQualityLister 返回需要单独请求其它清晰度的直播间，平台不需要时返回 false
+func GetQualityLister(l Live) (QualityLister, bool) {
+	if w, ok := l.(*WrappedLive); ok {
+		l = w.Live
+	}
+	q, ok := l.(QualityLister)
+	return q, ok
+}
+
 type Live interface {
 	SetLiveIdByString(string)
 	GetLiveId() types.LiveID
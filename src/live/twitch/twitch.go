@@ -1,6 +1,7 @@
 package twitch
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -12,6 +13,8 @@ import (
 
 	"github.com/bililive-go/bililive-go/src/live"
 	"github.com/bililive-go/bililive-go/src/live/internal"
+	"github.com/bililive-go/bililive-go/src/pkg/parser/hls"
+	"github.com/bililive-go/bililive-go/src/pkg/utils"
 )
 
 const (
@@ -156,6 +159,33 @@ func (l *Live) GetStreamUrls() (us []*url.URL, err error) {
 	return []*url.URL{u}, nil
 }
 
+// GetStreamInfos 返回 master playlist 中的每个画质，获取失败时返回 master playlist，由解析器选择码率最高的画质
+func (l *Live) GetStreamInfos() ([]*live.StreamUrlInfo, error) {
+	urls, err := l.GetStreamUrls()
+	if err != nil {
+		return nil, err
+	}
+	if infos, err := l.fetchVariants(urls[0]); err == nil {
+		return infos, nil
+	}
+	return utils.GenUrlInfos(urls, make(map[string]string)), nil
+}
+
+func (l *Live) fetchVariants(master *url.URL) ([]*live.StreamUrlInfo, error) {
+	resp, err := l.RequestSession.Get(master.String(), live.CommonUserAgent)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	body, err := resp.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return hls.ParseVariants(master, bytes.NewReader(body))
+}
+
 func (l *Live) GetPlatformCNName() string {
 	return cnName
 }
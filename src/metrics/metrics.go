@@ -13,7 +13,10 @@ import (
 	"github.com/bililive-go/bililive-go/src/interfaces"
 	"github.com/bililive-go/bililive-go/src/listeners"
 	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/bandwidth"
 	"github.com/bililive-go/bililive-go/src/recorders"
+	"github.com/bililive-go/bililive-go/src/relay"
+	"github.com/bililive-go/bililive-go/src/storage"
 	"github.com/bililive-go/bililive-go/src/types"
 )
 
@@ -36,6 +39,59 @@ var (
 		[]string{"live_id", "live_url", "live_host_name", "live_room_name"},
 		nil,
 	)
+	storageFreeBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("bgo", "storage", "free_bytes"),
+		"free bytes of output path",
+		[]string{"path"},
+		nil,
+	)
+	storageTotalBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("bgo", "storage", "total_bytes"),
+		"total bytes of output path",
+		[]string{"path"},
+		nil,
+	)
+	storageState = prometheus.NewDesc(
+		prometheus.BuildFQName("bgo", "storage", "state"),
+		"storage state, 0: ok, 1: warning, 2: critical",
+		[]string{"path"},
+		nil,
+	)
+	relayUp = prometheus.NewDesc(
+		prometheus.BuildFQName("bgo", "relay", "up"),
+		"whether the relay is pushing",
+		[]string{"live_id", "relay_url"},
+		nil,
+	)
+	relaySentBytes = prometheus.NewDesc(
+		prometheus.BuildFQName("bgo", "relay", "sent_bytes"),
+		"bytes pushed by the relay in the current recording session",
+		[]string{"live_id", "relay_url"},
+		nil,
+	)
+	relayRetries = prometheus.NewDesc(
+		prometheus.BuildFQName("bgo", "relay", "retries"),
+		"push failures of the relay in the current recording session",
+		[]string{"live_id", "relay_url"},
+		nil,
+	)
+	bandwidthLimit = prometheus.NewDesc(
+		prometheus.BuildFQName("bgo", "bandwidth", "limit_bytes_per_second"),
+		"limit of the total download bandwidth, 0 for unlimited",
+		nil,
+		nil,
+	)
+	recorderDownloadRate = prometheus.NewDesc(
+		prometheus.BuildFQName("bgo", "recorder", "download_bytes_per_second"),
+		"recent download rate of the recorder, only available when the bandwidth is limited",
+		[]string{"live_id"},
+		nil,
+	)
+	storageStateValues = map[storage.State]float64{
+		storage.StateOk:       0,
+		storage.StateWarning:  1,
+		storage.StateCritical: 2,
+	}
 )
 
 type collector struct {
@@ -90,12 +146,53 @@ func (c collector) Collect(ch chan<- prometheus.Metric) {
 		}(id, l)
 	}
 	wg.Wait()
+
+	if sm, ok := c.inst.StorageMonitor.(storage.Monitor); ok {
+		if status := sm.Status(); status.Enable {
+			for _, d := range status.Disks {
+				ch <- prometheus.MustNewConstMetric(storageFreeBytes, prometheus.GaugeValue, float64(d.Free), d.Path)
+				ch <- prometheus.MustNewConstMetric(storageTotalBytes, prometheus.GaugeValue, float64(d.Total), d.Path)
+				ch <- prometheus.MustNewConstMetric(storageState, prometheus.GaugeValue, storageStateValues[d.State], d.Path)
+			}
+		}
+	}
+
+	if rl, ok := c.inst.Relay.(relay.Relay); ok {
+		for _, status := range rl.Status() {
+			id := string(status.LiveId)
+			ch <- prometheus.MustNewConstMetric(relayUp, prometheus.GaugeValue,
+				bool2float64(status.State == relay.StatePushing), id, status.Url)
+			ch <- prometheus.MustNewConstMetric(relaySentBytes, prometheus.GaugeValue, float64(status.BytesSent), id, status.Url)
+			ch <- prometheus.MustNewConstMetric(relayRetries, prometheus.GaugeValue, float64(status.Retries), id, status.Url)
+		}
+	}
+
+	if lim, ok := c.inst.Bandwidth.(*bandwidth.Limiter); ok && lim.Enabled() {
+		status := lim.Status()
+		ch <- prometheus.MustNewConstMetric(bandwidthLimit, prometheus.GaugeValue, float64(status.Limit))
+		// 交接时同一直播间可能有多个连接
+		rates := make(map[types.LiveID]int64)
+		for _, flow := range status.Flows {
+			rates[flow.LiveId] += flow.Rate
+		}
+		for id, rate := range rates {
+			ch <- prometheus.MustNewConstMetric(recorderDownloadRate, prometheus.GaugeValue, float64(rate), string(id))
+		}
+	}
 }
 
 func (collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- liveStatus
 	ch <- liveDurationSeconds
 	ch <- recorderTotalBytes
+	ch <- storageFreeBytes
+	ch <- storageTotalBytes
+	ch <- storageState
+	ch <- relayUp
+	ch <- relaySentBytes
+	ch <- relayRetries
+	ch <- bandwidthLimit
+	ch <- recorderDownloadRate
 }
 
 func (c *collector) Start(_ context.Context) error {
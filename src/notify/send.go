@@ -44,6 +44,30 @@ func SendNotification(ctx context.Context, hostName, platform, liveURL, status s
 	// 构造Telegram消息内容 (包含所有信息)
 	telegramMessage := fmt.Sprintf("主播：%s\n平台：%s\n直播地址：%s", hostInfo, platform, liveURL)
 
+	// 构造邮件主题和内容
+	emailSubject := fmt.Sprintf("%s - %s", hostInfo, platform)
+	emailBody := fmt.Sprintf("主播：%s\n平台：%s\n直播地址：%s", hostInfo, platform, liveURL)
+
+	send(cfg, logger, telegramMessage, emailSubject, emailBody)
+	return nil
+}
+
+// SendMessage 发送与直播状态无关的通知，如磁盘空间不足
+func SendMessage(ctx context.Context, subject, body string) error {
+	cfg := configs.GetCurrentConfig()
+	if cfg == nil {
+		return fmt.Errorf("configuration is nil")
+	}
+	var logger *instance.Instance
+	if ctx != nil {
+		logger = instance.GetInstance(ctx)
+	}
+	send(cfg, logger, subject+"\n"+body, subject, body)
+	return nil
+}
+
+// send 分别发送 Telegram 与 Email 通知，其中一个失败不影响另一个
+func send(cfg *configs.Config, logger *instance.Instance, telegramMessage, emailSubject, emailBody string) {
 	// 检查是否开启了Telegram通知服务
 	if cfg.Notify.Telegram.Enable {
 		// 发送Telegram通知
@@ -65,10 +89,6 @@ func SendNotification(ctx context.Context, hostName, platform, liveURL, status s
 		}
 	}
 
-	// 构造邮件主题和内容
-	emailSubject := fmt.Sprintf("%s - %s", hostInfo, platform)
-	emailBody := fmt.Sprintf("主播：%s\n平台：%s\n直播地址：%s", hostInfo, platform, liveURL)
-
 	// 检查是否开启了Email通知服务
 	if cfg.Notify.Email.Enable {
 		// 发送Email通知
@@ -82,8 +102,6 @@ func SendNotification(ctx context.Context, hostName, platform, liveURL, status s
 			}
 		}
 	}
-
-	return nil
 }
 
 // SendTestNotification 发送测试通知
@@ -0,0 +1,351 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+// for test
+var (
+	// 重新分配带宽的间隔
+	rebalanceInterval = time.Second
+	// 每个连接至少分配的速度（字节每秒），避免低优先级的连接完全停止
+	minRate = 16 << 10
+)
+
+// 每次读取的最大字节数，避免一次等待过久
+const maxReadSize = 32 << 10
+
+// FlowStatus 一个录制连接的下载速度，单位为字节每秒
+type FlowStatus struct {
+	LiveId   types.LiveID `json:"live_id"`
+	Priority int          `json:"priority"`
+	// Rate 最近一段时间的下载速度
+	Rate int64 `json:"rate"`
+	// Allocated 分配给该连接的速度上限
+	Allocated int64 `json:"allocated"`
+	// Throttled 最近一段时间是否因为限速而等待
+	Throttled bool  `json:"throttled"`
+	Total     int64 `json:"total"`
+}
+
+type Status struct {
+	// Limit 总下载带宽上限，0 为不限制
+	Limit int64        `json:"limit"`
+	Rate  int64        `json:"rate"`
+	Flows []FlowStatus `json:"flows"`
+}
+
+// Limiter 限制全部录制器的总下载带宽
+//
+// 每隔 rebalanceInterval 按最近的下载速度重新分配带宽：高优先级的连接先分配，
+// 同一优先级的连接平分剩余的带宽，受限速影响的连接可以获得比当前速度更多的带宽
+type Limiter struct {
+	limit int64
+
+	lock          sync.Mutex
+	flows         map[*Flow]struct{}
+	lastRebalance time.Time
+	proxy         *proxy
+}
+
+func NewLimiter(ctx context.Context) *Limiter {
+	inst := instance.GetInstance(ctx)
+	l := &Limiter{
+		limit: inst.Config.Limits.BandwidthLimit(),
+		flows: make(map[*Flow]struct{}),
+	}
+	inst.Bandwidth = l
+	return l
+}
+
+func (l *Limiter) Start(ctx context.Context) error {
+	return nil
+}
+
+func (l *Limiter) Close(ctx context.Context) {
+	l.lock.Lock()
+	p := l.proxy
+	l.proxy = nil
+	l.lock.Unlock()
+	if p != nil {
+		p.close()
+	}
+}
+
+// Enabled 返回是否设置了带宽上限
+func (l *Limiter) Enabled() bool {
+	return l.limit > 0
+}
+
+// NewFlow 为直播间的一个下载连接创建限速，使用结束后需要调用 Close
+func (l *Limiter) NewFlow(id types.LiveID, priority int) *Flow {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	f := &Flow{
+		l:        l,
+		id:       id,
+		priority: priority,
+		start:    now,
+		last:     now,
+		// 新的连接还没有下载速度，在下次分配前视为需要更多带宽
+		throttled: true,
+	}
+	l.flows[f] = struct{}{}
+	l.rebalance(now, true)
+	f.tokens = f.rate
+	return f
+}
+
+// Available 返回优先级不低于 priority 的其它直播间使用之外剩余的带宽，没有上限时返回 math.MaxInt64
+func (l *Limiter) Available(id types.LiveID, priority int) int64 {
+	if !l.Enabled() {
+		return math.MaxInt64
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	used := 0.0
+	for f := range l.flows {
+		if f.id != id && f.priority >= priority {
+			used += f.usage
+		}
+	}
+	return max(l.limit-int64(used), 0)
+}
+
+// HasCapacity 返回剩余的带宽是否足够再录制一个直播间，以正在录制的直播间的平均下载速度估计需要的带宽
+func (l *Limiter) HasCapacity(id types.LiveID, priority int) bool {
+	if !l.Enabled() {
+		return true
+	}
+	available := l.Available(id, priority)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var (
+		total float64
+		n     int
+	)
+	for f := range l.flows {
+		if f.id != id {
+			total += f.usage
+			n++
+		}
+	}
+	if n == 0 {
+		return available > 0
+	}
+	return float64(available) >= total/float64(n)
+}
+
+// Proxy 返回经过本地代理、按 f 限速的直播流地址，用于无法直接限速的 ffmpeg，
+// playlist 中的分片、子流、EXT-X-MAP 与 EXT-X-KEY 地址（包括其他服务器上的绝对地址）同样经过代理；使用结束后需要调用返回的 release
+func (l *Limiter) Proxy(u *url.URL, f *Flow) (*url.URL, func(), error) {
+	l.lock.Lock()
+	if l.proxy == nil {
+		p, err := newProxy()
+		if err != nil {
+			l.lock.Unlock()
+			return nil, nil, err
+		}
+		l.proxy = p
+	}
+	p := l.proxy
+	l.lock.Unlock()
+	return p.register(u, f)
+}
+
+func (l *Limiter) Status() Status {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	s := Status{Limit: l.limit, Flows: make([]FlowStatus, 0, len(l.flows))}
+	for f := range l.flows {
+		s.Rate += int64(f.usage)
+		s.Flows = append(s.Flows, FlowStatus{
+			LiveId:    f.id,
+			Priority:  f.priority,
+			Rate:      int64(f.usage),
+			Allocated: int64(f.rate),
+			Throttled: f.throttled,
+			Total:     f.total,
+		})
+	}
+	sort.Slice(s.Flows, func(i, j int) bool {
+		if s.Flows[i].Priority != s.Flows[j].Priority {
+			return s.Flows[i].Priority > s.Flows[j].Priority
+		}
+		return s.Flows[i].LiveId < s.Flows[j].LiveId
+	})
+	return s
+}
+
+// rebalance 需要在持有锁的情况下调用，force 为 false 时距上次分配不足 rebalanceInterval 则跳过
+func (l *Limiter) rebalance(now time.Time, force bool) {
+	elapsed := now.Sub(l.lastRebalance)
+	if !force && elapsed < rebalanceInterval {
+		return
+	}
+	if elapsed >= rebalanceInterval {
+		for f := range l.flows {
+			f.measure(now)
+		}
+		l.lastRebalance = now
+	}
+	if !l.Enabled() {
+		return
+	}
+	groups := make(map[int][]*Flow)
+	priorities := make([]int, 0)
+	for f := range l.flows {
+		if _, ok := groups[f.priority]; !ok {
+			priorities = append(priorities, f.priority)
+		}
+		groups[f.priority] = append(groups[f.priority], f)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+	remaining := float64(l.limit)
+	for _, p := range priorities {
+		remaining -= allocate(groups[p], remaining)
+	}
+	// 剩余的带宽平分给全部连接，方便下载速度上升
+	if remaining > 0 && len(l.flows) > 0 {
+		extra := remaining / float64(len(l.flows))
+		for f := range l.flows {
+			f.rate += extra
+		}
+	}
+	for f := range l.flows {
+		f.rate = max(f.rate, float64(minRate))
+	}
+}
+
+// allocate 按最大最小公平分配 capacity，返回分配出去的带宽
+func allocate(flows []*Flow, capacity float64) float64 {
+	sort.Slice(flows, func(i, j int) bool { return flows[i].demand() < flows[j].demand() })
+	total := 0.0
+	for i, f := range flows {
+		share := max(capacity-total, 0) / float64(len(flows)-i)
+		f.rate = min(f.demand(), share)
+		total += f.rate
+	}
+	return total
+}
+
+// Flow 一个下载连接的限速，实现了 parser.RateLimiter
+type Flow struct {
+	l        *Limiter
+	id       types.LiveID
+	priority int
+	start    time.Time
+
+	// 以下字段由 l.lock 保护
+	rate   float64
+	tokens float64
+	last   time.Time
+	read   int64
+	total  int64
+	usage  float64
+	// throttled 上个周期是否因为限速而等待，waited 为当前周期
+	throttled bool
+	waited    bool
+	closed    bool
+}
+
+// demand 估计连接需要的带宽，受限速影响的连接需要比当前速度更多的带宽
+func (f *Flow) demand() float64 {
+	if f.throttled {
+		if f.usage == 0 {
+			return math.MaxFloat64
+		}
+		return f.usage * 2
+	}
+	return f.usage*1.2 + float64(minRate)
+}
+
+// measure 需要在持有锁的情况下调用，统计上个周期的下载速度
+func (f *Flow) measure(now time.Time) {
+	since := f.l.lastRebalance
+	if f.start.After(since) {
+		since = f.start
+	}
+	if elapsed := now.Sub(since).Seconds(); elapsed > 0 {
+		f.usage = float64(f.read) / elapsed
+		f.throttled, f.waited = f.waited, false
+	}
+	f.read = 0
+}
+
+// WaitN 记录读取了 n 字节，超过分配的速度时等待
+func (f *Flow) WaitN(ctx context.Context, n int) error {
+	l := f.l
+	l.lock.Lock()
+	now := time.Now()
+	l.rebalance(now, false)
+	f.read += int64(n)
+	f.total += int64(n)
+	if !l.Enabled() || f.closed {
+		l.lock.Unlock()
+		return nil
+	}
+	// 令牌桶最多积攒一秒的流量
+	f.tokens = min(f.tokens+f.rate*now.Sub(f.last).Seconds(), f.rate)
+	f.last = now
+	f.tokens -= float64(n)
+	var wait time.Duration
+	if f.tokens < 0 {
+		f.waited = true
+		wait = time.Duration(-f.tokens / f.rate * float64(time.Second))
+	}
+	l.lock.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (f *Flow) LimitReader(ctx context.Context, r io.Reader) io.Reader {
+	return &limitedReader{ctx: ctx, r: r, f: f}
+}
+
+func (f *Flow) Close() {
+	l := f.l
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	f.closed = true
+	delete(l.flows, f)
+	l.rebalance(time.Now(), true)
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	f   *Flow
+}
+
+func (r *limitedReader) Read(b []byte) (int, error) {
+	if len(b) > maxReadSize {
+		b = b[:maxReadSize]
+	}
+	n, err := r.r.Read(b)
+	if n > 0 {
+		if waitErr := r.f.WaitN(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
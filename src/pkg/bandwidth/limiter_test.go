@@ -0,0 +1,180 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterRebalance(t *testing.T) {
+	l := &Limiter{limit: 1000000, flows: make(map[*Flow]struct{})}
+	high := l.NewFlow("high", 1)
+	a := l.NewFlow("a", 0)
+	b := l.NewFlow("b", 0)
+	set := func(f *Flow, usage float64, throttled bool) {
+		f.usage, f.throttled = usage, throttled
+	}
+
+	// 高优先级的连接先分配，同一优先级的连接平分剩余的带宽
+	set(high, 400000, true)
+	set(a, 300000, true)
+	set(b, 300000, true)
+	l.rebalance(l.lastRebalance, true)
+	assert.Equal(t, 800000.0, high.rate)
+	assert.Equal(t, 100000.0, a.rate)
+	assert.Equal(t, 100000.0, b.rate)
+	assert.Equal(t, int64(300000), l.Available("a", 0))
+	assert.Equal(t, int64(600000), l.Available("a", 1))
+	assert.False(t, l.HasCapacity("c", 0))
+	assert.True(t, l.HasCapacity("c", 1))
+
+	// 未受限速影响的连接只保留少量余量，剩余的带宽平分给全部连接
+	set(high, 200000, false)
+	l.rebalance(l.lastRebalance, true)
+	assert.InDelta(t, 256384.0, high.rate, 1)
+	assert.InDelta(t, 371808.0, a.rate, 1)
+
+	high.Close()
+	a.Close()
+	l.rebalance(l.lastRebalance, true)
+	assert.Equal(t, 1000000.0, b.rate)
+	assert.Len(t, l.Status().Flows, 1)
+}
+
+func TestFlowLimitReader(t *testing.T) {
+	l := &Limiter{limit: 64 << 10, flows: make(map[*Flow]struct{})}
+	f := l.NewFlow("test", 0)
+	defer f.Close()
+	start := time.Now()
+	n, err := io.Copy(io.Discard, f.LimitReader(context.Background(), bytes.NewReader(make([]byte, 96<<10))))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(96<<10), n)
+	// 令牌桶中有一秒的流量，超出的部分需要等待
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	assert.Equal(t, int64(96<<10), l.Status().Flows[0].Total)
+}
+
+func TestProxy(t *testing.T) {
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	l := &Limiter{limit: 1 << 20, flows: make(map[*Flow]struct{})}
+	defer l.Close(context.Background())
+	f := l.NewFlow("test", 0)
+	defer f.Close()
+	u, _ := url.Parse(srv.URL + "/live/index.m3u8?token=1")
+	proxied, release, err := l.Proxy(u, f)
+	assert.NoError(t, err)
+
+	get := func(u *url.URL) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+		req.Header.Set("Referer", "https://live.bilibili.com/1")
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			return 0, ""
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	code, body := get(proxied)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "/live/index.m3u8", body)
+	assert.Equal(t, "token=1", requests[0].URL.RawQuery)
+	assert.Equal(t, "https://live.bilibili.com/1", requests[0].Header.Get("Referer"))
+
+	// playlist 中的相对地址同样经过代理
+	seg, _ := url.Parse("seg1.ts?t=2")
+	_, body = get(proxied.ResolveReference(seg))
+	assert.Equal(t, "/live/seg1.ts", body)
+	assert.Equal(t, "t=2", requests[1].URL.RawQuery)
+
+	release()
+	code, _ = get(proxied)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestProxyPlaylist(t *testing.T) {
+	var cdnRequests atomic.Int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnRequests.Add(1)
+		w.Write(make([]byte, 1000))
+	}))
+	defer cdn.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		fmt.Fprintf(w, `#EXTM3U
+#EXT-X-TARGETDURATION:2
+#EXT-X-KEY:METHOD=AES-128,URI="%[1]s/key?k=1",IV=0x1
+#EXT-X-MAP:URI="%[1]s/init.mp4"
+#EXTINF:2.000,
+%[1]s/seg1.m4s?t=1
+#EXTINF:2.000,
+/live/seg2.m4s
+`, cdn.URL)
+	}))
+	defer origin.Close()
+
+	l := &Limiter{limit: 1 << 20, flows: make(map[*Flow]struct{})}
+	defer l.Close(context.Background())
+	f := l.NewFlow("test", 0)
+	defer f.Close()
+	u, _ := url.Parse(origin.URL + "/live/index.m3u8")
+	proxied, release, err := l.Proxy(u, f)
+	assert.NoError(t, err)
+
+	get := func(u string) string {
+		resp, err := http.Get(u)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+	playlist := get(proxied.String())
+	var uris []string
+	for _, line := range strings.Split(playlist, "\n") {
+		if m := uriAttr.FindStringSubmatch(line); m != nil {
+			uris = append(uris, m[1])
+		} else if line != "" && !strings.HasPrefix(line, "#") {
+			uris = append(uris, line)
+		}
+	}
+	// 分片、初始化分片与密钥都经过代理，其他服务器注册在同一组中
+	if assert.Len(t, uris, 4) {
+		for _, uri := range uris {
+			assert.True(t, strings.HasPrefix(uri, "http://"+proxied.Host+"/"), uri)
+			assert.NotContains(t, uri, cdn.Listener.Addr().String())
+		}
+		assert.True(t, strings.HasSuffix(uris[0], "/key?k=1"))
+		assert.True(t, strings.HasSuffix(uris[3], "/live/seg2.m4s"))
+		for _, uri := range uris[:3] {
+			assert.Len(t, get(uri), 1000)
+		}
+	}
+	assert.Equal(t, int32(3), cdnRequests.Load())
+	// 经过代理的流量都计入 Flow
+	assert.Greater(t, l.Status().Flows[0].Total, int64(3000))
+
+	release()
+	resp, err := http.Get(uris[0])
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,232 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 不转发的逐跳首部
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// proxy 只监听本机的 HTTP 代理，把 /{token}/{path} 转发到 token 对应的直播流服务器，读取时按 Flow 限速
+type proxy struct {
+	listener net.Listener
+	server   *http.Server
+	hc       *http.Client
+
+	lock   sync.Mutex
+	routes map[string]*route
+}
+
+type route struct {
+	upstream *url.URL
+	flow     *Flow
+	group    *routeGroup
+}
+
+// routeGroup 是一次 register 产生的全部 token，playlist 中其他服务器的地址注册在同一组中、按同一个 Flow 限速，一起释放
+type routeGroup struct {
+	// tokens 服务器（scheme://userinfo@host）对应的 token
+	tokens map[string]string
+	// released 之后改写的 playlist 不再注册新的服务器
+	released bool
+}
+
+var errReleased = errors.New("proxy route is released")
+
+// maxPlaylistSize 改写 playlist 时最多读取的大小
+const maxPlaylistSize = 8 << 20
+
+// uriAttr 匹配 EXT-X-MAP、EXT-X-KEY、EXT-X-MEDIA 等标签中的 URI 属性
+var uriAttr = regexp.MustCompile(`URI="([^"]*)"`)
+
+func newProxy() (*proxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &proxy{
+		listener: listener,
+		hc:       &http.Client{},
+		routes:   make(map[string]*route),
+	}
+	p.server = &http.Server{Handler: p}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+func (p *proxy) close() {
+	p.server.Close()
+}
+
+func (p *proxy) register(u *url.URL, f *Flow) (*url.URL, func(), error) {
+	group := &routeGroup{tokens: make(map[string]string)}
+	p.lock.Lock()
+	proxied, err := p.proxyURL(u, f, group)
+	p.lock.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		p.lock.Lock()
+		for _, token := range group.tokens {
+			delete(p.routes, token)
+		}
+		group.released = true
+		p.lock.Unlock()
+	}
+	return proxied, release, nil
+}
+
+// proxyURL 需要在持有锁的情况下调用，返回 u 经过代理的地址，u 所在的服务器没有注册时在 group 中注册
+func (p *proxy) proxyURL(u *url.URL, f *Flow, group *routeGroup) (*url.URL, error) {
+	origin := &url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host}
+	token, ok := group.tokens[origin.String()]
+	if !ok {
+		if group.released {
+			return nil, errReleased
+		}
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		token = hex.EncodeToString(b)
+		group.tokens[origin.String()] = token
+		p.routes[token] = &route{upstream: origin, flow: f, group: group}
+	}
+	proxied := *u
+	proxied.Scheme = "http"
+	proxied.Host = p.listener.Addr().String()
+	proxied.User = nil
+	proxied.Path, proxied.RawPath = "/"+token+u.Path, "/"+token+u.EscapedPath()
+	return &proxied, nil
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	p.lock.Lock()
+	rt, ok := p.routes[token]
+	p.lock.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	target := *rt.upstream
+	target.RawPath = "/" + rest
+	target.Path, _ = url.PathUnescape(target.RawPath)
+	target.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	// 由 http.Client 处理压缩，改写 playlist 时读取到的是原文
+	req.Header.Del("Accept-Encoding")
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	body := rt.flow.LimitReader(r.Context(), resp.Body)
+	if resp.StatusCode == http.StatusOK && isPlaylist(resp, &target) {
+		b, err := io.ReadAll(io.LimitReader(body, maxPlaylistSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if bytes.HasPrefix(bytes.TrimPrefix(b, []byte("\ufeff")), []byte("#EXTM3U")) {
+			b = p.rewritePlaylist(b, resp.Request.URL, rt)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.WriteHeader(resp.StatusCode)
+		w.Write(b)
+		return
+	}
+	w.WriteHeader(resp.StatusCode)
+	copyAndFlush(r.Context(), w, body)
+}
+
+func isPlaylist(resp *http.Response, target *url.URL) bool {
+	return strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "mpegurl") ||
+		strings.HasSuffix(strings.ToLower(target.Path), ".m3u8")
+}
+
+// rewritePlaylist 将 playlist 中的分片、子流、EXT-X-MAP、EXT-X-KEY 等地址改为经过代理的地址，
+// 其他服务器上的地址注册到同一个 Flow，避免分片绕过限速；base 为 playlist 重定向后的实际地址
+func (p *proxy) rewritePlaylist(b []byte, base *url.URL, rt *route) []byte {
+	proxy := func(ref string) string {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		u = base.ResolveReference(u)
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return ref
+		}
+		p.lock.Lock()
+		proxied, err := p.proxyURL(u, rt.flow, rt.group)
+		p.lock.Unlock()
+		if err != nil {
+			return ref
+		}
+		return proxied.String()
+	}
+	lines := strings.Split(string(b), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			lines[i] = uriAttr.ReplaceAllStringFunc(line, func(m string) string {
+				return `URI="` + proxy(uriAttr.FindStringSubmatch(m)[1]) + `"`
+			})
+		default:
+			lines[i] = proxy(trimmed)
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// copyAndFlush 写入后立即发送，避免直播流停留在缓冲区中
+func copyAndFlush(ctx context.Context, w http.ResponseWriter, r io.Reader) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, maxReadSize)
+	for ctx.Err() == nil {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package danmaku
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ASSOptions 弹幕转换为 ASS 字幕的选项，为零值的字段使用默认值
+type ASSOptions struct {
+	// 字幕的分辨率，应与视频一致，默认为 1920x1080
+	Width, Height int
+	FontName      string
+	// FontSize 标准字号弹幕的像素大小，默认为高度的 1/28
+	FontSize int
+	// Opacity 不透明度，0 ~ 1，默认为 0.8
+	Opacity float64
+	// 滚动弹幕从右侧进入到完全离开的时间，默认为 12 秒；顶部、底部弹幕的显示时间，默认为 5 秒
+	ScrollDuration time.Duration
+	FixedDuration  time.Duration
+	// ScrollArea 滚动弹幕占屏幕高度的比例，0 ~ 1，默认为 1
+	ScrollArea float64
+	// Density 同屏最多显示的弹幕数量，0 为不限制
+	Density int
+	// Blocklist 包含其中任意关键词的弹幕不显示
+	Blocklist []string
+}
+
+func (o ASSOptions) withDefaults() ASSOptions {
+	if o.Width <= 0 || o.Height <= 0 {
+		o.Width, o.Height = 1920, 1080
+	}
+	if o.FontName == "" {
+		o.FontName = "Microsoft YaHei"
+	}
+	if o.FontSize <= 0 {
+		o.FontSize = o.Height / 28
+	}
+	if o.Opacity <= 0 || o.Opacity > 1 {
+		o.Opacity = 0.8
+	}
+	if o.ScrollDuration <= 0 {
+		o.ScrollDuration = 12 * time.Second
+	}
+	if o.FixedDuration <= 0 {
+		o.FixedDuration = 5 * time.Second
+	}
+	if o.ScrollArea <= 0 || o.ScrollArea > 1 {
+		o.ScrollArea = 1
+	}
+	return o
+}
+
+// 弹幕的显示位置
+const (
+	laneScroll = iota
+	laneTop
+	laneBottom
+)
+
+// lane 记录一行中最后一条弹幕，用于判断新弹幕是否会与其重叠
+type lane struct {
+	used  bool
+	start time.Duration
+	width float64
+	speed float64
+	end   time.Duration
+}
+
+// assLayout 为弹幕分配行，没有空闲的行时丢弃弹幕
+type assLayout struct {
+	opts   ASSOptions
+	height float64
+	lanes  [3][]lane
+	// ends 正在显示的弹幕的结束时间，用于限制同屏数量
+	ends []time.Duration
+}
+
+func newASSLayout(opts ASSOptions) *assLayout {
+	l := &assLayout{opts: opts, height: float64(opts.FontSize)}
+	all := int(float64(opts.Height) / l.height)
+	scroll := int(float64(opts.Height) * opts.ScrollArea / l.height)
+	l.lanes[laneScroll] = make([]lane, max(scroll, 1))
+	l.lanes[laneTop] = make([]lane, max(all, 1))
+	l.lanes[laneBottom] = make([]lane, max(all, 1))
+	return l
+}
+
+// textWidth 估算文本宽度，半角字符按半个字宽计算
+func textWidth(s string, size float64) float64 {
+	var w float64
+	for _, r := range s {
+		if r < 0x80 {
+			w += size / 2
+		} else {
+			w += size
+		}
+	}
+	return w
+}
+
+// free 判断新弹幕放在行中是否会与行中最后一条弹幕重叠
+func (l *assLayout) free(kind int, ln *lane, start time.Duration, width, speed float64) bool {
+	if !ln.used {
+		return true
+	}
+	if kind != laneScroll {
+		return ln.end <= start
+	}
+	// 前一条弹幕的尾部已经完全进入屏幕
+	if (start-ln.start).Seconds()*ln.speed < ln.width {
+		return false
+	}
+	// 新弹幕的头部到达左侧时前一条弹幕已经完全离开
+	return start+time.Duration(float64(l.opts.Width)/speed*float64(time.Second)) >= ln.end
+}
+
+// place 返回弹幕所在的行，-1 表示应丢弃
+func (l *assLayout) place(kind int, start, end time.Duration, width, speed float64) int {
+	if l.opts.Density > 0 {
+		ends := l.ends[:0]
+		for _, e := range l.ends {
+			if e > start {
+				ends = append(ends, e)
+			}
+		}
+		if l.ends = ends; len(l.ends) >= l.opts.Density {
+			return -1
+		}
+	}
+	for i := range l.lanes[kind] {
+		ln := &l.lanes[kind][i]
+		if l.free(kind, ln, start, width, speed) {
+			*ln = lane{used: true, start: start, width: width, speed: speed, end: end}
+			l.ends = append(l.ends, end)
+			return i
+		}
+	}
+	return -1
+}
+
+func assTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// assText 替换会被解析为样式标签与换行的字符
+var assText = strings.NewReplacer(`\`, `＼`, "{", "｛", "}", "｝", "\r", " ", "\n", " ")
+
+func blocked(content string, blocklist []string) bool {
+	for _, keyword := range blocklist {
+		if keyword != "" && strings.Contains(content, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteASS 将弹幕排版为 ASS 字幕，只包含普通弹幕，返回写入的弹幕数量
+func WriteASS(w io.Writer, items []Item, opts ASSOptions) (int, error) {
+	opts = opts.withDefaults()
+	alpha := int(math.Round((1 - opts.Opacity) * 255))
+	outline := max(opts.FontSize/25, 1)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "[Script Info]\nScriptType: v4.00+\nCollisions: Normal\nPlayResX: %d\nPlayResY: %d\nWrapStyle: 2\nScaledBorderAndShadow: yes\n\n", opts.Width, opts.Height)
+	bw.WriteString("[V4+ Styles]\nFormat: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	fmt.Fprintf(bw, "Style: Danmaku,%s,%d,&H%02XFFFFFF,&H%02XFFFFFF,&H%02X000000,&H%02X000000,0,0,0,0,100,100,0,0,1,%d,0,7,0,0,0,1\n\n",
+		opts.FontName, opts.FontSize, alpha, alpha, alpha, alpha, outline)
+	bw.WriteString("[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+
+	sorted := make([]Item, 0, len(items))
+	for _, item := range items {
+		if item.Message != nil && item.Message.Type == TypeDanmaku && item.Message.Content != "" {
+			sorted = append(sorted, item)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	layout := newASSLayout(opts)
+	count := 0
+	for _, item := range sorted {
+		m := item.Message
+		if blocked(m.Content, opts.Blocklist) {
+			continue
+		}
+		kind := laneScroll
+		switch m.Mode {
+		case 0, 1, 2, 3, 6:
+		case 4:
+			kind = laneBottom
+		case 5:
+			kind = laneTop
+		default:
+			// 高级弹幕等无法排版的类型
+			continue
+		}
+		size := float64(opts.FontSize)
+		if m.FontSize > 0 && m.FontSize != 25 {
+			size = math.Round(size * float64(m.FontSize) / 25)
+		}
+		text := assText.Replace(m.Content)
+		width := textWidth(text, size)
+		start, duration := item.Offset, opts.FixedDuration
+		if kind == laneScroll {
+			duration = opts.ScrollDuration
+		}
+		end := start + duration
+		speed := (float64(opts.Width) + width) / duration.Seconds()
+		i := layout.place(kind, start, end, width, speed)
+		if i < 0 {
+			continue
+		}
+
+		var tags strings.Builder
+		y := float64(i) * layout.height
+		switch kind {
+		case laneScroll:
+			fmt.Fprintf(&tags, `\move(%d,%d,%d,%d)`, opts.Width, int(y), -int(math.Ceil(width)), int(y))
+		case laneTop:
+			fmt.Fprintf(&tags, `\an8\pos(%d,%d)`, opts.Width/2, int(y))
+		case laneBottom:
+			fmt.Fprintf(&tags, `\an2\pos(%d,%d)`, opts.Width/2, opts.Height-int(y))
+		}
+		if int(size) != opts.FontSize {
+			fmt.Fprintf(&tags, `\fs%d`, int(size))
+		}
+		if c := m.Color; c != 0 && c != 0xffffff {
+			// ASS 的颜色顺序为 BGR
+			fmt.Fprintf(&tags, `\c&H%02X%02X%02X&`, c&0xff, c>>8&0xff, c>>16&0xff)
+		}
+		fmt.Fprintf(bw, "Dialogue: 0,%s,%s,Danmaku,,0,0,0,,{%s}%s\n", assTime(start), assTime(end), tags.String(), text)
+		count++
+	}
+	return count, bw.Flush()
+}
+
+// ConvertToASS 读取弹幕文件并写入 ASS 字幕，先写入临时文件，成功后再重命名
+func ConvertToASS(input, output string, opts ASSOptions) (int, error) {
+	items, err := ReadFile(input)
+	if err != nil {
+		return 0, err
+	}
+	tmp := output + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	count, err := WriteASS(f, items, opts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return count, os.Rename(tmp, output)
+}
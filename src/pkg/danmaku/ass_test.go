@@ -0,0 +1,113 @@
+package danmaku
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.Local)
+	msgs := []*Message{
+		{Type: TypeDanmaku, Time: start.Add(1500 * time.Millisecond), UserId: "1", UserName: "a", Content: "<弹幕>", Mode: 5, FontSize: 25, Color: 0xff0000},
+		{Type: TypeGift, Time: start.Add(2 * time.Second), UserId: "2", UserName: "b", GiftName: "小心心", Count: 2},
+		{Type: TypeSuperChat, Time: start.Add(3 * time.Second), UserId: "3", UserName: "c", Content: "SC", Price: 30, Duration: 60},
+		{Type: TypeGuard, Time: start.Add(4 * time.Second), UserId: "4", UserName: "d", GuardLevel: 3, Count: 1},
+	}
+	for _, format := range formats {
+		file := filepath.Join(dir, "a."+format)
+		w, err := NewWriter(format, file, start, RecordInfo{})
+		assert.NoError(t, err)
+		for _, m := range msgs {
+			assert.NoError(t, w.Write(m))
+		}
+		// 不关闭文件，模拟录制中断
+		items, err := ReadFile(file)
+		assert.NoError(t, err, format)
+		if !assert.Len(t, items, len(msgs), format) {
+			continue
+		}
+		assert.Equal(t, []time.Duration{1500 * time.Millisecond, 2 * time.Second, 3 * time.Second, 4 * time.Second},
+			[]time.Duration{items[0].Offset, items[1].Offset, items[2].Offset, items[3].Offset}, format)
+		for i, item := range items {
+			// xml 中没有弹幕以外消息的发送时间
+			expected := *msgs[i]
+			item.Message.Time, expected.Time = time.Time{}, time.Time{}
+			assert.Equal(t, &expected, item.Message, format)
+		}
+		w.Close()
+	}
+	_, err := ReadFile(filepath.Join(dir, "a.txt"))
+	assert.Error(t, err)
+}
+
+func TestWriteASS(t *testing.T) {
+	at := func(ms int, content string, mode int) Item {
+		return Item{Offset: time.Duration(ms) * time.Millisecond, Message: &Message{Type: TypeDanmaku, Content: content, Mode: mode}}
+	}
+	items := []Item{
+		at(1000, "second", 1),
+		at(0, "first", 1),
+		at(0, "top", 5),
+		at(0, "bottom", 4),
+		at(100, "广告{\\b1}", 1),
+		{Offset: 0, Message: &Message{Type: TypeGift, GiftName: "gift"}},
+		at(200, "advanced", 7),
+		at(2000, strings.Repeat("x", 40), 1),
+		{Offset: 300 * time.Millisecond, Message: &Message{Type: TypeDanmaku, Content: "red", Color: 0xff0000, FontSize: 50}},
+	}
+	var b strings.Builder
+	count, err := WriteASS(&b, items, ASSOptions{Width: 1280, Height: 720, FontSize: 36, Opacity: 0.5, Blocklist: []string{"广告"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, count)
+	s := b.String()
+	assert.Contains(t, s, "PlayResX: 1280\nPlayResY: 720\n")
+	assert.Contains(t, s, "Style: Danmaku,Microsoft YaHei,36,&H80FFFFFF,")
+	assert.Contains(t, s, `Dialogue: 0,0:00:00.00,0:00:12.00,Danmaku,,0,0,0,,{\move(1280,0,-90,0)}first`)
+	assert.Contains(t, s, `Dialogue: 0,0:00:00.00,0:00:05.00,Danmaku,,0,0,0,,{\an8\pos(640,0)}top`)
+	assert.Contains(t, s, `Dialogue: 0,0:00:00.00,0:00:05.00,Danmaku,,0,0,0,,{\an2\pos(640,720)}bottom`)
+	// 第一条弹幕还没有完全进入屏幕，放到下一行
+	assert.Contains(t, s, `{\move(1280,36,-108,36)\fs72\c&H0000FF&}red`)
+	// 不会追上第一条弹幕，放在同一行
+	assert.Contains(t, s, `Dialogue: 0,0:00:01.00,0:00:13.00,Danmaku,,0,0,0,,{\move(1280,0,-108,0)}second`)
+	// 较长的弹幕速度更快，会追上前面的弹幕
+	assert.Contains(t, s, `{\move(1280,72,-720,72)}`+strings.Repeat("x", 40))
+	assert.NotContains(t, s, "广告")
+	assert.NotContains(t, s, "advanced")
+	assert.Less(t, strings.Index(s, "first"), strings.Index(s, "second"))
+
+	// 同屏数量限制
+	b.Reset()
+	count, err = WriteASS(&b, items, ASSOptions{Density: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// 没有空闲的行时丢弃
+	items = nil
+	for i := 0; i < 5; i++ {
+		items = append(items, at(0, strings.Repeat("a", 10), 1))
+	}
+	b.Reset()
+	count, err = WriteASS(&b, items, ASSOptions{Width: 100, Height: 100, FontSize: 25, ScrollArea: 0.5})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestConvertToASS(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.xml")
+	assert.NoError(t, os.WriteFile(input, []byte(`<?xml version="1.0" encoding="utf-8"?><i><d p="1.000,1,25,16777215,0,0,1,0" user="a" uid="1">hello</d></i>`), 0644))
+	output := filepath.Join(dir, "a.ass")
+	count, err := ConvertToASS(input, output, ASSOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	b, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "}hello\n")
+	assert.NoFileExists(t, output+".tmp")
+}
@@ -0,0 +1,62 @@
+package danmaku
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// TypeRecordInfo 是 jsonl 文件第一行的类型
+const TypeRecordInfo MessageType = "record_info"
+
+type jsonlHeader struct {
+	Type MessageType `json:"type"`
+	RecordInfo
+	StartTime time.Time `json:"start_time"`
+}
+
+// jsonlLine 在消息中加入相对视频开始时间的秒数
+type jsonlLine struct {
+	Ts float64 `json:"ts"`
+	*Message
+}
+
+// JSONLWriter 每行写入一条 json 格式的消息，第一行为录制信息
+type JSONLWriter struct {
+	lock  sync.Mutex
+	f     *os.File
+	enc   *json.Encoder
+	start time.Time
+}
+
+func NewJSONLWriter(file string, start time.Time, info RecordInfo) (*JSONLWriter, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	w := &JSONLWriter{f: f, enc: json.NewEncoder(f), start: start}
+	w.enc.SetEscapeHTML(false)
+	if err := w.enc.Encode(jsonlHeader{Type: TypeRecordInfo, RecordInfo: info, StartTime: start}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write 写入一条消息，早于 start 的消息时间记为 0
+func (w *JSONLWriter) Write(m *Message) error {
+	ts := m.Time.Sub(w.start).Seconds()
+	if ts < 0 {
+		ts = 0
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.enc.Encode(jsonlLine{Ts: float64(int64(ts*1000)) / 1000, Message: m})
+}
+
+func (w *JSONLWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.f.Close()
+}
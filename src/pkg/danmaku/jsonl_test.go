@@ -0,0 +1,46 @@
+package danmaku
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestJSONLWriter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.jsonl")
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	w, err := NewWriter(FormatJSONL, file, start, RecordInfo{RoomId: "1", HostName: "主播", RoomName: "<标题>"})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(&Message{Type: TypeDanmaku, Time: start.Add(-time.Second), UserId: "1", UserName: "a", Content: "早"}))
+	assert.NoError(t, w.Write(&Message{Type: TypeGift, Time: start.Add(1500 * time.Millisecond), UserId: "2", UserName: "b", GiftName: "小心心", Count: 2}))
+	assert.NoError(t, w.Close())
+
+	f, err := os.Open(file)
+	assert.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	for s := bufio.NewScanner(f); s.Scan(); {
+		lines = append(lines, s.Text())
+	}
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "record_info", gjson.Get(lines[0], "type").String())
+	assert.Equal(t, "<标题>", gjson.Get(lines[0], "room_name").String())
+	assert.Equal(t, start.Unix(), gjson.Get(lines[0], "start_time").Time().Unix())
+	assert.Equal(t, 0.0, gjson.Get(lines[1], "ts").Float())
+	assert.Equal(t, "早", gjson.Get(lines[1], "content").String())
+	assert.Equal(t, 1.5, gjson.Get(lines[2], "ts").Float())
+	assert.Equal(t, "gift", gjson.Get(lines[2], "type").String())
+	assert.Equal(t, int64(2), gjson.Get(lines[2], "count").Int())
+}
+
+func TestFiles(t *testing.T) {
+	assert.Equal(t, []string{"/a/b.xml", "/a/b.jsonl"}, Files("/a/b.flv"))
+	assert.Equal(t, []string{"/a/b.jsonl"}, Files("/a/b.xml"))
+	_, err := NewWriter("ass", filepath.Join(t.TempDir(), "a.ass"), time.Now(), RecordInfo{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package danmaku
+
+import "time"
+
+// MessageType 弹幕消息的类型
+type MessageType string
+
+const (
+	// TypeDanmaku 普通弹幕
+	TypeDanmaku MessageType = "danmaku"
+	// TypeGift 礼物
+	TypeGift MessageType = "gift"
+	// TypeSuperChat 醒目留言
+	TypeSuperChat MessageType = "superchat"
+	// TypeGuard 上舰（开通大航海）
+	TypeGuard MessageType = "guard"
+)
+
+// Message 是各平台弹幕消息的统一格式，不同类型使用不同的字段
+type Message struct {
+	Type     MessageType `json:"type"`
+	Time     time.Time   `json:"time"`
+	UserId   string      `json:"uid,omitempty"`
+	UserName string      `json:"user,omitempty"`
+	// Content 弹幕或醒目留言的内容
+	Content string `json:"content,omitempty"`
+
+	// 弹幕的显示方式，与 bilibili 相同：mode 1 滚动、4 底部、5 顶部，color 为 RGB 整数
+	Mode     int `json:"mode,omitempty"`
+	FontSize int `json:"font_size,omitempty"`
+	Color    int `json:"color,omitempty"`
+
+	// 礼物、上舰的名称与数量
+	GiftName string `json:"gift_name,omitempty"`
+	Count    int    `json:"count,omitempty"`
+	// Price 总价值（元）
+	Price float64 `json:"price,omitempty"`
+	// Duration 醒目留言的显示时长（秒）
+	Duration int `json:"duration,omitempty"`
+	// GuardLevel 大航海等级：1 总督、2 提督、3 舰长
+	GuardLevel int `json:"guard_level,omitempty"`
+}
@@ -0,0 +1,137 @@
+package danmaku
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Item 是从弹幕文件读取的一条消息，Offset 为相对视频开始的时间
+type Item struct {
+	Offset  time.Duration
+	Message *Message
+}
+
+// ReadFile 按扩展名读取 xml 或 jsonl 格式的弹幕文件
+func ReadFile(file string) ([]Item, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".") {
+	case FormatXML:
+		return ReadXML(f)
+	case FormatJSONL:
+		return ReadJSONL(f)
+	default:
+		return nil, fmt.Errorf("unknown danmaku file %s", file)
+	}
+}
+
+func parseOffset(s string) time.Duration {
+	ts, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(ts * float64(time.Second))
+}
+
+// ReadXML 读取 BililiveRecorder 格式的弹幕，录制中断导致的不完整文件只读取已写入的部分
+func ReadXML(r io.Reader) ([]Item, error) {
+	var (
+		items []Item
+		dec   = xml.NewDecoder(r)
+	)
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return items, nil
+		}
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) && syntaxErr.Msg == "unexpected EOF" {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var e struct {
+			P         string  `xml:"p,attr"`
+			Ts        string  `xml:"ts,attr"`
+			User      string  `xml:"user,attr"`
+			Uid       string  `xml:"uid,attr"`
+			GiftName  string  `xml:"giftname,attr"`
+			GiftCount int     `xml:"giftcount,attr"`
+			Price     float64 `xml:"price,attr"`
+			Time      int     `xml:"time,attr"`
+			Level     int     `xml:"level,attr"`
+			Count     int     `xml:"count,attr"`
+			Text      string  `xml:",chardata"`
+		}
+		switch start.Name.Local {
+		case "d", "gift", "sc", "guard":
+		default:
+			continue
+		}
+		if err := dec.DecodeElement(&e, &start); err != nil {
+			if errors.As(err, &syntaxErr) && syntaxErr.Msg == "unexpected EOF" {
+				return items, nil
+			}
+			return nil, err
+		}
+		m := &Message{UserId: e.Uid, UserName: e.User}
+		item := Item{Offset: parseOffset(e.Ts), Message: m}
+		switch start.Name.Local {
+		case "d":
+			// p: 时间,模式,字号,颜色,发送时间(毫秒),...
+			p := strings.Split(e.P, ",")
+			if len(p) < 4 {
+				continue
+			}
+			item.Offset = parseOffset(p[0])
+			m.Type, m.Content = TypeDanmaku, e.Text
+			m.Mode, _ = strconv.Atoi(p[1])
+			m.FontSize, _ = strconv.Atoi(p[2])
+			m.Color, _ = strconv.Atoi(p[3])
+			if len(p) > 4 {
+				if ms, err := strconv.ParseInt(p[4], 10, 64); err == nil {
+					m.Time = time.UnixMilli(ms)
+				}
+			}
+		case "gift":
+			m.Type, m.GiftName, m.Count = TypeGift, e.GiftName, e.GiftCount
+		case "sc":
+			m.Type, m.Content, m.Price, m.Duration = TypeSuperChat, e.Text, e.Price, e.Time
+		case "guard":
+			m.Type, m.GuardLevel, m.Count = TypeGuard, e.Level, e.Count
+		}
+		items = append(items, item)
+	}
+}
+
+// ReadJSONL 读取 JSONLWriter 写入的弹幕，跳过第一行的录制信息与无法解析的行
+func ReadJSONL(r io.Reader) ([]Item, error) {
+	var items []Item
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for s.Scan() {
+		line := jsonlLine{Message: new(Message)}
+		if err := json.Unmarshal(s.Bytes(), &line); err != nil || line.Type == TypeRecordInfo {
+			continue
+		}
+		items = append(items, Item{
+			Offset:  time.Duration(line.Ts * float64(time.Second)),
+			Message: line.Message,
+		})
+	}
+	return items, s.Err()
+}
@@ -0,0 +1,76 @@
+package danmaku
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 弹幕文件的格式，同时也是文件的扩展名
+const (
+	FormatXML   = "xml"
+	FormatJSONL = "jsonl"
+)
+
+var formats = []string{FormatXML, FormatJSONL}
+
+// RecordInfo 写入弹幕文件头部的录制信息
+type RecordInfo struct {
+	RoomId   string `json:"room_id"`
+	HostName string `json:"host_name"`
+	RoomName string `json:"room_name"`
+	Version  string `json:"version"`
+}
+
+// Writer 写入一个视频文件对应的弹幕，消息的时间记为相对视频开始时间的秒数
+type Writer interface {
+	Write(m *Message) error
+	Close() error
+}
+
+// File 返回视频文件对应的弹幕文件
+func File(video, format string) string {
+	return strings.TrimSuffix(video, filepath.Ext(video)) + "." + format
+}
+
+// Files 返回视频文件可能对应的所有格式的弹幕文件
+func Files(video string) []string {
+	files := make([]string, 0, len(formats))
+	for _, format := range formats {
+		if file := File(video, format); file != video {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// ValidFormat 返回 format 是否是支持的格式
+func ValidFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWriter 按格式创建弹幕文件，format 为空时使用 xml
+func NewWriter(format, file string, start time.Time, info RecordInfo) (Writer, error) {
+	var (
+		w   Writer
+		err error
+	)
+	switch format {
+	case FormatXML, "":
+		w, err = NewXMLWriter(file, start, info)
+	case FormatJSONL:
+		w, err = NewJSONLWriter(file, start, info)
+	default:
+		return nil, fmt.Errorf("unknown danmaku format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
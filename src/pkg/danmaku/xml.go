@@ -0,0 +1,105 @@
+package danmaku
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const xmlHeader = `<?xml version="1.0" encoding="utf-8"?>
+<i>
+<chatserver>chat.bilibili.com</chatserver>
+<chatid>0</chatid>
+<mission>0</mission>
+<maxlimit>1000</maxlimit>
+<state>0</state>
+<real_name>0</real_name>
+<source>0</source>
+`
+
+// XMLWriter 按 BililiveRecorder 的格式写入弹幕，时间为相对 start 的秒数。
+// 每条消息写入后立即刷新，程序异常退出时只缺少结尾的 </i>
+type XMLWriter struct {
+	lock  sync.Mutex
+	f     *os.File
+	w     *bufio.Writer
+	start time.Time
+}
+
+func NewXMLWriter(file string, start time.Time, info RecordInfo) (*XMLWriter, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	w := &XMLWriter{f: f, w: bufio.NewWriter(f), start: start}
+	w.w.WriteString(xmlHeader)
+	fmt.Fprintf(w.w, `<BililiveRecorder version="%s" />`+"\n", escape(info.Version))
+	fmt.Fprintf(w.w, `<BililiveRecorderRecordInfo roomid="%s" shortid="0" name="%s" title="%s" areanameparent="" areanamechild="" start_time="%s" />`+"\n",
+		escape(info.RoomId), escape(info.HostName), escape(info.RoomName), start.Format(time.RFC3339Nano))
+	if err := w.w.Flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// escape 转义属性值与文本，XML 不允许的控制字符替换为 U+FFFD
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Write 写入一条消息，早于 start 的消息时间记为 0
+func (w *XMLWriter) Write(m *Message) error {
+	ts := m.Time.Sub(w.start).Seconds()
+	if ts < 0 {
+		ts = 0
+	}
+	user, uid := escape(m.UserName), escape(m.UserId)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	switch m.Type {
+	case TypeDanmaku:
+		mode, size, color := m.Mode, m.FontSize, m.Color
+		if mode == 0 {
+			mode = 1
+		}
+		if size == 0 {
+			size = 25
+		}
+		if color == 0 {
+			color = 0xffffff
+		}
+		fmt.Fprintf(w.w, `<d p="%.3f,%d,%d,%d,%d,0,%s,0" user="%s" uid="%s">%s</d>`+"\n",
+			ts, mode, size, color, m.Time.UnixMilli(), uid, user, uid, escape(m.Content))
+	case TypeGift:
+		fmt.Fprintf(w.w, `<gift ts="%.3f" user="%s" uid="%s" giftname="%s" giftcount="%d" />`+"\n",
+			ts, user, uid, escape(m.GiftName), m.Count)
+	case TypeSuperChat:
+		fmt.Fprintf(w.w, `<sc ts="%.3f" user="%s" uid="%s" price="%g" time="%d">%s</sc>`+"\n",
+			ts, user, uid, m.Price, m.Duration, escape(m.Content))
+	case TypeGuard:
+		fmt.Fprintf(w.w, `<guard ts="%.3f" user="%s" uid="%s" level="%d" count="%d" />`+"\n",
+			ts, user, uid, m.GuardLevel, m.Count)
+	default:
+		return nil
+	}
+	return w.w.Flush()
+}
+
+// Close 写入结尾并关闭文件
+func (w *XMLWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.w.WriteString("</i>\n")
+	err := w.w.Flush()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package danmaku
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXMLWriter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.xml")
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	w, err := NewXMLWriter(file, start, RecordInfo{RoomId: "1", HostName: "主播", RoomName: `标题 "<>&"`})
+	assert.NoError(t, err)
+	msgs := []*Message{
+		{Type: TypeDanmaku, Time: start.Add(-time.Second), UserId: "1", UserName: "a", Content: "早"},
+		{Type: TypeDanmaku, Time: start.Add(1500 * time.Millisecond), UserId: "2", UserName: "b", Content: "<233>\x01", Mode: 5, FontSize: 25, Color: 0xff0000},
+		{Type: TypeGift, Time: start.Add(2 * time.Second), UserId: "3", UserName: "c", GiftName: "小心心", Count: 2},
+		{Type: TypeSuperChat, Time: start.Add(3 * time.Second), UserId: "4", UserName: "d", Content: "SC", Price: 30, Duration: 60},
+		{Type: TypeGuard, Time: start.Add(4 * time.Second), UserId: "5", UserName: "e", GuardLevel: 3, Count: 1},
+	}
+	for _, m := range msgs {
+		assert.NoError(t, w.Write(m))
+	}
+	assert.NoError(t, w.Close())
+
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	var result struct {
+		RecordInfo struct {
+			Title string `xml:"title,attr"`
+		} `xml:"BililiveRecorderRecordInfo"`
+		D []struct {
+			P    string `xml:"p,attr"`
+			User string `xml:"user,attr"`
+			Text string `xml:",chardata"`
+		} `xml:"d"`
+		Gift []struct {
+			Ts        string `xml:"ts,attr"`
+			GiftName  string `xml:"giftname,attr"`
+			GiftCount string `xml:"giftcount,attr"`
+		} `xml:"gift"`
+		SC []struct {
+			Price string `xml:"price,attr"`
+			Time  string `xml:"time,attr"`
+			Text  string `xml:",chardata"`
+		} `xml:"sc"`
+		Guard []struct {
+			Level string `xml:"level,attr"`
+		} `xml:"guard"`
+	}
+	assert.NoError(t, xml.Unmarshal(b, &result))
+	assert.Equal(t, `标题 "<>&"`, result.RecordInfo.Title)
+	assert.Len(t, result.D, 2)
+	assert.Equal(t, "0.000,1,25,16777215,1704110399000,0,1,0", result.D[0].P)
+	assert.Equal(t, "1.500,5,25,16711680,1704110401500,0,2,0", result.D[1].P)
+	assert.Equal(t, "<233>�", result.D[1].Text)
+	assert.Equal(t, "2.000", result.Gift[0].Ts)
+	assert.Equal(t, "小心心", result.Gift[0].GiftName)
+	assert.Equal(t, "2", result.Gift[0].GiftCount)
+	assert.Equal(t, "30", result.SC[0].Price)
+	assert.Equal(t, "60", result.SC[0].Time)
+	assert.Equal(t, "SC", result.SC[0].Text)
+	assert.Equal(t, "3", result.Guard[0].Level)
+}
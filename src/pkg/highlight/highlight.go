@@ -0,0 +1,201 @@
+// Package highlight 根据弹幕、礼物与醒目留言的密度计算直播的活跃度曲线并找出高能片段
+package highlight
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+// Options 活跃度的计算方式与高能片段的选取规则，为零值的字段使用默认值
+type Options struct {
+	// Interval 活跃度曲线中每个点统计的时长，默认为 10 秒
+	Interval time.Duration
+	// TopN 最多选取的片段数量，默认为 5
+	TopN int
+	// 片段在峰值前后保留的时长，默认分别为 40 秒、20 秒
+	Before, After time.Duration
+	// MinRatio 峰值至少为有消息的时间段平均分数的倍数，默认为 2
+	MinRatio float64
+	// Keywords 弹幕包含关键词时额外增加的分数，如 {"233": 1, "草": 1}
+	Keywords map[string]float64
+	// 每条礼物（包括上舰）、醒目留言的分数，默认分别为 1、5
+	GiftWeight      float64
+	SuperChatWeight float64
+	// PriceWeight 礼物、醒目留言每元价值额外增加的分数，默认为 0.1
+	PriceWeight float64
+}
+
+func (o Options) withDefaults() Options {
+	if o.Interval <= 0 {
+		o.Interval = 10 * time.Second
+	}
+	if o.TopN <= 0 {
+		o.TopN = 5
+	}
+	if o.Before <= 0 {
+		o.Before = 40 * time.Second
+	}
+	if o.After <= 0 {
+		o.After = 20 * time.Second
+	}
+	if o.MinRatio <= 0 {
+		o.MinRatio = 2
+	}
+	if o.GiftWeight <= 0 {
+		o.GiftWeight = 1
+	}
+	if o.SuperChatWeight <= 0 {
+		o.SuperChatWeight = 5
+	}
+	if o.PriceWeight <= 0 {
+		o.PriceWeight = 0.1
+	}
+	return o
+}
+
+// Timeline 活跃度曲线，Scores[i] 为从 i*Interval 秒开始的一段时间内的分数
+type Timeline struct {
+	Interval float64   `json:"interval"`
+	Scores   []float64 `json:"scores"`
+}
+
+// Highlight 是一个高能片段，时间均为相对场次开始的秒数
+type Highlight struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// Peak 分数最高的一段的开始时间
+	Peak  float64 `json:"peak"`
+	Score float64 `json:"score"`
+	// Danmaku 峰值处的弹幕数量，Samples 为其中出现最多的弹幕
+	Danmaku int      `json:"danmaku"`
+	Samples []string `json:"samples,omitempty"`
+	// 导出的片段所在的录制文件与导出的文件
+	File string `json:"file,omitempty"`
+	Clip string `json:"clip,omitempty"`
+}
+
+// score 计算一条消息的分数
+func score(m *danmaku.Message, opts *Options) float64 {
+	switch m.Type {
+	case danmaku.TypeDanmaku:
+		s := 1.0
+		for keyword, weight := range opts.Keywords {
+			if keyword != "" && strings.Contains(m.Content, keyword) {
+				s += weight
+			}
+		}
+		return s
+	case danmaku.TypeGift, danmaku.TypeGuard:
+		return opts.GiftWeight + opts.PriceWeight*m.Price
+	case danmaku.TypeSuperChat:
+		return opts.SuperChatWeight + opts.PriceWeight*m.Price
+	}
+	return 0
+}
+
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// Detect 计算 items 的活跃度曲线，并按分数从高到低选取互不重叠的片段，返回的片段按时间排序。
+// items 的 Offset 为相对场次开始的时间，duration 为场次的时长，为 0 时使用最后一条消息的时间
+func Detect(items []danmaku.Item, duration time.Duration, opts Options) (*Timeline, []*Highlight) {
+	opts = opts.withDefaults()
+	for _, item := range items {
+		if item.Offset > duration {
+			duration = item.Offset
+		}
+	}
+	n := int(duration/opts.Interval) + 1
+	scores := make([]float64, n)
+	for _, item := range items {
+		if item.Message == nil || item.Offset < 0 {
+			continue
+		}
+		scores[int(item.Offset/opts.Interval)] += score(item.Message, &opts)
+	}
+	timeline := &Timeline{Interval: opts.Interval.Seconds(), Scores: make([]float64, n)}
+	// 平均值只统计有消息的时间段，避免弹幕稀疏时零星的消息被当作峰值
+	var (
+		total  float64
+		active int
+	)
+	for i, s := range scores {
+		timeline.Scores[i] = round(s)
+		if s > 0 {
+			total += s
+			active++
+		}
+	}
+	mean := total / float64(max(active, 1))
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	highlights := make([]*Highlight, 0, opts.TopN)
+	for _, i := range order {
+		if len(highlights) >= opts.TopN || scores[i] <= 0 || scores[i] < mean*opts.MinRatio {
+			break
+		}
+		peak := time.Duration(i) * opts.Interval
+		start := max(peak-opts.Before, 0)
+		end := min(peak+opts.Interval+opts.After, duration)
+		overlapped := false
+		for _, h := range highlights {
+			if start.Seconds() < h.End && end.Seconds() > h.Start {
+				overlapped = true
+				break
+			}
+		}
+		if overlapped {
+			continue
+		}
+		highlights = append(highlights, &Highlight{
+			Start: round(start.Seconds()),
+			End:   round(end.Seconds()),
+			Peak:  round(peak.Seconds()),
+			Score: round(scores[i]),
+		})
+	}
+	sort.Slice(highlights, func(i, j int) bool { return highlights[i].Start < highlights[j].Start })
+	for _, h := range highlights {
+		h.Danmaku, h.Samples = samples(items, h.Peak, h.Peak+opts.Interval.Seconds(), 3)
+	}
+	return timeline, highlights
+}
+
+// samples 返回 [from, to) 秒内的弹幕数量与出现次数最多的 n 条弹幕
+func samples(items []danmaku.Item, from, to float64, n int) (int, []string) {
+	count := 0
+	freq := make(map[string]int)
+	for _, item := range items {
+		offset := item.Offset.Seconds()
+		if item.Message == nil || item.Message.Type != danmaku.TypeDanmaku || offset < from || offset >= to {
+			continue
+		}
+		count++
+		freq[strings.TrimSpace(item.Message.Content)]++
+	}
+	contents := make([]string, 0, len(freq))
+	for content := range freq {
+		if content != "" {
+			contents = append(contents, content)
+		}
+	}
+	sort.Slice(contents, func(i, j int) bool {
+		if freq[contents[i]] != freq[contents[j]] {
+			return freq[contents[i]] > freq[contents[j]]
+		}
+		return contents[i] < contents[j]
+	})
+	if len(contents) > n {
+		contents = contents[:n]
+	}
+	return count, contents
+}
@@ -0,0 +1,56 @@
+package highlight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+func TestDetect(t *testing.T) {
+	var items []danmaku.Item
+	add := func(offset time.Duration, m *danmaku.Message) {
+		items = append(items, danmaku.Item{Offset: offset, Message: m})
+	}
+	// 每分钟一条弹幕作为背景
+	for i := 0; i < 60; i++ {
+		add(time.Duration(i)*time.Minute, &danmaku.Message{Type: danmaku.TypeDanmaku, Content: "hi"})
+	}
+	// 10 分钟处弹幕刷屏
+	for i := 0; i < 20; i++ {
+		add(10*time.Minute+time.Duration(i)*100*time.Millisecond, &danmaku.Message{Type: danmaku.TypeDanmaku, Content: "233333"})
+	}
+	add(10*time.Minute+time.Second, &danmaku.Message{Type: danmaku.TypeDanmaku, Content: "好活"})
+	// 10 分 30 秒处与第一个片段重叠，不会单独选取
+	for i := 0; i < 10; i++ {
+		add(10*time.Minute+30*time.Second, &danmaku.Message{Type: danmaku.TypeDanmaku, Content: "草"})
+	}
+	// 30 分钟处醒目留言与关键词
+	add(30*time.Minute+5*time.Second, &danmaku.Message{Type: danmaku.TypeSuperChat, Content: "SC", Price: 100})
+	for i := 0; i < 3; i++ {
+		add(30*time.Minute+5*time.Second, &danmaku.Message{Type: danmaku.TypeDanmaku, Content: "草"})
+	}
+	// 50 分钟处礼物
+	add(50*time.Minute, &danmaku.Message{Type: danmaku.TypeGift, Count: 1, Price: 10})
+
+	timeline, highlights := Detect(items, time.Hour, Options{TopN: 2, Keywords: map[string]float64{"草": 1}})
+	assert.Equal(t, float64(10), timeline.Interval)
+	assert.Len(t, timeline.Scores, 361)
+	assert.Equal(t, float64(22), timeline.Scores[60])
+	assert.Equal(t, float64(22), timeline.Scores[180])
+	assert.Equal(t, float64(3), timeline.Scores[300])
+
+	assert.Equal(t, []*Highlight{
+		{Start: 560, End: 630, Peak: 600, Score: 22, Danmaku: 22, Samples: []string{"233333", "hi", "好活"}},
+		{Start: 1760, End: 1830, Peak: 1800, Score: 22, Danmaku: 4, Samples: []string{"草", "hi"}},
+	}, highlights)
+
+	// 没有明显高于平均值的片段
+	_, highlights = Detect(items[:60], 0, Options{})
+	assert.Empty(t, highlights)
+	timeline, highlights = Detect(nil, 0, Options{})
+	assert.Equal(t, []float64{0}, timeline.Scores)
+	assert.Empty(t, highlights)
+}
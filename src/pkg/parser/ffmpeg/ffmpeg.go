@@ -172,6 +172,9 @@ func (p *Parser) ParseLiveStream(ctx context.Context, streamUrlInfo *live.Stream
 
 	inst := instance.GetInstance(ctx)
 	MaxFileSize := inst.Config.VideoSplitStrategies.MaxFileSize
+	if live != nil {
+		MaxFileSize = inst.Config.GetRoomConfig(live.GetRawUrl()).VideoSplitStrategies.MaxFileSize
+	}
 	if MaxFileSize < 0 {
 		inst.Logger.Infof("Invalid MaxFileSize: %d", MaxFileSize)
 	} else if MaxFileSize > 0 {
@@ -0,0 +1,429 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/parser"
+)
+
+const (
+	Name = "hls"
+
+	userAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/59.0.3071.115 Safari/537.36"
+
+	segmentRetryCount   = 3
+	downloadConcurrency = 3
+	// 连续获取 playlist 失败超过该次数后结束本次录制
+	maxPlaylistFailures = 5
+)
+
+// for test
+var retryInterval = time.Second
+
+func init() {
+	parser.Register(Name, new(builder))
+}
+
+type builder struct{}
+
+func (b *builder) Build(cfg map[string]string) (parser.Parser, error) {
+	timeout := time.Minute
+	if us, err := strconv.Atoi(cfg["timeout_in_us"]); err == nil && us > 0 {
+		timeout = time.Duration(us) * time.Microsecond
+	}
+	return &Parser{
+		hc:        &http.Client{Timeout: timeout},
+		stopCh:    make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}, nil
+}
+
+type status struct {
+	totalSize          int64
+	segmentsDownloaded uint64
+	segmentsFailed     uint64
+	// 因 playlist 窗口滑动过快而未能下载的分片
+	segmentsSkipped uint64
+	discontinuities uint64
+	playlistResets  uint64
+	lastSequence    uint64
+	targetDuration  float64
+	// 已出现在 playlist 中但尚未写入的时长（秒）
+	lag float64
+}
+
+type Parser struct {
+	hc        *http.Client
+	headers   map[string]string
+	stopCh    chan struct{}
+	closeOnce *sync.Once
+	logger    *logrus.Entry
+
+	file        string
+	o           *os.File
+	outputFiles []string
+	// outputTimes 每个输出文件开始写入的时间
+	outputTimes []time.Time
+	lastMap     string
+	// 下载分片的限速，为 nil 时不限速
+	limiter parser.RateLimiter
+
+	statusLock sync.RWMutex
+	status     status
+}
+
+func (p *Parser) ParseLiveStream(ctx context.Context, streamUrlInfo *live.StreamUrlInfo, live live.Live, file string) error {
+	p.headers = streamUrlInfo.HeadersForDownloader
+	p.file = file
+	p.logger = instance.GetInstance(ctx).Logger.WithField("parser", Name)
+	defer p.closeOutput()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var (
+		playlistUrl = streamUrlInfo.Url
+		started     bool
+		lastSeq     uint64
+		failures    int
+	)
+	for {
+		pl, err := p.fetchPlaylist(ctx, playlistUrl)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			if failures++; failures >= maxPlaylistFailures {
+				return err
+			}
+			p.logger.WithError(err).Warnf("failed to fetch playlist, retry %d/%d", failures, maxPlaylistFailures)
+			if !p.sleep(ctx, retryInterval) {
+				return nil
+			}
+			continue
+		}
+		failures = 0
+		if pl.Media == nil {
+			v, err := pl.bestVariant()
+			if err != nil {
+				return err
+			}
+			playlistUrl = v.Url
+			continue
+		}
+
+		media := pl.Media
+		if started && len(media.Segments) > 0 {
+			first := media.Segments[0].Sequence
+			last := media.Segments[len(media.Segments)-1].Sequence
+			switch {
+			case last < lastSeq:
+				// 服务端重启编码或切换了源站，media sequence 被重置
+				p.updateStatus(func(s *status) { s.playlistResets++ })
+				p.logger.Warnf("playlist reset detected, media sequence %d -> %d", lastSeq, last)
+				started = false
+			case first > lastSeq+1:
+				skipped := first - lastSeq - 1
+				p.updateStatus(func(s *status) { s.segmentsSkipped += skipped })
+				p.logger.Warnf("%d segments slid out of playlist before being downloaded", skipped)
+			}
+		}
+		newSegments := make([]*segment, 0, len(media.Segments))
+		for _, seg := range media.Segments {
+			if !started || seg.Sequence > lastSeq {
+				newSegments = append(newSegments, seg)
+			}
+		}
+		p.updateStatus(func(s *status) {
+			s.targetDuration = media.TargetDuration
+			s.lag = totalDuration(newSegments)
+		})
+
+		if len(newSegments) > 0 {
+			started = true
+			var err error
+			lastSeq, err = p.downloadSegments(ctx, newSegments, lastSeq)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if media.EndList {
+			return nil
+		}
+
+		wait := time.Duration(media.TargetDuration * float64(time.Second))
+		if wait <= 0 {
+			wait = retryInterval
+		}
+		if len(newSegments) == 0 {
+			// 按照规范，playlist 未更新时等待半个 target duration 后重新获取
+			wait /= 2
+		}
+		if !p.sleep(ctx, wait) {
+			return nil
+		}
+	}
+}
+
+func (p *Parser) sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// downloadSegments 并发下载分片，并按顺序写入输出文件，返回最后处理的分片序号
+func (p *Parser) downloadSegments(ctx context.Context, segments []*segment, lastSeq uint64) (uint64, error) {
+	// 提前返回时结束仍在进行的下载
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		data []byte
+		err  error
+	}
+	var (
+		sem     = make(chan struct{}, downloadConcurrency)
+		results = make([]chan result, len(segments))
+	)
+	for i, seg := range segments {
+		results[i] = make(chan result, 1)
+		go func(ch chan<- result, u *url.URL) {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				ch <- result{err: ctx.Err()}
+				return
+			}
+			defer func() { <-sem }()
+			data, err := p.fetchWithRetry(ctx, u)
+			ch <- result{data, err}
+		}(results[i], seg.Url)
+	}
+
+	for i, seg := range segments {
+		res := <-results[i]
+		if ctx.Err() != nil {
+			return lastSeq, ctx.Err()
+		}
+		if seg.Discontinuity {
+			p.updateStatus(func(s *status) { s.discontinuities++ })
+			p.logger.Infof("discontinuity at segment %d", seg.Sequence)
+		}
+		lastSeq = seg.Sequence
+		if res.err != nil {
+			p.updateStatus(func(s *status) { s.segmentsFailed++ })
+			p.logger.WithError(res.err).Warnf("failed to download segment %d (%s), skipped", seg.Sequence, seg.Url)
+			continue
+		}
+		if seg.Map != nil && seg.Map.String() != p.lastMap {
+			init, err := p.fetchWithRetry(ctx, seg.Map)
+			if err != nil {
+				p.updateStatus(func(s *status) { s.segmentsFailed++ })
+				p.logger.WithError(err).Warnf("failed to download init segment (%s), skipped segment %d", seg.Map, seg.Sequence)
+				continue
+			}
+			// 一个 fMP4 文件只能有一个 init segment，更换时切换到新文件
+			if p.lastMap != "" {
+				p.closeOutput()
+			}
+			if err := p.ensureOutput(seg); err != nil {
+				return lastSeq, err
+			}
+			if err := p.write(init); err != nil {
+				return lastSeq, err
+			}
+			p.lastMap = seg.Map.String()
+		}
+		if err := p.ensureOutput(seg); err != nil {
+			return lastSeq, err
+		}
+		if err := p.write(res.data); err != nil {
+			return lastSeq, err
+		}
+		p.updateStatus(func(s *status) {
+			s.segmentsDownloaded++
+			s.lastSequence = seg.Sequence
+			s.lag = totalDuration(segments[i+1:])
+		})
+	}
+	return lastSeq, nil
+}
+
+func totalDuration(segments []*segment) float64 {
+	var d float64
+	for _, seg := range segments {
+		d += seg.Duration
+	}
+	return d
+}
+
+// ensureOutput 在写入第一个分片前打开输出文件，fMP4 分片无法保存为 .ts，改用 .mp4 扩展名；
+// 之后的文件与原生 flv 解析器切分的文件一样加上 _P002 等后缀
+func (p *Parser) ensureOutput(seg *segment) error {
+	if p.o != nil {
+		return nil
+	}
+	file := p.file
+	if seg.Map != nil && strings.ToLower(filepath.Ext(file)) == ".ts" {
+		file = strings.TrimSuffix(file, filepath.Ext(file)) + ".mp4"
+	}
+	p.statusLock.RLock()
+	n := len(p.outputFiles)
+	p.statusLock.RUnlock()
+	if n > 0 {
+		ext := filepath.Ext(file)
+		file = fmt.Sprintf("%s_P%03d%s", strings.TrimSuffix(file, ext), n+1, ext)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	p.o = f
+	p.statusLock.Lock()
+	p.outputFiles = append(p.outputFiles, file)
+	p.outputTimes = append(p.outputTimes, time.Now())
+	p.statusLock.Unlock()
+	return nil
+}
+
+func (p *Parser) write(b []byte) error {
+	n, err := p.o.Write(b)
+	p.updateStatus(func(s *status) { s.totalSize += int64(n) })
+	return err
+}
+
+func (p *Parser) SetRateLimiter(l parser.RateLimiter) {
+	p.limiter = l
+}
+
+func (p *Parser) closeOutput() {
+	if p.o != nil {
+		p.o.Close()
+		p.o = nil
+	}
+}
+
+func (p *Parser) fetchPlaylist(ctx context.Context, u *url.URL) (*playlist, error) {
+	resp, err := p.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// 以重定向后的地址作为相对路径的基准
+	return parsePlaylist(resp.Request.URL, resp.Body)
+}
+
+func (p *Parser) fetchWithRetry(ctx context.Context, u *url.URL) (data []byte, err error) {
+	for i := 0; i < segmentRetryCount; i++ {
+		if i > 0 && !p.sleep(ctx, retryInterval*time.Duration(i)) {
+			return nil, ctx.Err()
+		}
+		var resp *http.Response
+		if resp, err = p.get(ctx, u); err != nil {
+			continue
+		}
+		var body io.Reader = resp.Body
+		if p.limiter != nil {
+			body = p.limiter.LimitReader(ctx, body)
+		}
+		data, err = io.ReadAll(body)
+		resp.Body.Close()
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+func (p *Parser) get(ctx context.Context, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, u)
+	}
+	return resp, nil
+}
+
+func (p *Parser) updateStatus(fn func(s *status)) {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+	fn(&p.status)
+}
+
+func (p *Parser) Status() (map[string]string, error) {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	s := p.status
+	return map[string]string{
+		"parser":              Name,
+		"total_size":          strconv.FormatInt(s.totalSize, 10),
+		"segments_downloaded": strconv.FormatUint(s.segmentsDownloaded, 10),
+		"segments_failed":     strconv.FormatUint(s.segmentsFailed, 10),
+		"segments_skipped":    strconv.FormatUint(s.segmentsSkipped, 10),
+		"discontinuities":     strconv.FormatUint(s.discontinuities, 10),
+		"playlist_resets":     strconv.FormatUint(s.playlistResets, 10),
+		"last_sequence":       strconv.FormatUint(s.lastSequence, 10),
+		"target_duration":     strconv.FormatFloat(s.targetDuration, 'f', -1, 64),
+		"lag":                 strconv.FormatFloat(s.lag, 'f', 3, 64),
+	}, nil
+}
+
+// OutputFiles 可以在解析过程中调用，最后一个文件是正在写入的文件
+func (p *Parser) OutputFiles() []string {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	return append([]string(nil), p.outputFiles...)
+}
+
+// OutputFileTimes 返回每个输出文件开始写入的时间
+func (p *Parser) OutputFileTimes() []time.Time {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	return append([]time.Time(nil), p.outputTimes...)
+}
+
+func (p *Parser) Stop() error {
+	p.closeOnce.Do(func() {
+		close(p.stopCh)
+	})
+	return nil
+}
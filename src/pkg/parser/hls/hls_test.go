@@ -0,0 +1,284 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/live"
+)
+
+func newTestContext() context.Context {
+	return context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+	})
+}
+
+func TestParsePlaylist(t *testing.T) {
+	base, _ := url.Parse("https://example.com/live/index.m3u8?token=1")
+	pl, err := parsePlaylist(base, strings.NewReader(`#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-MAP:URI="h.m4s"
+#EXTINF:2.000,
+100.m4s
+#EXT-X-DISCONTINUITY
+#EXTINF:1.500,
+https://cdn.example.com/101.m4s
+`))
+	assert.NoError(t, err)
+	assert.Nil(t, pl.Variants)
+	assert.Equal(t, float64(2), pl.Media.TargetDuration)
+	assert.Len(t, pl.Media.Segments, 2)
+	assert.Equal(t, uint64(100), pl.Media.Segments[0].Sequence)
+	assert.Equal(t, "https://example.com/live/100.m4s", pl.Media.Segments[0].Url.String())
+	assert.Equal(t, "https://example.com/live/h.m4s", pl.Media.Segments[0].Map.String())
+	assert.False(t, pl.Media.Segments[0].Discontinuity)
+	assert.Equal(t, uint64(101), pl.Media.Segments[1].Sequence)
+	assert.Equal(t, 1.5, pl.Media.Segments[1].Duration)
+	assert.True(t, pl.Media.Segments[1].Discontinuity)
+	assert.False(t, pl.Media.EndList)
+
+	pl, err = parsePlaylist(base, strings.NewReader(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720
+high.m3u8
+`))
+	assert.NoError(t, err)
+	assert.Nil(t, pl.Media)
+	v, err := pl.bestVariant()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/live/high.m3u8", v.Url.String())
+	assert.Equal(t, "1280x720", v.Resolution)
+
+	_, err = ParseVariants(base, strings.NewReader("#EXTM3U\n#EXTINF:2,\n1.ts\n"))
+	assert.Equal(t, ErrNoVariant, err)
+
+	_, err = parsePlaylist(base, strings.NewReader("<html></html>"))
+	assert.Equal(t, ErrNotM3u8Playlist, err)
+	_, err = parsePlaylist(base, strings.NewReader("#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\"\n"))
+	assert.Equal(t, ErrEncryptedSegment, err)
+}
+
+// liveServer 模拟一个滑动窗口的直播 playlist，每次请求推进一个分片
+type liveServer struct {
+	sync.Mutex
+	next    int
+	total   int
+	window  int
+	failing map[int]bool
+	fmp4    bool
+	// mapFrom 大于 0 时从该分片开始使用新的 init segment
+	mapFrom  int
+	sequence func(i int) int
+}
+
+func (s *liveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	switch {
+	case r.URL.Path == "/index.m3u8":
+		if s.next < s.total {
+			s.next++
+		}
+		start := s.next - s.window
+		if start < 0 {
+			start = 0
+		}
+		b := new(strings.Builder)
+		fmt.Fprintf(b, "#EXTM3U\n#EXT-X-TARGETDURATION:0.01\n#EXT-X-MEDIA-SEQUENCE:%d\n", s.sequence(start))
+		for i := start; i < s.next; i++ {
+			if s.fmp4 && (i == start || i == s.mapFrom) {
+				if s.mapFrom > 0 && i >= s.mapFrom {
+					b.WriteString("#EXT-X-MAP:URI=\"init2.mp4\"\n")
+				} else {
+					b.WriteString("#EXT-X-MAP:URI=\"init.mp4\"\n")
+				}
+			}
+			fmt.Fprintf(b, "#EXTINF:0.01,\n%d.seg\n", i)
+		}
+		if s.next == s.total {
+			b.WriteString("#EXT-X-ENDLIST\n")
+		}
+		w.Write([]byte(b.String()))
+	case r.URL.Path == "/init.mp4":
+		w.Write([]byte("[init]"))
+	case r.URL.Path == "/init2.mp4":
+		w.Write([]byte("[init2]"))
+	default:
+		var i int
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/"), "%d.seg", &i)
+		if s.failing[i] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "[%d]", i)
+	}
+}
+
+func runParser(t *testing.T, s *liveServer, file string) (*Parser, error) {
+	backup := retryInterval
+	retryInterval = time.Millisecond
+	defer func() { retryInterval = backup }()
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/index.m3u8")
+	p, err := new(builder).Build(map[string]string{})
+	assert.NoError(t, err)
+	parser := p.(*Parser)
+	return parser, parser.ParseLiveStream(newTestContext(), &live.StreamUrlInfo{Url: u}, nil, file)
+}
+
+func TestParseLiveStream(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.ts")
+	s := &liveServer{
+		total:    5,
+		window:   3,
+		failing:  map[int]bool{3: true},
+		sequence: func(i int) int { return i },
+	}
+	p, err := runParser(t, s, file)
+	assert.NoError(t, err)
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "[0][1][2][4]", string(b))
+	assert.Equal(t, []string{file}, p.OutputFiles())
+
+	status, err := p.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, "4", status["segments_downloaded"])
+	assert.Equal(t, "1", status["segments_failed"])
+	assert.Equal(t, "4", status["last_sequence"])
+	assert.Equal(t, "12", status["total_size"])
+}
+
+func TestParseLiveStreamFmp4(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.ts")
+	s := &liveServer{
+		total:    3,
+		window:   2,
+		fmp4:     true,
+		sequence: func(i int) int { return i },
+	}
+	p, err := runParser(t, s, file)
+	assert.NoError(t, err)
+	mp4File := strings.TrimSuffix(file, ".ts") + ".mp4"
+	assert.Equal(t, []string{mp4File}, p.OutputFiles())
+	b, err := os.ReadFile(mp4File)
+	assert.NoError(t, err)
+	assert.Equal(t, "[init][0][1][2]", string(b))
+}
+
+func TestParseLiveStreamMapChange(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.ts")
+	s := &liveServer{
+		total:    4,
+		window:   2,
+		fmp4:     true,
+		mapFrom:  2,
+		sequence: func(i int) int { return i },
+	}
+	p, err := runParser(t, s, file)
+	assert.NoError(t, err)
+	// init segment 变化后写入新的文件
+	files := []string{
+		strings.TrimSuffix(file, ".ts") + ".mp4",
+		strings.TrimSuffix(file, ".ts") + "_P002.mp4",
+	}
+	assert.Equal(t, files, p.OutputFiles())
+	for i, expected := range []string{"[init][0][1]", "[init2][2][3]"} {
+		b, err := os.ReadFile(files[i])
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(b))
+	}
+}
+
+func TestParseLiveStreamReset(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.ts")
+	s := &liveServer{
+		total:  6,
+		window: 1,
+		// 第 3 个分片之后 media sequence 从头开始
+		sequence: func(i int) int {
+			if i >= 3 {
+				return i - 3
+			}
+			return i + 10
+		},
+	}
+	p, err := runParser(t, s, file)
+	assert.NoError(t, err)
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "[0][1][2][3][4][5]", string(b))
+	status, _ := p.Status()
+	assert.Equal(t, "1", status["playlist_resets"])
+}
+
+func TestStop(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.ts")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:0\n"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/index.m3u8")
+	p, _ := new(builder).Build(map[string]string{})
+	done := make(chan error)
+	go func() {
+		done <- p.ParseLiveStream(newTestContext(), &live.StreamUrlInfo{Url: u}, nil, file)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, p.Stop())
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("parser did not stop")
+	}
+}
+
+func TestParseVariants(t *testing.T) {
+	base, _ := url.Parse("https://usher.example.com/api/channel/hls/test.m3u8")
+	infos, err := ParseVariants(base, strings.NewReader(`#EXTM3U
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="chunked",NAME="1080p60 (source)",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:BANDWIDTH=8533000,RESOLUTION=1920x1080,CODECS="avc1.64002A,mp4a.40.2",VIDEO="chunked",FRAME-RATE=60.000
+https://video.example.com/chunked/index.m3u8
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="720p30",NAME="720p",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:BANDWIDTH=2373000,RESOLUTION=1280x720,CODECS="hvc1.1.2.L93.B0,mp4a.40.2",VIDEO="720p30"
+https://video.example.com/720p30/index.m3u8
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="audio_only",NAME="audio_only",AUTOSELECT=NO,DEFAULT=NO
+#EXT-X-STREAM-INF:BANDWIDTH=160000,CODECS="mp4a.40.2",VIDEO="audio_only"
+https://video.example.com/audio_only/index.m3u8
+`))
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 3) {
+		assert.Equal(t, "1080p60 (source)", infos[0].Name)
+		assert.Equal(t, 1080, infos[0].Resolution)
+		assert.Equal(t, 8533, infos[0].Vbitrate)
+		assert.Equal(t, live.CodecAVC, infos[0].Codec)
+		assert.Equal(t, live.ContainerHLS, infos[0].Container)
+		assert.False(t, infos[0].AudioOnly)
+		assert.Equal(t, "https://video.example.com/chunked/index.m3u8", infos[0].Url.String())
+		assert.Equal(t, live.CodecHEVC, infos[1].Codec)
+		assert.Equal(t, 720, infos[1].Resolution)
+		assert.Equal(t, "audio_only", infos[2].Name)
+		assert.True(t, infos[2].AudioOnly)
+		assert.Equal(t, 0, infos[2].Resolution)
+	}
+}
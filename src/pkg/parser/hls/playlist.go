@@ -0,0 +1,245 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bililive-go/bililive-go/src/live"
+)
+
+var (
+	ErrNotM3u8Playlist  = errors.New("not m3u8 playlist")
+	ErrEncryptedSegment = errors.New("encrypted segment is not supported")
+	ErrNoVariant        = errors.New("master playlist has no variant")
+)
+
+type segment struct {
+	Sequence      uint64
+	Url           *url.URL
+	Duration      float64
+	Discontinuity bool
+	// fMP4 的初始化分片（#EXT-X-MAP），MPEG-TS 分片为 nil
+	Map *url.URL
+}
+
+type variant struct {
+	Url        *url.URL
+	Bandwidth  int
+	Resolution string
+	Codecs     string
+	// Name 子流的视频分组（#EXT-X-MEDIA）的名称，没有时为分组 ID
+	Name string
+}
+
+type mediaPlaylist struct {
+	TargetDuration        float64
+	MediaSequence         uint64
+	DiscontinuitySequence uint64
+	Segments              []*segment
+	EndList               bool
+}
+
+type playlist struct {
+	// Variants 不为空时表示这是一个 master playlist
+	Variants []*variant
+	Media    *mediaPlaylist
+}
+
+// parseAttributes 解析形如 KEY=VALUE,KEY="VALUE" 的属性列表
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if comma := strings.IndexByte(s, ','); comma >= 0 {
+			value, s = s[:comma], s[comma:]
+		} else {
+			value, s = s, ""
+		}
+		attrs[key] = value
+		s = strings.TrimPrefix(s, ",")
+	}
+	return attrs
+}
+
+func parsePlaylist(base *url.URL, r io.Reader) (*playlist, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if !s.Scan() || !strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(s.Text(), "\ufeff")), "#EXTM3U") {
+		return nil, ErrNotM3u8Playlist
+	}
+
+	var (
+		pl         = &playlist{}
+		media      = &mediaPlaylist{}
+		seq        uint64
+		seqSet     bool
+		duration   float64
+		discont    bool
+		mapUrl     *url.URL
+		nextStream map[string]string
+		// 视频分组 ID 对应的名称
+		groupNames = make(map[string]string)
+	)
+	resolve := func(ref string) (*url.URL, error) {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return nil, err
+		}
+		return base.ResolveReference(u), nil
+	}
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			u, err := resolve(line)
+			if err != nil {
+				return nil, err
+			}
+			if nextStream != nil {
+				bandwidth, _ := strconv.Atoi(nextStream["BANDWIDTH"])
+				pl.Variants = append(pl.Variants, &variant{
+					Url:        u,
+					Bandwidth:  bandwidth,
+					Resolution: nextStream["RESOLUTION"],
+					Codecs:     nextStream["CODECS"],
+					Name:       nextStream["VIDEO"],
+				})
+				nextStream = nil
+				continue
+			}
+			if !seqSet {
+				seq, seqSet = media.MediaSequence, true
+			}
+			media.Segments = append(media.Segments, &segment{
+				Sequence:      seq,
+				Url:           u,
+				Duration:      duration,
+				Discontinuity: discont,
+				Map:           mapUrl,
+			})
+			seq++
+			duration, discont = 0, false
+			continue
+		}
+
+		tag, value, _ := strings.Cut(line, ":")
+		switch tag {
+		case "#EXT-X-STREAM-INF":
+			nextStream = parseAttributes(value)
+		case "#EXT-X-MEDIA":
+			if attrs := parseAttributes(value); attrs["TYPE"] == "VIDEO" && attrs["NAME"] != "" {
+				groupNames[attrs["GROUP-ID"]] = attrs["NAME"]
+			}
+		case "#EXT-X-TARGETDURATION":
+			media.TargetDuration, _ = strconv.ParseFloat(value, 64)
+		case "#EXT-X-MEDIA-SEQUENCE":
+			media.MediaSequence, _ = strconv.ParseUint(value, 10, 64)
+		case "#EXT-X-DISCONTINUITY-SEQUENCE":
+			media.DiscontinuitySequence, _ = strconv.ParseUint(value, 10, 64)
+		case "#EXTINF":
+			durStr, _, _ := strings.Cut(value, ",")
+			duration, _ = strconv.ParseFloat(strings.TrimSpace(durStr), 64)
+		case "#EXT-X-DISCONTINUITY":
+			discont = true
+		case "#EXT-X-MAP":
+			u, err := resolve(parseAttributes(value)["URI"])
+			if err != nil {
+				return nil, err
+			}
+			mapUrl = u
+		case "#EXT-X-KEY":
+			if method := parseAttributes(value)["METHOD"]; method != "" && method != "NONE" {
+				return nil, ErrEncryptedSegment
+			}
+		case "#EXT-X-ENDLIST":
+			media.EndList = true
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(pl.Variants) == 0 {
+		pl.Media = media
+	}
+	for _, v := range pl.Variants {
+		if name, ok := groupNames[v.Name]; ok {
+			v.Name = name
+		}
+	}
+	return pl, nil
+}
+
+// ParseVariants 解析 master playlist，每个子流返回一条线路，用于插件报告可选的画质；
+// 不是 master playlist 时返回 ErrNoVariant
+func ParseVariants(base *url.URL, r io.Reader) ([]*live.StreamUrlInfo, error) {
+	pl, err := parsePlaylist(base, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(pl.Variants) == 0 {
+		return nil, ErrNoVariant
+	}
+	infos := make([]*live.StreamUrlInfo, 0, len(pl.Variants))
+	for _, v := range pl.Variants {
+		info := &live.StreamUrlInfo{
+			Url:       v.Url,
+			Name:      v.Name,
+			Vbitrate:  v.Bandwidth / 1000,
+			Container: live.ContainerHLS,
+		}
+		if _, height, ok := strings.Cut(v.Resolution, "x"); ok {
+			info.Resolution, _ = strconv.Atoi(height)
+		}
+		// 有 CODECS 但没有视频编码的是纯音频子流
+		info.AudioOnly = v.Codecs != ""
+		for _, codec := range strings.Split(v.Codecs, ",") {
+			switch prefix, _, _ := strings.Cut(strings.TrimSpace(codec), "."); prefix {
+			case "avc1", "avc3":
+				info.Codec, info.AudioOnly = live.CodecAVC, false
+			case "hvc1", "hev1":
+				info.Codec, info.AudioOnly = live.CodecHEVC, false
+			case "av01":
+				info.Codec, info.AudioOnly = live.CodecAV1, false
+			case "mp4a", "ac-3", "ec-3", "opus":
+			default:
+				info.AudioOnly = false
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// bestVariant 选择码率最高的子流
+func (pl *playlist) bestVariant() (*variant, error) {
+	var best *variant
+	for _, v := range pl.Variants {
+		if best == nil || v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+	}
+	if best == nil {
+		return nil, ErrNoVariant
+	}
+	return best, nil
+}
@@ -0,0 +1,335 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+var (
+	ErrUnsupportedAMF0Type = errors.New("unsupported amf0 type")
+	ErrInvalidAMF0Data     = errors.New("invalid amf0 data")
+)
+
+// AMF0 值与 Go 类型的对应关系:
+//
+//	Number -> float64, Boolean -> bool, String/LongString/XMLDocument -> string,
+//	Object/TypedObject -> AMFObject, ECMAArray -> AMFECMAArray, StrictArray -> []interface{},
+//	Date -> time.Time, Null/Undefined/Unsupported -> nil
+type AMFProperty struct {
+	Key   string
+	Value interface{}
+}
+
+// AMFProperties 保持属性的原始顺序，部分播放器依赖 onMetaData 中的属性顺序
+type AMFProperties []AMFProperty
+
+func (ps AMFProperties) Get(key string) (interface{}, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (ps *AMFProperties) Set(key string, value interface{}) {
+	for i, p := range *ps {
+		if p.Key == key {
+			(*ps)[i].Value = value
+			return
+		}
+	}
+	*ps = append(*ps, AMFProperty{key, value})
+}
+
+func (ps *AMFProperties) Delete(key string) {
+	for i, p := range *ps {
+		if p.Key == key {
+			*ps = append((*ps)[:i], (*ps)[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ps AMFProperties) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for i, p := range ps {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(p.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(p.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type AMFObject struct {
+	AMFProperties
+}
+
+type AMFECMAArray struct {
+	AMFProperties
+}
+
+// DecodeAMF0 依次解码 b 中的所有 AMF0 值
+func DecodeAMF0(b []byte) ([]interface{}, error) {
+	r := bytes.NewReader(b)
+	var values []interface{}
+	for r.Len() > 0 {
+		v, err := decodeAMF0Value(r)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func readAMF0(r *bytes.Reader, n int) ([]byte, error) {
+	if n > r.Len() {
+		return nil, ErrInvalidAMF0Data
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrInvalidAMF0Data
+	}
+	return b, nil
+}
+
+func decodeAMF0String(r *bytes.Reader, long bool) (string, error) {
+	var n int
+	if long {
+		b, err := readAMF0(r, 4)
+		if err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint32(b))
+	} else {
+		b, err := readAMF0(r, 2)
+		if err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(b))
+	}
+	b, err := readAMF0(r, n)
+	return string(b), err
+}
+
+func decodeAMF0Properties(r *bytes.Reader) (AMFProperties, error) {
+	ps := AMFProperties{}
+	for {
+		key, err := decodeAMF0String(r, false)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			marker, err := r.ReadByte()
+			if err != nil {
+				return nil, ErrInvalidAMF0Data
+			}
+			if DataType(marker) == ObjectEndMarker {
+				return ps, nil
+			}
+			// 空字符串作为属性名，回退后按普通属性处理
+			r.UnreadByte()
+		}
+		value, err := decodeAMF0Value(r)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, AMFProperty{key, value})
+	}
+}
+
+func decodeAMF0Value(r *bytes.Reader) (interface{}, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrInvalidAMF0Data
+	}
+	switch DataType(t) {
+	case Number:
+		b, err := readAMF0(r, 8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case Boolean:
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidAMF0Data
+		}
+		return b != 0, nil
+	case String:
+		return decodeAMF0String(r, false)
+	case LongString, XMLDocument:
+		return decodeAMF0String(r, true)
+	case Object:
+		ps, err := decodeAMF0Properties(r)
+		if err != nil {
+			return nil, err
+		}
+		return AMFObject{ps}, nil
+	case TypedObject:
+		// 丢弃类名，按普通对象处理
+		if _, err := decodeAMF0String(r, false); err != nil {
+			return nil, err
+		}
+		ps, err := decodeAMF0Properties(r)
+		if err != nil {
+			return nil, err
+		}
+		return AMFObject{ps}, nil
+	case ECMAArray:
+		// 数组长度只是参考值，以 ObjectEndMarker 为准
+		if _, err := readAMF0(r, 4); err != nil {
+			return nil, err
+		}
+		ps, err := decodeAMF0Properties(r)
+		if err != nil {
+			return nil, err
+		}
+		return AMFECMAArray{ps}, nil
+	case StrictArray:
+		b, err := readAMF0(r, 4)
+		if err != nil {
+			return nil, err
+		}
+		n := int(binary.BigEndian.Uint32(b))
+		if n > r.Len() {
+			return nil, ErrInvalidAMF0Data
+		}
+		values := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := decodeAMF0Value(r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case Date:
+		b, err := readAMF0(r, 10)
+		if err != nil {
+			return nil, err
+		}
+		ms := math.Float64frombits(binary.BigEndian.Uint64(b))
+		// 时区字段已废弃，总是按 UTC 处理
+		return time.UnixMilli(int64(ms)).UTC(), nil
+	case Null, Undefined, Unsupported:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedAMF0Type, t)
+	}
+}
+
+// EncodeAMF0 依次编码 values，整数类型按 Number 编码
+func EncodeAMF0(values ...interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, v := range values {
+		if err := encodeAMF0Value(buf, v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeAMF0Number(buf *bytes.Buffer, f float64) {
+	buf.WriteByte(byte(Number))
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+}
+
+func encodeAMF0Key(buf *bytes.Buffer, s string) error {
+	if len(s) > math.MaxUint16 {
+		return ErrInvalidAMF0Data
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+	return nil
+}
+
+func encodeAMF0Properties(buf *bytes.Buffer, ps AMFProperties) error {
+	for _, p := range ps {
+		if err := encodeAMF0Key(buf, p.Key); err != nil {
+			return err
+		}
+		if err := encodeAMF0Value(buf, p.Value); err != nil {
+			return err
+		}
+	}
+	buf.Write([]byte{0, 0, byte(ObjectEndMarker)})
+	return nil
+}
+
+func encodeAMF0Value(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(byte(Null))
+	case float64:
+		encodeAMF0Number(buf, v)
+	case float32:
+		encodeAMF0Number(buf, float64(v))
+	case int:
+		encodeAMF0Number(buf, float64(v))
+	case int64:
+		encodeAMF0Number(buf, float64(v))
+	case uint32:
+		encodeAMF0Number(buf, float64(v))
+	case uint64:
+		encodeAMF0Number(buf, float64(v))
+	case bool:
+		buf.WriteByte(byte(Boolean))
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case string:
+		if len(v) > math.MaxUint16 {
+			buf.WriteByte(byte(LongString))
+			binary.Write(buf, binary.BigEndian, uint32(len(v)))
+			buf.WriteString(v)
+		} else {
+			buf.WriteByte(byte(String))
+			encodeAMF0Key(buf, v)
+		}
+	case AMFObject:
+		buf.WriteByte(byte(Object))
+		return encodeAMF0Properties(buf, v.AMFProperties)
+	case AMFECMAArray:
+		buf.WriteByte(byte(ECMAArray))
+		binary.Write(buf, binary.BigEndian, uint32(len(v.AMFProperties)))
+		return encodeAMF0Properties(buf, v.AMFProperties)
+	case []interface{}:
+		buf.WriteByte(byte(StrictArray))
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		for _, item := range v {
+			if err := encodeAMF0Value(buf, item); err != nil {
+				return err
+			}
+		}
+	case time.Time:
+		buf.WriteByte(byte(Date))
+		binary.Write(buf, binary.BigEndian, math.Float64bits(float64(v.UnixMilli())))
+		buf.Write([]byte{0, 0})
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedAMF0Type, v)
+	}
+	return nil
+}
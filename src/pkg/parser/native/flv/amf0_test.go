@@ -0,0 +1,48 @@
+package flv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAMF0(t *testing.T) {
+	date := time.UnixMilli(1700000000000).UTC()
+	values := []interface{}{
+		"onMetaData",
+		AMFECMAArray{AMFProperties{
+			{"duration", 12.5},
+			{"stereo", true},
+			{"encoder", "obs"},
+			{"empty", nil},
+			{"date", date},
+			{"keyframes", AMFObject{AMFProperties{
+				{"times", []interface{}{0.0, 2.0}},
+			}}},
+		}},
+	}
+	b, err := EncodeAMF0(values...)
+	assert.NoError(t, err)
+	decoded, err := DecodeAMF0(b)
+	assert.NoError(t, err)
+	assert.Equal(t, values, decoded)
+
+	props := decoded[1].(AMFECMAArray).AMFProperties
+	props.Set("duration", 1.0)
+	props.Delete("empty")
+	props.Set("filesize", 100)
+	v, ok := props.Get("duration")
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, v)
+	_, ok = props.Get("empty")
+	assert.False(t, ok)
+	assert.Equal(t, "filesize", props[len(props)-1].Key)
+
+	_, err = DecodeAMF0(b[:len(b)-2])
+	assert.ErrorIs(t, err, ErrInvalidAMF0Data)
+	_, err = DecodeAMF0([]byte{byte(Reference), 0, 1})
+	assert.ErrorIs(t, err, ErrUnsupportedAMF0Type)
+	_, err = EncodeAMF0(struct{}{})
+	assert.ErrorIs(t, err, ErrUnsupportedAMF0Type)
+}
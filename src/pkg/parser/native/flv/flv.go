@@ -4,19 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
 
 	"github.com/bililive-go/bililive-go/src/instance"
 	"github.com/bililive-go/bililive-go/src/live"
 	"github.com/bililive-go/bililive-go/src/pkg/parser"
 	"github.com/bililive-go/bililive-go/src/pkg/reader"
-	"github.com/bililive-go/bililive-go/src/pkg/utils"
 )
 
 const (
@@ -27,6 +34,9 @@ const (
 	scriptTag uint8 = 18
 
 	ioRetryCount int = 3
+
+	// 交接时旧连接的时间戳落后超过该值，认为两个连接的时间线不可比较，直接在下一个关键帧处结束
+	maxHandoverLag int64 = 60000
 )
 
 var (
@@ -34,6 +44,9 @@ var (
 
 	ErrNotFlvStream = errors.New("not flv stream")
 	ErrUnknownTag   = errors.New("unknown tag")
+	ErrInvalidTag   = errors.New("invalid tag")
+
+	errHandoverDone = errors.New("handover done")
 )
 
 func init() {
@@ -47,33 +60,88 @@ func (b *builder) Build(cfg map[string]string) (parser.Parser, error) {
 	// if err != nil {
 	// 	timeout = time.Minute
 	// }
-	return &Parser{
+	p := &Parser{
 		Metadata:  Metadata{},
 		hc:        &http.Client{},
 		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
 		closeOnce: new(sync.Once),
-	}, nil
+	}
+	p.firstKeyFrame.Store(-1)
+	p.stopAt.Store(-1)
+	return p, nil
 }
 
 type Metadata struct {
 	HasVideo, HasAudio bool
 }
 
+type status struct {
+	totalSize       int64
+	discontinuities uint64
+	// 内容相同、被丢弃的重复 sequence header
+	duplicateHeaders uint64
+	metadata         AMFProperties
+}
+
 type Parser struct {
 	Metadata Metadata
 
-	i              *reader.BufferedReader
-	o              io.Writer
-	avcHeaderCount uint8
-	tagCount       uint32
+	i        *reader.BufferedReader
+	o        *output
+	tagCount uint32
+	logger   *logrus.Entry
+
+	// 切分文件时需要在新文件开头重新写入的内容
+	header    []byte
+	metadata  AMFProperties
+	avcHeader *tag
+	aacHeader *tag
+	ts        timestampNormalizer
+
+	file        string
+	outputFiles []string
+	// outputTimes 每个输出文件开始写入的时间
+	outputTimes []time.Time
+	// 文件大小超过该值后在下一个关键帧处切分，0 为不限制
+	maxFileSize    int64
+	splitRequested atomic.Bool
+
+	// 交接使用的直播流时间戳，-1 表示未设置
+	firstKeyFrame atomic.Int64
+	stopAt        atomic.Int64
+
+	// 本地转播，为 nil 时不转播
+	tee parser.Tee
+	// 下载限速，为 nil 时不限速
+	limiter parser.RateLimiter
 
 	hc        *http.Client
 	stopCh    chan struct{}
+	doneCh    chan struct{}
 	closeOnce *sync.Once
+
+	statusLock sync.RWMutex
+	status     status
 }
 
 func (p *Parser) ParseLiveStream(ctx context.Context, streamUrlInfo *live.StreamUrlInfo, live live.Live, file string) error {
+	defer close(p.doneCh)
 	url := streamUrlInfo.Url
+	p.file = file
+	inst := instance.GetInstance(ctx)
+	p.logger = inst.Logger.WithField("parser", Name)
+	if inst.Config != nil {
+		maxFileSize := inst.Config.VideoSplitStrategies.MaxFileSize
+		if live != nil {
+			maxFileSize = inst.Config.GetRoomConfig(live.GetRawUrl()).VideoSplitStrategies.MaxFileSize
+		}
+		if maxFileSize < 0 {
+			p.logger.Infof("Invalid MaxFileSize: %d", maxFileSize)
+		} else {
+			p.maxFileSize = int64(maxFileSize)
+		}
+	}
 	// init input
 	req, err := http.NewRequest("GET", url.String(), nil)
 	if err != nil {
@@ -89,21 +157,42 @@ func (p *Parser) ParseLiveStream(ctx context.Context, streamUrlInfo *live.Stream
 		return err
 	}
 	defer resp.Body.Close()
-	p.i = reader.New(resp.Body)
-	defer p.i.Free()
-
-	// init output
-	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		return err
+	var body io.Reader = resp.Body
+	if p.limiter != nil {
+		body = p.limiter.LimitReader(ctx, body)
 	}
-	p.o = f
-	defer f.Close()
+	p.i = reader.New(body)
+	defer p.i.Free()
+	defer p.closeOutput()
 
 	// start parse
 	return p.doParse(ctx)
 }
 
+// Split 在下一个关键帧处切换到新文件，不会断开连接
+func (p *Parser) Split() error {
+	p.splitRequested.Store(true)
+	return nil
+}
+
+func (p *Parser) SetTee(tee parser.Tee) {
+	p.tee = tee
+}
+
+func (p *Parser) SetRateLimiter(l parser.RateLimiter) {
+	p.limiter = l
+}
+
+func (p *Parser) FirstKeyFrame() (uint32, bool) {
+	ts := p.firstKeyFrame.Load()
+	return uint32(ts), ts >= 0
+}
+
+func (p *Parser) StopAt(timestamp uint32) <-chan struct{} {
+	p.stopAt.Store(int64(timestamp))
+	return p.doneCh
+}
+
 func (p *Parser) Stop() error {
 	p.closeOnce.Do(func() {
 		close(p.stopCh)
@@ -129,43 +218,170 @@ func (p *Parser) doParse(ctx context.Context) error {
 	if binary.BigEndian.Uint32(b[5:]) != 9 {
 		return ErrNotFlvStream
 	}
+	p.header = append([]byte(nil), b...)
+	p.i.Reset()
+	if p.tee != nil {
+		p.tee.WriteHeader(p.header)
+	}
 
-	// write flv header
-	if err := p.doWrite(ctx, p.i.AllBytes()); err != nil {
+	// init output
+	if err := p.openOutput(ctx, p.file); err != nil {
 		return err
 	}
-	p.i.Reset()
 
 	for {
 		select {
 		case <-p.stopCh:
 			return nil
 		default:
-			if err := p.parseTag(ctx); err != nil {
+			if err := p.parseTag(ctx); err == errHandoverDone {
+				p.logger.Info("handover done")
+				return nil
+			} else if err != nil {
 				return err
 			}
 		}
 	}
 }
 
-func (p *Parser) doCopy(ctx context.Context, n uint32) error {
-	if writtenCount, err := io.CopyN(p.o, p.i, int64(n)); err != nil || writtenCount != int64(writtenCount) {
-		utils.PrintStack()
-		if err == nil {
-			err = fmt.Errorf("doCopy(%d), %d bytes written", n, writtenCount)
-		}
+// openOutput 创建输出文件并写入 flv header 与 PreviousTagSize0
+func (p *Parser) openOutput(ctx context.Context, file string) error {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	p.o = &output{f: f, file: file}
+	p.statusLock.Lock()
+	p.outputFiles = append(p.outputFiles, file)
+	p.outputTimes = append(p.outputTimes, time.Now())
+	p.statusLock.Unlock()
+	return p.doWrite(ctx, append(append([]byte(nil), p.header...), 0, 0, 0, 0))
+}
+
+func (p *Parser) closeOutput() {
+	if p.o == nil {
+		return
+	}
+	o := p.o
+	p.o = nil
+	if err := p.finishOutput(o); err != nil {
+		p.logger.WithError(err).Warnf("failed to rewrite metadata of %s", o.file)
+	}
+}
+
+// splitFile 切换到新文件，新文件以缓存的 metadata 与 sequence header 开头，时间戳从 0 重新开始
+func (p *Parser) splitFile(ctx context.Context, reason string) error {
+	p.closeOutput()
+	ext := filepath.Ext(p.file)
+	file := fmt.Sprintf("%s_P%03d%s", strings.TrimSuffix(p.file, ext), len(p.outputFiles)+1, ext)
+	p.logger.Infof("%s, continue recording in %s", reason, file)
+	if err := p.openOutput(ctx, file); err != nil {
+		return err
+	}
+	p.ts.Reset()
+	if err := p.writeMetadata(ctx); err != nil {
 		return err
 	}
+	for _, t := range []*tag{p.avcHeader, p.aacHeader} {
+		if t == nil {
+			continue
+		}
+		if err := p.write(ctx, t, 0); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// onSequenceHeader 丢弃重复的 sequence header，内容变化时切分文件
+func (p *Parser) onSequenceHeader(ctx context.Context, cache **tag, t *tag) error {
+	old := *cache
+	*cache = t
+	switch {
+	case old != nil && bytes.Equal(old.Data, t.Data):
+		p.updateStatus(func(s *status) { s.duplicateHeaders++ })
+		return nil
+	case old != nil && p.o.hasMedia:
+		return p.splitFile(ctx, "codec parameters changed")
+	default:
+		return p.write(ctx, t, p.ts.Current())
+	}
+}
+
+// writeTag 改写音视频 tag 的时间戳后写入，在不连续点之前重新写入 sequence header
+func (p *Parser) writeTag(ctx context.Context, t *tag) error {
+	if t.Type == scriptTag {
+		return p.write(ctx, t, p.ts.Current())
+	}
+	if stopAt := p.stopAt.Load(); stopAt >= 0 && p.isSplitPoint(t) {
+		if ts := int64(t.Timestamp); ts >= stopAt || stopAt-ts > maxHandoverLag {
+			return errHandoverDone
+		}
+	}
+	if t.isKeyFrame() {
+		p.firstKeyFrame.CompareAndSwap(-1, int64(t.Timestamp))
+	}
+	if p.o.hasMedia && p.isSplitPoint(t) {
+		if p.splitRequested.Swap(false) {
+			if err := p.splitFile(ctx, "split requested"); err != nil {
+				return err
+			}
+		} else if p.maxFileSize > 0 && p.o.size >= p.maxFileSize {
+			if err := p.splitFile(ctx, "max file size reached"); err != nil {
+				return err
+			}
+		}
+	}
+	timestamp, discontinuity := p.ts.Normalize(t.Type, t.Timestamp)
+	if discontinuity {
+		p.updateStatus(func(s *status) { s.discontinuities++ })
+		p.logger.Warnf("timestamp discontinuity detected at tag %d, %dms", p.tagCount, t.Timestamp)
+		for _, h := range []*tag{p.avcHeader, p.aacHeader} {
+			if h == nil {
+				continue
+			}
+			if err := p.write(ctx, h, timestamp); err != nil {
+				return err
+			}
+		}
+	}
+	p.o.hasMedia = true
+	return p.write(ctx, t, timestamp)
+}
+
+// isSplitPoint 只在视频关键帧处切分，纯音频流可以在任意音频 tag 处切分
+func (p *Parser) isSplitPoint(t *tag) bool {
+	if p.avcHeader == nil && !p.Metadata.HasVideo {
+		return t.Type == audioTag
+	}
+	return t.isKeyFrame()
+}
+
+// write 写入 tag，文件中尚无 onMetaData 时先写入 metadata
+func (p *Parser) write(ctx context.Context, t *tag, timestamp uint32) error {
+	if !p.o.hasMetadata {
+		if err := p.writeMetadata(ctx); err != nil {
+			return err
+		}
+	}
+	if t.isKeyFrame() {
+		p.o.addKeyframe(timestamp)
+	}
+	if t.Type != scriptTag && timestamp > p.o.lastTimestamp {
+		p.o.lastTimestamp = timestamp
+	}
+	return p.doWrite(ctx, t.Bytes(timestamp))
+}
+
 func (p *Parser) doWrite(ctx context.Context, b []byte) error {
 	inst := instance.GetInstance(ctx)
 	logger := inst.Logger
 	leftInputSize := len(b)
 	for retryLeft := ioRetryCount; retryLeft > 0 && leftInputSize > 0; retryLeft-- {
-		writtenCount, err := p.o.Write(b[len(b)-leftInputSize:])
+		writtenCount, err := p.o.f.Write(b[len(b)-leftInputSize:])
 		leftInputSize -= writtenCount
+		p.o.size += int64(writtenCount)
+		p.updateStatus(func(s *status) { s.totalSize += int64(writtenCount) })
 		if err != nil {
 			logger.Debugf("%s", string(debug.Stack()))
 			return err
@@ -179,3 +395,38 @@ func (p *Parser) doWrite(ctx context.Context, b []byte) error {
 	}
 	return nil
 }
+
+func (p *Parser) updateStatus(fn func(s *status)) {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+	fn(&p.status)
+}
+
+func (p *Parser) Status() (map[string]string, error) {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	s := p.status
+	metadata, _ := json.Marshal(s.metadata)
+	return map[string]string{
+		"parser":            Name,
+		"total_size":        strconv.FormatInt(s.totalSize, 10),
+		"discontinuities":   strconv.FormatUint(s.discontinuities, 10),
+		"duplicate_headers": strconv.FormatUint(s.duplicateHeaders, 10),
+		"files":             strconv.Itoa(len(p.outputFiles)),
+		"metadata":          string(metadata),
+	}, nil
+}
+
+// OutputFiles 可以在解析过程中调用，最后一个文件是正在写入的文件
+func (p *Parser) OutputFiles() []string {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	return append([]string(nil), p.outputFiles...)
+}
+
+// OutputFileTimes 返回每个输出文件开始写入的时间
+func (p *Parser) OutputFileTimes() []time.Time {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+	return append([]time.Time(nil), p.outputTimes...)
+}
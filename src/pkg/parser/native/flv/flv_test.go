@@ -0,0 +1,342 @@
+package flv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/parser"
+)
+
+func newTestContext() context.Context {
+	return context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+	})
+}
+
+var (
+	testScript   = &tag{Type: scriptTag, Data: mustEncodeAMF0("onMetaData", AMFECMAArray{AMFProperties{{"width", 1920.0}, {"duration", 0.0}}})}
+	testAvcSeq   = &tag{Type: videoTag, Data: []byte{0x17, 0, 0, 0, 0, 1}}
+	testAvcSeq2  = &tag{Type: videoTag, Data: []byte{0x17, 0, 0, 0, 0, 2}}
+	testAacSeq   = &tag{Type: audioTag, Data: []byte{0xaf, 0, 0x12, 0x10}}
+	testKeyFrame = []byte{0x17, 1, 0, 0, 0, 0xff}
+	testFrame    = []byte{0x27, 1, 0, 0, 0, 0xee}
+	testAudio    = []byte{0xaf, 1, 0xdd}
+)
+
+func mustEncodeAMF0(values ...interface{}) []byte {
+	b, err := EncodeAMF0(values...)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func buildFlv(tags ...*tag) []byte {
+	b := append([]byte(nil), flvSign...)
+	b = append(b, 5, 0, 0, 0, 9, 0, 0, 0, 0)
+	for _, t := range tags {
+		b = append(b, t.Bytes(t.Timestamp)...)
+	}
+	return b
+}
+
+// readTags 解析 flv 文件中的所有 tag
+func readTags(t *testing.T, file string) []*tag {
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(b, flvSign))
+	b = b[13:]
+	var tags []*tag
+	for len(b) > 0 {
+		size := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+		tags = append(tags, &tag{
+			Type:      b[0],
+			Timestamp: uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6]) | uint32(b[7])<<24,
+			Data:      b[tagHeaderSize : tagHeaderSize+size],
+		})
+		assert.Equal(t, uint32(tagHeaderSize+size), binary.BigEndian.Uint32(b[tagHeaderSize+size:]))
+		b = b[tagHeaderSize+size+4:]
+	}
+	return tags
+}
+
+func runParser(t *testing.T, data []byte, file string) *Parser {
+	p, err := new(builder).Build(map[string]string{})
+	assert.NoError(t, err)
+	return runParserWith(t, p.(*Parser), newTestContext(), data, file, true)
+}
+
+func runParserWith(t *testing.T, parser *Parser, ctx context.Context, data []byte, file string, eof bool) *Parser {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/live.flv")
+	err := parser.ParseLiveStream(ctx, &live.StreamUrlInfo{Url: u}, nil, file)
+	if eof {
+		// 数据读完后以 EOF 结束
+		assert.Error(t, err)
+	} else {
+		assert.NoError(t, err)
+	}
+	return parser
+}
+
+func withTs(t *tag, ts uint32) *tag {
+	return &tag{Type: t.Type, Timestamp: ts, Data: t.Data}
+}
+
+func TestParseLiveStreamDiscontinuity(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.flv")
+	p := runParser(t, buildFlv(
+		testScript,
+		testAvcSeq,
+		testAacSeq,
+		&tag{Type: videoTag, Timestamp: 50000, Data: testKeyFrame},
+		&tag{Type: audioTag, Timestamp: 50010, Data: testAudio},
+		&tag{Type: videoTag, Timestamp: 50033, Data: testFrame},
+		// CDN 重连，重复的 sequence header 与回退的时间戳
+		withTs(testAvcSeq, 0),
+		withTs(testAacSeq, 0),
+		&tag{Type: videoTag, Timestamp: 0, Data: testKeyFrame},
+		&tag{Type: audioTag, Timestamp: 10, Data: testAudio},
+	), file)
+
+	assert.Equal(t, []string{file}, p.OutputFiles())
+	tags := readTags(t, file)
+	var timestamps []uint32
+	for _, tag := range tags {
+		timestamps = append(timestamps, tag.Timestamp)
+	}
+	// script, avc, aac, 3 个媒体 tag, 不连续点前重新写入的 avc/aac, 2 个媒体 tag
+	assert.Equal(t, []uint32{0, 0, 0, 0, 10, 33, 66, 66, 66, 76}, timestamps)
+	assert.Equal(t, testAvcSeq.Data, tags[6].Data)
+	assert.Equal(t, testAacSeq.Data, tags[7].Data)
+
+	status, err := p.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", status["discontinuities"])
+	assert.Equal(t, "2", status["duplicate_headers"])
+	stat, _ := os.Stat(file)
+	assert.Equal(t, status["total_size"], strconv.FormatInt(stat.Size(), 10))
+}
+
+func TestParseLiveStreamSplitOnCodecChange(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.flv")
+	p := runParser(t, buildFlv(
+		testScript,
+		testAvcSeq,
+		testAacSeq,
+		&tag{Type: videoTag, Timestamp: 1000, Data: testKeyFrame},
+		&tag{Type: videoTag, Timestamp: 1033, Data: testFrame},
+		// 分辨率变化，新的 sps/pps
+		withTs(testAvcSeq2, 1066),
+		&tag{Type: videoTag, Timestamp: 1066, Data: testKeyFrame},
+		&tag{Type: audioTag, Timestamp: 1070, Data: testAudio},
+	), file)
+
+	part2 := filepath.Join(filepath.Dir(file), "out_P002.flv")
+	assert.Equal(t, []string{file, part2}, p.OutputFiles())
+	assert.Len(t, readTags(t, file), 5)
+
+	tags := readTags(t, part2)
+	assert.Len(t, tags, 5)
+	assert.Equal(t, scriptTag, tags[0].Type)
+	assert.Equal(t, testAvcSeq2.Data, tags[1].Data)
+	assert.Equal(t, testAacSeq.Data, tags[2].Data)
+	assert.Equal(t, uint32(0), tags[3].Timestamp)
+	assert.Equal(t, uint32(4), tags[4].Timestamp)
+	status, _ := p.Status()
+	assert.Equal(t, "2", status["files"])
+	assert.Equal(t, `{"width":1920,"duration":0}`, status["metadata"])
+
+	metadata, err := ReadMetadata(part2)
+	assert.NoError(t, err)
+	width, _ := metadata.Get("width")
+	assert.Equal(t, 1920.0, width)
+	duration, _ := metadata.Get("duration")
+	assert.Equal(t, 0.004, duration)
+}
+
+func testMetadata(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.flv")
+	runParser(t, buildFlv(
+		testScript,
+		testAvcSeq,
+		testAacSeq,
+		&tag{Type: videoTag, Timestamp: 0, Data: testKeyFrame},
+		&tag{Type: audioTag, Timestamp: 10, Data: testAudio},
+		&tag{Type: videoTag, Timestamp: 2000, Data: testKeyFrame},
+		&tag{Type: videoTag, Timestamp: 2033, Data: testFrame},
+		&tag{Type: videoTag, Timestamp: 4000, Data: testKeyFrame},
+	), file)
+
+	metadata, err := ReadMetadata(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "width", metadata[0].Key)
+	duration, _ := metadata.Get("duration")
+	assert.Equal(t, 4.0, duration)
+	filesize, _ := metadata.Get("filesize")
+	stat, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(stat.Size()), filesize)
+
+	keyframes, _ := metadata.Get("keyframes")
+	times, _ := keyframes.(AMFObject).Get("times")
+	assert.Equal(t, []interface{}{0.0, 2.0, 4.0}, times)
+	positions, _ := keyframes.(AMFObject).Get("filepositions")
+	b, _ := os.ReadFile(file)
+	assert.Len(t, positions, 3)
+	for _, pos := range positions.([]interface{}) {
+		offset := int(pos.(float64))
+		assert.Equal(t, videoTag, b[offset])
+		assert.Equal(t, testKeyFrame, b[offset+tagHeaderSize:offset+tagHeaderSize+len(testKeyFrame)])
+	}
+	// 改写后所有 tag 仍然完整
+	assert.Len(t, readTags(t, file), 8)
+}
+
+func TestMetadata(t *testing.T) {
+	t.Run("in place", testMetadata)
+	t.Run("rewrite", func(t *testing.T) {
+		backup := metadataPaddingSize
+		metadataPaddingSize = 0
+		defer func() { metadataPaddingSize = backup }()
+		testMetadata(t)
+	})
+}
+
+func TestParseLiveStreamSplit(t *testing.T) {
+	data := buildFlv(
+		testScript,
+		testAvcSeq,
+		testAacSeq,
+		&tag{Type: videoTag, Timestamp: 1000, Data: testKeyFrame},
+		&tag{Type: audioTag, Timestamp: 1010, Data: testAudio},
+		&tag{Type: videoTag, Timestamp: 1033, Data: testFrame},
+		&tag{Type: videoTag, Timestamp: 3000, Data: testKeyFrame},
+		&tag{Type: audioTag, Timestamp: 3010, Data: testAudio},
+	)
+	check := func(p *Parser, file string) {
+		part2 := filepath.Join(filepath.Dir(file), "out_P002.flv")
+		assert.Equal(t, []string{file, part2}, p.OutputFiles())
+		assert.Len(t, readTags(t, file), 6)
+		tags := readTags(t, part2)
+		// metadata, avc, aac, 关键帧, 音频
+		assert.Len(t, tags, 5)
+		assert.Equal(t, testAvcSeq.Data, tags[1].Data)
+		assert.Equal(t, testAacSeq.Data, tags[2].Data)
+		assert.Equal(t, testKeyFrame, tags[3].Data)
+		assert.Equal(t, uint32(0), tags[3].Timestamp)
+		assert.Equal(t, uint32(10), tags[4].Timestamp)
+	}
+
+	t.Run("requested", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "out.flv")
+		p, _ := new(builder).Build(map[string]string{})
+		// 文件中还没有音视频数据，请求会保留到下一个关键帧
+		assert.NoError(t, p.(*Parser).Split())
+		check(runParserWith(t, p.(*Parser), newTestContext(), data, file, true), file)
+	})
+
+	t.Run("max file size", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "out.flv")
+		cfg := configs.NewConfig()
+		cfg.VideoSplitStrategies.MaxFileSize = 1
+		ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+			Config: cfg,
+			Logger: &interfaces.Logger{Logger: logrus.New()},
+		})
+		p, _ := new(builder).Build(map[string]string{})
+		check(runParserWith(t, p.(*Parser), ctx, data, file, true), file)
+	})
+}
+
+func TestHandover(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.flv")
+	p, _ := new(builder).Build(map[string]string{})
+	parser := p.(*Parser)
+	_, ok := parser.FirstKeyFrame()
+	assert.False(t, ok)
+	done := parser.StopAt(3000)
+	// 在 3000ms 处的关键帧结束，该关键帧属于新的录制器
+	runParserWith(t, parser, newTestContext(), buildFlv(
+		testScript,
+		testAvcSeq,
+		testAacSeq,
+		&tag{Type: videoTag, Timestamp: 1000, Data: testKeyFrame},
+		&tag{Type: videoTag, Timestamp: 2000, Data: testKeyFrame},
+		&tag{Type: audioTag, Timestamp: 2990, Data: testAudio},
+		&tag{Type: videoTag, Timestamp: 3000, Data: testKeyFrame},
+		&tag{Type: audioTag, Timestamp: 3010, Data: testAudio},
+	), file, false)
+	<-done
+	ts, ok := parser.FirstKeyFrame()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1000), ts)
+	assert.Len(t, readTags(t, file), 6)
+}
+
+func TestParseTagHeader(t *testing.T) {
+	h, err := parseVideoTagHeader([]byte{0x1c, 0, 0, 0, 0})
+	assert.NoError(t, err)
+	assert.Equal(t, HEVCCode, h.CodeID)
+	assert.True(t, h.isSequenceHeader())
+	_, err = parseVideoTagHeader([]byte{0x17})
+	assert.Equal(t, ErrInvalidTag, err)
+
+	a, err := parseAudioTagHeader(testAacSeq.Data)
+	assert.NoError(t, err)
+	assert.True(t, a.isSequenceHeader())
+	assert.True(t, (&tag{Type: videoTag, Data: testKeyFrame}).isKeyFrame())
+	assert.False(t, (&tag{Type: videoTag, Data: testFrame}).isKeyFrame())
+}
+
+type recordingTee struct {
+	header []byte
+	tags   []*parser.Tag
+}
+
+func (r *recordingTee) WriteHeader(header []byte) {
+	r.header = header
+}
+
+func (r *recordingTee) WriteTag(tag *parser.Tag) {
+	r.tags = append(r.tags, tag)
+}
+
+func TestParseLiveStreamTee(t *testing.T) {
+	tee := new(recordingTee)
+	p, err := new(builder).Build(map[string]string{})
+	assert.NoError(t, err)
+	p.(parser.TeeParser).SetTee(tee)
+	runParserWith(t, p.(*Parser), newTestContext(), buildFlv(
+		testScript,
+		testAvcSeq,
+		&tag{Type: videoTag, Timestamp: 100, Data: testKeyFrame},
+		&tag{Type: videoTag, Timestamp: 133, Data: testFrame},
+	), filepath.Join(t.TempDir(), "out.flv"), true)
+
+	assert.Equal(t, flvSign, tee.header[:4])
+	assert.Len(t, tee.tags, 4)
+	assert.Equal(t, scriptTag, tee.tags[0].Type)
+	assert.True(t, tee.tags[1].SequenceHeader)
+	assert.True(t, tee.tags[2].KeyFrame)
+	assert.Equal(t, uint32(133), tee.tags[3].Timestamp)
+	assert.False(t, tee.tags[3].KeyFrame)
+}
@@ -0,0 +1,197 @@
+package flv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	metadataPaddingKey = "padding"
+	// padding 属性自身的开销: 属性名长度(2) + 属性名 + 类型(1) + 字符串长度(2)
+	metadataPaddingOverhead = 2 + len(metadataPaddingKey) + 1 + 2
+)
+
+// for test
+// 在文件开头的 onMetaData 中预留的空间，足够容纳约 3400 个关键帧的索引，超出时通过复制文件改写
+var metadataPaddingSize = 60 * 1024
+
+var ErrNoMetadata = errors.New("no onMetaData found")
+
+// 由解析器生成、需要丢弃的源站 metadata 属性
+var generatedMetadataKeys = []string{"duration", "filesize", "keyframes", metadataPaddingKey}
+
+// decodeMetadata 解析 onMetaData script tag，其他 script tag 返回 false
+func decodeMetadata(data []byte) (AMFProperties, bool) {
+	// 部分源站的 script tag 末尾带有无法解析的数据，只要前两个值正确即可
+	values, _ := DecodeAMF0(data)
+	if len(values) < 2 || values[0] != "onMetaData" {
+		return nil, false
+	}
+	switch v := values[1].(type) {
+	case AMFECMAArray:
+		return v.AMFProperties, true
+	case AMFObject:
+		return v.AMFProperties, true
+	default:
+		return nil, false
+	}
+}
+
+func encodeMetadata(props AMFProperties) ([]byte, error) {
+	return EncodeAMF0("onMetaData", AMFECMAArray{props})
+}
+
+// buildMetadata 基于源站的 metadata 生成写入文件的 metadata，
+// final 为 false 时 duration、filesize 与关键帧索引为空，delta 为关键帧位置的修正量
+func (p *Parser) buildMetadata(o *output, final bool, delta int64) AMFProperties {
+	props := append(AMFProperties(nil), p.metadata...)
+	for _, key := range generatedMetadataKeys {
+		props.Delete(key)
+	}
+	var (
+		duration, filesize float64
+		times              = []interface{}{}
+		positions          = []interface{}{}
+	)
+	if final {
+		duration = float64(o.lastTimestamp) / 1000
+		filesize = float64(o.size + delta)
+		times = o.keyframeTimes
+		for _, pos := range o.keyframePositions {
+			positions = append(positions, pos.(float64)+float64(delta))
+		}
+	}
+	props.Set("duration", duration)
+	props.Set("filesize", filesize)
+	props.Set("keyframes", AMFObject{AMFProperties{
+		{"times", times},
+		{"filepositions", positions},
+	}})
+	return props
+}
+
+// writeMetadata 在文件开头写入带有预留空间的 onMetaData
+func (p *Parser) writeMetadata(ctx context.Context) error {
+	props := p.buildMetadata(p.o, false, 0)
+	props.Set(metadataPaddingKey, strings.Repeat(" ", metadataPaddingSize))
+	data, err := encodeMetadata(props)
+	if err != nil {
+		return err
+	}
+	p.o.hasMetadata = true
+	p.o.metadataOffset = p.o.size
+	p.o.metadataSize = len(data)
+	return p.doWrite(ctx, (&tag{Type: scriptTag, Data: data}).Bytes(0))
+}
+
+// finishOutput 写入最终的 duration、filesize 与关键帧索引并关闭文件，
+// 预留空间足够时原地改写，否则复制一份新文件
+func (p *Parser) finishOutput(o *output) error {
+	if !o.hasMetadata {
+		return o.f.Close()
+	}
+	props := p.buildMetadata(o, true, 0)
+	data, err := encodeMetadata(props)
+	if err != nil {
+		o.f.Close()
+		return err
+	}
+	if diff := o.metadataSize - len(data); diff == 0 ||
+		(diff >= metadataPaddingOverhead && diff-metadataPaddingOverhead <= math.MaxUint16) {
+		if diff > 0 {
+			props.Set(metadataPaddingKey, strings.Repeat(" ", diff-metadataPaddingOverhead))
+			if data, err = encodeMetadata(props); err != nil {
+				o.f.Close()
+				return err
+			}
+		}
+		_, err = o.f.WriteAt(data, o.metadataOffset+tagHeaderSize)
+		if closeErr := o.f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+
+	if err := o.f.Close(); err != nil {
+		return err
+	}
+	// 关键帧索引的长度与位置的取值无关，修正一次即可
+	delta := int64(len(data) - o.metadataSize)
+	if data, err = encodeMetadata(p.buildMetadata(o, true, delta)); err != nil {
+		return err
+	}
+	return rewriteMetadata(o, data)
+}
+
+// rewriteMetadata 将新的 onMetaData 与原文件的其余部分复制到临时文件后替换原文件
+func rewriteMetadata(o *output, data []byte) (err error) {
+	src, err := os.Open(o.file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := o.file + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err = io.CopyN(dst, src, o.metadataOffset); err != nil {
+		return err
+	}
+	if _, err = dst.Write((&tag{Type: scriptTag, Data: data}).Bytes(0)); err != nil {
+		return err
+	}
+	if _, err = src.Seek(o.metadataOffset+int64(tagHeaderSize+o.metadataSize+4), io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Rename(tmp, o.file)
+}
+
+// ReadMetadata 读取 flv 文件开头的 onMetaData
+func ReadMetadata(file string) (AMFProperties, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, 9+4+tagHeaderSize)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b[:4], flvSign) {
+		return nil, ErrNotFlvStream
+	}
+	h := b[13:]
+	if h[0]&0x1f != scriptTag {
+		return nil, ErrNoMetadata
+	}
+	data := make([]byte, int(h[1])<<16|int(h[2])<<8|int(h[3]))
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	props, ok := decodeMetadata(data)
+	if !ok {
+		return nil, ErrNoMetadata
+	}
+	return props, nil
+}
@@ -0,0 +1,26 @@
+package flv
+
+import "os"
+
+type output struct {
+	f    *os.File
+	file string
+	size int64
+	// 是否已经写入过音视频数据
+	hasMedia bool
+
+	// 文件开头 onMetaData tag 的位置与 tag data 长度，关闭文件时原地改写
+	hasMetadata    bool
+	metadataOffset int64
+	metadataSize   int
+
+	lastTimestamp     uint32
+	keyframeTimes     []interface{}
+	keyframePositions []interface{}
+}
+
+// addKeyframe 记录即将写入的关键帧，位置为 tag 在文件中的起始偏移
+func (o *output) addKeyframe(timestamp uint32) {
+	o.keyframeTimes = append(o.keyframeTimes, float64(timestamp)/1000)
+	o.keyframePositions = append(o.keyframePositions, float64(o.size))
+}
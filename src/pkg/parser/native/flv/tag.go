@@ -1,33 +1,100 @@
 package flv
 
-import "context"
+import (
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/bililive-go/bililive-go/src/pkg/parser"
+)
+
+const tagHeaderSize = 11
+
+type tag struct {
+	Type      uint8
+	Timestamp uint32
+	Data      []byte
+}
+
+func (t *tag) isVideoSequenceHeader() bool {
+	if t.Type != videoTag {
+		return false
+	}
+	h, err := parseVideoTagHeader(t.Data)
+	return err == nil && h.isSequenceHeader()
+}
+
+func (t *tag) isAudioSequenceHeader() bool {
+	if t.Type != audioTag {
+		return false
+	}
+	h, err := parseAudioTagHeader(t.Data)
+	return err == nil && h.isSequenceHeader()
+}
+
+func (t *tag) isKeyFrame() bool {
+	if t.Type != videoTag {
+		return false
+	}
+	h, err := parseVideoTagHeader(t.Data)
+	return err == nil && h.FrameType == KeyFrame && !h.isSequenceHeader()
+}
+
+// Bytes 按照给定的时间戳序列化 tag，包含末尾的 PreviousTagSize
+func (t *tag) Bytes(timestamp uint32) []byte {
+	size := len(t.Data)
+	b := make([]byte, tagHeaderSize+size+4)
+	b[0] = t.Type
+	b[1], b[2], b[3] = byte(size>>16), byte(size>>8), byte(size)
+	b[4], b[5], b[6] = byte(timestamp>>16), byte(timestamp>>8), byte(timestamp)
+	b[7] = byte(timestamp >> 24)
+	// StreamID 总是 0
+	copy(b[tagHeaderSize:], t.Data)
+	binary.BigEndian.PutUint32(b[tagHeaderSize+size:], uint32(tagHeaderSize+size))
+	return b
+}
 
 func (p *Parser) parseTag(ctx context.Context) error {
 	p.tagCount += 1
 
-	b, err := p.i.ReadN(15)
+	// PreviousTagSize + tag header
+	b, err := p.i.ReadN(4 + tagHeaderSize)
 	if err != nil {
 		return err
 	}
 
-	tagType := uint8(b[4])
+	tagType := uint8(b[4]) & 0x1f
 	length := uint32(b[5])<<16 | uint32(b[6])<<8 | uint32(b[7])
 	timeStamp := uint32(b[8])<<16 | uint32(b[9])<<8 | uint32(b[10]) | uint32(b[11])<<24
+	p.i.Reset()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(p.i, data); err != nil {
+		return err
+	}
+	t := &tag{
+		Type:      tagType,
+		Timestamp: timeStamp,
+		Data:      data,
+	}
+	if p.tee != nil {
+		p.tee.WriteTag(&parser.Tag{
+			Type:           t.Type,
+			Timestamp:      t.Timestamp,
+			Data:           t.Data,
+			KeyFrame:       t.isKeyFrame(),
+			SequenceHeader: t.isVideoSequenceHeader() || t.isAudioSequenceHeader(),
+		})
+	}
 
 	switch tagType {
 	case audioTag:
-		if _, err := p.parseAudioTag(ctx, length, timeStamp); err != nil {
-			return err
-		}
+		return p.parseAudioTag(ctx, t)
 	case videoTag:
-		if _, err := p.parseVideoTag(ctx, length, timeStamp); err != nil {
-			return err
-		}
+		return p.parseVideoTag(ctx, t)
 	case scriptTag:
-		return p.parseScriptTag(ctx, length)
+		return p.parseScriptTag(ctx, t)
 	default:
 		return ErrUnknownTag
 	}
-
-	return nil
 }
@@ -47,37 +47,36 @@ const (
 	AACRaw       AACPacketType = 1
 )
 
-func (p *Parser) parseAudioTag(ctx context.Context, length, timestamp uint32) (*AudioTagHeader, error) {
-	b, err := p.i.ReadByte()
-	l := length - 1
-	if err != nil {
-		return nil, err
+func parseAudioTagHeader(data []byte) (*AudioTagHeader, error) {
+	if len(data) < 1 {
+		return nil, ErrInvalidTag
 	}
 	tag := new(AudioTagHeader)
-
-	tag.SoundFormat = SoundFormat(b >> 4 & 15)
-	tag.SoundRate = SoundRate(b >> 2 & 3)
-	tag.SoundSize = SoundSize(b >> 1 & 1)
-	tag.SoundType = SoundType(b & 1)
+	tag.SoundFormat = SoundFormat(data[0] >> 4 & 15)
+	tag.SoundRate = SoundRate(data[0] >> 2 & 3)
+	tag.SoundSize = SoundSize(data[0] >> 1 & 1)
+	tag.SoundType = SoundType(data[0] & 1)
 
 	if tag.SoundFormat == AAC {
-		b, err := p.i.ReadByte()
-		l -= 1
-		if err != nil {
-			return nil, err
+		if len(data) < 2 {
+			return nil, ErrInvalidTag
 		}
-		tag.AACPacketType = AACPacketType(b)
+		tag.AACPacketType = AACPacketType(data[1])
 	}
+	return tag, nil
+}
 
-	// write tag header && audio tag header & AACPacketType
-	if err := p.doWrite(ctx, p.i.AllBytes()); err != nil {
-		return nil, err
+func (h *AudioTagHeader) isSequenceHeader() bool {
+	return h.SoundFormat == AAC && h.AACPacketType == AACSeqHeader
+}
+
+func (p *Parser) parseAudioTag(ctx context.Context, t *tag) error {
+	h, err := parseAudioTagHeader(t.Data)
+	if err != nil {
+		return err
 	}
-	p.i.Reset()
-	// write body
-	if err := p.doCopy(ctx, l); err != nil {
-		return nil, err
+	if h.isSequenceHeader() {
+		return p.onSequenceHeader(ctx, &p.aacHeader, t)
 	}
-
-	return tag, nil
+	return p.writeTag(ctx, t)
 }
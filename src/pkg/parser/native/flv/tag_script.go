@@ -17,18 +17,22 @@ const (
 	StrictArray     DataType = 10
 	Date            DataType = 11
 	LongString      DataType = 12
+	Unsupported     DataType = 13
+	XMLDocument     DataType = 15
+	TypedObject     DataType = 16
 )
 
-func (p *Parser) parseScriptTag(ctx context.Context, length uint32) error {
-	// TODO: parse script tag content
-	// write tag header
-	if err := p.doWrite(ctx, p.i.AllBytes()); err != nil {
-		return err
+func (p *Parser) parseScriptTag(ctx context.Context, t *tag) error {
+	props, ok := decodeMetadata(t.Data)
+	if !ok {
+		// 其他 script tag 原样写入
+		return p.writeTag(ctx, t)
 	}
-	p.i.Reset()
-	// write body
-	if err := p.doCopy(ctx, length); err != nil {
-		return err
+	p.updateStatus(func(s *status) { s.metadata = props })
+	if p.o.hasMetadata {
+		// 每个文件只保留开头的 onMetaData
+		return nil
 	}
-	return nil
+	p.metadata = props
+	return p.writeMetadata(ctx)
 }
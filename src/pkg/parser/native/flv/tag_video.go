@@ -2,7 +2,6 @@ package flv
 
 import (
 	"context"
-	"errors"
 )
 
 type (
@@ -27,12 +26,13 @@ const (
 	VideoInfoFrame       FrameType = 5 // video info/command frame
 
 	// CodeID
-	H263Code          CodeID = 2 // Sorenson H.263
-	ScreenVideoCode   CodeID = 3 // Screen video
-	VP6Code           CodeID = 4 // On2 VP6
-	VP6AlphaCode      CodeID = 5 // On2 VP6 with alpha channel
-	ScreenVideoV2Code CodeID = 6 // Screen video version 2
-	AVCCode           CodeID = 7 // AVC
+	H263Code          CodeID = 2  // Sorenson H.263
+	ScreenVideoCode   CodeID = 3  // Screen video
+	VP6Code           CodeID = 4  // On2 VP6
+	VP6AlphaCode      CodeID = 5  // On2 VP6 with alpha channel
+	ScreenVideoV2Code CodeID = 6  // Screen video version 2
+	AVCCode           CodeID = 7  // AVC
+	HEVCCode          CodeID = 12 // HEVC, non-standard extension used by chinese CDNs
 
 	// AVCPacketType
 	AVCSeqHeader AVCPacketType = 0 // AVC sequence header
@@ -40,52 +40,37 @@ const (
 	AVCEndSeq    AVCPacketType = 2 // AVC end of sequence (lower level NALU sequence ender is not required or supported)
 )
 
-func (p *Parser) parseVideoTag(ctx context.Context, length, timestamp uint32) (*VideoTagHeader, error) {
-	// header
-	b, err := p.i.ReadByte()
-	l := length - 1
-	if err != nil {
-		return nil, err
+func parseVideoTagHeader(data []byte) (*VideoTagHeader, error) {
+	if len(data) < 1 {
+		return nil, ErrInvalidTag
 	}
 	tag := new(VideoTagHeader)
-	tag.FrameType = FrameType(b >> 4 & 15)
-	tag.CodeID = CodeID(b & 15)
+	tag.FrameType = FrameType(data[0] >> 4 & 15)
+	tag.CodeID = CodeID(data[0] & 15)
 
-	if tag.CodeID == AVCCode {
-		// read AVCPacketType
-		b, err := p.i.ReadByte()
-		l -= 1
-		if err != nil {
-			return nil, err
+	if tag.CodeID == AVCCode || tag.CodeID == HEVCCode {
+		if len(data) < 5 {
+			return nil, ErrInvalidTag
 		}
-		tag.AVCPacketType = AVCPacketType(b)
-		switch tag.AVCPacketType {
-		case AVCNALU:
-			// read CompositionTime
-			b, err := p.i.ReadN(3)
-			l -= 3
-			if err != nil {
-				return nil, err
-			}
-			tag.CompositionTime = uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
-		case AVCSeqHeader:
-			p.avcHeaderCount++
-			if p.avcHeaderCount > 1 {
-				// new sps pps
-				return nil, errors.New("EOF new sps pps")
-			}
+		tag.AVCPacketType = AVCPacketType(data[1])
+		if tag.AVCPacketType == AVCNALU {
+			tag.CompositionTime = uint32(data[2])<<16 | uint32(data[3])<<8 | uint32(data[4])
 		}
 	}
+	return tag, nil
+}
+
+func (h *VideoTagHeader) isSequenceHeader() bool {
+	return (h.CodeID == AVCCode || h.CodeID == HEVCCode) && h.AVCPacketType == AVCSeqHeader
+}
 
-	// write tag header && video tag header & AVCPacketType & CompositionTime
-	if err := p.doWrite(ctx, p.i.AllBytes()); err != nil {
-		return nil, err
+func (p *Parser) parseVideoTag(ctx context.Context, t *tag) error {
+	h, err := parseVideoTagHeader(t.Data)
+	if err != nil {
+		return err
 	}
-	p.i.Reset()
-	// write body
-	if err := p.doCopy(ctx, l); err != nil {
-		return nil, err
+	if h.isSequenceHeader() {
+		return p.onSequenceHeader(ctx, &p.avcHeader, t)
 	}
-
-	return tag, nil
+	return p.writeTag(ctx, t)
 }
@@ -0,0 +1,58 @@
+package flv
+
+const (
+	// 时间戳回退超过该值视为不连续（音视频交织本身会带来少量回退）
+	maxTimestampRewind int64 = 1000
+	// 相邻 tag 时间戳前跳超过该值视为不连续
+	maxTimestampGap int64 = 5000
+	// 修复不连续时，新时间线与上一个 tag 之间的间隔
+	defaultTagInterval int64 = 33
+)
+
+// timestampNormalizer 将输入的音视频时间戳改写为从 0 开始的单调时间线，
+// CDN 重连、编码器重启导致的回退或大幅跳变会被拼接到上一个 tag 之后
+type timestampNormalizer struct {
+	started       bool
+	offset        int64
+	lastIn        int64
+	lastOut       int64
+	lastOutByType map[uint8]int64
+}
+
+func (n *timestampNormalizer) Reset() {
+	*n = timestampNormalizer{}
+}
+
+// Normalize 返回改写后的时间戳，以及该 tag 是否位于不连续点上
+func (n *timestampNormalizer) Normalize(tagType uint8, timestamp uint32) (uint32, bool) {
+	in := int64(timestamp)
+	discontinuity := false
+	if !n.started {
+		n.started = true
+		n.offset = -in
+		n.lastOutByType = make(map[uint8]int64)
+	} else if delta := in - n.lastIn; delta < -maxTimestampRewind || delta > maxTimestampGap {
+		discontinuity = true
+		n.offset = n.lastOut + defaultTagInterval - in
+	}
+	n.lastIn = in
+
+	out := in + n.offset
+	// 同一类型的 tag 不允许时间戳回退
+	if last, ok := n.lastOutByType[tagType]; ok && out < last {
+		out = last
+	}
+	if out < 0 {
+		out = 0
+	}
+	n.lastOutByType[tagType] = out
+	if out > n.lastOut {
+		n.lastOut = out
+	}
+	return uint32(out), discontinuity
+}
+
+// Current 返回最近输出的时间戳，用于写入不参与归一化的 script tag 与 sequence header
+func (n *timestampNormalizer) Current() uint32 {
+	return uint32(n.lastOut)
+}
@@ -0,0 +1,40 @@
+package flv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampNormalizer(t *testing.T) {
+	var n timestampNormalizer
+	cases := []struct {
+		tagType       uint8
+		in, out       uint32
+		discontinuity bool
+	}{
+		{videoTag, 100000, 0, false},
+		{audioTag, 100010, 10, false},
+		{videoTag, 100033, 33, false},
+		// 音视频交织导致的少量回退
+		{audioTag, 100020, 20, false},
+		// 编码器重启，时间戳回到 0
+		{videoTag, 0, 66, true},
+		{audioTag, 20, 86, false},
+		{videoTag, 33, 99, false},
+		// 大幅前跳
+		{videoTag, 60000, 132, true},
+		// 同类型 tag 不允许回退
+		{videoTag, 59990, 132, false},
+	}
+	for i, c := range cases {
+		out, discontinuity := n.Normalize(c.tagType, c.in)
+		assert.Equal(t, c.out, out, "case %d", i)
+		assert.Equal(t, c.discontinuity, discontinuity, "case %d", i)
+	}
+
+	n.Reset()
+	out, discontinuity := n.Normalize(videoTag, 5000)
+	assert.Equal(t, uint32(0), out)
+	assert.False(t, discontinuity)
+}
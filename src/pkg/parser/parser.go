@@ -4,6 +4,8 @@ package parser
 import (
 	"context"
 	"errors"
+	"io"
+	"time"
 
 	"github.com/bililive-go/bililive-go/src/live"
 )
@@ -22,6 +24,73 @@ type StatusParser interface {
 	Status() (map[string]string, error)
 }
 
+// FilesParser 实际输出的文件可能与传入的文件名不同（例如更换了扩展名），
+// 通过 OutputFiles 返回本次解析写出的全部文件
+type FilesParser interface {
+	Parser
+	OutputFiles() []string
+}
+
+// FileTimesParser 可以返回 OutputFiles 中每个文件开始写入的时间，用于对齐弹幕等按时间记录的数据
+type FileTimesParser interface {
+	FilesParser
+	// OutputFileTimes 与 OutputFiles 一一对应
+	OutputFileTimes() []time.Time
+}
+
+// SplitParser 可以在不断开连接的情况下切换到新的文件
+type SplitParser interface {
+	FilesParser
+	// Split 请求在下一个关键帧处切分文件，立即返回
+	Split() error
+}
+
+// HandoverParser 可以与另一个录制同一直播流的解析器交接，裁剪两者重叠的部分
+type HandoverParser interface {
+	Parser
+	// FirstKeyFrame 返回写入的第一个关键帧在直播流中的时间戳
+	FirstKeyFrame() (uint32, bool)
+	// StopAt 在直播流时间戳不小于 timestamp 的第一个关键帧处结束解析，返回的 channel 在解析结束后关闭
+	StopAt(timestamp uint32) <-chan struct{}
+}
+
+// Tag 直播流中的一个 flv tag，时间戳为直播流中的原始时间戳
+type Tag struct {
+	Type      uint8
+	Timestamp uint32
+	Data      []byte
+	// KeyFrame 视频关键帧，不包括 sequence header
+	KeyFrame       bool
+	SequenceHeader bool
+}
+
+// Tee 接收解析器读到的直播流，用于本地转播，实现不能阻塞解析
+type Tee interface {
+	// WriteHeader 写入 flv header，每个连接只调用一次
+	WriteHeader(header []byte)
+	WriteTag(tag *Tag)
+}
+
+// TeeParser 可以在录制的同时把直播流交给 Tee
+type TeeParser interface {
+	Parser
+	// SetTee 需要在 ParseLiveStream 之前调用
+	SetTee(tee Tee)
+}
+
+// RateLimiter 限制解析器的下载速度
+type RateLimiter interface {
+	// LimitReader 返回按限速读取 r 的 Reader
+	LimitReader(ctx context.Context, r io.Reader) io.Reader
+}
+
+// LimitedParser 可以限制下载直播流的速度
+type LimitedParser interface {
+	Parser
+	// SetRateLimiter 需要在 ParseLiveStream 之前调用
+	SetRateLimiter(l RateLimiter)
+}
+
 var m = make(map[string]Builder)
 
 func Register(name string, b Builder) {
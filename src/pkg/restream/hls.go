@@ -0,0 +1,165 @@
+package restream
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	hlsPlaylist = "index.m3u8"
+	// 超过该时长没有请求时停止封装
+	hlsIdleTimeout = 30 * time.Second
+	// 第一次请求时等待 ffmpeg 生成播放列表的时长
+	hlsWaitTimeout = 15 * time.Second
+)
+
+// for test
+var hlsPollInterval = 200 * time.Millisecond
+
+// hlsPackager 使用 ffmpeg 把转播的 flv 以流复制的方式封装为 HLS，文件保存在临时目录中
+type hlsPackager struct {
+	dir        string
+	cancel     context.CancelFunc
+	done       chan struct{}
+	lastAccess atomic.Int64
+}
+
+func (p *hlsPackager) touch() {
+	p.lastAccess.Store(time.Now().UnixNano())
+}
+
+func (p *hlsPackager) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// watch 无人请求一段时间后停止 ffmpeg
+func (p *hlsPackager) watch(ctx context.Context) {
+	ticker := time.NewTicker(hlsIdleTimeout / 6)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, p.lastAccess.Load())) > hlsIdleTimeout {
+				p.cancel()
+				return
+			}
+		}
+	}
+}
+
+func (h *Hub) startHLS(ffmpegPath string) (*hlsPackager, error) {
+	h.hlsLock.Lock()
+	defer h.hlsLock.Unlock()
+	if h.hls != nil && !h.hls.stopped() {
+		return h.hls, nil
+	}
+	sub, err := h.Subscribe()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "bililive-hls-")
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "flv", "-i", "pipe:0",
+		"-c", "copy",
+		"-f", "hls",
+		"-hls_time", "2",
+		"-hls_list_size", "6",
+		"-hls_flags", "delete_segments+temp_file",
+		"-hls_segment_filename", filepath.Join(dir, "seg%05d.ts"),
+		filepath.Join(dir, hlsPlaylist),
+	)
+	stdin, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		cancel()
+		sub.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	p := &hlsPackager{
+		dir:    dir,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	p.touch()
+	go func() {
+		sub.Copy(ctx, stdin)
+		stdin.Close()
+	}()
+	go func() {
+		cmd.Wait()
+		cancel()
+		os.RemoveAll(dir)
+		close(p.done)
+	}()
+	go p.watch(ctx)
+	h.hls = p
+	return p, nil
+}
+
+func (h *Hub) stopHLS() {
+	h.hlsLock.Lock()
+	defer h.hlsLock.Unlock()
+	if h.hls != nil {
+		h.hls.cancel()
+		h.hls = nil
+	}
+}
+
+// ServeHLS 返回 HLS 的播放列表或分片，第一次请求时启动 ffmpeg，无人请求一段时间后自动停止
+func (h *Hub) ServeHLS(w http.ResponseWriter, r *http.Request, ffmpegPath, file string) {
+	p, err := h.startHLS(ffmpegPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	p.touch()
+	path := filepath.Join(p.dir, filepath.Base(file))
+	switch filepath.Ext(path) {
+	case ".m3u8":
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+	case ".ts":
+		w.Header().Set("Content-Type", "video/mp2t")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	// 刚启动时播放列表还没有生成
+	deadline := time.Now().Add(hlsWaitTimeout)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if p.stopped() || time.Now().After(deadline) {
+			http.NotFound(w, r)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(hlsPollInterval):
+		}
+	}
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,264 @@
+package restream
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/bililive-go/bililive-go/src/pkg/parser"
+)
+
+const (
+	audioTag  uint8 = 8
+	videoTag  uint8 = 9
+	scriptTag uint8 = 18
+
+	tagHeaderSize = 11
+
+	// 时间戳跳变超过该值（毫秒）时认为直播流不连续，接在上一个 tag 之后继续
+	maxTimestampJump int64 = 5000
+	// GOP 超过该数量的 tag 时不再缓存，等待下一个关键帧
+	maxGopTags = 4096
+)
+
+var (
+	ErrHubClosed    = errors.New("restream is closed")
+	ErrSlowConsumer = errors.New("subscriber is too slow")
+)
+
+// Hub 把一个直播间的 flv 直播流分发给本地的订阅者
+//
+// 录制器每次连接直播流都通过 NewSource 得到一个新的来源，最后写入 header 的来源生效，
+// 重连、切分与交接时订阅者看到的仍是同一条连续的直播流
+type Hub struct {
+	bufferSize int
+
+	lock   sync.Mutex
+	closed bool
+	source *source
+	// 新的订阅者首先收到的内容
+	header    []byte
+	metadata  []byte
+	avcHeader []byte
+	aacHeader []byte
+	gop       [][]byte
+	// 输出时间戳与来源时间戳的差值
+	offset        int64
+	lastTimestamp uint32
+	rebase        bool
+
+	subscribers map[*Subscriber]struct{}
+
+	hlsLock sync.Mutex
+	hls     *hlsPackager
+}
+
+func newHub(bufferSize int) *Hub {
+	return &Hub{
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+// NewSource 返回交给解析器的 Tee
+func (h *Hub) NewSource() parser.Tee {
+	return &source{hub: h}
+}
+
+type source struct {
+	hub *Hub
+}
+
+func (s *source) WriteHeader(header []byte) {
+	h := s.hub
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return
+	}
+	h.source = s
+	h.rebase = true
+	if h.header == nil {
+		h.header = append(append([]byte(nil), header...), 0, 0, 0, 0)
+		h.broadcast(h.header)
+	}
+}
+
+func (s *source) WriteTag(t *parser.Tag) {
+	h := s.hub
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed || h.source != s {
+		return
+	}
+	b := tagBytes(t, h.timestamp(t))
+	switch {
+	case t.Type == scriptTag:
+		h.metadata = b
+	case t.SequenceHeader && t.Type == videoTag:
+		h.avcHeader = b
+	case t.SequenceHeader && t.Type == audioTag:
+		h.aacHeader = b
+	case t.KeyFrame:
+		h.gop = [][]byte{b}
+	case h.gop != nil && len(h.gop) < maxGopTags:
+		h.gop = append(h.gop, b)
+	default:
+		h.gop = nil
+	}
+	h.broadcast(b)
+}
+
+// broadcast 发送给所有订阅者，断开缓冲区已满的订阅者，调用时需要持有锁
+func (h *Hub) broadcast(b []byte) {
+	for sub := range h.subscribers {
+		select {
+		case sub.ch <- b:
+		default:
+			h.remove(sub, ErrSlowConsumer)
+		}
+	}
+}
+
+// timestamp 返回 tag 在输出中的时间戳，更换来源或时间戳跳变时接在上一个 tag 之后，调用时需要持有锁
+func (h *Hub) timestamp(t *parser.Tag) uint32 {
+	if t.Type == scriptTag {
+		return 0
+	}
+	ts := int64(t.Timestamp) + h.offset
+	if last := int64(h.lastTimestamp); h.rebase || ts < last-maxTimestampJump || ts > last+maxTimestampJump {
+		h.offset = last - int64(t.Timestamp)
+		h.rebase = false
+		ts = last
+	}
+	if ts > int64(h.lastTimestamp) {
+		h.lastTimestamp = uint32(ts)
+	}
+	return uint32(ts)
+}
+
+// tagBytes 按照给定的时间戳序列化 tag，包含末尾的 PreviousTagSize
+func tagBytes(t *parser.Tag, timestamp uint32) []byte {
+	size := len(t.Data)
+	b := make([]byte, tagHeaderSize+size+4)
+	b[0] = t.Type
+	b[1], b[2], b[3] = byte(size>>16), byte(size>>8), byte(size)
+	b[4], b[5], b[6] = byte(timestamp>>16), byte(timestamp>>8), byte(timestamp)
+	b[7] = byte(timestamp >> 24)
+	copy(b[tagHeaderSize:], t.Data)
+	binary.BigEndian.PutUint32(b[tagHeaderSize+size:], uint32(tagHeaderSize+size))
+	return b
+}
+
+// Subscriber 本地转播的一个订阅者
+type Subscriber struct {
+	hub *Hub
+	// 订阅时缓存的 header、metadata、sequence header 与最近的 GOP
+	init []byte
+	ch   chan []byte
+	done chan struct{}
+	err  error
+}
+
+// Subscribe 订阅直播流，还没有收到 header 时新的订阅者从收到 header 之后开始
+func (h *Hub) Subscribe() (*Subscriber, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+	sub := &Subscriber{
+		hub:  h,
+		ch:   make(chan []byte, h.bufferSize),
+		done: make(chan struct{}),
+	}
+	if h.header != nil {
+		for _, b := range append([][]byte{h.header, h.metadata, h.avcHeader, h.aacHeader}, h.gop...) {
+			sub.init = append(sub.init, b...)
+		}
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// remove 调用时需要持有锁
+func (h *Hub) remove(sub *Subscriber, err error) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	sub.err = err
+	close(sub.done)
+}
+
+// Close 取消订阅
+func (s *Subscriber) Close() {
+	s.hub.lock.Lock()
+	defer s.hub.lock.Unlock()
+	s.hub.remove(s, nil)
+}
+
+// Done 返回订阅结束时关闭的 channel
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 返回订阅结束的原因，直播间的录制结束时为 ErrHubClosed
+func (s *Subscriber) Err() error {
+	s.hub.lock.Lock()
+	defer s.hub.lock.Unlock()
+	return s.err
+}
+
+// Copy 把直播流写入 w，直到 ctx 结束、直播间的录制结束或者订阅者跟不上直播流
+func (s *Subscriber) Copy(ctx context.Context, w io.Writer) error {
+	defer s.Close()
+	flusher, _ := w.(http.Flusher)
+	write := func(b []byte) error {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	if len(s.init) > 0 {
+		if err := write(s.init); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.done:
+			return s.Err()
+		case b := <-s.ch:
+			if err := write(b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Subscribers 返回当前的订阅者数量
+func (h *Hub) Subscribers() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.subscribers)
+}
+
+// Close 结束转播，所有订阅者的 Copy 返回 ErrHubClosed
+func (h *Hub) Close() {
+	h.lock.Lock()
+	h.closed = true
+	for sub := range h.subscribers {
+		h.remove(sub, ErrHubClosed)
+	}
+	h.lock.Unlock()
+	h.stopHLS()
+}
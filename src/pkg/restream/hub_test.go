@@ -0,0 +1,101 @@
+package restream
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/pkg/parser"
+)
+
+var testHeader = []byte{0x46, 0x4c, 0x56, 0x01, 5, 0, 0, 0, 9}
+
+func readTimestamps(b []byte) (types []uint8, timestamps []uint32) {
+	b = b[13:]
+	for len(b) > 0 {
+		size := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+		types = append(types, b[0])
+		timestamps = append(timestamps, uint32(b[4])<<16|uint32(b[5])<<8|uint32(b[6])|uint32(b[7])<<24)
+		b = b[tagHeaderSize+size+4:]
+	}
+	return
+}
+
+// syncWriter 在 Copy 写入足够的数据后结束订阅
+type syncWriter struct {
+	bytes.Buffer
+	want   int
+	cancel context.CancelFunc
+}
+
+func (w *syncWriter) Write(b []byte) (int, error) {
+	n, err := w.Buffer.Write(b)
+	if w.Len() >= w.want {
+		w.cancel()
+	}
+	return n, err
+}
+
+func TestHubLateJoiner(t *testing.T) {
+	h := newHub(16)
+	src := h.NewSource()
+	src.WriteHeader(testHeader)
+	src.WriteTag(&parser.Tag{Type: scriptTag, Data: []byte{2}})
+	src.WriteTag(&parser.Tag{Type: videoTag, Timestamp: 1000, Data: []byte{0x17, 0}, SequenceHeader: true})
+	src.WriteTag(&parser.Tag{Type: videoTag, Timestamp: 1000, Data: []byte{0x17, 1}, KeyFrame: true})
+	src.WriteTag(&parser.Tag{Type: videoTag, Timestamp: 1033, Data: []byte{0x27, 1}})
+	src.WriteTag(&parser.Tag{Type: videoTag, Timestamp: 2000, Data: []byte{0x17, 1}, KeyFrame: true})
+	src.WriteTag(&parser.Tag{Type: audioTag, Timestamp: 2010, Data: []byte{0xaf, 1}})
+
+	sub, err := h.Subscribe()
+	assert.NoError(t, err)
+	// 只包含 metadata、sequence header 与最近的 GOP
+	types, timestamps := readTimestamps(sub.init)
+	assert.Equal(t, []uint8{scriptTag, videoTag, videoTag, audioTag}, types)
+	assert.Equal(t, []uint32{0, 0, 1000, 1010}, timestamps)
+
+	// 新的来源接在上一个 tag 之后，旧的来源被忽略
+	next := h.NewSource()
+	next.WriteHeader(testHeader)
+	next.WriteTag(&parser.Tag{Type: videoTag, Timestamp: 0, Data: []byte{0x17, 1}, KeyFrame: true})
+	src.WriteTag(&parser.Tag{Type: videoTag, Timestamp: 2033, Data: []byte{0x27, 1}})
+	next.WriteTag(&parser.Tag{Type: videoTag, Timestamp: 33, Data: []byte{0x27, 1}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &syncWriter{want: len(sub.init) + 2*(tagHeaderSize+2+4), cancel: cancel}
+	assert.ErrorIs(t, sub.Copy(ctx, w), context.Canceled)
+	types, timestamps = readTimestamps(w.Bytes())
+	assert.Equal(t, []uint8{scriptTag, videoTag, videoTag, audioTag, videoTag, videoTag}, types)
+	assert.Equal(t, []uint32{0, 0, 1000, 1010, 1010, 1043}, timestamps)
+	assert.Equal(t, 0, h.Subscribers())
+}
+
+func TestHubDropSlowConsumer(t *testing.T) {
+	h := newHub(2)
+	src := h.NewSource()
+	src.WriteHeader(testHeader)
+	slow, err := h.Subscribe()
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		src.WriteTag(&parser.Tag{Type: audioTag, Timestamp: uint32(i * 20), Data: []byte{0xaf, 1}})
+	}
+	assert.Equal(t, 0, h.Subscribers())
+	assert.ErrorIs(t, slow.Copy(context.Background(), new(bytes.Buffer)), ErrSlowConsumer)
+
+	sub, err := h.Subscribe()
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- sub.Copy(context.Background(), new(bytes.Buffer)) }()
+	h.Close()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrHubClosed)
+	case <-time.After(time.Second):
+		t.Fatal("subscriber was not closed")
+	}
+	_, err = h.Subscribe()
+	assert.ErrorIs(t, err, ErrHubClosed)
+}
@@ -0,0 +1,83 @@
+package restream
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+// Registry 按直播间管理本地转播，转播随录制场次开始与结束
+type Registry struct {
+	bufferSize int
+
+	lock  sync.Mutex
+	hubs  map[types.LiveID]*Hub
+	hooks []func(id types.LiveID, h *Hub)
+}
+
+func NewRegistry(ctx context.Context) *Registry {
+	inst := instance.GetInstance(ctx)
+	r := &Registry{
+		bufferSize: inst.Config.Restream.BufferSize,
+		hubs:       make(map[types.LiveID]*Hub),
+	}
+	inst.Restream = r
+	return r
+}
+
+func (r *Registry) Start(ctx context.Context) error {
+	return nil
+}
+
+func (r *Registry) Close(ctx context.Context) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for id, h := range r.hubs {
+		h.Close()
+		delete(r.hubs, id)
+	}
+}
+
+// OnHub 在创建直播间的转播时调用 fn，转播在场次结束时关闭
+func (r *Registry) OnHub(fn func(id types.LiveID, h *Hub)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+// Hub 返回直播间的转播，不存在时创建
+func (r *Registry) Hub(id types.LiveID) *Hub {
+	r.lock.Lock()
+	h, ok := r.hubs[id]
+	if ok {
+		r.lock.Unlock()
+		return h
+	}
+	h = newHub(r.bufferSize)
+	r.hubs[id] = h
+	hooks := r.hooks
+	r.lock.Unlock()
+	for _, fn := range hooks {
+		fn(id, h)
+	}
+	return h
+}
+
+func (r *Registry) Get(id types.LiveID) (*Hub, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	h, ok := r.hubs[id]
+	return h, ok
+}
+
+// Remove 结束直播间的转播
+func (r *Registry) Remove(id types.LiveID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if h, ok := r.hubs[id]; ok {
+		h.Close()
+		delete(r.hubs, id)
+	}
+}
@@ -0,0 +1,202 @@
+// Package schedule 解析每周重复的录制时间段
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window 每周重复的时间段，如 "mon-fri 20:00-02:00"，结束时间不晚于开始时间时跨越午夜
+type Window struct {
+	days [7]bool
+	// 当天的分钟数，end 为 24*60 时表示到午夜
+	start, end int
+}
+
+// ParseWindow 解析时间段，星期与时间均可省略，分别表示每天与全天
+//
+// 星期可以是 *、daily、weekdays、weekends，或以逗号分隔的名称（mon）、数字（0 与 7 为周日）及范围（mon-fri、fri-mon）
+// 跨越午夜的时间段属于开始的那一天，如 "fri 22:00-03:00" 包括周六凌晨
+func ParseWindow(s string) (Window, error) {
+	var (
+		w                 Window
+		hasDays, hasTimes bool
+	)
+	for _, field := range strings.Fields(strings.ToLower(s)) {
+		var err error
+		if strings.Contains(field, ":") {
+			if hasTimes {
+				return w, fmt.Errorf("invalid window %q: duplicate time range", s)
+			}
+			hasTimes = true
+			w.start, w.end, err = parseTimes(field)
+		} else {
+			if hasDays {
+				return w, fmt.Errorf("invalid window %q: duplicate days", s)
+			}
+			hasDays = true
+			w.days, err = parseDays(field)
+		}
+		if err != nil {
+			return w, fmt.Errorf("invalid window %q: %w", s, err)
+		}
+	}
+	if !hasDays && !hasTimes {
+		return w, fmt.Errorf("invalid window %q: empty", s)
+	}
+	if !hasDays {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	if !hasTimes {
+		w.end = 24 * 60
+	}
+	return w, nil
+}
+
+func parseDays(s string) (days [7]bool, err error) {
+	switch s {
+	case "*", "daily":
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	case "weekdays":
+		return [7]bool{false, true, true, true, true, true, false}, nil
+	case "weekends":
+		return [7]bool{true, false, false, false, false, false, true}, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := parseDay(from)
+		if err != nil {
+			return days, err
+		}
+		last := first
+		if isRange {
+			if last, err = parseDay(to); err != nil {
+				return days, err
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseDay(s string) (time.Weekday, error) {
+	if d, ok := dayNames[s]; ok {
+		return d, nil
+	}
+	if len(s) > 3 {
+		if d, ok := dayNames[s[:3]]; ok && strings.HasPrefix(strings.ToLower(d.String()), s) {
+			return d, nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 7 {
+		return time.Weekday(n % 7), nil
+	}
+	return 0, fmt.Errorf("unknown day %q", s)
+}
+
+func parseTimes(s string) (start, end int, err error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("time range %q should be like 20:00-02:00", s)
+	}
+	if start, err = parseClock(from); err != nil {
+		return
+	}
+	if end, err = parseClock(to); err != nil {
+		return
+	}
+	if start == 24*60 {
+		return 0, 0, fmt.Errorf("time range %q can not start at 24:00", s)
+	}
+	return
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || minute < 0 || minute >= 60 || hour > 24 || (hour == 24 && minute > 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// Contains 返回 t 是否在时间段内，t 需要已经转换到时间段所在的时区
+func (w Window) Contains(t time.Time) bool {
+	day := t.Weekday()
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+	return (w.days[day] && minute >= w.start) || (w.days[(day+6)%7] && minute < w.end)
+}
+
+// Schedule 一组时间段，在任一 Windows 内且不在任何 Exclude 内时生效，没有 Windows 时除 Exclude 外全部生效
+type Schedule struct {
+	Location *time.Location
+	Windows  []Window
+	Exclude  []Window
+}
+
+// New 解析时区与时间段，时区为空时使用本地时区
+func New(timezone string, windows, exclude []string) (*Schedule, error) {
+	s := &Schedule{Location: time.Local}
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+		s.Location = loc
+	}
+	for _, spec := range windows {
+		w, err := ParseWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	for _, spec := range exclude {
+		w, err := ParseWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.Exclude = append(s.Exclude, w)
+	}
+	return s, nil
+}
+
+// Active 返回 t 时是否允许录制
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.Location)
+	for _, w := range s.Exclude {
+		if w.Contains(t) {
+			return false
+		}
+	}
+	if len(s.Windows) == 0 {
+		return true
+	}
+	for _, w := range s.Windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Day 返回 t 在时间表所在时区的日期，用于按天统计录制时长
+func (s *Schedule) Day(t time.Time) string {
+	return t.In(s.Location).Format(time.DateOnly)
+}
@@ -0,0 +1,59 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWindow(t *testing.T) {
+	for _, spec := range []string{"", "mon mon", "20:00", "mon 20:00-25:00", "mon 24:00-02:00", "funday", "8"} {
+		_, err := ParseWindow(spec)
+		assert.Error(t, err, spec)
+	}
+
+	w, err := ParseWindow("fri-mon")
+	assert.NoError(t, err)
+	assert.Equal(t, [7]bool{true, true, false, false, false, true, true}, w.days)
+	assert.Equal(t, 0, w.start)
+	assert.Equal(t, 24*60, w.end)
+
+	w, err = ParseWindow("Monday,3,7 08:30-12:00")
+	assert.NoError(t, err)
+	assert.Equal(t, [7]bool{true, true, false, true, false, false, false}, w.days)
+	assert.Equal(t, 8*60+30, w.start)
+	assert.Equal(t, 12*60, w.end)
+}
+
+func TestSchedule(t *testing.T) {
+	_, err := New("Mars/Olympus", nil, nil)
+	assert.Error(t, err)
+
+	s, err := New("Asia/Shanghai", []string{"weekdays 20:00-02:00", "sat 10:00-12:00"}, []string{"sun"})
+	assert.NoError(t, err)
+	at := func(day, clock string) time.Time {
+		// 2024-01-01 是周一
+		t, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-0"+day+" "+clock, s.Location)
+		return t
+	}
+	assert.False(t, s.Active(at("1", "19:59")))
+	assert.True(t, s.Active(at("1", "20:00")))
+	assert.True(t, s.Active(at("2", "01:59")))
+	assert.False(t, s.Active(at("2", "02:00")))
+	// 周五晚上的时间段持续到周六凌晨
+	assert.True(t, s.Active(at("6", "01:00")))
+	assert.True(t, s.Active(at("6", "11:00")))
+	assert.False(t, s.Active(at("6", "20:00")))
+	assert.False(t, s.Active(at("7", "11:00")))
+	// 周日没有时间段，周一凌晨不在时间段内
+	assert.False(t, s.Active(at("1", "01:00")))
+	// 时区按时间表转换
+	assert.True(t, s.Active(time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)))
+	assert.Equal(t, "2024-01-02", s.Day(time.Date(2024, 1, 1, 16, 0, 0, 0, time.UTC)))
+
+	s, err = New("", nil, []string{"00:00-08:00"})
+	assert.NoError(t, err)
+	assert.True(t, s.Active(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)))
+	assert.False(t, s.Active(time.Date(2024, 1, 1, 7, 0, 0, 0, time.Local)))
+}
@@ -0,0 +1,116 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/utils"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+// CommandlineData 是渲染命令、目录、地址模板时可以使用的变量，同时以 BILILIVE_ 开头的环境变量传给命令
+type CommandlineData struct {
+	Ffmpeg string
+	// FileName 按文件执行时为当前文件，按场次执行时为场次的第一个文件
+	FileName string
+	// Files 修复后的全部输出文件
+	Files        []string
+	Info         *live.Info
+	LiveId       types.LiveID
+	Platform     string
+	SessionId    string
+	SessionStart time.Time
+	// SessionEnd 按文件执行时场次可能尚未结束，为零值
+	SessionEnd time.Time
+	// ExitStatus 文件（场次最后一个文件）结束录制的原因
+	ExitStatus string
+}
+
+// Env 返回传给自定义命令的环境变量
+func (d *CommandlineData) Env() []string {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	var hostName, roomName string
+	if d.Info != nil {
+		hostName, roomName = d.Info.HostName, d.Info.RoomName
+	}
+	return []string{
+		"BILILIVE_FFMPEG=" + d.Ffmpeg,
+		"BILILIVE_FILE_NAME=" + d.FileName,
+		"BILILIVE_FILES=" + strings.Join(d.Files, "\n"),
+		"BILILIVE_LIVE_ID=" + string(d.LiveId),
+		"BILILIVE_PLATFORM=" + d.Platform,
+		"BILILIVE_HOST_NAME=" + hostName,
+		"BILILIVE_ROOM_NAME=" + roomName,
+		"BILILIVE_SESSION_ID=" + d.SessionId,
+		"BILILIVE_SESSION_START=" + formatTime(d.SessionStart),
+		"BILILIVE_SESSION_END=" + formatTime(d.SessionEnd),
+		"BILILIVE_EXIT_STATUS=" + d.ExitStatus,
+	}
+}
+
+// shellQuote 转义后的字符串作为一个参数传给 RunCommand 使用的 shell，不会展开其中的变量与命令；
+// 主播名、标题等来自直播平台，放入命令时需要使用 shellQuote 或者通过环境变量传递
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		// cmd 在引号内仍然展开 %VAR%，在引号外用 ^ 转义 %
+		s = strings.ReplaceAll(s, `"`, `""`)
+		s = strings.ReplaceAll(s, "%", `"^%"`)
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Render 使用 utils.GetFuncMap 中的函数与 shellQuote 渲染模板
+func Render(cfg *configs.Config, name, text string, data *CommandlineData) (string, error) {
+	tmpl, err := template.New(name).Funcs(utils.GetFuncMap(cfg)).Funcs(template.FuncMap{"shellQuote": shellQuote}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RunCommand 使用系统 shell 执行命令，输出写入 w
+func RunCommand(ctx context.Context, cmdStr string, env []string, w io.Writer) error {
+	bash := ""
+	args := ""
+	switch runtime.GOOS {
+	case "linux":
+		bash = "bash"
+		args = "-c"
+	case "windows":
+		bash = "cmd"
+		args = "/C"
+	default:
+		return fmt.Errorf("unsupported system %s", runtime.GOOS)
+	}
+	fmt.Fprintf(w, "start executing custom_commandline: %s %s %s\n", bash, args, cmdStr)
+	cmd := exec.CommandContext(ctx, bash, args, cmdStr)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	fmt.Fprintf(w, "end executing custom_commandline: %s\n", cmdStr)
+	if err != nil {
+		return fmt.Errorf("custom commandline execute failure: %w", err)
+	}
+	return nil
+}
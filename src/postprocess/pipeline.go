@@ -0,0 +1,300 @@
+package postprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+// Reporter 接收流水线的日志与进度，*jobs.Task 实现了该接口
+type Reporter interface {
+	Logf(format string, args ...any)
+	LogWriter() io.Writer
+	SetProgress(progress float64)
+}
+
+// 远程上传的状态
+const (
+	UploadUploading = "uploading"
+	UploadSucceeded = "succeeded"
+	UploadFailed    = "failed"
+)
+
+// UploadStatus 是 remote_upload 步骤中一个文件的上传状态
+type UploadStatus struct {
+	File   string `json:"file"`
+	Target string `json:"target"`
+	Key    string `json:"key"`
+	State  string `json:"state"`
+	Size   int64  `json:"size,omitempty"`
+	ETag   string `json:"etag,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UploadReporter 由 Reporter 选择实现，用于记录上传状态
+type UploadReporter interface {
+	ReportUpload(status UploadStatus)
+}
+
+// CheckpointReporter 由 Reporter 选择实现，每个步骤结束后保存进度，重试时通过 Pipeline.Resume 继续
+type CheckpointReporter interface {
+	SaveCheckpoint(cp *Checkpoint)
+}
+
+// OutputReporter 由 Reporter 选择实现，流水线结束时接收输出的视频文件，不包括附属文件
+type OutputReporter interface {
+	ReportOutputs(paths []string)
+}
+
+// Checkpoint 是流水线的进度，重试时已经完成的步骤不会再次执行，
+// 避免 move、delete_source 等步骤处理过的文件找不到，或者重复执行命令与上传
+type Checkpoint struct {
+	Files []CheckpointFile `json:"files"`
+}
+
+// CheckpointFile 是流水线中的一个文件与它下一个要执行的步骤
+type CheckpointFile struct {
+	Path      string   `json:"path"`
+	NeedFix   bool     `json:"need_fix"`
+	Artifacts []string `json:"artifacts,omitempty"`
+	Step      int      `json:"step"`
+}
+
+// File 是流水线的输入文件
+type File struct {
+	Path string
+	// NeedFix 为 false 时跳过 fix 步骤，原生 flv 解析器的输出已经修复过
+	NeedFix bool
+}
+
+// file 是流水线中流转的文件，Artifacts 为封面、音频、校验和等附属文件，会随 move 步骤一起移动
+type file struct {
+	Path      string
+	NeedFix   bool
+	Artifacts []string
+	// step 下一个要执行的步骤，之前的步骤已经在上次执行时完成
+	step int
+}
+
+type stepFunc func(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error)
+
+var stepFuncs = map[string]stepFunc{
+	configs.StepFix:          fixStep,
+	configs.StepRemux:        remuxStep,
+	configs.StepExtractAudio: extractAudioStep,
+	configs.StepThumbnail:    thumbnailStep,
+	configs.StepChecksum:     checksumStep,
+	configs.StepMove:         moveStep,
+	configs.StepUpload:       uploadStep,
+	configs.StepCommand:      commandStep,
+	configs.StepRemoteUpload: remoteUploadStep,
+	configs.StepDanmakuASS:   danmakuASSStep,
+}
+
+// Pipeline 按顺序对文件执行后处理步骤，每个步骤的输出作为下一个步骤的输入
+type Pipeline struct {
+	Config *configs.Config
+	// OutPutPath 直播间生效的输出目录，为空时使用全局的 out_put_path
+	OutPutPath string
+	Steps      []configs.PostProcessStep
+	Reporter   Reporter
+	// Resume 不为 nil 时忽略 Run 的 files，从上次保存的进度继续
+	Resume *Checkpoint
+}
+
+// Run 执行流水线，Data 中的 FileName 与 Files 会在每个步骤执行前替换为当前的文件
+//
+// 设置了 CheckpointReporter 时每个步骤结束后保存进度；on_failure 为 continue 的步骤失败后不再保存，
+// 重试时从该步骤继续，之后的步骤会再次执行
+func (p *Pipeline) Run(ctx context.Context, files []File, data CommandlineData) error {
+	current := p.input(files)
+	if len(current) == 0 {
+		return errors.New("no file to process")
+	}
+	defer func() { p.reportOutputs(current) }()
+
+	var errs []error
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		if done(current, i) {
+			// 上次执行时已经完成
+			continue
+		}
+		p.Reporter.Logf("step %d/%d: %s", i+1, len(p.Steps), step.Type)
+		fn, ok := stepFuncs[step.Type]
+		if !ok {
+			return fmt.Errorf("unknown post process step %q", step.Type)
+		}
+
+		paths := make([]string, 0, len(current))
+		for _, f := range current {
+			paths = append(paths, f.Path)
+		}
+		var (
+			next    = make([]*file, 0, len(current))
+			stepErr error
+		)
+		for _, f := range current {
+			if f.step > i {
+				next = append(next, f)
+				continue
+			}
+			if ok, reason := p.match(ctx, &step.When, f.Path, data.Ffmpeg); !ok {
+				p.Reporter.Logf("skip %s: %s", f.Path, reason)
+				f.step = i + 1
+				next = append(next, f)
+				continue
+			}
+			d := data
+			d.FileName, d.Files = f.Path, paths
+			out, err := fn(ctx, p, step, f, &d)
+			if err != nil {
+				p.Reporter.Logf("%s step failed on %s: %v", step.Type, f.Path, err)
+				stepErr = errors.Join(stepErr, fmt.Errorf("%s %s: %w", step.Type, filepath.Base(f.Path), err))
+				if step.OnFailure == configs.OnFailureIgnore {
+					f.step = i + 1
+				}
+				next = append(next, f)
+				continue
+			}
+			for _, o := range out {
+				o.step = i + 1
+			}
+			next = append(next, out...)
+		}
+		current = next
+		p.Reporter.SetProgress(float64(i+1) / float64(len(p.Steps)))
+		if len(errs) == 0 {
+			p.saveCheckpoint(current)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if stepErr == nil {
+			continue
+		}
+		switch step.OnFailure {
+		case configs.OnFailureIgnore:
+		case configs.OnFailureContinue:
+			errs = append(errs, stepErr)
+		default:
+			return errors.Join(append(errs, stepErr)...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// done 返回全部文件是否已经完成第 step 个步骤
+func done(files []*file, step int) bool {
+	for _, f := range files {
+		if f.step <= step {
+			return false
+		}
+	}
+	return true
+}
+
+// input 返回存在的输入文件，设置了 Resume 时返回上次保存的文件
+func (p *Pipeline) input(files []File) []*file {
+	if p.Resume != nil {
+		current := make([]*file, 0, len(p.Resume.Files))
+		for _, f := range p.Resume.Files {
+			if _, err := os.Stat(f.Path); err != nil {
+				p.Reporter.Logf("skip %s: %v", f.Path, err)
+				continue
+			}
+			current = append(current, &file{Path: f.Path, NeedFix: f.NeedFix, Artifacts: f.Artifacts, step: f.Step})
+		}
+		return current
+	}
+	current := make([]*file, 0, len(files))
+	for _, f := range files {
+		if _, err := os.Stat(f.Path); err != nil {
+			p.Reporter.Logf("skip %s: %v", f.Path, err)
+			continue
+		}
+		nf := &file{Path: f.Path, NeedFix: f.NeedFix}
+		// 录制时保存的弹幕文件随视频文件一起移动、上传
+		for _, d := range danmaku.Files(f.Path) {
+			if _, err := os.Stat(d); err == nil {
+				nf.Artifacts = append(nf.Artifacts, d)
+			}
+		}
+		current = append(current, nf)
+	}
+	return current
+}
+
+func (p *Pipeline) saveCheckpoint(current []*file) {
+	r, ok := p.Reporter.(CheckpointReporter)
+	if !ok {
+		return
+	}
+	cp := &Checkpoint{Files: make([]CheckpointFile, 0, len(current))}
+	for _, f := range current {
+		cp.Files = append(cp.Files, CheckpointFile{Path: f.Path, NeedFix: f.NeedFix, Artifacts: f.Artifacts, Step: f.step})
+	}
+	r.SaveCheckpoint(cp)
+}
+
+func (p *Pipeline) reportOutputs(current []*file) {
+	r, ok := p.Reporter.(OutputReporter)
+	if !ok {
+		return
+	}
+	paths := make([]string, 0, len(current))
+	for _, f := range current {
+		paths = append(paths, f.Path)
+	}
+	r.ReportOutputs(paths)
+}
+
+func (p *Pipeline) reportUpload(status UploadStatus) {
+	if r, ok := p.Reporter.(UploadReporter); ok {
+		r.ReportUpload(status)
+	}
+}
+
+// match 判断文件是否满足步骤的执行条件，不满足时返回原因
+func (p *Pipeline) match(ctx context.Context, cond *configs.StepCondition, path, ffmpeg string) (bool, string) {
+	if len(cond.Extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(path))
+		matched := false
+		for _, e := range cond.Extensions {
+			if strings.ToLower("."+strings.TrimPrefix(e, ".")) == ext {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, fmt.Sprintf("extension %s not in %v", ext, cond.Extensions)
+		}
+	}
+	if cond.MinSize > 0 {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return false, err.Error()
+		}
+		if stat.Size() < cond.MinSize {
+			return false, fmt.Sprintf("size %d < %d", stat.Size(), cond.MinSize)
+		}
+	}
+	if cond.MinDuration > 0 {
+		d, err := probeDuration(ctx, ffmpeg, path)
+		if err != nil {
+			return false, fmt.Sprintf("failed to probe duration: %v", err)
+		}
+		if d < cond.MinDuration {
+			return false, fmt.Sprintf("duration %s < %s", d, cond.MinDuration)
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,354 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/live"
+)
+
+type testReporter struct {
+	sync.Mutex
+	log        bytes.Buffer
+	progress   float64
+	uploads    []UploadStatus
+	checkpoint *Checkpoint
+	outputs    []string
+}
+
+func (r *testReporter) ReportOutputs(paths []string) {
+	r.Lock()
+	defer r.Unlock()
+	r.outputs = paths
+}
+
+func (r *testReporter) SaveCheckpoint(cp *Checkpoint) {
+	r.Lock()
+	defer r.Unlock()
+	r.checkpoint = cp
+}
+
+func (r *testReporter) ReportUpload(status UploadStatus) {
+	r.Lock()
+	defer r.Unlock()
+	r.uploads = append(r.uploads, status)
+}
+
+func (r *testReporter) Logf(format string, args ...any) {
+	r.Lock()
+	defer r.Unlock()
+	fmt.Fprintf(&r.log, format+"\n", args...)
+}
+
+func (r *testReporter) LogWriter() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		r.Lock()
+		defer r.Unlock()
+		return r.log.Write(p)
+	})
+}
+
+func (r *testReporter) SetProgress(progress float64) {
+	r.progress = progress
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// fakeFfmpeg 把 -i 指定的输入复制到最后一个参数，并记录收到的参数
+func fakeFfmpeg(t *testing.T, dir string) string {
+	if runtime.GOOS != "linux" {
+		t.Skip("fake ffmpeg requires sh")
+	}
+	path := filepath.Join(dir, "ffmpeg")
+	script := `#!/bin/sh
+echo "$@" >> "` + filepath.Join(dir, "ffmpeg.log") + `"
+prev=""
+for a; do
+  [ "$prev" = "-i" ] && in="$a"
+  prev="$a"
+done
+cp "$in" "$a"
+`
+	assert.NoError(t, os.WriteFile(path, []byte(script), 0755))
+	return path
+}
+
+func TestRender(t *testing.T) {
+	data := &CommandlineData{
+		Ffmpeg:       "/usr/bin/ffmpeg",
+		FileName:     "/out/a.flv",
+		Files:        []string{"/out/a.flv", "/out/a_P002.flv"},
+		Info:         &live.Info{HostName: "host", RoomName: "room"},
+		Platform:     "哔哩哔哩",
+		SessionStart: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		ExitStatus:   "stop",
+	}
+	cmd, err := Render(&configs.Config{}, "test",
+		`{{ .Ffmpeg }} -i "{{ .FileName }}" "{{ .FileName | trimSuffix (.FileName | ext) }}.mp4" {{ len .Files }} {{ .Info.HostName }} {{ .ExitStatus }}`, data)
+	assert.NoError(t, err)
+	assert.Equal(t, `/usr/bin/ffmpeg -i "/out/a.flv" "/out/a.mp4" 2 host stop`, cmd)
+
+	_, err = Render(&configs.Config{}, "test", "{{ .NotExist }}", data)
+	assert.Error(t, err)
+
+	env := data.Env()
+	assert.Contains(t, env, "BILILIVE_FILE_NAME=/out/a.flv")
+	assert.Contains(t, env, "BILILIVE_FILES=/out/a.flv\n/out/a_P002.flv")
+	assert.Contains(t, env, "BILILIVE_HOST_NAME=host")
+	assert.Contains(t, env, "BILILIVE_SESSION_START=2024-01-02T03:04:05Z")
+	assert.Contains(t, env, "BILILIVE_SESSION_END=")
+	assert.Contains(t, env, "BILILIVE_EXIT_STATUS=stop")
+}
+
+func TestShellQuote(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("command test requires bash")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	data := &CommandlineData{
+		FileName: filepath.Join(dir, "it's $(touch x).flv"),
+		Info:     &live.Info{RoomName: "$(touch x); `touch y` 'a'"},
+	}
+	// 直播间标题中的命令不会被执行
+	cmd, err := Render(&configs.Config{}, "test",
+		`cd `+dir+` && echo {{ .Info.RoomName | shellQuote }} {{ .FileName | base | shellQuote }} "$BILILIVE_ROOM_NAME" > out.txt`, data)
+	assert.NoError(t, err)
+	assert.NoError(t, RunCommand(context.Background(), cmd, data.Env(), io.Discard))
+	b, _ := os.ReadFile(out)
+	room := "$(touch x); `touch y` 'a'"
+	assert.Equal(t, room+" it's $(touch x).flv "+room+"\n", string(b))
+	assert.NoFileExists(t, filepath.Join(dir, "x"))
+	assert.NoFileExists(t, filepath.Join(dir, "y"))
+}
+
+func TestPipeline(t *testing.T) {
+	dir := t.TempDir()
+	ffmpeg := fakeFfmpeg(t, dir)
+	var uploaded sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		uploaded.Store(r.URL.Path, string(b))
+	}))
+	defer server.Close()
+
+	src := filepath.Join(dir, "rec", "a.flv")
+	short := filepath.Join(dir, "rec", "b.ts")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(src), os.ModePerm))
+	assert.NoError(t, os.WriteFile(src, []byte("0123456789"), 0644))
+	assert.NoError(t, os.WriteFile(short, []byte("0"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "rec", "a.xml"), []byte("<i></i>"), 0644))
+
+	r := new(testReporter)
+	p := &Pipeline{
+		Config: &configs.Config{},
+		Steps: []configs.PostProcessStep{
+			{Type: configs.StepFix},
+			{Type: configs.StepRemux, Format: "mp4", Faststart: true, DeleteSource: true, When: configs.StepCondition{MinSize: 5}},
+			{Type: configs.StepThumbnail, When: configs.StepCondition{Extensions: []string{"mp4"}}},
+			{Type: configs.StepChecksum, Algorithm: "md5"},
+			{Type: configs.StepMove, Dir: filepath.Join(dir, "done", "{{ .Info.HostName }}")},
+			{Type: configs.StepUpload, Url: server.URL + "/{{ .FileName | base }}"},
+			{Type: configs.StepCommand, Command: `echo "$BILILIVE_FILE_NAME {{ len .Files }}" >> ` + filepath.Join(dir, "cmd.log")},
+		},
+		Reporter: r,
+	}
+	err := p.Run(context.Background(), []File{{Path: src}, {Path: short}, {Path: filepath.Join(dir, "missing.flv")}}, CommandlineData{
+		Ffmpeg: ffmpeg,
+		Info:   &live.Info{HostName: "host"},
+	})
+	assert.NoError(t, err, r.log.String())
+	assert.Equal(t, float64(1), r.progress)
+
+	done := filepath.Join(dir, "done", "host")
+	// 满足条件的文件被转封装并删除原文件，附属文件与弹幕文件随之移动
+	assert.NoFileExists(t, src)
+	for _, name := range []string{"a.mp4", "a.xml", "a.jpg", "a.mp4.md5", "b.ts", "b.ts.md5"} {
+		assert.FileExists(t, filepath.Join(done, name))
+	}
+	b, _ := os.ReadFile(filepath.Join(done, "a.mp4.md5"))
+	assert.Equal(t, "781e5e245d69b566979b86e28d23f2c7  a.mp4\n", string(b))
+	ffmpegLog, _ := os.ReadFile(filepath.Join(dir, "ffmpeg.log"))
+	assert.Contains(t, string(ffmpegLog), "-movflags +faststart")
+	assert.Equal(t, 2, strings.Count(string(ffmpegLog), "\n"))
+
+	v, _ := uploaded.Load("/a.mp4")
+	assert.Equal(t, "0123456789", v)
+	v, _ = uploaded.Load("/b.ts")
+	assert.Equal(t, "0", v)
+
+	cmdLog, _ := os.ReadFile(filepath.Join(dir, "cmd.log"))
+	assert.Equal(t, filepath.Join(done, "a.mp4")+" 2\n"+filepath.Join(done, "b.ts")+" 2\n", string(cmdLog))
+}
+
+func TestPipelineOnFailure(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("command step requires bash")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.flv")
+	assert.NoError(t, os.WriteFile(src, []byte("a"), 0644))
+	run := func(onFailure string) (error, bool) {
+		marker := filepath.Join(dir, "marker")
+		os.Remove(marker)
+		p := &Pipeline{
+			Config: &configs.Config{},
+			Steps: []configs.PostProcessStep{
+				{Type: configs.StepCommand, Command: "exit 1", OnFailure: onFailure},
+				{Type: configs.StepCommand, Command: "touch " + marker},
+			},
+			Reporter: new(testReporter),
+		}
+		err := p.Run(context.Background(), []File{{Path: src}}, CommandlineData{})
+		_, statErr := os.Stat(marker)
+		return err, statErr == nil
+	}
+
+	err, next := run("")
+	assert.Error(t, err)
+	assert.False(t, next)
+	err, next = run(configs.OnFailureContinue)
+	assert.Error(t, err)
+	assert.True(t, next)
+	err, next = run(configs.OnFailureIgnore)
+	assert.NoError(t, err)
+	assert.True(t, next)
+
+	p := &Pipeline{Config: &configs.Config{}, Reporter: new(testReporter)}
+	assert.Error(t, p.Run(context.Background(), []File{{Path: filepath.Join(dir, "missing.flv")}}, CommandlineData{}))
+}
+
+func TestPipelineResume(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("command step requires bash")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "rec", "a.flv")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(src), os.ModePerm))
+	assert.NoError(t, os.WriteFile(src, []byte("a"), 0644))
+	marker := filepath.Join(dir, "marker")
+	r := new(testReporter)
+	p := &Pipeline{
+		Config: &configs.Config{},
+		Steps: []configs.PostProcessStep{
+			{Type: configs.StepMove, Dir: filepath.Join(dir, "done")},
+			{Type: configs.StepCommand, Command: "test -f " + marker},
+		},
+		Reporter: r,
+	}
+	// move 之后的步骤失败，进度记录了移动后的文件
+	assert.Error(t, p.Run(context.Background(), []File{{Path: src}}, CommandlineData{}))
+	moved := filepath.Join(dir, "done", "a.flv")
+	assert.Equal(t, &Checkpoint{Files: []CheckpointFile{{Path: moved, Step: 1}}}, r.checkpoint)
+	assert.Equal(t, []string{moved}, r.outputs)
+
+	// 重试时从失败的步骤继续，不再执行 move
+	assert.NoError(t, os.WriteFile(marker, nil, 0644))
+	p.Resume = r.checkpoint
+	assert.NoError(t, p.Run(context.Background(), []File{{Path: src}}, CommandlineData{}), r.log.String())
+	assert.FileExists(t, moved)
+	assert.Equal(t, &Checkpoint{Files: []CheckpointFile{{Path: moved, Step: 2}}}, r.checkpoint)
+	assert.Equal(t, 1, strings.Count(r.log.String(), "step 1/2: move"))
+}
+
+func TestPipelineRemoteUpload(t *testing.T) {
+	var objects sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		objects.Store(r.URL.Path, string(b))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.flv")
+	assert.NoError(t, os.WriteFile(src, []byte("a"), 0644))
+	cfg := &configs.Config{
+		OutPutPath: dir,
+		RemoteStorages: map[string]configs.RemoteStorage{
+			"minio": {Type: configs.RemoteStorageS3, Endpoint: server.URL, Bucket: "bucket", PathStyle: true},
+		},
+	}
+	r := new(testReporter)
+	p := &Pipeline{
+		Config: cfg,
+		Steps: []configs.PostProcessStep{
+			{Type: configs.StepChecksum},
+			{Type: configs.StepRemoteUpload, Target: "minio", Key: "{{ .Info.HostName }}/{{ .FileName | base }}", DeleteSource: true},
+			{Type: configs.StepRemoteUpload, Target: "minio"},
+		},
+		Reporter: r,
+	}
+	err := p.Run(context.Background(), []File{{Path: src}}, CommandlineData{Info: &live.Info{HostName: "host"}})
+	assert.NoError(t, err, r.log.String())
+
+	v, _ := objects.Load("/bucket/host/a.flv")
+	assert.Equal(t, "a", v)
+	_, ok := objects.Load("/bucket/host/a.flv.sha256")
+	assert.True(t, ok)
+	// 上传后删除的文件不再交给后续步骤
+	assert.NoFileExists(t, src)
+	assert.NoFileExists(t, src+".sha256")
+	assert.Len(t, r.uploads, 4)
+	assert.Equal(t, UploadSucceeded, r.uploads[1].State)
+	assert.Equal(t, "host/a.flv", r.uploads[1].Key)
+}
+
+func TestPipelineDanmakuASS(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mp4")
+	assert.NoError(t, os.WriteFile(src, []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.jsonl"),
+		[]byte(`{"type":"record_info"}`+"\n"+`{"ts":1.5,"type":"danmaku","content":"hello"}`+"\n"), 0644))
+	noDanmaku := filepath.Join(dir, "b.mp4")
+	assert.NoError(t, os.WriteFile(noDanmaku, []byte("b"), 0644))
+
+	r := new(testReporter)
+	p := &Pipeline{
+		Config:   &configs.Config{},
+		Steps:    []configs.PostProcessStep{{Type: configs.StepDanmakuASS, ASS: configs.DanmakuASS{FontSize: 40}}},
+		Reporter: r,
+	}
+	assert.NoError(t, p.Run(context.Background(), []File{{Path: src}, {Path: noDanmaku}}, CommandlineData{}), r.log.String())
+	b, err := os.ReadFile(filepath.Join(dir, "a.ass"))
+	assert.NoError(t, err)
+	// 无法读取分辨率时使用 1920x1080
+	assert.Contains(t, string(b), "PlayResY: 1080\n")
+	assert.Contains(t, string(b), "Style: Danmaku,Microsoft YaHei,40,")
+	assert.Contains(t, string(b), "Dialogue: 0,0:00:01.50,0:00:13.50,")
+	assert.NoFileExists(t, filepath.Join(dir, "b.ass"))
+	assert.Contains(t, r.log.String(), "no danmaku file of "+noDanmaku)
+}
+
+func TestParseResolution(t *testing.T) {
+	w, h, err := parseResolution("  Stream #0:0: Video: h264 (High) (avc1 / 0x31637661), yuv420p(tv, bt709), 1280x720 [SAR 1:1 DAR 16:9], 30 fps\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1280, 720}, []int{w, h})
+	_, _, err = parseResolution("  Stream #0:0: Audio: aac (LC), 48000 Hz, stereo\n")
+	assert.Error(t, err)
+}
+
+func TestParseDuration(t *testing.T) {
+	d, err := parseDuration("Input #0, flv, from 'a.flv':\n  Duration: 01:02:03.50, start: 0.000000, bitrate: N/A\n")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour+2*time.Minute+3500*time.Millisecond, d)
+	_, err = parseDuration("a.flv: Invalid data found when processing input")
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/pkg/parser/native/flv"
+)
+
+var (
+	durationRegexp   = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+	resolutionRegexp = regexp.MustCompile(`Video: .*?[\s,](\d{2,5})x(\d{2,5})\b`)
+)
+
+// probeDuration 优先读取 flv 的 onMetaData，其他文件解析 ffmpeg -i 的输出
+func probeDuration(ctx context.Context, ffmpeg, path string) (time.Duration, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".flv" {
+		if props, err := flv.ReadMetadata(path); err == nil {
+			if v, ok := props.Get("duration"); ok {
+				if d, ok := v.(float64); ok && d > 0 {
+					return time.Duration(d * float64(time.Second)), nil
+				}
+			}
+		}
+	}
+	info, err := ffmpegInfo(ctx, ffmpeg, path)
+	if err != nil {
+		return 0, err
+	}
+	return parseDuration(info)
+}
+
+// ProbeResolution 返回视频的分辨率，优先读取 flv 的 onMetaData，其他文件解析 ffmpeg -i 的输出
+func ProbeResolution(ctx context.Context, ffmpeg, path string) (width, height int, err error) {
+	if strings.ToLower(filepath.Ext(path)) == ".flv" {
+		if props, err := flv.ReadMetadata(path); err == nil {
+			w, _ := props.Get("width")
+			h, _ := props.Get("height")
+			if w, ok := w.(float64); ok && w > 0 {
+				if h, ok := h.(float64); ok && h > 0 {
+					return int(w), int(h), nil
+				}
+			}
+		}
+	}
+	info, err := ffmpegInfo(ctx, ffmpeg, path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseResolution(info)
+}
+
+func parseResolution(s string) (width, height int, err error) {
+	m := resolutionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, errors.New("no video stream in ffmpeg output")
+	}
+	width, _ = strconv.Atoi(m[1])
+	height, _ = strconv.Atoi(m[2])
+	return width, height, nil
+}
+
+// ffmpegInfo 返回 ffmpeg -i 输出的文件信息
+func ffmpegInfo(ctx context.Context, ffmpeg, path string) (string, error) {
+	if ffmpeg == "" {
+		return "", errors.New("ffmpeg not found")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-i", path)
+	cmd.Stderr = &stderr
+	// 没有指定输出文件，ffmpeg 总是以非零值退出
+	cmd.Run()
+	return stderr.String(), nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	m := durationRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errors.New("no duration in ffmpeg output")
+	}
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.ParseFloat(m[3], 64)
+	return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec*float64(time.Second)), nil
+}
@@ -0,0 +1,351 @@
+package postprocess
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+	"github.com/bililive-go/bililive-go/src/remote"
+	"github.com/bililive-go/bililive-go/src/tools"
+)
+
+// for test
+var httpClient = http.DefaultClient
+
+func trimExt(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+func (p *Pipeline) ffmpeg(ctx context.Context, ffmpeg string, args ...string) error {
+	cmd := exec.CommandContext(ctx, ffmpeg, append([]string{"-hide_banner", "-y"}, args...)...)
+	cmd.Stdout = p.Reporter.LogWriter()
+	cmd.Stderr = p.Reporter.LogWriter()
+	return cmd.Run()
+}
+
+// ffmpegOutput 先写入临时文件，成功后再重命名，避免中断时留下不完整的文件或覆盖输入
+func (p *Pipeline) ffmpegOutput(ctx context.Context, ffmpeg, output string, args ...string) error {
+	tmp := trimExt(output) + ".tmp" + filepath.Ext(output)
+	if err := p.ffmpeg(ctx, ffmpeg, append(args, tmp)...); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, output)
+}
+
+func fixStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	if !f.NeedFix {
+		p.Reporter.Logf("%s is already repaired by native parser", f.Path)
+		return []*file{f}, nil
+	}
+	outputs, err := tools.FixFlvByBililiveRecorder(ctx, f.Path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*file, 0, len(outputs))
+	for i, output := range outputs {
+		nf := &file{Path: output}
+		if i == 0 {
+			nf.Artifacts = f.Artifacts
+		}
+		files = append(files, nf)
+	}
+	return files, nil
+}
+
+func remuxStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	args := []string{"-i", f.Path, "-c", "copy"}
+	ext := ".mp4"
+	switch step.Format {
+	case "mkv":
+		ext = ".mkv"
+	case "fmp4":
+		args = append(args, "-movflags", "+frag_keyframe+empty_moov+default_base_moof")
+	default:
+		if step.Faststart {
+			args = append(args, "-movflags", "+faststart")
+		}
+	}
+	output := trimExt(f.Path) + ext
+	if err := p.ffmpegOutput(ctx, data.Ffmpeg, output, args...); err != nil {
+		return nil, err
+	}
+	if step.DeleteSource && output != f.Path {
+		os.Remove(f.Path)
+	}
+	return []*file{{Path: output, Artifacts: f.Artifacts}}, nil
+}
+
+// extractAudioStep 音频作为附属文件保存，设置 delete_source 时替换原文件
+func extractAudioStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	args := []string{"-i", f.Path, "-vn"}
+	ext := ".m4a"
+	if step.Format == "mp3" {
+		ext = ".mp3"
+		args = append(args, "-c:a", "libmp3lame", "-q:a", "2")
+	} else {
+		args = append(args, "-c:a", "copy")
+	}
+	output := trimExt(f.Path) + ext
+	if err := p.ffmpegOutput(ctx, data.Ffmpeg, output, args...); err != nil {
+		return nil, err
+	}
+	if step.DeleteSource {
+		os.Remove(f.Path)
+		return []*file{{Path: output, Artifacts: f.Artifacts}}, nil
+	}
+	f.Artifacts = append(f.Artifacts, output)
+	return []*file{f}, nil
+}
+
+func thumbnailStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	ext := ".jpg"
+	if step.Format == "png" {
+		ext = ".png"
+	}
+	output := trimExt(f.Path) + ext
+	args := []string{
+		"-ss", strconv.FormatFloat(step.Offset.Seconds(), 'f', 3, 64),
+		"-i", f.Path,
+		"-frames:v", "1",
+	}
+	if err := p.ffmpegOutput(ctx, data.Ffmpeg, output, args...); err != nil {
+		return nil, err
+	}
+	f.Artifacts = append(f.Artifacts, output)
+	return []*file{f}, nil
+}
+
+// checksumStep 以 sha256sum 的格式写入 <文件名>.<算法>
+func checksumStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	var (
+		h         hash.Hash
+		algorithm = step.Algorithm
+	)
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	default:
+		algorithm = "sha256"
+		h = sha256.New()
+	}
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	if _, err := io.Copy(h, in); err != nil {
+		return nil, err
+	}
+	output := f.Path + "." + algorithm
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(f.Path))
+	if err := os.WriteFile(output, []byte(line), 0644); err != nil {
+		return nil, err
+	}
+	f.Artifacts = append(f.Artifacts, output)
+	return []*file{f}, nil
+}
+
+// moveStep 将文件与附属文件移动到 dir 模板渲染出的目录
+func moveStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	dir, err := Render(p.Config, "move_dir", step.Dir, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	moved := &file{NeedFix: f.NeedFix}
+	if moved.Path, err = moveFile(f.Path, dir); err != nil {
+		return nil, err
+	}
+	for _, artifact := range f.Artifacts {
+		path, err := moveFile(artifact, dir)
+		if err != nil {
+			p.Reporter.Logf("failed to move %s: %v", artifact, err)
+			path = artifact
+		}
+		moved.Artifacts = append(moved.Artifacts, path)
+	}
+	p.Reporter.Logf("moved %s to %s", f.Path, dir)
+	return []*file{moved}, nil
+}
+
+// moveFile 优先重命名，跨设备时复制后删除原文件
+func moveFile(src, dir string) (string, error) {
+	dst := filepath.Join(dir, filepath.Base(src))
+	if err := os.Rename(src, dst); err == nil {
+		return dst, nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	in.Close()
+	return dst, os.Remove(src)
+}
+
+// uploadStep 以 HTTP PUT 上传文件，url 为模板
+func uploadStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	u, err := Render(p.Config, "upload_url", step.Url, data)
+	if err != nil {
+		return nil, err
+	}
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, in)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = stat.Size()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+	}
+	p.Reporter.Logf("uploaded %s to %s", f.Path, u)
+	return []*file{f}, nil
+}
+
+func commandStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	cmdStr, err := Render(p.Config, "command", step.Command, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := RunCommand(ctx, cmdStr, data.Env(), p.Reporter.LogWriter()); err != nil {
+		return nil, err
+	}
+	return []*file{f}, nil
+}
+
+// remoteUploadStep 上传文件与附属文件，附属文件放在文件所在的远程目录
+func remoteUploadStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	key, err := remoteKey(p, step.Key, f.Path, data)
+	if err != nil {
+		return nil, err
+	}
+	paths := append([]string{f.Path}, f.Artifacts...)
+	for i, local := range paths {
+		k := key
+		if i > 0 {
+			k = path.Join(path.Dir(key), filepath.Base(local))
+		}
+		status := UploadStatus{File: local, Target: step.Target, Key: k, State: UploadUploading}
+		p.reportUpload(status)
+		result, err := remote.Upload(ctx, p.Config, step.Target, local, k, p.Reporter.Logf)
+		if err != nil {
+			status.State, status.Error = UploadFailed, err.Error()
+			p.reportUpload(status)
+			return nil, err
+		}
+		status.State, status.Size, status.ETag = UploadSucceeded, result.Size, result.ETag
+		p.reportUpload(status)
+		p.Reporter.Logf("uploaded %s to %s:%s", local, step.Target, k)
+	}
+	if !step.DeleteSource {
+		return []*file{f}, nil
+	}
+	for _, local := range paths {
+		os.Remove(local)
+	}
+	return []*file{}, nil
+}
+
+// remoteKey 渲染远程路径模板，模板为空时使用文件相对 out_put_path 的路径
+func remoteKey(p *Pipeline, tmpl, local string, data *CommandlineData) (string, error) {
+	if tmpl != "" {
+		key, err := Render(p.Config, "remote_key", tmpl, data)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(key)), "/"), nil
+	}
+	outPutPath := p.OutPutPath
+	if outPutPath == "" {
+		outPutPath = p.Config.OutPutPath
+	}
+	outPutPath, _ = filepath.Abs(outPutPath)
+	abs, _ := filepath.Abs(local)
+	if rel, err := filepath.Rel(outPutPath, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel), nil
+	}
+	return filepath.Base(local), nil
+}
+
+// danmakuASSStep 将录制时保存的弹幕文件转换为 ASS 字幕，分辨率与视频一致，字幕作为附属文件保存
+func danmakuASSStep(ctx context.Context, p *Pipeline, step *configs.PostProcessStep, f *file, data *CommandlineData) ([]*file, error) {
+	var input string
+	for _, artifact := range f.Artifacts {
+		if danmaku.ValidFormat(strings.TrimPrefix(filepath.Ext(artifact), ".")) {
+			input = artifact
+			break
+		}
+	}
+	if input == "" {
+		p.Reporter.Logf("no danmaku file of %s", f.Path)
+		return []*file{f}, nil
+	}
+	opts := danmaku.ASSOptions{
+		FontName:       step.ASS.FontName,
+		FontSize:       step.ASS.FontSize,
+		Opacity:        step.ASS.Opacity,
+		ScrollDuration: step.ASS.ScrollDuration,
+		FixedDuration:  step.ASS.FixedDuration,
+		ScrollArea:     step.ASS.ScrollArea,
+		Density:        step.ASS.Density,
+		Blocklist:      step.ASS.Blocklist,
+	}
+	var err error
+	if opts.Width, opts.Height, err = ProbeResolution(ctx, data.Ffmpeg, f.Path); err != nil {
+		p.Reporter.Logf("failed to probe resolution of %s, use 1920x1080: %v", f.Path, err)
+	}
+	output := trimExt(f.Path) + ".ass"
+	count, err := danmaku.ConvertToASS(input, output, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.Reporter.Logf("rendered %d danmaku of %s to %s", count, input, output)
+	f.Artifacts = append(f.Artifacts, output)
+	return []*file{f}, nil
+}
@@ -0,0 +1,165 @@
+package recorders
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/consts"
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+	"github.com/bililive-go/bililive-go/src/pkg/parser"
+)
+
+// for test
+var danmakuSwitchInterval = time.Second
+
+// currentFile 返回正在写入的视频文件与开始写入的时间，解析器内部切分时为最新的文件
+func (r *recorder) currentFile() (string, time.Time) {
+	p := r.getParser()
+	if fp, ok := p.(parser.FilesParser); ok {
+		if files := fp.OutputFiles(); len(files) > 0 {
+			if tp, ok := p.(parser.FileTimesParser); ok {
+				if times := tp.OutputFileTimes(); len(times) == len(files) {
+					return files[len(files)-1], times[len(times)-1]
+				}
+			}
+			return files[len(files)-1], r.StartTime()
+		}
+	}
+	file, _ := r.file.Load().(string)
+	return file, r.StartTime()
+}
+
+// danmakuFile 是一个视频文件对应的弹幕文件，start 为视频文件开始写入的时间
+type danmakuFile struct {
+	w     danmaku.Writer
+	video string
+	start time.Time
+}
+
+// recordDanmaku 在录制器停止前接收弹幕，写入正在录制的视频文件对应的弹幕文件，
+// 视频文件切换时弹幕文件一起切换，时间从视频文件开始写入时计算；
+// 弹幕按接收时间写入对应的文件，切换前收到、切换后才处理的弹幕写入上一个文件，上一个文件在下一次检查时关闭；
+// 同一场次中交接录制时新的录制器不再建立连接，由当前的连接在旧的录制器停止后继续写入新的录制器的文件
+func (r *recorder) recordDanmaku(ctx context.Context) {
+	provider, ok := live.GetDanmakuProvider(r.Live)
+	if !ok || !r.config.DanmakuEnabled(r.Live.GetRawUrl()) {
+		return
+	}
+	if r.session.followDanmaku(r) {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch, err := provider.Danmaku(ctx)
+	if err != nil {
+		r.session.stopDanmaku()
+		r.getLogger().WithError(err).Warn("failed to receive danmaku")
+		return
+	}
+	// 正在写入弹幕的录制器
+	cur := r
+
+	format := r.config.GetDanmakuFormat()
+	// file 为正在写入的弹幕文件，prev 为上一个文件
+	var file, prev *danmakuFile
+	closeFile := func(f *danmakuFile) {
+		if f == nil || f.w == nil {
+			return
+		}
+		if err := f.w.Close(); err != nil {
+			r.getLogger().WithError(err).Warn("failed to close danmaku file")
+		}
+		// 没有录到数据的视频文件会被删除，弹幕文件也一起删除
+		if stat, err := os.Stat(f.video); err != nil || stat.Size() == 0 {
+			os.Remove(danmaku.File(f.video, format))
+		}
+	}
+	defer func() {
+		closeFile(prev)
+		closeFile(file)
+	}()
+	switchFile := func() {
+		video, start := cur.currentFile()
+		if file != nil && video == file.video {
+			return
+		}
+		closeFile(prev)
+		prev, file = file, nil
+		if video == "" {
+			return
+		}
+		info := danmaku.RecordInfo{
+			RoomId:  path.Base(strings.TrimSuffix(r.Live.GetRawUrl(), "/")),
+			Version: consts.AppName + " " + consts.AppVersion,
+		}
+		if obj, err := r.cache.Get(r.Live); err == nil {
+			info.HostName = obj.(*live.Info).HostName
+			info.RoomName = obj.(*live.Info).RoomName
+		}
+		file = &danmakuFile{video: video, start: start}
+		if file.w, err = danmaku.NewWriter(format, danmaku.File(video, format), start, info); err != nil {
+			r.getLogger().WithError(err).Warn("failed to create danmaku file")
+		}
+	}
+	// target 返回接收时间所在的弹幕文件
+	target := func(m *danmaku.Message) *danmakuFile {
+		if prev != nil && file != nil && m.Time.Before(file.start) {
+			return prev
+		}
+		return file
+	}
+	// tick 切换文件，上一个文件在切换后的下一次检查时关闭
+	tick := func() {
+		closeFile(prev)
+		prev = nil
+		switchFile()
+	}
+
+	// following 在正在写入的录制器停止后切换到交接后的录制器，没有时返回 false
+	following := func() bool {
+		select {
+		case <-cur.stop:
+			cur = r.session.nextDanmaku(cur)
+			return cur != nil
+		default:
+			return true
+		}
+	}
+
+	ticker := time.NewTicker(danmakuSwitchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				r.session.stopDanmaku()
+				return
+			}
+			if !following() {
+				return
+			}
+			switchFile()
+			f := target(m)
+			if f == nil || f.w == nil {
+				continue
+			}
+			if err := f.w.Write(m); err != nil {
+				r.getLogger().WithError(err).Warn("failed to write danmaku")
+			}
+		case <-ticker.C:
+			if !following() {
+				return
+			}
+			tick()
+		case <-cur.stop:
+			if !following() {
+				return
+			}
+			switchFile()
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package recorders
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/live"
+	livemock "github.com/bililive-go/bililive-go/src/live/mock"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+)
+
+type danmakuLive struct {
+	*livemock.MockLive
+	ch chan *danmaku.Message
+	// 建立的弹幕连接数
+	connections atomic.Int32
+}
+
+func (l *danmakuLive) Danmaku(ctx context.Context) (<-chan *danmaku.Message, error) {
+	l.connections.Add(1)
+	out := make(chan *danmaku.Message)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case m := <-l.ch:
+				out <- m
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func TestRecordDanmaku(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backup := danmakuSwitchInterval
+	danmakuSwitchInterval = 10 * time.Millisecond
+	defer func() { danmakuSwitchInterval = backup }()
+
+	dir := t.TempDir()
+	cfg := configs.NewConfig()
+	cfg.Danmaku.Enable = true
+	l := &danmakuLive{MockLive: livemock.NewMockLive(ctrl), ch: make(chan *danmaku.Message)}
+	l.EXPECT().GetRawUrl().Return("https://live.bilibili.com/1").AnyTimes()
+	cache := gcache.New(4).LRU().Build()
+	cache.Set(live.Live(l), &live.Info{HostName: "host", RoomName: "room"})
+	r := &recorder{
+		Live:       l,
+		config:     cfg,
+		cache:      cache,
+		logger:     &interfaces.Logger{Logger: logrus.New()},
+		stop:       make(chan struct{}),
+		parserLock: new(sync.RWMutex),
+	}
+	done := make(chan struct{})
+	go func() {
+		r.recordDanmaku(context.Background())
+		close(done)
+	}()
+
+	a := filepath.Join(dir, "a.flv")
+	b := filepath.Join(dir, "b.flv")
+	empty := filepath.Join(dir, "empty.flv")
+	assert.NoError(t, os.WriteFile(a, []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(b, []byte("b"), 0644))
+	send := func(file, content string) {
+		r.file.Store(file)
+		l.ch <- &danmaku.Message{Type: danmaku.TypeDanmaku, Time: time.Now(), Content: content}
+		assert.Eventually(t, func() bool {
+			b, _ := os.ReadFile(danmaku.File(file, danmaku.FormatXML))
+			return strings.Contains(string(b), ">"+content+"</d>")
+		}, time.Second, 5*time.Millisecond)
+	}
+	send(a, "first")
+	send(b, "second")
+	// 没有数据的视频文件不保留弹幕文件
+	send(empty, "third")
+	close(r.stop)
+	<-done
+
+	content, err := os.ReadFile(filepath.Join(dir, "a.xml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), ">first</d>")
+	assert.NotContains(t, string(content), "second")
+	assert.True(t, strings.HasSuffix(string(content), "</i>\n"))
+	content, err = os.ReadFile(filepath.Join(dir, "b.xml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `name="host" title="room"`)
+	assert.Contains(t, string(content), ">second</d>")
+	assert.NoFileExists(t, filepath.Join(dir, "empty.xml"))
+
+	// 关闭弹幕录制时直接返回
+	cfg.Danmaku.Enable = false
+	r.recordDanmaku(context.Background())
+}
+
+type fileTimesParser struct {
+	lock  sync.Mutex
+	files []string
+	times []time.Time
+}
+
+func (p *fileTimesParser) ParseLiveStream(context.Context, *live.StreamUrlInfo, live.Live, string) error {
+	return nil
+}
+
+func (p *fileTimesParser) Stop() error { return nil }
+
+func (p *fileTimesParser) OutputFiles() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.files...)
+}
+
+func (p *fileTimesParser) OutputFileTimes() []time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]time.Time(nil), p.times...)
+}
+
+func (p *fileTimesParser) add(file string, start time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.files = append(p.files, file)
+	p.times = append(p.times, start)
+}
+
+func TestRecordDanmakuFileTimes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backup := danmakuSwitchInterval
+	danmakuSwitchInterval = time.Hour
+	defer func() { danmakuSwitchInterval = backup }()
+
+	dir := t.TempDir()
+	cfg := configs.NewConfig()
+	cfg.Danmaku.Enable = true
+	l := &danmakuLive{MockLive: livemock.NewMockLive(ctrl), ch: make(chan *danmaku.Message)}
+	l.EXPECT().GetRawUrl().Return("https://live.bilibili.com/1").AnyTimes()
+	p := new(fileTimesParser)
+	r := &recorder{
+		Live:       l,
+		config:     cfg,
+		cache:      gcache.New(4).LRU().Build(),
+		logger:     &interfaces.Logger{Logger: logrus.New()},
+		stop:       make(chan struct{}),
+		parser:     p,
+		parserLock: new(sync.RWMutex),
+	}
+	a, b := filepath.Join(dir, "a.flv"), filepath.Join(dir, "b.flv")
+	assert.NoError(t, os.WriteFile(a, []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(b, []byte("b"), 0644))
+	t0 := time.Now().Add(-time.Minute)
+	p.add(a, t0)
+	done := make(chan struct{})
+	go func() {
+		r.recordDanmaku(context.Background())
+		close(done)
+	}()
+	send := func(at time.Time, file, content string) {
+		l.ch <- &danmaku.Message{Type: danmaku.TypeDanmaku, Time: at, Content: content}
+		assert.Eventually(t, func() bool {
+			b, _ := os.ReadFile(danmaku.File(file, danmaku.FormatXML))
+			return strings.Contains(string(b), ">"+content+"</d>")
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	send(t0.Add(time.Second), a, "first")
+	// 切分后才处理的弹幕按接收时间写入上一个文件
+	t1 := t0.Add(10 * time.Second)
+	p.add(b, t1)
+	send(t1.Add(-time.Second), a, "late")
+	send(t1.Add(2*time.Second), b, "second")
+	close(r.stop)
+	<-done
+
+	content, err := os.ReadFile(filepath.Join(dir, "a.xml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `start_time="`+t0.Format(time.RFC3339Nano)+`"`)
+	assert.Contains(t, string(content), `p="1.000,`)
+	assert.Contains(t, string(content), `p="9.000,1,25,16777215,`)
+	assert.Contains(t, string(content), ">late</d>")
+	assert.NotContains(t, string(content), "second")
+	content, err = os.ReadFile(filepath.Join(dir, "b.xml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `start_time="`+t1.Format(time.RFC3339Nano)+`"`)
+	assert.Contains(t, string(content), `p="2.000,`)
+	assert.Contains(t, string(content), ">second</d>")
+	assert.NotContains(t, string(content), "late")
+}
+
+func TestRecordDanmakuHandover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backup := danmakuSwitchInterval
+	danmakuSwitchInterval = 10 * time.Millisecond
+	defer func() { danmakuSwitchInterval = backup }()
+
+	dir := t.TempDir()
+	cfg := configs.NewConfig()
+	cfg.Danmaku.Enable = true
+	l := &danmakuLive{MockLive: livemock.NewMockLive(ctrl), ch: make(chan *danmaku.Message)}
+	l.EXPECT().GetRawUrl().Return("https://live.bilibili.com/1").AnyTimes()
+	session := &Session{}
+	newTestRecorder := func(file string) *recorder {
+		assert.NoError(t, os.WriteFile(file, []byte("a"), 0644))
+		r := &recorder{
+			Live:       l,
+			config:     cfg,
+			cache:      gcache.New(4).LRU().Build(),
+			logger:     &interfaces.Logger{Logger: logrus.New()},
+			stop:       make(chan struct{}),
+			parserLock: new(sync.RWMutex),
+			session:    session,
+		}
+		r.file.Store(file)
+		return r
+	}
+	send := func(file, content string) {
+		l.ch <- &danmaku.Message{Type: danmaku.TypeDanmaku, Time: time.Now(), Content: content}
+		assert.Eventually(t, func() bool {
+			b, _ := os.ReadFile(danmaku.File(file, danmaku.FormatXML))
+			return strings.Contains(string(b), ">"+content+"</d>")
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	a, b := filepath.Join(dir, "a.flv"), filepath.Join(dir, "b.flv")
+	old := newTestRecorder(a)
+	done := make(chan struct{})
+	go func() {
+		old.recordDanmaku(context.Background())
+		close(done)
+	}()
+	send(a, "first")
+
+	// 交接时新的录制器不建立新的连接，旧的录制器停止后写入新的录制器的文件
+	next := newTestRecorder(b)
+	next.recordDanmaku(context.Background())
+	send(a, "second")
+	close(old.stop)
+	send(b, "third")
+	assert.Equal(t, int32(1), l.connections.Load())
+	content, err := os.ReadFile(filepath.Join(dir, "a.xml"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "third")
+
+	close(next.stop)
+	<-done
+	assert.Nil(t, session.danmaku)
+}
@@ -6,4 +6,11 @@ var (
 	ErrRecorderExist          = errors.New("recorder is exist")
 	ErrRecorderNotExist       = errors.New("recorder is not exist")
 	ErrParserNotSupportStatus = errors.New("parser not support get status")
+	ErrParserNotSupportSplit  = errors.New("parser not support split")
+	ErrRecorderPaused         = errors.New("recorder is paused")
+	ErrRecorderNotPaused      = errors.New("recorder is not paused")
+	ErrRecordingSuppressed    = errors.New("recording is stopped manually until the live ends")
+	ErrLiveNotStarted         = errors.New("live is not started")
+	ErrNotListening           = errors.New("live is not listening")
+	ErrRecordingQueued        = errors.New("waiting for a free recording slot or bandwidth")
 )
@@ -1,9 +1,22 @@
 package recorders
 
-import "github.com/bililive-go/bililive-go/src/pkg/events"
+import (
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/events"
+)
 
 const (
 	RecorderStart   events.EventType = "RecorderStart"
 	RecorderStop    events.EventType = "RecorderStop"
 	RecorderRestart events.EventType = "RecorderRestart"
+	// 以下事件由手动控制录制时发出，携带的数据为 live.Live
+	RecorderSplit  events.EventType = "RecorderSplit"
+	RecorderPause  events.EventType = "RecorderPause"
+	RecorderResume events.EventType = "RecorderResume"
 )
+
+// RecorderStopEvent 是 RecorderStop 事件携带的数据，事件在最后一个分段写完后发出
+type RecorderStopEvent struct {
+	Live    live.Live
+	Session *Session
+}
@@ -0,0 +1,196 @@
+package recorders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/jobs"
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+	"github.com/bililive-go/bililive-go/src/pkg/highlight"
+	"github.com/bililive-go/bililive-go/src/pkg/utils"
+)
+
+// HighlightJob 场次结束后根据弹幕密度检测高能片段并导出的任务
+const HighlightJob = "highlight"
+
+type highlightPayload struct {
+	SessionId string `json:"session_id"`
+}
+
+// 录制文件被转封装后依次尝试的扩展名
+var videoExts = []string{".flv", ".ts", ".mp4", ".mkv"}
+
+// SubmitHighlight 提交场次的高能片段检测任务，已有的结果会被替换；
+// 场次的后处理任务结束后才开始执行，从后处理输出的文件导出片段
+func SubmitHighlight(ctx context.Context, sessionId string) (*jobs.Job, error) {
+	jm, ok := instance.GetInstance(ctx).JobManager.(jobs.Manager)
+	if !ok {
+		return nil, errors.New("job manager is not available")
+	}
+	after := sessionPostProcessJobs(jm.GetJobs(ctx), sessionId)
+	return jm.SubmitAfter(ctx, HighlightJob, highlightPayload{SessionId: sessionId}, after)
+}
+
+func highlightOptions(cfg *configs.Highlight) highlight.Options {
+	return highlight.Options{
+		Interval:        cfg.Interval,
+		TopN:            cfg.TopN,
+		Before:          cfg.Before,
+		After:           cfg.After,
+		MinRatio:        cfg.MinRatio,
+		Keywords:        cfg.Keywords,
+		GiftWeight:      cfg.GiftWeight,
+		SuperChatWeight: cfg.SuperChatWeight,
+		PriceWeight:     cfg.PriceWeight,
+	}
+}
+
+// segmentVideo 返回分段后处理输出的视频文件，没有记录时查找录制文件；
+// 修复时切分出多个文件时使用第一个，片段的时间与它对应
+func segmentVideo(seg *Segment) string {
+	for _, file := range seg.Outputs {
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return findVideo(seg.File)
+}
+
+// findVideo 返回录制文件，文件被转封装时返回同名的其他格式的文件
+func findVideo(file string) string {
+	if _, err := os.Stat(file); err == nil {
+		return file
+	}
+	stem := strings.TrimSuffix(file, filepath.Ext(file))
+	for _, ext := range videoExts {
+		if _, err := os.Stat(stem + ext); err == nil {
+			return stem + ext
+		}
+	}
+	return ""
+}
+
+// sessionDanmaku 读取场次中每个分段的弹幕，时间转换为相对场次开始的时间
+func sessionDanmaku(s *Session, logf func(format string, args ...any)) []danmaku.Item {
+	var items []danmaku.Item
+	for _, seg := range s.Segments {
+		for _, file := range danmaku.Files(seg.File) {
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+			segItems, err := danmaku.ReadFile(file)
+			if err != nil {
+				logf("failed to read %s: %v", file, err)
+				continue
+			}
+			offset := seg.StartTime.Sub(s.StartTime)
+			for _, item := range segItems {
+				item.Offset += offset
+				items = append(items, item)
+			}
+			logf("read %d danmaku from %s", len(segItems), file)
+			break
+		}
+	}
+	return items
+}
+
+// clipSegment 返回峰值所在的分段，以及片段在该分段中的开始时间与时长（秒），片段不会跨越分段
+func clipSegment(s *Session, h *highlight.Highlight) (*Segment, float64, float64) {
+	for _, seg := range s.Segments {
+		start := seg.StartTime.Sub(s.StartTime).Seconds()
+		end := seg.EndTime.Sub(s.StartTime).Seconds()
+		if seg.EndTime.IsZero() {
+			end = h.End
+		}
+		if h.Peak < start || h.Peak >= end {
+			continue
+		}
+		from, to := max(h.Start, start), min(h.End, end)
+		return seg, from - start, to - from
+	}
+	return nil, 0, 0
+}
+
+func exportClip(ctx context.Context, task *jobs.Task, ffmpeg, video, output string, offset, duration float64) error {
+	cmd := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-y",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", video,
+		"-t", strconv.FormatFloat(duration, 'f', 3, 64),
+		"-c", "copy", "-avoid_negative_ts", "make_zero",
+		output,
+	)
+	cmd.Stdout = task.LogWriter()
+	cmd.Stderr = task.LogWriter()
+	if err := cmd.Run(); err != nil {
+		os.Remove(output)
+		return err
+	}
+	return nil
+}
+
+func detectHighlights(ctx context.Context, task *jobs.Task) error {
+	var payload highlightPayload
+	if err := task.Payload(&payload); err != nil {
+		return err
+	}
+	inst := instance.GetInstance(ctx)
+	m, ok := inst.RecorderManager.(*manager)
+	if !ok {
+		return errors.New("recorder manager is not available")
+	}
+	s, err := m.GetSession(ctx, payload.SessionId)
+	if err != nil {
+		return err
+	}
+	items := sessionDanmaku(s, task.Logf)
+	if len(items) == 0 {
+		task.Logf("no danmaku in session %s", s.Id)
+	}
+	var duration time.Duration
+	if !s.EndTime.IsZero() {
+		duration = s.EndTime.Sub(s.StartTime)
+	}
+	cfg := &inst.Config.Highlight
+	timeline, highlights := highlight.Detect(items, duration, highlightOptions(cfg))
+	task.Logf("found %d highlights", len(highlights))
+
+	var errs []error
+	if cfg.ExportClips && len(highlights) > 0 {
+		ffmpeg, err := utils.GetFFmpegPath(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to find ffmpeg: %w", err)
+		}
+		for i, h := range highlights {
+			seg, offset, length := clipSegment(s, h)
+			if seg == nil || length <= 0 {
+				continue
+			}
+			video := segmentVideo(seg)
+			if video == "" {
+				task.Logf("skip highlight at %.0fs: %s is not exist", h.Peak, seg.File)
+				continue
+			}
+			ext := filepath.Ext(video)
+			output := fmt.Sprintf("%s.highlight-%02d%s", strings.TrimSuffix(video, ext), i+1, ext)
+			if err := exportClip(ctx, task, ffmpeg, video, output, offset, length); err != nil {
+				errs = append(errs, fmt.Errorf("export %s: %w", filepath.Base(output), err))
+				continue
+			}
+			h.File, h.Clip = video, output
+			task.Logf("exported highlight at %.0fs to %s", h.Peak, output)
+			task.SetProgress(float64(i+1) / float64(len(highlights)))
+		}
+	}
+	m.recordHighlights(s.Id, timeline, highlights)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+package recorders
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/pkg/danmaku"
+	"github.com/bililive-go/bililive-go/src/pkg/highlight"
+)
+
+func TestSessionDanmaku(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	s := &Session{
+		StartTime: start,
+		Segments: []*Segment{
+			{File: filepath.Join(dir, "a.flv"), StartTime: start, EndTime: start.Add(time.Minute)},
+			{File: filepath.Join(dir, "b.flv"), StartTime: start.Add(70 * time.Second), EndTime: start.Add(2 * time.Minute)},
+		},
+	}
+	for i, format := range []string{danmaku.FormatXML, danmaku.FormatJSONL} {
+		seg := s.Segments[i]
+		w, err := danmaku.NewWriter(format, danmaku.File(seg.File, format), seg.StartTime, danmaku.RecordInfo{})
+		assert.NoError(t, err)
+		assert.NoError(t, w.Write(&danmaku.Message{Type: danmaku.TypeDanmaku, Time: seg.StartTime.Add(5 * time.Second), UserName: "a", Content: "草"}))
+		assert.NoError(t, w.Close())
+	}
+
+	items := sessionDanmaku(s, t.Logf)
+	assert.Len(t, items, 2)
+	assert.Equal(t, 5*time.Second, items[0].Offset)
+	assert.Equal(t, 75*time.Second, items[1].Offset)
+}
+
+func TestClipSegment(t *testing.T) {
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	s := &Session{
+		StartTime: start,
+		Segments: []*Segment{
+			{File: "a.flv", StartTime: start, EndTime: start.Add(time.Minute)},
+			{File: "b.flv", StartTime: start.Add(70 * time.Second)},
+		},
+	}
+
+	seg, offset, length := clipSegment(s, &highlight.Highlight{Start: 30, End: 90, Peak: 50})
+	assert.Equal(t, "a.flv", seg.File)
+	assert.Equal(t, 30.0, offset)
+	assert.Equal(t, 30.0, length)
+
+	seg, offset, length = clipSegment(s, &highlight.Highlight{Start: 60, End: 120, Peak: 100})
+	assert.Equal(t, "b.flv", seg.File)
+	assert.Equal(t, 0.0, offset)
+	assert.Equal(t, 50.0, length)
+
+	seg, _, _ = clipSegment(s, &highlight.Highlight{Start: 50, End: 80, Peak: 65})
+	assert.Nil(t, seg)
+}
@@ -0,0 +1,217 @@
+package recorders
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/bandwidth"
+	"github.com/bililive-go/bililive-go/src/pkg/parser"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+// for test
+var limitsCheckInterval = 10 * time.Second
+
+// admit 需要在持有锁的情况下调用，只在开始新的场次时检查
+//
+// 达到并发数上限时，如果有优先级更低的录制则停止其中优先级最低的一个并让它等待，否则加入等待队列；
+// over_budget 为 wait 且剩余带宽不足时同样加入等待队列
+func (m *manager) admit(l live.Live) error {
+	id := l.GetLiveId()
+	priority := m.cfg.GetPriority(l.GetRawUrl())
+	if limit := m.cfg.Limits.MaxConcurrentRecordings; limit > 0 && len(m.savers) >= limit {
+		victim, ok := m.lowestPriority()
+		if !ok || m.cfg.GetPriority(victim.GetRawUrl()) >= priority {
+			m.waiting[id] = l
+			return ErrRecordingQueued
+		}
+		m.inst.Logger.Warnf("stop recording %s to record %s with higher priority", victim.GetRawUrl(), l.GetRawUrl())
+		m.endSession(victim.GetLiveId())
+		m.savers[victim.GetLiveId()].Close()
+		delete(m.savers, victim.GetLiveId())
+		m.waiting[victim.GetLiveId()] = victim
+	}
+	if lim, ok := m.inst.Bandwidth.(*bandwidth.Limiter); ok && m.cfg.Limits.OverBudget == configs.OverBudgetWait &&
+		!lim.HasCapacity(id, priority) {
+		m.waiting[id] = l
+		return ErrRecordingQueued
+	}
+	delete(m.waiting, id)
+	return nil
+}
+
+// lowestPriority 需要在持有锁的情况下调用，返回可以被停止的优先级最低的录制
+func (m *manager) lowestPriority() (live.Live, bool) {
+	recording := make([]live.Live, 0, len(m.savers))
+	for id := range m.savers {
+		if l, ok := m.inst.Lives[id]; ok {
+			recording = append(recording, l)
+		}
+	}
+	victim, _, ok := LowestPriority(m.cfg, recording, func(id types.LiveID) bool { return m.manual[id] }, nil)
+	return victim, ok
+}
+
+// LowestPriority 从正在录制的直播间中选择需要停止的一个：跳过手动开始的录制与 skip 返回 true 的优先级，
+// 选择优先级最低的，优先级相同时选择 id 较小的；返回选中的直播间与其优先级，skip 可以为 nil
+func LowestPriority(cfg *configs.Config, recording []live.Live, isManual func(types.LiveID) bool, skip func(priority int) bool) (live.Live, int, bool) {
+	var (
+		victim   live.Live
+		priority int
+	)
+	for _, l := range recording {
+		id := l.GetLiveId()
+		if isManual(id) {
+			continue
+		}
+		p := cfg.GetPriority(l.GetRawUrl())
+		if skip != nil && skip(p) {
+			continue
+		}
+		if victim == nil || p < priority || (p == priority && id < victim.GetLiveId()) {
+			victim, priority = l, p
+		}
+	}
+	return victim, priority, victim != nil
+}
+
+// startWaiting 按优先级为等待中的直播间开始录制，直到再次超出上限
+func (m *manager) startWaiting(ctx context.Context) {
+	m.lock.RLock()
+	waiting := make([]live.Live, 0, len(m.waiting))
+	for _, l := range m.waiting {
+		waiting = append(waiting, l)
+	}
+	m.lock.RUnlock()
+	sort.Slice(waiting, func(i, j int) bool {
+		pi, pj := m.cfg.GetPriority(waiting[i].GetRawUrl()), m.cfg.GetPriority(waiting[j].GetRawUrl())
+		if pi != pj {
+			return pi > pj
+		}
+		return waiting[i].GetLiveId() < waiting[j].GetLiveId()
+	})
+	for _, l := range waiting {
+		err := m.AddRecorder(ctx, l)
+		if errors.Is(err, ErrRecordingQueued) {
+			return
+		}
+		m.lock.Lock()
+		delete(m.waiting, l.GetLiveId())
+		m.lock.Unlock()
+		if err != nil && !errors.Is(err, ErrRecorderExist) {
+			m.inst.Logger.Infof("skip recording %s: %v", l.GetRawUrl(), err)
+		}
+	}
+}
+
+// watchLimits 设置了带宽上限时定期检查等待中的直播间，带宽空闲后开始录制
+func (m *manager) watchLimits(ctx context.Context) {
+	if m.cfg.Limits.BandwidthLimit() <= 0 || m.cfg.Limits.OverBudget != configs.OverBudgetWait {
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(limitsCheckInterval):
+				m.startWaiting(ctx)
+			}
+		}
+	}()
+}
+
+func (m *manager) IsWaiting(ctx context.Context, liveId types.LiveID) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, ok := m.waiting[liveId]
+	return ok
+}
+
+// overBudget 返回 over_budget 为 downgrade 时剩余带宽是否不足以再录制一个直播间
+func (r *recorder) overBudget(ctx context.Context) (*bandwidth.Limiter, bool) {
+	lim, ok := instance.GetInstance(ctx).Bandwidth.(*bandwidth.Limiter)
+	if !ok || !lim.Enabled() || r.config.Limits.OverBudget != configs.OverBudgetDowngrade {
+		return nil, false
+	}
+	return lim, !lim.HasCapacity(r.Live.GetLiveId(), r.config.GetPriority(r.Live.GetRawUrl()))
+}
+
+// fitBandwidth over_budget 为 downgrade 且剩余带宽不足时，优先录制码率不超过剩余带宽的变体
+func (r *recorder) fitBandwidth(ctx context.Context, variants []*StreamVariant) []*StreamVariant {
+	lim, over := r.overBudget(ctx)
+	if !over {
+		return variants
+	}
+	res := downgradeVariants(variants, lim.Available(r.Live.GetLiveId(), r.config.GetPriority(r.Live.GetRawUrl())))
+	if len(res) > 0 && res[0] != variants[0] {
+		r.getLogger().Warnf("bandwidth is over budget, downgrade to stream variant[%s]", res[0].Name)
+	}
+	return res
+}
+
+// downgradeVariants 把码率不超过 available（字节每秒）的变体移到前面并保持原有顺序，
+// 都超过时按码率与分辨率从低到高排序
+func downgradeVariants(variants []*StreamVariant, available int64) []*StreamVariant {
+	fits := func(v *StreamVariant) bool {
+		return v.Bitrate > 0 && int64(v.Bitrate)*1000/8 <= available
+	}
+	if len(variants) == 0 || fits(variants[0]) {
+		return variants
+	}
+	res := make([]*StreamVariant, 0, len(variants))
+	for _, v := range variants {
+		if fits(v) {
+			res = append(res, v)
+		}
+	}
+	if len(res) == 0 {
+		res = append(res, variants...)
+		sort.SliceStable(res, func(i, j int) bool {
+			if res[i].bitrate() != res[j].bitrate() {
+				return res[i].bitrate() < res[j].bitrate()
+			}
+			return res[i].resolution() < res[j].resolution()
+		})
+		return res
+	}
+	for _, v := range variants {
+		if !fits(v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// limitBandwidth 设置了带宽上限时为本次连接限速，不支持限速的解析器通过本地代理下载；
+// 返回解析器使用的线路与结束连接后需要调用的函数
+func (r *recorder) limitBandwidth(ctx context.Context, p parser.Parser, streamInfo *live.StreamUrlInfo) (*live.StreamUrlInfo, func()) {
+	lim, ok := instance.GetInstance(ctx).Bandwidth.(*bandwidth.Limiter)
+	if !ok || !lim.Enabled() {
+		return streamInfo, func() {}
+	}
+	flow := lim.NewFlow(r.Live.GetLiveId(), r.config.GetPriority(r.Live.GetRawUrl()))
+	if lp, ok := p.(parser.LimitedParser); ok {
+		lp.SetRateLimiter(flow)
+		return streamInfo, flow.Close
+	}
+	proxied, release, err := lim.Proxy(streamInfo.Url, flow)
+	if err != nil {
+		r.getLogger().WithError(err).Warn("failed to start bandwidth limiting proxy, download without limit")
+		return streamInfo, flow.Close
+	}
+	info := *streamInfo
+	info.Url = proxied
+	return &info, func() {
+		release()
+		flow.Close()
+	}
+}
@@ -2,24 +2,38 @@ package recorders
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/bililive-go/bililive-go/src/configs"
 	"github.com/bililive-go/bililive-go/src/instance"
 	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/jobs"
 	"github.com/bililive-go/bililive-go/src/listeners"
 	"github.com/bililive-go/bililive-go/src/live"
 	"github.com/bililive-go/bililive-go/src/pkg/events"
+	"github.com/bililive-go/bililive-go/src/pkg/highlight"
+	"github.com/bililive-go/bililive-go/src/pkg/restream"
+	"github.com/bililive-go/bililive-go/src/postprocess"
+	"github.com/bililive-go/bililive-go/src/scheduler"
 	"github.com/bililive-go/bililive-go/src/types"
 )
 
 func NewManager(ctx context.Context) Manager {
+	inst := instance.GetInstance(ctx)
+	cfg := inst.Config
 	rm := &manager{
-		savers: make(map[types.LiveID]Recorder),
-		cfg:    instance.GetInstance(ctx).Config,
+		inst:       inst,
+		savers:     make(map[types.LiveID]Recorder),
+		sessions:   make(map[types.LiveID]*Session),
+		manual:     make(map[types.LiveID]bool),
+		suppressed: make(map[types.LiveID]bool),
+		waiting:    make(map[types.LiveID]live.Live),
+		store:      newSessionStore(cfg.AppDataPath),
+		cfg:        cfg,
 	}
-	instance.GetInstance(ctx).RecorderManager = rm
+	inst.RecorderManager = rm
 
 	return rm
 }
@@ -31,23 +45,60 @@ type Manager interface {
 	RestartRecorder(ctx context.Context, liveId live.Live) error
 	GetRecorder(ctx context.Context, liveId types.LiveID) (Recorder, error)
 	HasRecorder(ctx context.Context, liveId types.LiveID) bool
+	// GetSessions 返回进行中与已保存的全部录制场次，按开始时间倒序排列
+	GetSessions(ctx context.Context) ([]*Session, error)
+	GetSession(ctx context.Context, id string) (*Session, error)
+	// StartRecording 手动开始录制，不受录制时间表限制，并取消 StopRecording 的效果
+	StartRecording(ctx context.Context, live live.Live) error
+	// StopRecording 手动停止录制但继续监控，直到下次开播前不会自动录制
+	StopRecording(ctx context.Context, liveId types.LiveID) error
+	// SplitRecorder 立即切换到新文件
+	SplitRecorder(ctx context.Context, live live.Live) error
+	PauseRecorder(ctx context.Context, live live.Live) error
+	ResumeRecorder(ctx context.Context, live live.Live) error
+	IsManualRecording(ctx context.Context, liveId types.LiveID) bool
+	IsPaused(ctx context.Context, liveId types.LiveID) bool
+	IsSuppressed(ctx context.Context, liveId types.LiveID) bool
+	// IsWaiting 返回直播间是否因为超出并发数或带宽上限在等待开始录制
+	IsWaiting(ctx context.Context, liveId types.LiveID) bool
 }
 
 // for test
 var (
-	newRecorder = NewRecorder
+	newRecorder     = NewRecorder
+	handoverTimeout = 30 * time.Second
 )
 
 type manager struct {
+	inst   *instance.Instance
 	lock   sync.RWMutex
 	savers map[types.LiveID]Recorder
-	cfg    *configs.Config
+	// 进行中的录制场次，录制器重启时沿用同一个场次
+	sessions map[types.LiveID]*Session
+	// 手动开始录制的场次，场次结束时清除
+	manual map[types.LiveID]bool
+	// 手动停止录制的直播间，下播或停止监控时清除
+	suppressed map[types.LiveID]bool
+	// 超出并发数或带宽上限、等待开始录制的直播间，下播或停止监控时清除
+	waiting map[types.LiveID]live.Live
+	store   *sessionStore
+	cfg     *configs.Config
+	// 串行修改已结束场次的上传状态与高能片段
+	uploadLock sync.Mutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 func (m *manager) registryListener(ctx context.Context, ed events.Dispatcher) {
 	ed.AddEventListener(listeners.LiveStart, events.NewEventListener(func(event *events.Event) {
 		live := event.Object.(live.Live)
-		if err := m.AddRecorder(ctx, live); err != nil {
+		err := m.AddRecorder(ctx, live)
+		switch {
+		case errors.Is(err, scheduler.ErrOutsideSchedule), errors.Is(err, scheduler.ErrDailyLimitExceeded),
+			errors.Is(err, ErrRecordingSuppressed), errors.Is(err, ErrRecordingQueued):
+			instance.GetInstance(ctx).Logger.Infof("skip recording %s: %v", live.GetRawUrl(), err)
+		case err != nil:
 			instance.GetInstance(ctx).Logger.Errorf("failed to add recorder, err: %v", err)
 		}
 	}))
@@ -73,6 +124,37 @@ func (m *manager) registryListener(ctx context.Context, ed events.Dispatcher) {
 	})
 	ed.AddEventListener(listeners.LiveEnd, removeEvtListener)
 	ed.AddEventListener(listeners.ListenStop, removeEvtListener)
+
+	clearSuppressedListener := events.NewEventListener(func(event *events.Event) {
+		live := event.Object.(live.Live)
+		m.lock.Lock()
+		delete(m.suppressed, live.GetLiveId())
+		delete(m.waiting, live.GetLiveId())
+		m.lock.Unlock()
+	})
+	ed.AddEventListener(listeners.LiveEnd, clearSuppressedListener)
+	ed.AddEventListener(listeners.ListenStop, clearSuppressedListener)
+
+	ed.AddEventListener(RecorderStop, events.NewEventListener(func(event *events.Event) {
+		e := event.Object.(*RecorderStopEvent)
+		// 录制器重启时场次仍在继续，只在场次结束后处理
+		if !e.Session.finalize() {
+			return
+		}
+		m.finishSession(ctx, e.Live, e.Session)
+	}))
+}
+
+// finishSession 在场次结束、全部录制器结束运行后提交场次的后处理与高能片段检测
+func (m *manager) finishSession(ctx context.Context, l live.Live, s *Session) {
+	if commandlineBySession(m.cfg, l.GetRawUrl()) {
+		submitSessionPostProcess(ctx, l, s)
+	}
+	if m.cfg.Highlight.Enable && m.cfg.DanmakuEnabled(l.GetRawUrl()) {
+		if _, err := SubmitHighlight(ctx, s.Id); err != nil {
+			instance.GetInstance(ctx).Logger.WithError(err).Errorf("failed to submit highlight job of %s", s.Id)
+		}
+	}
 }
 
 func (m *manager) Start(ctx context.Context) error {
@@ -81,13 +163,23 @@ func (m *manager) Start(ctx context.Context) error {
 		inst.WaitGroup.Add(1)
 	}
 	m.registryListener(ctx, inst.EventDispatcher.(events.Dispatcher))
+	if jm, ok := inst.JobManager.(jobs.Manager); ok {
+		jm.Register(PostProcessJob, postProcess)
+		jm.Register(HighlightJob, detectHighlights)
+	}
+	m.watchLimits(ctx)
 	return nil
 }
 
 func (m *manager) Close(ctx context.Context) {
+	if m.cancel != nil {
+		m.cancel()
+		m.wg.Wait()
+	}
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	for id, recorder := range m.savers {
+		m.endSession(id)
 		recorder.Close()
 		delete(m.savers, id)
 	}
@@ -101,13 +193,32 @@ func (m *manager) AddRecorder(ctx context.Context, live live.Live) error {
 	if _, ok := m.savers[live.GetLiveId()]; ok {
 		return ErrRecorderExist
 	}
-	recorder, err := newRecorder(ctx, live)
+	if m.suppressed[live.GetLiveId()] {
+		return ErrRecordingSuppressed
+	}
+	if err := allowRecording(ctx, live); err != nil {
+		return err
+	}
+	if _, ok := m.sessions[live.GetLiveId()]; !ok {
+		if err := allowSchedule(ctx, live); err != nil {
+			return err
+		}
+		if err := m.admit(live); err != nil {
+			return err
+		}
+	}
+	return m.startRecorder(ctx, live)
+}
+
+// startRecorder 需要在持有锁的情况下调用
+func (m *manager) startRecorder(ctx context.Context, live live.Live) error {
+	recorder, err := newRecorder(ctx, live, m.getOrCreateSession(ctx, live))
 	if err != nil {
 		return err
 	}
 	m.savers[live.GetLiveId()] = recorder
 
-	if maxDur := m.cfg.VideoSplitStrategies.MaxDuration; maxDur != 0 {
+	if maxDur := m.splitStrategies(live).MaxDuration; maxDur != 0 {
 		go m.cronRestart(ctx, live)
 	}
 	return recorder.Start(ctx)
@@ -118,7 +229,18 @@ func (m *manager) cronRestart(ctx context.Context, live live.Live) {
 	if err != nil {
 		return
 	}
-	if time.Since(recorder.StartTime()) < m.cfg.VideoSplitStrategies.MaxDuration {
+	maxDur := m.splitStrategies(live).MaxDuration
+	if maxDur == 0 {
+		return
+	}
+	if time.Since(recorder.StartTime()) < maxDur {
+		time.AfterFunc(time.Minute/4, func() {
+			m.cronRestart(ctx, live)
+		})
+		return
+	}
+	// 解析器支持时在同一连接上切分文件，避免重连丢失数据
+	if err := recorder.Split(); err == nil {
 		time.AfterFunc(time.Minute/4, func() {
 			m.cronRestart(ctx, live)
 		})
@@ -129,28 +251,293 @@ func (m *manager) cronRestart(ctx context.Context, live live.Live) {
 	}
 }
 
+// splitStrategies 返回直播间生效的切分设置
+func (m *manager) splitStrategies(live live.Live) configs.VideoSplitStrategies {
+	return m.cfg.GetRoomConfig(live.GetRawUrl()).VideoSplitStrategies
+}
+
 func (m *manager) RestartRecorder(ctx context.Context, live live.Live) error {
-	if err := m.RemoveRecorder(ctx, live.GetLiveId()); err != nil {
+	if m.splitStrategies(live).Handover {
+		return m.handoverRecorder(ctx, live)
+	}
+	if err := m.removeRecorder(live.GetLiveId(), false); err != nil {
 		return err
 	}
 	if err := m.AddRecorder(ctx, live); err != nil {
+		// 无法继续录制时结束场次，否则场次不会被保存为已结束，下次开播也会沿用该场次
+		m.lock.Lock()
+		var s *Session
+		if _, ok := m.savers[live.GetLiveId()]; !ok {
+			s = m.endSession(live.GetLiveId())
+		}
+		m.lock.Unlock()
+		if s.finalize() {
+			m.finishSession(ctx, live, s)
+		}
+		m.startWaiting(ctx)
 		return err
 	}
 	return nil
 }
 
+// handoverRecorder 先启动新的录制器，由旧的录制器在新的录制器收到数据后自行结束
+func (m *manager) handoverRecorder(ctx context.Context, live live.Live) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	old, ok := m.savers[live.GetLiveId()]
+	if !ok {
+		return ErrRecorderNotExist
+	}
+	recorder, err := newRecorder(ctx, live, m.getOrCreateSession(ctx, live))
+	if err != nil {
+		return err
+	}
+	m.savers[live.GetLiveId()] = recorder
+
+	if maxDur := m.splitStrategies(live).MaxDuration; maxDur != 0 {
+		go m.cronRestart(ctx, live)
+	}
+	if err := recorder.Start(ctx); err != nil {
+		old.Close()
+		return err
+	}
+	go old.Handover(recorder, handoverTimeout)
+	return nil
+}
+
 func (m *manager) RemoveRecorder(ctx context.Context, liveId types.LiveID) error {
+	if err := m.removeRecorder(liveId, true); err != nil {
+		return err
+	}
+	m.startWaiting(ctx)
+	return nil
+}
+
+// removeRecorder 关闭录制器，endSession 为 false 时场次在重启后继续
+func (m *manager) removeRecorder(liveId types.LiveID, endSession bool) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	recorder, ok := m.savers[liveId]
 	if !ok {
 		return ErrRecorderNotExist
 	}
+	if endSession {
+		m.endSession(liveId)
+	}
 	recorder.Close()
 	delete(m.savers, liveId)
 	return nil
 }
 
+// getOrCreateSession 需要在持有锁的情况下调用
+func (m *manager) getOrCreateSession(ctx context.Context, l live.Live) *Session {
+	if s, ok := m.sessions[l.GetLiveId()]; ok {
+		return s
+	}
+	var info *live.Info
+	if inst := instance.GetInstance(ctx); inst != nil && inst.Cache != nil {
+		if obj, err := inst.Cache.Get(l); err == nil {
+			info, _ = obj.(*live.Info)
+		}
+	}
+	s := newSession(l, info, m.store)
+	m.sessions[l.GetLiveId()] = s
+	return s
+}
+
+// endSession 需要在持有锁的情况下调用，返回结束的场次，没有进行中的场次时返回 nil
+func (m *manager) endSession(liveId types.LiveID) *Session {
+	s, ok := m.sessions[liveId]
+	if ok {
+		s.end()
+		delete(m.sessions, liveId)
+	}
+	delete(m.manual, liveId)
+	// 场次结束时结束本地转播，录制器重启时观看者不会断开
+	if reg, ok := m.inst.Restream.(*restream.Registry); ok {
+		reg.Remove(liveId)
+	}
+	return s
+}
+
+func (m *manager) StartRecording(ctx context.Context, l live.Live) error {
+	inst := instance.GetInstance(ctx)
+	if lm, ok := inst.ListenerManager.(listeners.Manager); !ok || !lm.HasListener(ctx, l.GetLiveId()) {
+		return ErrNotListening
+	}
+	if obj, err := inst.Cache.Get(l); err != nil || !obj.(*live.Info).Status {
+		return ErrLiveNotStarted
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.savers[l.GetLiveId()]; ok {
+		return ErrRecorderExist
+	}
+	if err := allowRecording(ctx, l); err != nil {
+		return err
+	}
+	delete(m.suppressed, l.GetLiveId())
+	delete(m.waiting, l.GetLiveId())
+	m.manual[l.GetLiveId()] = true
+	return m.startRecorder(ctx, l)
+}
+
+func (m *manager) StopRecording(ctx context.Context, liveId types.LiveID) error {
+	m.lock.Lock()
+	recorder, ok := m.savers[liveId]
+	if !ok {
+		m.lock.Unlock()
+		return ErrRecorderNotExist
+	}
+	m.suppressed[liveId] = true
+	m.endSession(liveId)
+	recorder.Close()
+	delete(m.savers, liveId)
+	m.lock.Unlock()
+	m.startWaiting(ctx)
+	return nil
+}
+
+func (m *manager) SplitRecorder(ctx context.Context, live live.Live) error {
+	recorder, err := m.GetRecorder(ctx, live.GetLiveId())
+	if err != nil {
+		return err
+	}
+	if m.IsPaused(ctx, live.GetLiveId()) {
+		return ErrRecorderPaused
+	}
+	// 解析器不支持在同一连接上切分时重新连接
+	if err = recorder.Split(); errors.Is(err, ErrParserNotSupportSplit) {
+		err = m.RestartRecorder(ctx, live)
+	}
+	if err != nil {
+		return err
+	}
+	instance.GetInstance(ctx).EventDispatcher.(events.Dispatcher).DispatchEvent(events.NewEvent(RecorderSplit, live))
+	return nil
+}
+
+func (m *manager) PauseRecorder(ctx context.Context, live live.Live) error {
+	recorder, err := m.GetRecorder(ctx, live.GetLiveId())
+	if err != nil {
+		return err
+	}
+	if err := recorder.Pause(); err != nil {
+		return err
+	}
+	instance.GetInstance(ctx).EventDispatcher.(events.Dispatcher).DispatchEvent(events.NewEvent(RecorderPause, live))
+	return nil
+}
+
+func (m *manager) ResumeRecorder(ctx context.Context, live live.Live) error {
+	recorder, err := m.GetRecorder(ctx, live.GetLiveId())
+	if err != nil {
+		return err
+	}
+	if err := recorder.Resume(); err != nil {
+		return err
+	}
+	instance.GetInstance(ctx).EventDispatcher.(events.Dispatcher).DispatchEvent(events.NewEvent(RecorderResume, live))
+	return nil
+}
+
+func (m *manager) IsManualRecording(ctx context.Context, liveId types.LiveID) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.manual[liveId]
+}
+
+func (m *manager) IsPaused(ctx context.Context, liveId types.LiveID) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.sessions[liveId].Paused()
+}
+
+func (m *manager) IsSuppressed(ctx context.Context, liveId types.LiveID) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.suppressed[liveId]
+}
+
+func (m *manager) GetSessions(ctx context.Context) ([]*Session, error) {
+	sessions := make([]*Session, 0)
+	seen := make(map[string]bool)
+	m.lock.RLock()
+	for _, s := range m.sessions {
+		snapshot := s.Snapshot()
+		sessions = append(sessions, snapshot)
+		seen[snapshot.Id] = true
+	}
+	m.lock.RUnlock()
+	if m.store != nil {
+		saved, err := m.store.list()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range saved {
+			if !seen[s.Id] {
+				sessions = append(sessions, s)
+			}
+		}
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func (m *manager) GetSession(ctx context.Context, id string) (*Session, error) {
+	m.lock.RLock()
+	for _, s := range m.sessions {
+		if s.Id == id {
+			m.lock.RUnlock()
+			return s.Snapshot(), nil
+		}
+	}
+	m.lock.RUnlock()
+	if m.store == nil {
+		return nil, ErrSessionNotExist
+	}
+	return m.store.load(id)
+}
+
+// updateSession 修改场次，场次已结束时修改保存的记录
+func (m *manager) updateSession(sessionId string, fn func(s *Session)) {
+	m.lock.RLock()
+	for _, s := range m.sessions {
+		if s.Id == sessionId {
+			m.lock.RUnlock()
+			fn(s)
+			return
+		}
+	}
+	m.lock.RUnlock()
+	if m.store == nil {
+		return
+	}
+	m.uploadLock.Lock()
+	defer m.uploadLock.Unlock()
+	s, err := m.store.load(sessionId)
+	if err != nil {
+		return
+	}
+	s.store = m.store
+	fn(s)
+}
+
+// recordUpload 更新场次的上传状态
+func (m *manager) recordUpload(sessionId string, status postprocess.UploadStatus) {
+	m.updateSession(sessionId, func(s *Session) { s.setUpload(status) })
+}
+
+// recordHighlights 更新场次的高能片段
+func (m *manager) recordHighlights(sessionId string, timeline *highlight.Timeline, highlights []*highlight.Highlight) {
+	m.updateSession(sessionId, func(s *Session) { s.setHighlights(timeline, highlights) })
+}
+
+// recordOutputs 记录分段文件后处理后的文件
+func (m *manager) recordOutputs(sessionId, file string, outputs []string) {
+	m.updateSession(sessionId, func(s *Session) { s.setOutputs(file, outputs) })
+}
+
 func (m *manager) GetRecorder(ctx context.Context, liveId types.LiveID) (Recorder, error) {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
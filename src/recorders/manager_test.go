@@ -2,15 +2,25 @@ package recorders
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/bluele/gcache"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	gomock "go.uber.org/mock/gomock"
 
 	"github.com/bililive-go/bililive-go/src/configs"
 	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/jobs"
 	"github.com/bililive-go/bililive-go/src/live"
 	livemock "github.com/bililive-go/bililive-go/src/live/mock"
+	"github.com/bililive-go/bililive-go/src/pkg/events"
+	evtmock "github.com/bililive-go/bililive-go/src/pkg/events/mock"
 	"github.com/bililive-go/bililive-go/src/types"
 )
 
@@ -23,7 +33,7 @@ func TestManagerAddAndRemoveRecorder(t *testing.T) {
 	})
 	m := NewManager(ctx)
 	backup := newRecorder
-	newRecorder = func(ctx context.Context, live live.Live) (Recorder, error) {
+	newRecorder = func(ctx context.Context, live live.Live, session *Session) (Recorder, error) {
 		r := NewMockRecorder(ctrl)
 		r.EXPECT().Start(ctx).Return(nil)
 		r.EXPECT().Close()
@@ -32,6 +42,8 @@ func TestManagerAddAndRemoveRecorder(t *testing.T) {
 	defer func() { newRecorder = backup }()
 	l := livemock.NewMockLive(ctrl)
 	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
 	assert.NoError(t, m.AddRecorder(context.Background(), l))
 	assert.Equal(t, ErrRecorderExist, m.AddRecorder(context.Background(), l))
 	ln, err := m.GetRecorder(context.Background(), "test")
@@ -45,3 +57,277 @@ func TestManagerAddAndRemoveRecorder(t *testing.T) {
 	assert.Equal(t, ErrRecorderNotExist, err)
 	assert.False(t, m.HasRecorder(context.Background(), "test"))
 }
+
+func TestManagerHandoverRecorder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := new(configs.Config)
+	cfg.VideoSplitStrategies.Handover = true
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: cfg,
+	})
+	m := NewManager(ctx)
+	backup := newRecorder
+	defer func() { newRecorder = backup }()
+
+	old := NewMockRecorder(ctrl)
+	next := NewMockRecorder(ctrl)
+	recorders := []Recorder{old, next}
+	newRecorder = func(ctx context.Context, live live.Live, session *Session) (Recorder, error) {
+		r := recorders[0]
+		recorders = recorders[1:]
+		return r, nil
+	}
+	handedOver := make(chan struct{})
+	old.EXPECT().Start(gomock.Any()).Return(nil)
+	old.EXPECT().Handover(next, handoverTimeout).Do(func(Recorder, time.Duration) { close(handedOver) })
+	next.EXPECT().Start(gomock.Any()).Return(nil)
+	next.EXPECT().Close()
+
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+	assert.NoError(t, m.AddRecorder(context.Background(), l))
+	assert.NoError(t, m.RestartRecorder(context.Background(), l))
+	select {
+	case <-handedOver:
+	case <-time.After(time.Second):
+		t.Fatal("old recorder was not handed over")
+	}
+	r, err := m.GetRecorder(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, next, r)
+	assert.NoError(t, m.RemoveRecorder(context.Background(), "test"))
+}
+
+func TestManagerControlRecording(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ed := evtmock.NewMockDispatcher(ctrl)
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config:          new(configs.Config),
+		EventDispatcher: ed,
+	})
+	m := NewManager(ctx)
+	backup := newRecorder
+	defer func() { newRecorder = backup }()
+	r := NewMockRecorder(ctrl)
+	newRecorder = func(ctx context.Context, live live.Live, session *Session) (Recorder, error) {
+		return r, nil
+	}
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+
+	r.EXPECT().Start(gomock.Any()).Return(nil)
+	r.EXPECT().Split().Return(nil)
+	r.EXPECT().Pause().Return(nil)
+	r.EXPECT().Resume().Return(nil)
+	r.EXPECT().Close()
+	ed.EXPECT().DispatchEvent(gomock.Any()).Times(3)
+
+	assert.NoError(t, m.AddRecorder(ctx, l))
+	assert.NoError(t, m.SplitRecorder(ctx, l))
+	assert.NoError(t, m.PauseRecorder(ctx, l))
+	assert.NoError(t, m.ResumeRecorder(ctx, l))
+
+	assert.NoError(t, m.StopRecording(ctx, "test"))
+	assert.False(t, m.HasRecorder(ctx, "test"))
+	assert.True(t, m.IsSuppressed(ctx, "test"))
+	assert.Equal(t, ErrRecordingSuppressed, m.AddRecorder(ctx, l))
+	assert.Equal(t, ErrRecorderNotExist, m.StopRecording(ctx, "test"))
+	assert.Equal(t, ErrRecorderNotExist, m.PauseRecorder(ctx, l))
+}
+
+func TestManagerLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := configs.NewConfig()
+	cfg.AppDataPath = ""
+	cfg.Limits.MaxConcurrentRecordings = 1
+	cfg.LiveRooms = []configs.LiveRoom{
+		{Url: "https://live.bilibili.com/a"},
+		{Url: "https://live.bilibili.com/b"},
+		{Url: "https://live.bilibili.com/c", Priority: 1},
+	}
+	lives := make(map[types.LiveID]live.Live)
+	for _, id := range []types.LiveID{"a", "b", "c"} {
+		l := livemock.NewMockLive(ctrl)
+		l.EXPECT().GetLiveId().Return(id).AnyTimes()
+		l.EXPECT().GetRawUrl().Return("https://live.bilibili.com/" + string(id)).AnyTimes()
+		l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+		lives[id] = l
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: cfg,
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+		Lives:  lives,
+	})
+	m := NewManager(ctx)
+	backup := newRecorder
+	defer func() { newRecorder = backup }()
+	var started []types.LiveID
+	newRecorder = func(ctx context.Context, live live.Live, session *Session) (Recorder, error) {
+		started = append(started, live.GetLiveId())
+		r := NewMockRecorder(ctrl)
+		r.EXPECT().Start(gomock.Any()).Return(nil)
+		r.EXPECT().Close()
+		return r, nil
+	}
+
+	assert.NoError(t, m.AddRecorder(ctx, lives["a"]))
+	assert.Equal(t, ErrRecordingQueued, m.AddRecorder(ctx, lives["b"]))
+	assert.True(t, m.IsWaiting(ctx, "b"))
+	// 优先级更高的直播间停止优先级最低的录制
+	assert.NoError(t, m.AddRecorder(ctx, lives["c"]))
+	assert.False(t, m.HasRecorder(ctx, "a"))
+	assert.True(t, m.IsWaiting(ctx, "a"))
+
+	// 录制结束后按优先级开始等待中的录制
+	assert.NoError(t, m.RemoveRecorder(ctx, "c"))
+	assert.True(t, m.HasRecorder(ctx, "a"))
+	assert.True(t, m.IsWaiting(ctx, "b"))
+	assert.Equal(t, []types.LiveID{"a", "c", "a"}, started)
+
+	assert.NoError(t, m.RemoveRecorder(ctx, "a"))
+	assert.NoError(t, m.RemoveRecorder(ctx, "b"))
+	assert.False(t, m.IsWaiting(ctx, "b"))
+}
+
+// fakeJobManager 记录提交的任务类型
+type fakeJobManager struct {
+	jobs.Manager
+	lock      sync.Mutex
+	submitted []string
+}
+
+func (m *fakeJobManager) Submit(ctx context.Context, jobType string, payload any) (*jobs.Job, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.submitted = append(m.submitted, jobType)
+	return &jobs.Job{Type: jobType}, nil
+}
+
+func (m *fakeJobManager) SubmitAfter(ctx context.Context, jobType string, payload any, after []string) (*jobs.Job, error) {
+	return m.Submit(ctx, jobType, payload)
+}
+
+func (m *fakeJobManager) GetJobs(ctx context.Context) []*jobs.Job {
+	return nil
+}
+
+func (m *fakeJobManager) Submitted() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]string(nil), m.submitted...)
+}
+
+// fakeGuard 在 reject 为 true 时拒绝录制
+type fakeGuard struct {
+	reject bool
+}
+
+func (fakeGuard) Start(ctx context.Context) error { return nil }
+func (fakeGuard) Close(ctx context.Context)       {}
+
+func (g *fakeGuard) AllowRecording(l live.Live) error {
+	if g.reject {
+		return errInsufficientStorage
+	}
+	return nil
+}
+
+var errInsufficientStorage = errors.New("insufficient storage space")
+
+func TestManagerRestartRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := new(configs.Config)
+	cfg.Highlight.Enable = true
+	cfg.Danmaku.Enable = true
+	guard := new(fakeGuard)
+	jm := new(fakeJobManager)
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config:         cfg,
+		Logger:         &interfaces.Logger{Logger: logrus.New()},
+		StorageMonitor: guard,
+		JobManager:     jm,
+	})
+	m := NewManager(ctx).(*manager)
+	backup := newRecorder
+	defer func() { newRecorder = backup }()
+	newRecorder = func(ctx context.Context, live live.Live, session *Session) (Recorder, error) {
+		r := NewMockRecorder(ctrl)
+		r.EXPECT().Start(gomock.Any()).Return(nil)
+		r.EXPECT().Close()
+		return r, nil
+	}
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+
+	assert.NoError(t, m.AddRecorder(ctx, l))
+	s := m.sessions["test"]
+	// 重启时被拒绝，场次结束并执行场次结束后的处理
+	guard.reject = true
+	assert.Equal(t, errInsufficientStorage, m.RestartRecorder(ctx, l))
+	assert.False(t, m.HasRecorder(ctx, "test"))
+	assert.Empty(t, m.sessions)
+	assert.False(t, s.Active())
+	assert.Equal(t, []string{HighlightJob}, jm.Submitted())
+
+	// 下次开始录制时使用新的场次
+	guard.reject = false
+	assert.NoError(t, m.AddRecorder(ctx, l))
+	assert.NotEqual(t, s, m.sessions["test"])
+	assert.NoError(t, m.RemoveRecorder(ctx, "test"))
+}
+
+func TestManagerLiveEndDuringHandover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backupRecorder, backupTimeout := newRecorder, handoverTimeout
+	defer func() { newRecorder, handoverTimeout = backupRecorder, backupTimeout }()
+	handoverTimeout = time.Minute
+
+	cfg := new(configs.Config)
+	cfg.Highlight.Enable = true
+	cfg.Danmaku.Enable = true
+	cfg.VideoSplitStrategies.Handover = true
+	jm := new(fakeJobManager)
+	inst := &instance.Instance{
+		Config:     cfg,
+		Logger:     &interfaces.Logger{Logger: logrus.New()},
+		Cache:      gcache.New(4).LRU().Build(),
+		JobManager: jm,
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, inst)
+	ed := events.NewDispatcher(ctx)
+	m := NewManager(ctx).(*manager)
+	m.registryListener(ctx, ed)
+	var stopped atomic.Int32
+	ed.AddEventListener(RecorderStop, events.NewEventListener(func(*events.Event) { stopped.Add(1) }))
+	newRecorder = func(ctx context.Context, l live.Live, session *Session) (Recorder, error) {
+		// 暂停的录制器不连接直播流，直到被关闭
+		session.pause()
+		return NewRecorder(ctx, l, session)
+	}
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+
+	assert.NoError(t, m.AddRecorder(ctx, l))
+	assert.NoError(t, m.RestartRecorder(ctx, l))
+	// 新的录制器收到数据之前直播结束，两个录制器都结束后只提交一次场次结束后的处理
+	assert.NoError(t, m.RemoveRecorder(ctx, "test"))
+	assert.Eventually(t, func() bool { return stopped.Load() == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{HighlightJob}, jm.Submitted())
+}
@@ -70,6 +70,60 @@ func (mr *MockRecorderMockRecorder) GetStatus() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatus", reflect.TypeOf((*MockRecorder)(nil).GetStatus))
 }
 
+// Handover mocks base method.
+func (m *MockRecorder) Handover(next Recorder, timeout time.Duration) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Handover", next, timeout)
+}
+
+// Handover indicates an expected call of Handover.
+func (mr *MockRecorderMockRecorder) Handover(next, timeout any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Handover", reflect.TypeOf((*MockRecorder)(nil).Handover), next, timeout)
+}
+
+// Pause mocks base method.
+func (m *MockRecorder) Pause() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pause")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockRecorderMockRecorder) Pause() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockRecorder)(nil).Pause))
+}
+
+// Resume mocks base method.
+func (m *MockRecorder) Resume() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resume")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Resume indicates an expected call of Resume.
+func (mr *MockRecorderMockRecorder) Resume() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockRecorder)(nil).Resume))
+}
+
+// Split mocks base method.
+func (m *MockRecorder) Split() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Split")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Split indicates an expected call of Split.
+func (mr *MockRecorderMockRecorder) Split() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Split", reflect.TypeOf((*MockRecorder)(nil).Split))
+}
+
 // Start mocks base method.
 func (m *MockRecorder) Start(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -163,6 +217,36 @@ func (mr *MockManagerMockRecorder) GetRecorder(ctx, liveId any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecorder", reflect.TypeOf((*MockManager)(nil).GetRecorder), ctx, liveId)
 }
 
+// GetSession mocks base method.
+func (m *MockManager) GetSession(ctx context.Context, id string) (*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSession", ctx, id)
+	ret0, _ := ret[0].(*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSession indicates an expected call of GetSession.
+func (mr *MockManagerMockRecorder) GetSession(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSession", reflect.TypeOf((*MockManager)(nil).GetSession), ctx, id)
+}
+
+// GetSessions mocks base method.
+func (m *MockManager) GetSessions(ctx context.Context) ([]*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSessions", ctx)
+	ret0, _ := ret[0].([]*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSessions indicates an expected call of GetSessions.
+func (mr *MockManagerMockRecorder) GetSessions(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSessions", reflect.TypeOf((*MockManager)(nil).GetSessions), ctx)
+}
+
 // HasRecorder mocks base method.
 func (m *MockManager) HasRecorder(ctx context.Context, liveId types.LiveID) bool {
 	m.ctrl.T.Helper()
@@ -177,6 +261,76 @@ func (mr *MockManagerMockRecorder) HasRecorder(ctx, liveId any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasRecorder", reflect.TypeOf((*MockManager)(nil).HasRecorder), ctx, liveId)
 }
 
+// IsManualRecording mocks base method.
+func (m *MockManager) IsManualRecording(ctx context.Context, liveId types.LiveID) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsManualRecording", ctx, liveId)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsManualRecording indicates an expected call of IsManualRecording.
+func (mr *MockManagerMockRecorder) IsManualRecording(ctx, liveId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsManualRecording", reflect.TypeOf((*MockManager)(nil).IsManualRecording), ctx, liveId)
+}
+
+// IsPaused mocks base method.
+func (m *MockManager) IsPaused(ctx context.Context, liveId types.LiveID) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsPaused", ctx, liveId)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsPaused indicates an expected call of IsPaused.
+func (mr *MockManagerMockRecorder) IsPaused(ctx, liveId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsPaused", reflect.TypeOf((*MockManager)(nil).IsPaused), ctx, liveId)
+}
+
+// IsSuppressed mocks base method.
+func (m *MockManager) IsSuppressed(ctx context.Context, liveId types.LiveID) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsSuppressed", ctx, liveId)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsSuppressed indicates an expected call of IsSuppressed.
+func (mr *MockManagerMockRecorder) IsSuppressed(ctx, liveId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsSuppressed", reflect.TypeOf((*MockManager)(nil).IsSuppressed), ctx, liveId)
+}
+
+// IsWaiting mocks base method.
+func (m *MockManager) IsWaiting(ctx context.Context, liveId types.LiveID) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsWaiting", ctx, liveId)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsWaiting indicates an expected call of IsWaiting.
+func (mr *MockManagerMockRecorder) IsWaiting(ctx, liveId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsWaiting", reflect.TypeOf((*MockManager)(nil).IsWaiting), ctx, liveId)
+}
+
+// PauseRecorder mocks base method.
+func (m *MockManager) PauseRecorder(ctx context.Context, arg1 live.Live) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PauseRecorder", ctx, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PauseRecorder indicates an expected call of PauseRecorder.
+func (mr *MockManagerMockRecorder) PauseRecorder(ctx, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseRecorder", reflect.TypeOf((*MockManager)(nil).PauseRecorder), ctx, arg1)
+}
+
 // RemoveRecorder mocks base method.
 func (m *MockManager) RemoveRecorder(ctx context.Context, liveId types.LiveID) error {
 	m.ctrl.T.Helper()
@@ -205,6 +359,34 @@ func (mr *MockManagerMockRecorder) RestartRecorder(ctx, liveId any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestartRecorder", reflect.TypeOf((*MockManager)(nil).RestartRecorder), ctx, liveId)
 }
 
+// ResumeRecorder mocks base method.
+func (m *MockManager) ResumeRecorder(ctx context.Context, arg1 live.Live) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResumeRecorder", ctx, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResumeRecorder indicates an expected call of ResumeRecorder.
+func (mr *MockManagerMockRecorder) ResumeRecorder(ctx, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResumeRecorder", reflect.TypeOf((*MockManager)(nil).ResumeRecorder), ctx, arg1)
+}
+
+// SplitRecorder mocks base method.
+func (m *MockManager) SplitRecorder(ctx context.Context, arg1 live.Live) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SplitRecorder", ctx, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SplitRecorder indicates an expected call of SplitRecorder.
+func (mr *MockManagerMockRecorder) SplitRecorder(ctx, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SplitRecorder", reflect.TypeOf((*MockManager)(nil).SplitRecorder), ctx, arg1)
+}
+
 // Start mocks base method.
 func (m *MockManager) Start(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -218,3 +400,31 @@ func (mr *MockManagerMockRecorder) Start(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockManager)(nil).Start), ctx)
 }
+
+// StartRecording mocks base method.
+func (m *MockManager) StartRecording(ctx context.Context, arg1 live.Live) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartRecording", ctx, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StartRecording indicates an expected call of StartRecording.
+func (mr *MockManagerMockRecorder) StartRecording(ctx, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartRecording", reflect.TypeOf((*MockManager)(nil).StartRecording), ctx, arg1)
+}
+
+// StopRecording mocks base method.
+func (m *MockManager) StopRecording(ctx context.Context, liveId types.LiveID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StopRecording", ctx, liveId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StopRecording indicates an expected call of StopRecording.
+func (mr *MockManagerMockRecorder) StopRecording(ctx, liveId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopRecording", reflect.TypeOf((*MockManager)(nil).StopRecording), ctx, liveId)
+}
@@ -0,0 +1,392 @@
+package recorders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/jobs"
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/utils"
+	"github.com/bililive-go/bililive-go/src/postprocess"
+	"github.com/bililive-go/bililive-go/src/tools"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+// PostProcessJob 录制完成后修复、转换文件并执行自定义命令的任务
+const PostProcessJob = "post_process"
+
+type postProcessFile struct {
+	File    string `json:"file"`
+	NeedFix bool   `json:"need_fix"`
+}
+
+type postProcessPayload struct {
+	Files []postProcessFile `json:"files"`
+	// Scope 为 session 时在所有文件处理完成后对整个场次执行一次自定义命令
+	Scope        string           `json:"scope"`
+	LiveId       types.LiveID     `json:"live_id"`
+	LiveUrl      string           `json:"live_url"`
+	Platform     string           `json:"platform"`
+	HostName     string           `json:"host_name"`
+	RoomName     string           `json:"room_name"`
+	SessionId    string           `json:"session_id"`
+	SessionStart time.Time        `json:"session_start"`
+	SessionEnd   time.Time        `json:"session_end"`
+	ExitStatus   SegmentEndReason `json:"exit_status"`
+	// Checkpoint 流水线已经完成的步骤与当前的文件，重试时从失败的步骤继续
+	Checkpoint *postprocess.Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// PostProcessFiles 返回后处理任务要处理的文件，其他类型的任务返回 nil
+func PostProcessFiles(job *jobs.Job) []string {
+	if job.Type != PostProcessJob {
+		return nil
+	}
+	var payload postProcessPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil
+	}
+	files := make([]string, 0, len(payload.Files))
+	if payload.Checkpoint != nil {
+		for _, f := range payload.Checkpoint.Files {
+			files = append(files, f.Path)
+		}
+		return files
+	}
+	for _, f := range payload.Files {
+		files = append(files, f.File)
+	}
+	return files
+}
+
+// sessionPostProcessJobs 返回场次中还没有结束的后处理任务
+func sessionPostProcessJobs(list []*jobs.Job, sessionId string) []string {
+	var ids []string
+	for _, job := range list {
+		if job.Type != PostProcessJob || job.State == jobs.StateSucceeded ||
+			job.State == jobs.StateFailed || job.State == jobs.StateCanceled {
+			continue
+		}
+		var payload postProcessPayload
+		if err := json.Unmarshal(job.Payload, &payload); err == nil && payload.SessionId == sessionId {
+			ids = append(ids, job.Id)
+		}
+	}
+	return ids
+}
+
+// commandlineBySession 自定义命令是否在场次结束后统一执行，设置了流水线时总是按文件执行
+func commandlineBySession(cfg *configs.Config, liveUrl string) bool {
+	orf := cfg.GetRoomConfig(liveUrl).OnRecordFinished
+	return len(orf.Pipeline) == 0 &&
+		strings.TrimSpace(orf.CustomCommandline) != "" &&
+		orf.CustomCommandlineScope == configs.CommandlineScopeSession
+}
+
+// submitPostProcess 将后处理提交到任务队列，不阻塞录制器重新连接
+func (r *recorder) submitPostProcess(ctx context.Context, info *live.Info, files []string, needFix bool, reason SegmentEndReason) {
+	if commandlineBySession(r.config, r.Live.GetRawUrl()) {
+		// 场次结束后统一处理
+		if needFix && r.session != nil {
+			r.session.markNeedFix(files...)
+		}
+		return
+	}
+	payload := postProcessPayload{
+		Scope:    configs.CommandlineScopeFile,
+		LiveId:   r.Live.GetLiveId(),
+		LiveUrl:  r.Live.GetRawUrl(),
+		Platform: r.Live.GetPlatformCNName(),
+		HostName: info.HostName,
+		RoomName: info.RoomName,
+	}
+	if r.session != nil {
+		payload.SessionId = r.session.Id
+		payload.SessionStart = r.session.StartTime
+	}
+	for i, file := range files {
+		p := payload
+		p.Files = []postProcessFile{{File: file, NeedFix: needFix}}
+		p.ExitStatus = SegmentEndSplit
+		if i == len(files)-1 {
+			p.ExitStatus = reason
+		}
+		submitPostProcessJob(ctx, p)
+	}
+}
+
+// submitSessionPostProcess 在场次结束、最后一个文件写完后提交整个场次的后处理
+func submitSessionPostProcess(ctx context.Context, l live.Live, s *Session) {
+	snapshot := s.Snapshot()
+	if len(snapshot.Segments) == 0 {
+		return
+	}
+	payload := postProcessPayload{
+		Scope:        configs.CommandlineScopeSession,
+		LiveId:       snapshot.LiveId,
+		LiveUrl:      l.GetRawUrl(),
+		Platform:     snapshot.Platform,
+		HostName:     snapshot.HostName,
+		RoomName:     snapshot.RoomName,
+		SessionId:    snapshot.Id,
+		SessionStart: snapshot.StartTime,
+		SessionEnd:   snapshot.EndTime,
+		ExitStatus:   snapshot.Segments[len(snapshot.Segments)-1].EndReason,
+	}
+	for _, seg := range snapshot.Segments {
+		payload.Files = append(payload.Files, postProcessFile{
+			File:    seg.File,
+			NeedFix: s.needsFix(seg.File),
+		})
+	}
+	submitPostProcessJob(ctx, payload)
+}
+
+func submitPostProcessJob(ctx context.Context, payload postProcessPayload) {
+	logger := instance.GetInstance(ctx).Logger
+	jm, ok := instance.GetInstance(ctx).JobManager.(jobs.Manager)
+	if !ok {
+		logger.Warnf("job manager is not available, skip post processing of %s", payload.SessionId)
+		return
+	}
+	if job, err := jm.Submit(ctx, PostProcessJob, payload); err != nil {
+		logger.WithError(err).Errorf("failed to submit post processing job of %s", payload.SessionId)
+	} else {
+		logger.Debugf("post processing job %s submitted for %d files", job.Id, len(payload.Files))
+	}
+}
+
+// commandlineInfo 优先使用录制时的主播名与标题，直播间仍在监控时附带 Live 以便模板调用其方法
+func commandlineInfo(ctx context.Context, payload *postProcessPayload) *live.Info {
+	info := &live.Info{
+		HostName: payload.HostName,
+		RoomName: payload.RoomName,
+	}
+	inst := instance.GetInstance(ctx)
+	if l, ok := inst.Lives[payload.LiveId]; ok {
+		info.Live = l
+		if inst.Cache != nil {
+			if obj, err := inst.Cache.Get(l); err == nil {
+				if cached, ok := obj.(*live.Info); ok {
+					c := *cached
+					c.HostName, c.RoomName = info.HostName, info.RoomName
+					info = &c
+				}
+			}
+		}
+	}
+	return info
+}
+
+// postProcessReporter 将流水线的上传状态记录到场次中，进度保存到任务的 Payload 中
+type postProcessReporter struct {
+	*jobs.Task
+	ctx     context.Context
+	payload *postProcessPayload
+}
+
+func (r *postProcessReporter) SaveCheckpoint(cp *postprocess.Checkpoint) {
+	r.payload.Checkpoint = cp
+	if err := r.SetPayload(r.payload); err != nil {
+		r.Logf("failed to save checkpoint: %v", err)
+	}
+}
+
+// ReportOutputs 按文件执行时记录分段文件处理后的文件
+func (r *postProcessReporter) ReportOutputs(paths []string) {
+	if len(r.payload.Files) != 1 {
+		return
+	}
+	sources := make([]string, len(paths))
+	for i := range sources {
+		sources[i] = r.payload.Files[0].File
+	}
+	recordOutputs(r.ctx, r.payload.SessionId, sources, paths)
+}
+
+func (r *postProcessReporter) ReportUpload(status postprocess.UploadStatus) {
+	if m, ok := instance.GetInstance(r.ctx).RecorderManager.(*manager); ok && r.payload.SessionId != "" {
+		m.recordUpload(r.payload.SessionId, status)
+	}
+}
+
+// recordOutputs 按分段文件记录后处理后的文件，sources 与 outputs 一一对应，高能片段从这些文件导出
+func recordOutputs(ctx context.Context, sessionId string, sources, outputs []string) {
+	m, ok := instance.GetInstance(ctx).RecorderManager.(*manager)
+	if !ok || sessionId == "" {
+		return
+	}
+	var order []string
+	bySource := make(map[string][]string)
+	for i, source := range sources {
+		if _, ok := bySource[source]; !ok {
+			order = append(order, source)
+		}
+		bySource[source] = append(bySource[source], outputs[i])
+	}
+	for _, source := range order {
+		m.recordOutputs(sessionId, source, bySource[source])
+	}
+}
+
+func postProcess(ctx context.Context, task *jobs.Task) error {
+	var payload postProcessPayload
+	if err := task.Payload(&payload); err != nil {
+		return err
+	}
+	cfg := instance.GetInstance(ctx).Config
+	ffmpegPath, err := utils.GetFFmpegPath(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find ffmpeg: %w", err)
+	}
+	data := postprocess.CommandlineData{
+		Ffmpeg:       ffmpegPath,
+		Info:         commandlineInfo(ctx, &payload),
+		LiveId:       payload.LiveId,
+		Platform:     payload.Platform,
+		SessionId:    payload.SessionId,
+		SessionStart: payload.SessionStart,
+		SessionEnd:   payload.SessionEnd,
+		ExitStatus:   string(payload.ExitStatus),
+	}
+	rc := cfg.GetRoomConfig(payload.LiveUrl)
+	orf := rc.OnRecordFinished
+	if steps := orf.Pipeline; len(steps) > 0 {
+		files := make([]postprocess.File, 0, len(payload.Files))
+		for _, f := range payload.Files {
+			files = append(files, postprocess.File{Path: f.File, NeedFix: f.NeedFix})
+		}
+		pipeline := &postprocess.Pipeline{
+			Config:     cfg,
+			OutPutPath: rc.OutPutPath,
+			Steps:      steps,
+			Reporter:   &postProcessReporter{Task: task, ctx: ctx, payload: &payload},
+			Resume:     payload.Checkpoint,
+		}
+		if payload.Checkpoint != nil {
+			task.Logf("resume from the last checkpoint")
+		}
+		return pipeline.Run(ctx, files, data)
+	}
+
+	var (
+		errs   []error
+		steps  = 0
+		done   = 0
+		cmdStr = strings.TrimSpace(orf.CustomCommandline)
+	)
+	files := make([]postProcessFile, 0, len(payload.Files))
+	for _, f := range payload.Files {
+		if _, err := os.Stat(f.File); err != nil {
+			task.Logf("skip %s: %v", f.File, err)
+			continue
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return errors.New("no file to process")
+	}
+	for _, f := range files {
+		if f.NeedFix && orf.FixFlvAtFirst {
+			steps++
+		}
+	}
+	for _, enabled := range []bool{orf.ConvertToMp4, cmdStr != ""} {
+		if enabled {
+			steps++
+		}
+	}
+	stepDone := func() {
+		done++
+		task.SetProgress(float64(done) / float64(steps))
+	}
+
+	outputFiles := make([]string, 0, len(files))
+	// 与 outputFiles 对应的分段文件
+	sources := make([]string, 0, len(files))
+	for _, f := range files {
+		if !f.NeedFix || !orf.FixFlvAtFirst {
+			outputFiles = append(outputFiles, f.File)
+			sources = append(sources, f.File)
+			continue
+		}
+		task.Logf("fix flv file %s", f.File)
+		fixed, err := tools.FixFlvByBililiveRecorder(ctx, f.File)
+		if err != nil {
+			task.Logf("failed to fix flv file, skip this step: %v", err)
+		}
+		outputFiles = append(outputFiles, fixed...)
+		for range fixed {
+			sources = append(sources, f.File)
+		}
+		stepDone()
+	}
+	finalFiles := append([]string(nil), outputFiles...)
+	defer func() { recordOutputs(ctx, payload.SessionId, sources, finalFiles) }()
+	if orf.ConvertToMp4 {
+		for i, outputFile := range outputFiles {
+			//格式转换时去除原本后缀名
+			newFileName := outputFile[0:strings.LastIndex(outputFile, ".")]
+			task.Logf("convert %s to mp4", outputFile)
+			convertCmd := exec.CommandContext(ctx,
+				ffmpegPath,
+				"-y",
+				"-i",
+				outputFile,
+				"-c",
+				"copy",
+				newFileName+".mp4",
+			)
+			convertCmd.Stderr = task.LogWriter()
+
+			if err = convertCmd.Run(); err != nil {
+				errs = append(errs, fmt.Errorf("转换失败: %w", err))
+				continue
+			}
+			finalFiles[i] = newFileName + ".mp4"
+			if orf.DeleteFlvAfterConvert {
+				os.Remove(outputFile)
+			}
+		}
+		stepDone()
+	}
+
+	if cmdStr != "" {
+		data.Files = outputFiles
+		// 按文件执行时，修复步骤切分出的每个文件各执行一次
+		targets := outputFiles
+		if payload.Scope == configs.CommandlineScopeSession {
+			targets = outputFiles[:1]
+		}
+		for _, target := range targets {
+			data.FileName = target
+			rendered, err := postprocess.Render(cfg, "custom_commandline", cmdStr, &data)
+			if err != nil {
+				task.Logf("failed to render custom_commandline: %v", err)
+				return err
+			}
+			if err := postprocess.RunCommand(ctx, rendered, data.Env(), task.LogWriter()); err != nil {
+				errs = append(errs, err)
+			} else if orf.DeleteFlvAfterConvert {
+				// 只删除交给命令处理、且命令成功结束的文件
+				deleteFiles := []string{target}
+				if payload.Scope == configs.CommandlineScopeSession {
+					deleteFiles = outputFiles
+				}
+				for _, file := range deleteFiles {
+					os.Remove(file)
+				}
+			}
+		}
+		stepDone()
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,212 @@
+package recorders
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/jobs"
+	livemock "github.com/bililive-go/bililive-go/src/live/mock"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+func runPostProcess(t *testing.T, cfg *configs.Config, payload postProcessPayload) *jobs.Job {
+	ffmpeg, err := os.Executable()
+	assert.NoError(t, err)
+	cfg.FfmpegPath = ffmpeg
+	cfg.AppDataPath = t.TempDir()
+	if cfg.Jobs.MaxAttempts == 0 {
+		cfg.Jobs = configs.Jobs{Workers: 1, MaxAttempts: 1}
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+		Config: cfg,
+	})
+	jm := jobs.NewManager(ctx)
+	jm.Register(PostProcessJob, postProcess)
+	assert.NoError(t, jm.Start(ctx))
+	defer jm.Close(ctx)
+
+	job, err := jm.Submit(ctx, PostProcessJob, payload)
+	assert.NoError(t, err)
+	return waitJob(t, ctx, jm, job.Id)
+}
+
+func waitJob(t *testing.T, ctx context.Context, jm jobs.Manager, id string) *jobs.Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, _ := jm.GetJob(ctx, id); job.State == jobs.StateSucceeded || job.State == jobs.StateFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestPostProcessCommandline(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("custom commandline test requires bash")
+	}
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.flv")
+	b := filepath.Join(dir, "b.flv")
+	out := filepath.Join(dir, "out.txt")
+	writeFiles := func() {
+		assert.NoError(t, os.WriteFile(a, []byte("a"), 0644))
+		assert.NoError(t, os.WriteFile(b, []byte("b"), 0644))
+	}
+	read := func() string {
+		b, _ := os.ReadFile(out)
+		os.Remove(out)
+		return string(b)
+	}
+	cfg := &configs.Config{
+		OnRecordFinished: configs.OnRecordFinished{
+			CustomCommandline:      `echo "{{ .FileName | base }} {{ len .Files }} {{ .Info.HostName }} $BILILIVE_SESSION_ID $BILILIVE_EXIT_STATUS" >> ` + out,
+			CustomCommandlineScope: configs.CommandlineScopeFile,
+		},
+	}
+	payload := postProcessPayload{
+		Files:      []postProcessFile{{File: a}},
+		Scope:      configs.CommandlineScopeFile,
+		HostName:   "host",
+		SessionId:  "s1",
+		ExitStatus: SegmentEndReconnect,
+	}
+
+	writeFiles()
+	job := runPostProcess(t, cfg, payload)
+	assert.Equal(t, jobs.StateSucceeded, job.State, job.Error)
+	assert.Equal(t, "a.flv 1 host s1 reconnect\n", read())
+	assert.FileExists(t, a)
+
+	// 按场次执行时只执行一次，成功后删除全部文件
+	cfg.OnRecordFinished.CustomCommandlineScope = configs.CommandlineScopeSession
+	cfg.OnRecordFinished.DeleteFlvAfterConvert = true
+	payload.Scope = configs.CommandlineScopeSession
+	payload.Files = []postProcessFile{{File: a}, {File: b}, {File: filepath.Join(dir, "deleted.flv")}}
+	payload.ExitStatus = SegmentEndStop
+	job = runPostProcess(t, cfg, payload)
+	assert.Equal(t, jobs.StateSucceeded, job.State, job.Error)
+	assert.Equal(t, "a.flv 2 host s1 stop\n", read())
+	assert.NoFileExists(t, a)
+	assert.NoFileExists(t, b)
+
+	// 命令失败时不删除文件
+	writeFiles()
+	cfg.OnRecordFinished.CustomCommandline = "exit 1"
+	job = runPostProcess(t, cfg, payload)
+	assert.Equal(t, jobs.StateFailed, job.State)
+	assert.FileExists(t, a)
+	assert.FileExists(t, b)
+}
+
+func TestPostProcessPipeline(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.flv")
+	assert.NoError(t, os.WriteFile(a, []byte("a"), 0644))
+	cfg := &configs.Config{
+		OnRecordFinished: configs.OnRecordFinished{
+			CustomCommandline: "exit 1",
+			Pipeline:          []configs.PostProcessStep{{Type: configs.StepChecksum}},
+		},
+	}
+	// 设置了流水线时不再执行旧的自定义命令
+	job := runPostProcess(t, cfg, postProcessPayload{Files: []postProcessFile{{File: a}}})
+	assert.Equal(t, jobs.StateSucceeded, job.State, job.Error)
+	assert.FileExists(t, a+".sha256")
+}
+
+func TestPostProcessPipelineRetry(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("command step requires bash")
+	}
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.flv")
+	marker := filepath.Join(dir, "marker")
+	out := filepath.Join(dir, "out.txt")
+	assert.NoError(t, os.WriteFile(a, []byte("a"), 0644))
+	cfg := &configs.Config{
+		Jobs: configs.Jobs{Workers: 1, MaxAttempts: 2},
+		OnRecordFinished: configs.OnRecordFinished{
+			Pipeline: []configs.PostProcessStep{
+				{Type: configs.StepMove, Dir: filepath.Join(dir, "done")},
+				{Type: configs.StepCommand, Command: `echo "$BILILIVE_FILE_NAME" >> ` + out},
+				// 第一次执行时失败
+				{Type: configs.StepCommand, Command: "test -f " + marker + " || { touch " + marker + "; exit 1; }"},
+			},
+		},
+	}
+	// 重试时从失败的步骤继续，已经移动的文件不会找不到，之前的命令也不会再次执行
+	job := runPostProcess(t, cfg, postProcessPayload{Files: []postProcessFile{{File: a}}})
+	assert.Equal(t, jobs.StateSucceeded, job.State, job.Error)
+	assert.Equal(t, 2, job.Attempts)
+	b, _ := os.ReadFile(out)
+	assert.Equal(t, filepath.Join(dir, "done", "a.flv")+"\n", string(b))
+	assert.Equal(t, []string{filepath.Join(dir, "done", "a.flv")}, PostProcessFiles(job))
+}
+
+func TestHighlightAfterPostProcess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.flv")
+	assert.NoError(t, os.WriteFile(a, []byte("a"), 0644))
+	ffmpeg, err := os.Executable()
+	assert.NoError(t, err)
+	cfg := &configs.Config{
+		AppDataPath: t.TempDir(),
+		FfmpegPath:  ffmpeg,
+		Jobs:        configs.Jobs{Workers: 2, MaxAttempts: 1},
+		OnRecordFinished: configs.OnRecordFinished{
+			Pipeline: []configs.PostProcessStep{{Type: configs.StepMove, Dir: filepath.Join(dir, "done")}},
+		},
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+		Config: cfg,
+	})
+	m := NewManager(ctx).(*manager)
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+	s := newSession(l, nil, m.store)
+	s.finishSegment(s.startSegment(a, ""), []string{a}, nil, SegmentEndStop)
+	s.end()
+
+	jm := jobs.NewManager(ctx)
+	jm.Register(PostProcessJob, postProcess)
+	jm.Register(HighlightJob, detectHighlights)
+	pp, err := jm.Submit(ctx, PostProcessJob, postProcessPayload{SessionId: s.Id, Files: []postProcessFile{{File: a}}})
+	assert.NoError(t, err)
+	// 高能片段检测在场次的后处理结束后执行
+	hl, err := SubmitHighlight(ctx, s.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{pp.Id}, hl.DependsOn)
+	assert.NoError(t, jm.Start(ctx))
+	defer jm.Close(ctx)
+
+	hl = waitJob(t, ctx, jm, hl.Id)
+	assert.Equal(t, jobs.StateSucceeded, hl.State, hl.Error)
+	pp, _ = jm.GetJob(ctx, pp.Id)
+	assert.True(t, pp.FinishedAt.Before(hl.StartedAt))
+
+	// 后处理输出的文件记录在分段中，高能片段从移动后的文件导出
+	saved, err := m.GetSession(ctx, s.Id)
+	assert.NoError(t, err)
+	moved := filepath.Join(dir, "done", "a.flv")
+	assert.Equal(t, []string{moved}, saved.Segments[0].Outputs)
+	assert.Equal(t, moved, segmentVideo(saved.Segments[0]))
+}
@@ -0,0 +1,168 @@
+package recorders
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/live"
+)
+
+// StreamVariant 清晰度、编码、封装格式都相同的一组线路，组内只有 CDN 节点不同
+type StreamVariant struct {
+	Name       string `json:"name"`
+	Codec      string `json:"codec"`
+	Container  string `json:"container"`
+	Resolution int    `json:"resolution"`
+	Bitrate    int    `json:"bitrate"`
+	AudioOnly  bool   `json:"audio_only"`
+	// Hosts 组内各线路的 CDN 节点
+	Hosts []string `json:"hosts"`
+	// Selected 按线路选择策略将被录制的变体
+	Selected bool `json:"selected"`
+
+	infos []*live.StreamUrlInfo
+}
+
+type variantKey struct {
+	name, codec, container string
+	resolution, bitrate    int
+	audioOnly              bool
+}
+
+// groupVariants 按清晰度、编码与封装格式分组，保持插件返回的顺序
+func groupVariants(infos []*live.StreamUrlInfo) []*StreamVariant {
+	var (
+		variants = make([]*StreamVariant, 0)
+		index    = make(map[variantKey]*StreamVariant)
+	)
+	for _, info := range infos {
+		key := variantKey{info.Name, info.Codec, info.GetContainer(), info.Resolution, info.Vbitrate, info.AudioOnly}
+		v, ok := index[key]
+		if !ok {
+			v = &StreamVariant{
+				Name:       key.name,
+				Codec:      key.codec,
+				Container:  key.container,
+				Resolution: key.resolution,
+				Bitrate:    key.bitrate,
+				AudioOnly:  key.audioOnly,
+				Hosts:      make([]string, 0),
+			}
+			index[key] = v
+			variants = append(variants, v)
+		}
+		v.Hosts = append(v.Hosts, info.Url.Host)
+		v.infos = append(v.infos, info)
+	}
+	return variants
+}
+
+// resolution 未知的分辨率通常是原画，视为最高
+func (v *StreamVariant) resolution() int {
+	if v.Resolution == 0 {
+		return math.MaxInt
+	}
+	return v.Resolution
+}
+
+// bitrate 未知的码率通常是原画，视为最高
+func (v *StreamVariant) bitrate() int {
+	if v.Bitrate == 0 {
+		return math.MaxInt
+	}
+	return v.Bitrate
+}
+
+// selectVariants 按线路选择策略对变体排序，第一个为将被录制的变体，其余作为备选依次尝试
+//
+// 依次比较：是否符合 audio_only、是否不超过 max_resolution（都超过时分辨率低的优先）、
+// 码率是否不低于 min_bitrate、是否为优先的编码、是否为优先的封装格式、分辨率与码率高的优先；
+// 都相同时保持插件返回的顺序
+func selectVariants(infos []*live.StreamUrlInfo, policy configs.QualityPolicy) []*StreamVariant {
+	variants := groupVariants(infos)
+	fits := func(v *StreamVariant) bool {
+		return policy.MaxResolution == 0 || v.resolution() <= policy.MaxResolution
+	}
+	type rule func(a, b *StreamVariant) (less, decided bool)
+	prefer := func(match func(v *StreamVariant) bool) rule {
+		return func(a, b *StreamVariant) (bool, bool) {
+			ma, mb := match(a), match(b)
+			return ma, ma != mb
+		}
+	}
+	rules := []rule{
+		prefer(func(v *StreamVariant) bool { return v.AudioOnly == policy.AudioOnly }),
+		prefer(fits),
+		func(a, b *StreamVariant) (bool, bool) {
+			// 都超过最大分辨率时选择最接近的
+			if !fits(a) && !fits(b) && a.resolution() != b.resolution() {
+				return a.resolution() < b.resolution(), true
+			}
+			return false, false
+		},
+		prefer(func(v *StreamVariant) bool { return v.Bitrate == 0 || v.Bitrate >= policy.MinBitrate }),
+		prefer(func(v *StreamVariant) bool { return policy.Codec == "" || v.Codec == policy.Codec }),
+		prefer(func(v *StreamVariant) bool { return policy.Container == "" || v.Container == policy.Container }),
+		func(a, b *StreamVariant) (bool, bool) {
+			return a.resolution() > b.resolution(), a.resolution() != b.resolution()
+		},
+		func(a, b *StreamVariant) (bool, bool) {
+			return a.bitrate() > b.bitrate(), a.bitrate() != b.bitrate()
+		},
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		for _, r := range rules {
+			if less, decided := r(variants[i], variants[j]); decided {
+				return less
+			}
+		}
+		return false
+	})
+	if len(variants) > 0 {
+		variants[0].Selected = true
+	}
+	return variants
+}
+
+// needAllQualities 线路选择策略限制了分辨率或码率，或者需要降低码率适应带宽上限时才请求其它清晰度
+func (r *recorder) needAllQualities(ctx context.Context, policy configs.QualityPolicy) bool {
+	if policy.MaxResolution > 0 || policy.MinBitrate > 0 {
+		return true
+	}
+	_, over := r.overBudget(ctx)
+	return over
+}
+
+// StreamVariants 是直播间当前可录制的全部变体
+type StreamVariants struct {
+	// PolicySupported 插件是否报告了多个画质或画质信息，为 false 时线路选择策略对该直播间不起作用
+	PolicySupported bool             `json:"policy_supported"`
+	Variants        []*StreamVariant `json:"variants"`
+}
+
+// policySupported 只有一个没有分辨率与码率的变体时无从选择，抖音等平台只返回一条这样的线路
+func policySupported(variants []*StreamVariant) bool {
+	if len(variants) > 1 {
+		return true
+	}
+	for _, v := range variants {
+		if v.Resolution > 0 || v.Bitrate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStreamVariants 获取直播间当前可录制的全部变体，按直播间生效的线路选择策略排序
+func GetStreamVariants(ctx context.Context, l live.Live) (*StreamVariants, error) {
+	infos, err := getStreamInfos(l, true)
+	if err != nil {
+		return nil, err
+	}
+	cfg := instance.GetInstance(ctx).Config
+	variants := selectVariants(infos, cfg.GetRoomConfig(l.GetRawUrl()).QualityPolicy)
+	return &StreamVariants{PolicySupported: policySupported(variants), Variants: variants}, nil
+}
@@ -0,0 +1,66 @@
+package recorders
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/live"
+)
+
+func newTestVariant(t *testing.T, rawUrl, codec string, resolution, bitrate int) *live.StreamUrlInfo {
+	info := newTestStreamInfo(t, rawUrl)
+	info.Codec, info.Resolution, info.Vbitrate = codec, resolution, bitrate
+	return info
+}
+
+func TestSelectVariants(t *testing.T) {
+	infos := []*live.StreamUrlInfo{
+		newTestVariant(t, "https://a.example.com/1080.flv", live.CodecAVC, 1080, 8000),
+		newTestVariant(t, "https://b.example.com/1080.flv", live.CodecAVC, 1080, 8000),
+		newTestVariant(t, "https://a.example.com/1080.m3u8", live.CodecHEVC, 1080, 8000),
+		newTestVariant(t, "https://a.example.com/720.flv", live.CodecAVC, 720, 2000),
+		newTestVariant(t, "https://a.example.com/2160.flv", live.CodecAVC, 2160, 0),
+	}
+
+	variants := selectVariants(infos, configs.QualityPolicy{})
+	assert.Len(t, variants, 4)
+	assert.True(t, variants[0].Selected)
+	assert.Equal(t, 2160, variants[0].Resolution)
+	assert.False(t, variants[1].Selected)
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, variants[1].Hosts)
+
+	variants = selectVariants(infos, configs.QualityPolicy{MaxResolution: 1080, Codec: live.CodecHEVC})
+	assert.Equal(t, live.CodecHEVC, variants[0].Codec)
+	assert.Equal(t, live.ContainerHLS, variants[0].Container)
+	assert.Equal(t, 2160, variants[len(variants)-1].Resolution)
+
+	variants = selectVariants(infos, configs.QualityPolicy{MaxResolution: 1080, Container: live.ContainerFLV})
+	assert.Equal(t, live.ContainerFLV, variants[0].Container)
+	assert.Equal(t, 1080, variants[0].Resolution)
+
+	// 没有满足条件的变体时选择最接近的
+	variants = selectVariants(infos, configs.QualityPolicy{MaxResolution: 480})
+	assert.Equal(t, 720, variants[0].Resolution)
+	variants = selectVariants(infos, configs.QualityPolicy{MaxResolution: 720, MinBitrate: 4000})
+	assert.Equal(t, 720, variants[0].Resolution)
+}
+
+func TestDowngradeVariants(t *testing.T) {
+	infos := []*live.StreamUrlInfo{
+		newTestVariant(t, "https://a.example.com/2160.flv", live.CodecAVC, 2160, 0),
+		newTestVariant(t, "https://a.example.com/1080.flv", live.CodecAVC, 1080, 8000),
+		newTestVariant(t, "https://a.example.com/720.flv", live.CodecAVC, 720, 2000),
+	}
+	variants := selectVariants(infos, configs.QualityPolicy{})
+
+	// 码率未知的原画不能确定是否超出剩余带宽
+	res := downgradeVariants(variants, 8000*1000/8)
+	assert.Equal(t, []int{1080, 720, 2160}, []int{res[0].Resolution, res[1].Resolution, res[2].Resolution})
+	res = downgradeVariants(variants, 4000*1000/8)
+	assert.Equal(t, []int{720, 2160, 1080}, []int{res[0].Resolution, res[1].Resolution, res[2].Resolution})
+	// 都超出剩余带宽时选择码率最低的
+	res = downgradeVariants(variants, 0)
+	assert.Equal(t, []int{720, 1080, 2160}, []int{res[0].Resolution, res[1].Resolution, res[2].Resolution})
+}
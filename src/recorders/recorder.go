@@ -4,12 +4,12 @@ package recorders
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,9 +27,10 @@ import (
 	"github.com/bililive-go/bililive-go/src/pkg/events"
 	"github.com/bililive-go/bililive-go/src/pkg/parser"
 	"github.com/bililive-go/bililive-go/src/pkg/parser/ffmpeg"
+	"github.com/bililive-go/bililive-go/src/pkg/parser/hls"
 	"github.com/bililive-go/bililive-go/src/pkg/parser/native/flv"
+	"github.com/bililive-go/bililive-go/src/pkg/restream"
 	"github.com/bililive-go/bililive-go/src/pkg/utils"
-	"github.com/bililive-go/bililive-go/src/tools"
 )
 
 const (
@@ -41,10 +42,13 @@ const (
 
 // for test
 var (
-	newParser = func(u *url.URL, useNativeFlvParser bool, cfg map[string]string) (parser.Parser, error) {
+	newParser = func(u *url.URL, feature configs.Feature, cfg map[string]string) (parser.Parser, error) {
 		parserName := ffmpeg.Name
-		if strings.Contains(u.Path, ".flv") && useNativeFlvParser {
+		switch {
+		case strings.Contains(u.Path, ".flv") && feature.UseNativeFlvParser:
 			parserName = flv.Name
+		case strings.Contains(u.Path, "m3u8") && feature.UseNativeHlsParser:
+			parserName = hls.Name
 		}
 		return parser.New(parserName, cfg)
 	}
@@ -58,6 +62,8 @@ var (
 			os.Remove(file)
 		}
 	}
+
+	handoverPollInterval = 200 * time.Millisecond
 )
 
 func getDefaultFileNameTmpl(config *configs.Config) *template.Template {
@@ -69,6 +75,14 @@ type Recorder interface {
 	Start(ctx context.Context) error
 	StartTime() time.Time
 	GetStatus() (map[string]string, error)
+	// Split 在不断开连接的情况下切换到新文件，解析器不支持时返回 ErrParserNotSupportSplit
+	Split() error
+	// Handover 等待 next 开始写入数据后关闭当前录制器，超过 timeout 时直接关闭
+	Handover(next Recorder, timeout time.Duration)
+	// Pause 结束当前文件并暂停录制，暂停期间的直播流被丢弃，场次继续
+	Pause() error
+	// Resume 恢复暂停的录制，重新连接后写入新文件
+	Resume() error
 	Close()
 }
 
@@ -80,55 +94,138 @@ type recorder struct {
 	ed         events.Dispatcher
 	logger     *interfaces.Logger
 	cache      gcache.Cache
-	startTime  time.Time
 	parser     parser.Parser
 	parserLock *sync.RWMutex
+	// 当前正在写入的文件
+	file atomic.Value
+	// 开始写入当前文件的时间（UnixNano），切分时由其它 goroutine 更新
+	startTime atomic.Int64
+	session   *Session
 
 	stop  chan struct{}
 	state uint32
 }
 
-func NewRecorder(ctx context.Context, live live.Live) (Recorder, error) {
+func NewRecorder(ctx context.Context, live live.Live, session *Session) (Recorder, error) {
 	inst := instance.GetInstance(ctx)
-	return &recorder{
+	r := &recorder{
 		Live:       live,
-		OutPutPath: instance.GetInstance(ctx).Config.OutPutPath,
+		OutPutPath: inst.Config.GetRoomConfig(live.GetRawUrl()).OutPutPath,
 		config:     inst.Config,
 		cache:      inst.Cache,
-		startTime:  time.Now(),
 		ed:         inst.EventDispatcher.(events.Dispatcher),
 		logger:     inst.Logger,
 		state:      begin,
 		stop:       make(chan struct{}),
 		parserLock: new(sync.RWMutex),
-	}, nil
+		session:    session,
+	}
+	r.startTime.Store(time.Now().UnixNano())
+	return r, nil
 }
 
-func (r *recorder) tryRecord(ctx context.Context) {
-	var streamInfos []*live.StreamUrlInfo
-	var err error
-	if streamInfos, err = r.Live.GetStreamInfos(); err == live.ErrNotImplemented {
+// recordingGuard 由 storage.Monitor 与 scheduler.Scheduler 实现，磁盘空间不足或不在录制时间段内时拒绝录制
+type recordingGuard interface {
+	AllowRecording(l live.Live) error
+}
+
+func allowRecording(ctx context.Context, l live.Live) error {
+	if inst := instance.GetInstance(ctx); inst != nil {
+		if g, ok := inst.StorageMonitor.(recordingGuard); ok {
+			return g.AllowRecording(l)
+		}
+	}
+	return nil
+}
+
+// allowSchedule 只在开始新的场次时检查，录制器重启与重连时继续录制，由 scheduler 按 on_window_close 停止
+func allowSchedule(ctx context.Context, l live.Live) error {
+	if inst := instance.GetInstance(ctx); inst != nil {
+		if g, ok := inst.Scheduler.(recordingGuard); ok {
+			return g.AllowRecording(l)
+		}
+	}
+	return nil
+}
+
+// getStreamInfos 获取直播间的线路，all 为 true 时额外请求其它清晰度，兼容只实现了 GetStreamUrls 的插件
+func getStreamInfos(l live.Live, all bool) ([]*live.StreamUrlInfo, error) {
+	if q, ok := live.GetQualityLister(l); ok && all {
+		return q.GetAllStreamInfos()
+	}
+	streamInfos, err := l.GetStreamInfos()
+	if err == live.ErrNotImplemented {
 		var urls []*url.URL
 		// TODO: remove deprecated method GetStreamUrls
 		//nolint:staticcheck
-		if urls, err = r.Live.GetStreamUrls(); err == live.ErrNotImplemented {
-			panic("GetStreamInfos and GetStreamUrls are not implemented for " + r.Live.GetPlatformCNName())
+		if urls, err = l.GetStreamUrls(); err == live.ErrNotImplemented {
+			panic("GetStreamInfos and GetStreamUrls are not implemented for " + l.GetPlatformCNName())
 		} else if err == nil {
 			streamInfos = utils.GenUrlInfos(urls, make(map[string]string))
 		}
 	}
+	return streamInfos, err
+}
+
+func (r *recorder) tryRecord(ctx context.Context) {
+	if err := allowRecording(ctx, r.Live); err != nil {
+		r.getLogger().WithError(err).Warn("skip recording, will retry after 5s...")
+		time.Sleep(5 * time.Second)
+		return
+	}
+	policy := r.config.GetRoomConfig(r.Live.GetRawUrl()).QualityPolicy
+	streamInfos, err := getStreamInfos(r.Live, r.needAllQualities(ctx, policy))
 	if err != nil || len(streamInfos) == 0 {
 		r.getLogger().WithError(err).Warn("failed to get stream url, will retry after 5s...")
 		time.Sleep(5 * time.Second)
 		return
 	}
 
+	for i, variant := range r.fitBandwidth(ctx, selectVariants(streamInfos, policy)) {
+		if i > 0 {
+			r.getLogger().Warnf("all hosts of preferred stream variant failed, fallback to variant[%s]", variant.Name)
+		}
+		r.getLogger().Debugf("try stream variant[%s]: codec %s, container %s, resolution %d, bitrate %d",
+			variant.Name, variant.Codec, variant.Container, variant.Resolution, variant.Bitrate)
+		if r.recordVariant(ctx, variant) || r.isStopped() {
+			return
+		}
+	}
+}
+
+// recordVariant 在同一变体的各个线路间依次尝试录制，录制正常结束或录制器停止时返回 true
+func (r *recorder) recordVariant(ctx context.Context, variant *StreamVariant) bool {
+	selector := newStreamSelector(r.Live.GetPlatformCNName(), r.config.StreamSelector, variant.infos)
+	for _, res := range selector.Rank(ctx) {
+		r.getLogger().Debugf("probe stream host[%s]: status %d, latency %v, throughput %s/s, err: %v",
+			res.Info.Url.Host, res.StatusCode, res.Latency, utils.FormatBytes(int64(res.Throughput)), res.Err)
+	}
+	for {
+		streamInfo, ok := selector.Next()
+		if !ok {
+			return false
+		}
+		recorded, err := r.recordStream(ctx, streamInfo)
+		if r.isStopped() || r.session.Paused() || err == nil {
+			return true
+		}
+		if !recorded {
+			// 没有录到任何数据，说明该线路不可用，冷却一段时间
+			selector.MarkBad(streamInfo)
+		}
+		r.getLogger().WithError(err).Warnf("stream host[%s] failed, try next one", streamInfo.Url.Host)
+	}
+}
+
+// recordStream 使用指定线路录制，返回是否录到了数据以及解析器的错误
+func (r *recorder) recordStream(ctx context.Context, streamInfo *live.StreamUrlInfo) (recorded bool, err error) {
 	obj, _ := r.cache.Get(r.Live)
 	info := obj.(*live.Info)
 
+	rc := r.config.GetRoomConfig(r.Live.GetRawUrl())
 	tmpl := getDefaultFileNameTmpl(r.config)
-	if r.config.OutputTmpl != "" {
-		_tmpl, errTmpl := template.New("user_filename").Funcs(utils.GetFuncMap(r.config)).Parse(r.config.OutputTmpl)
+	if rc.OutputTmpl != "" {
+		_tmpl, errTmpl := template.New("user_filename").Funcs(utils.GetFuncMap(r.config)).Parse(rc.OutputTmpl)
 		if errTmpl == nil {
 			tmpl = _tmpl
 		}
@@ -140,7 +237,6 @@ func (r *recorder) tryRecord(ctx context.Context) {
 	}
 	fileName := filepath.Join(r.OutPutPath, buf.String())
 	outputPath, _ := filepath.Split(fileName)
-	streamInfo := streamInfos[0]
 	url := streamInfo.Url
 
 	if strings.Contains(url.Path, "m3u8") {
@@ -156,103 +252,107 @@ func (r *recorder) tryRecord(ctx context.Context) {
 		return
 	}
 	parserCfg := map[string]string{
-		"timeout_in_us": strconv.Itoa(r.config.TimeoutInUs),
+		"timeout_in_us": strconv.Itoa(rc.TimeoutInUs),
 	}
 	if r.config.Debug {
 		parserCfg["debug"] = "true"
 	}
-	p, err := newParser(url, r.config.Feature.UseNativeFlvParser, parserCfg)
+	p, err := newParser(url, r.config.Feature, parserCfg)
 	if err != nil {
 		r.getLogger().WithError(err).Error("failed to init parse")
 		return
 	}
+	if tp, ok := p.(parser.TeeParser); ok && r.config.RestreamEnabled(r.Live.GetRawUrl()) {
+		if reg, ok := instance.GetInstance(ctx).Restream.(*restream.Registry); ok {
+			tp.SetTee(reg.Hub(r.Live.GetLiveId()).NewSource())
+		}
+	}
+	parseInfo, release := r.limitBandwidth(ctx, p, streamInfo)
+	defer release()
 	r.setAndCloseParser(p)
-	r.startTime = time.Now()
+	if r.session.Paused() {
+		return
+	}
+	r.file.Store(fileName)
+	r.startTime.Store(time.Now().UnixNano())
+	var seg *Segment
+	if r.session != nil {
+		seg = r.session.startSegment(fileName, url.String())
+	}
 	r.getLogger().Debugln("Start ParseLiveStream(" + url.String() + ", " + fileName + ")")
-	r.getLogger().Println(r.parser.ParseLiveStream(ctx, streamInfo, r.Live, fileName))
+	err = r.parser.ParseLiveStream(ctx, parseInfo, r.Live, fileName)
+	r.getLogger().Println(err)
 	r.getLogger().Debugln("End ParseLiveStream(" + url.String() + ", " + fileName + ")")
-	removeEmptyFile(fileName)
-	ffmpegPath, err := utils.GetFFmpegPath(ctx)
-	if err != nil {
-		r.getLogger().WithError(err).Error("failed to find ffmpeg")
-		return
+	outputFiles := []string{fileName}
+	if fp, ok := p.(parser.FilesParser); ok {
+		outputFiles = fp.OutputFiles()
 	}
-
-		outputFiles := []string{fileName}
-		if r.config.OnRecordFinished.FixFlvAtFirst {
-			outputFiles, err = tools.FixFlvByBililiveRecorder(ctx, fileName)
-			if err != nil {
-				r.getLogger().WithError(err).Error("failed to fix flv file, skip this step")
-			}
-		}
-		if r.config.OnRecordFinished.ConvertToMp4 {
-			for _, outputFile := range outputFiles {
-				//格式转换时去除原本后缀名
-				newFileName := outputFile[0:strings.LastIndex(outputFile, ".")]
-				convertCmd := exec.Command(
-					ffmpegPath,
-					//"-hide_banner",
-					"-i",
-					outputFile,
-					"-c",
-					"copy",
-					newFileName+".mp4",
-				)
-				var stderr bytes.Buffer
-				convertCmd.Stderr = &stderr
-				
-				if err = convertCmd.Run(); err != nil {
-					r.getLogger().Info("转换失败: %v | FFmpeg Log:\n%s", err, stderr.String())
-					convertCmd.Process.Kill()
-					r.getLogger().Debugln(err)
-				} else if r.config.OnRecordFinished.DeleteFlvAfterConvert {
-					os.Remove(outputFile)
-				}
-			}
+	var outputTimes []time.Time
+	if fp, ok := p.(parser.FileTimesParser); ok {
+		outputTimes = fp.OutputFileTimes()
+	}
+	recordedFiles := make([]string, 0, len(outputFiles))
+	for _, file := range outputFiles {
+		if stat, statErr := os.Stat(file); statErr == nil && stat.Size() > 0 {
+			recorded = true
+			recordedFiles = append(recordedFiles, file)
 		}
+		removeEmptyFile(file)
+	}
+	if r.session != nil {
+		r.session.finishSegment(seg, outputFiles, outputTimes, r.segmentEndReason(err))
+	}
+	if recorded {
+		// 原生 flv 解析器已经修复了时间戳并按编码参数切分了文件，无需再调用外部工具修复
+		_, repaired := p.(*flv.Parser)
+		r.submitPostProcess(ctx, info, recordedFiles, !repaired, r.segmentEndReason(err))
+	}
+	return
+}
 
-
-	
-	cmdStr := strings.Trim(r.config.OnRecordFinished.CustomCommandline, "")
-	if len(cmdStr) > 0 {
-		bash := ""
-		args := ""
-		switch runtime.GOOS {
-		case "linux":
-			bash = "bash"
-			args = "-c"
-		case "windows":
-			bash = "cmd"
-			args = "/C"
-		default:
-			r.getLogger().Warnln("Unsupport system ", runtime.GOOS)
-		}
-		r.getLogger().Debugf("start executing custom_commandline: %s %s %s", bash, args, cmdStr)
-		cmd := exec.Command(bash, args, cmdStr)
-		if r.config.Debug {
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-		}
-		if err = cmd.Run(); err != nil {
-			r.getLogger().WithError(err).Debugf("custom commandline execute failure (%s %s)\n", bash, cmdStr)
-		} else if r.config.OnRecordFinished.DeleteFlvAfterConvert {
-			os.Remove(fileName)
-		}
-		r.getLogger().Debugf("end executing custom_commandline: %s", cmdStr)
-	} 
+func (r *recorder) segmentEndReason(err error) SegmentEndReason {
+	switch {
+	case r.isStopped() && r.session.Active():
+		// 录制器被重启，场次仍在继续
+		return SegmentEndSplit
+	case r.isStopped():
+		return SegmentEndStop
+	case r.session.Paused():
+		return SegmentEndPause
+	case err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return SegmentEndReconnect
+	default:
+		return SegmentEndError
+	}
 }
 
 func (r *recorder) run(ctx context.Context) {
 	for {
 		select {
 		case <-r.stop:
+			r.session.detach()
+			r.ed.DispatchEvent(events.NewEvent(RecorderStop, &RecorderStopEvent{
+				Live:    r.Live,
+				Session: r.session,
+			}))
 			return
 		default:
-			r.tryRecord(ctx)
+			if r.session.waitResume(r.stop) && !r.isStopped() {
+				r.tryRecord(ctx)
+			}
 		}
 	}
 }
 
+func (r *recorder) isStopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
 func (r *recorder) getParser() parser.Parser {
 	r.parserLock.RLock()
 	defer r.parserLock.RUnlock()
@@ -274,7 +374,9 @@ func (r *recorder) Start(ctx context.Context) error {
 	if !atomic.CompareAndSwapUint32(&r.state, begin, pending) {
 		return nil
 	}
+	r.session.attach()
 	go r.run(ctx)
+	go r.recordDanmaku(ctx)
 	r.getLogger().Info("Record Start")
 	r.ed.DispatchEvent(events.NewEvent(RecorderStart, r.Live))
 	atomic.CompareAndSwapUint32(&r.state, pending, running)
@@ -282,21 +384,88 @@ func (r *recorder) Start(ctx context.Context) error {
 }
 
 func (r *recorder) StartTime() time.Time {
-	return r.startTime
+	return time.Unix(0, r.startTime.Load())
 }
 
 func (r *recorder) Close() {
-	if !atomic.CompareAndSwapUint32(&r.state, running, stopped) {
+	if !r.markStopped() {
 		return
 	}
+	r.closeParser()
+}
+
+// markStopped 结束录制循环，但不停止正在运行的解析器
+func (r *recorder) markStopped() bool {
+	if !atomic.CompareAndSwapUint32(&r.state, running, stopped) {
+		return false
+	}
 	close(r.stop)
+	return true
+}
+
+func (r *recorder) closeParser() {
 	if p := r.getParser(); p != nil {
 		if err := p.Stop(); err != nil {
 			r.getLogger().WithError(err).Warn("failed to end recorder")
 		}
 	}
 	r.getLogger().Info("Record End")
-	r.ed.DispatchEvent(events.NewEvent(RecorderStop, r.Live))
+}
+
+// handoverPoint 返回录制器是否已经写入了数据，解析器支持时一并返回第一个关键帧的时间戳
+func (r *recorder) handoverPoint() (ready bool, timestamp uint32, ok bool) {
+	p := r.getParser()
+	if hp, isHandoverParser := p.(parser.HandoverParser); isHandoverParser {
+		timestamp, ok = hp.FirstKeyFrame()
+		return ok, timestamp, ok
+	}
+	if file, _ := r.file.Load().(string); file != "" {
+		if stat, err := os.Stat(file); err == nil && stat.Size() > 0 {
+			return true, 0, false
+		}
+	}
+	return false, 0, false
+}
+
+func (r *recorder) Handover(next Recorder, timeout time.Duration) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	n, isRecorder := next.(*recorder)
+	if !isRecorder {
+		r.Close()
+		return
+	}
+	ticker := time.NewTicker(handoverPollInterval)
+	defer ticker.Stop()
+	for {
+		ready, timestamp, ok := n.handoverPoint()
+		if ready {
+			hp, isHandoverParser := r.getParser().(parser.HandoverParser)
+			if !ok || !isHandoverParser || !r.markStopped() {
+				r.Close()
+				return
+			}
+			// 旧的解析器在新文件起点对应的关键帧处结束，避免内容重复
+			select {
+			case <-hp.StopAt(timestamp):
+			case <-deadline.C:
+				r.getLogger().Warn("timeout waiting for the old recorder to reach the handover point")
+			}
+			r.closeParser()
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-n.stop:
+			// 交接完成前直播结束或停止录制
+			r.Close()
+			return
+		case <-deadline.C:
+			r.getLogger().Warn("the new recorder did not receive data in time, close the old one")
+			r.Close()
+			return
+		}
+	}
 }
 
 func (r *recorder) getLogger() *logrus.Entry {
@@ -315,6 +484,39 @@ func (r *recorder) getFields() map[string]any {
 	}
 }
 
+func (r *recorder) Split() error {
+	splitP, ok := r.getParser().(parser.SplitParser)
+	if !ok {
+		return ErrParserNotSupportSplit
+	}
+	if err := splitP.Split(); err != nil {
+		return err
+	}
+	r.startTime.Store(time.Now().UnixNano())
+	return nil
+}
+
+func (r *recorder) Pause() error {
+	if !r.session.pause() {
+		return ErrRecorderPaused
+	}
+	if p := r.getParser(); p != nil {
+		if err := p.Stop(); err != nil {
+			r.getLogger().WithError(err).Warn("failed to pause recorder")
+		}
+	}
+	r.getLogger().Info("Record Paused")
+	return nil
+}
+
+func (r *recorder) Resume() error {
+	if !r.session.resume() {
+		return ErrRecorderNotPaused
+	}
+	r.getLogger().Info("Record Resumed")
+	return nil
+}
+
 func (r *recorder) GetStatus() (map[string]string, error) {
 	statusP, ok := r.getParser().(parser.StatusParser)
 	if !ok {
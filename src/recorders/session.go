@@ -0,0 +1,506 @@
+package recorders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/highlight"
+	"github.com/bililive-go/bililive-go/src/postprocess"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+var ErrSessionNotExist = errors.New("session is not exist")
+
+// SegmentEndReason 分段结束的原因
+type SegmentEndReason string
+
+const (
+	// SegmentEndSplit 按标题变化、时长、大小或编码参数切分
+	SegmentEndSplit SegmentEndReason = "split"
+	// SegmentEndReconnect 直播流断开后重新连接
+	SegmentEndReconnect SegmentEndReason = "reconnect"
+	// SegmentEndError 解析器出错
+	SegmentEndError SegmentEndReason = "error"
+	// SegmentEndStop 直播结束或停止录制
+	SegmentEndStop SegmentEndReason = "stop"
+	// SegmentEndPause 手动暂停录制
+	SegmentEndPause SegmentEndReason = "pause"
+)
+
+// Segment 是录制场次中的一个文件
+type Segment struct {
+	File      string           `json:"file"`
+	StartTime time.Time        `json:"start_time"`
+	EndTime   time.Time        `json:"end_time"`
+	Size      int64            `json:"size"`
+	StreamUrl string           `json:"stream_url"`
+	EndReason SegmentEndReason `json:"end_reason,omitempty"`
+	// Outputs 后处理转换、移动后的视频文件，修复时切分出多个文件时按顺序记录
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// Upload 是场次中文件的远程上传状态
+type Upload struct {
+	postprocess.UploadStatus
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Session 是一次从开播到下播的录制场次，重连、切分产生的文件按顺序记录为分段
+type Session struct {
+	Id        string       `json:"id"`
+	LiveId    types.LiveID `json:"live_id"`
+	Platform  string       `json:"platform"`
+	HostName  string       `json:"host_name"`
+	RoomName  string       `json:"room_name"`
+	StartTime time.Time    `json:"start_time"`
+	EndTime   time.Time    `json:"end_time"`
+	Segments  []*Segment   `json:"segments"`
+	Uploads   []*Upload    `json:"uploads,omitempty"`
+	// 场次结束后由 highlight 任务写入的活跃度曲线与高能片段
+	Timeline   *highlight.Timeline    `json:"timeline,omitempty"`
+	Highlights []*highlight.Highlight `json:"highlights,omitempty"`
+
+	lock  sync.RWMutex
+	store *sessionStore
+	// 需要在场次后处理时修复的文件，不持久化
+	needFix map[string]bool
+	// 暂停录制时创建，恢复时关闭，不持久化
+	resumed chan struct{}
+	// 弹幕写入该录制器的文件，交接后的录制器沿用同一个弹幕连接
+	danmaku *recorder
+	// 正在运行的录制器数量，交接时新旧录制器同时运行
+	recorders int
+	// 场次结束后的处理已经提交，避免交接中的录制器结束时重复提交
+	finalized bool
+}
+
+func newSession(l live.Live, info *live.Info, store *sessionStore) *Session {
+	now := time.Now()
+	s := &Session{
+		// 精确到微秒，避免同一秒内重新开始录制时覆盖上一场的记录
+		Id:        fmt.Sprintf("%s_%s%06d", l.GetLiveId(), now.Format("20060102150405"), now.Nanosecond()/1000),
+		LiveId:    l.GetLiveId(),
+		Platform:  l.GetPlatformCNName(),
+		StartTime: now,
+		Segments:  []*Segment{},
+		store:     store,
+	}
+	if info != nil {
+		s.HostName = info.HostName
+		s.RoomName = info.RoomName
+	}
+	s.save()
+	return s
+}
+
+// Snapshot 返回场次的副本，用于序列化
+func (s *Session) Snapshot() *Session {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	c := &Session{
+		Id:        s.Id,
+		LiveId:    s.LiveId,
+		Platform:  s.Platform,
+		HostName:  s.HostName,
+		RoomName:  s.RoomName,
+		StartTime: s.StartTime,
+		EndTime:   s.EndTime,
+		Segments:  make([]*Segment, len(s.Segments)),
+	}
+	for i, seg := range s.Segments {
+		segCopy := *seg
+		c.Segments[i] = &segCopy
+	}
+	for _, u := range s.Uploads {
+		uploadCopy := *u
+		c.Uploads = append(c.Uploads, &uploadCopy)
+	}
+	// 活跃度曲线写入后不会再修改
+	c.Timeline = s.Timeline
+	for _, h := range s.Highlights {
+		highlightCopy := *h
+		c.Highlights = append(c.Highlights, &highlightCopy)
+	}
+	return c
+}
+
+// Active 场次是否仍在进行中
+func (s *Session) Active() bool {
+	if s == nil {
+		return false
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.EndTime.IsZero()
+}
+
+// followDanmaku 让场次的弹幕写入 r 的文件，返回是否已经有录制器在接收弹幕，没有时由 r 开始接收
+func (s *Session) followDanmaku(r *recorder) bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	running := s.danmaku != nil
+	s.danmaku = r
+	return running
+}
+
+// nextDanmaku 在 r 停止后返回继续接收弹幕的录制器，返回 nil 时结束接收
+func (s *Session) nextDanmaku(r *recorder) *recorder {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.danmaku == r {
+		s.danmaku = nil
+		return nil
+	}
+	return s.danmaku
+}
+
+// stopDanmaku 弹幕连接断开时调用，之后开始的录制器重新接收弹幕
+func (s *Session) stopDanmaku() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.danmaku = nil
+}
+
+// Paused 返回场次的录制是否被手动暂停
+func (s *Session) Paused() bool {
+	if s == nil {
+		return false
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.resumed != nil
+}
+
+// pause 暂停录制，已经暂停时返回 false
+func (s *Session) pause() bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.resumed != nil {
+		return false
+	}
+	s.resumed = make(chan struct{})
+	return true
+}
+
+// resume 恢复录制，没有暂停时返回 false
+func (s *Session) resume() bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.resumed == nil {
+		return false
+	}
+	close(s.resumed)
+	s.resumed = nil
+	return true
+}
+
+// waitResume 暂停时等待恢复录制，stop 关闭时返回 false
+func (s *Session) waitResume(stop <-chan struct{}) bool {
+	if s == nil {
+		return true
+	}
+	s.lock.RLock()
+	resumed := s.resumed
+	s.lock.RUnlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// Files 按顺序返回场次中的所有文件
+func (s *Session) Files() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	files := make([]string, 0, len(s.Segments))
+	for _, seg := range s.Segments {
+		files = append(files, seg.File)
+	}
+	return files
+}
+
+func (s *Session) markNeedFix(files ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.needFix == nil {
+		s.needFix = make(map[string]bool)
+	}
+	for _, file := range files {
+		s.needFix[file] = true
+	}
+}
+
+func (s *Session) needsFix(file string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.needFix[file]
+}
+
+// setUpload 按文件与目标更新上传状态
+func (s *Session) setUpload(status postprocess.UploadStatus) {
+	u := &Upload{UploadStatus: status, UpdatedAt: time.Now()}
+	s.lock.Lock()
+	replaced := false
+	for i, v := range s.Uploads {
+		if v.File == status.File && v.Target == status.Target {
+			s.Uploads[i], replaced = u, true
+			break
+		}
+	}
+	if !replaced {
+		s.Uploads = append(s.Uploads, u)
+	}
+	s.lock.Unlock()
+	s.save()
+}
+
+// setOutputs 记录分段文件后处理后的文件
+func (s *Session) setOutputs(file string, outputs []string) {
+	s.lock.Lock()
+	for _, seg := range s.Segments {
+		if seg.File == file {
+			seg.Outputs = outputs
+		}
+	}
+	s.lock.Unlock()
+	s.save()
+}
+
+// setHighlights 替换场次的活跃度曲线与高能片段
+func (s *Session) setHighlights(timeline *highlight.Timeline, highlights []*highlight.Highlight) {
+	s.lock.Lock()
+	s.Timeline, s.Highlights = timeline, highlights
+	s.lock.Unlock()
+	s.save()
+}
+
+// attach 在录制器开始运行时调用
+func (s *Session) attach() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.recorders++
+	s.lock.Unlock()
+}
+
+// detach 在录制器结束运行时调用
+func (s *Session) detach() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.recorders--
+	s.lock.Unlock()
+}
+
+// finalize 在场次已经结束且全部录制器都已结束运行时返回 true，每个场次只返回一次，
+// 调用方此时执行场次结束后的处理
+func (s *Session) finalize() bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.finalized || s.EndTime.IsZero() || s.recorders > 0 {
+		return false
+	}
+	s.finalized = true
+	return true
+}
+
+func (s *Session) end() {
+	s.lock.Lock()
+	if s.EndTime.IsZero() {
+		s.EndTime = time.Now()
+	}
+	s.lock.Unlock()
+	s.save()
+}
+
+// startSegment 在解析器开始写入时记录一个尚未结束的分段
+func (s *Session) startSegment(file, streamUrl string) *Segment {
+	seg := &Segment{
+		File:      file,
+		StartTime: time.Now(),
+		StreamUrl: streamUrl,
+	}
+	s.lock.Lock()
+	s.Segments = append(s.Segments, seg)
+	s.lock.Unlock()
+	s.save()
+	return seg
+}
+
+// finishSegment 用解析器实际写出的文件替换 startSegment 记录的分段，
+// starts 为解析器记录的每个文件开始写入的时间，与弹幕文件的开始时间一致；
+// 解析器没有记录时，内部切分出的文件以文件修改时间作为分段的结束时间
+func (s *Session) finishSegment(seg *Segment, files []string, starts []time.Time, reason SegmentEndReason) {
+	if len(starts) != len(files) {
+		starts = nil
+	}
+	now := time.Now()
+	segments := make([]*Segment, 0, len(files))
+	start := seg.StartTime
+	for i, file := range files {
+		if starts != nil {
+			start = starts[i]
+		}
+		stat, err := os.Stat(file)
+		if err != nil {
+			// 空文件已被删除
+			continue
+		}
+		end, endReason := stat.ModTime(), SegmentEndSplit
+		if starts != nil && i < len(files)-1 {
+			end = starts[i+1]
+		}
+		if i == len(files)-1 {
+			end, endReason = now, reason
+		}
+		segments = append(segments, &Segment{
+			File:      file,
+			StartTime: start,
+			EndTime:   end,
+			Size:      stat.Size(),
+			StreamUrl: seg.StreamUrl,
+			EndReason: endReason,
+		})
+		start = end
+	}
+	if len(segments) > 0 {
+		// 最后一个文件被删除时，保留真实的结束原因
+		segments[len(segments)-1].EndReason = reason
+	}
+
+	s.lock.Lock()
+	for i, v := range s.Segments {
+		if v == seg {
+			s.Segments = append(s.Segments[:i], append(segments, s.Segments[i+1:]...)...)
+			break
+		}
+	}
+	s.lock.Unlock()
+	s.save()
+}
+
+func (s *Session) save() {
+	if s.store == nil {
+		return
+	}
+	// 持有 store 的锁时生成快照，并发保存时后写入的总是较新的状态
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+	s.store.write(s.Snapshot())
+}
+
+// sessionStore 将场次持久化到 AppDataPath/sessions 目录，每个场次一个 json 文件
+type sessionStore struct {
+	dir  string
+	lock sync.Mutex
+}
+
+func newSessionStore(appDataPath string) *sessionStore {
+	if appDataPath == "" {
+		return nil
+	}
+	return &sessionStore{dir: filepath.Join(appDataPath, "sessions")}
+}
+
+// write 写入场次，调用时需持有 st.lock
+func (st *sessionStore) write(s *Session) error {
+	if err := mkdir(st.dir); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(st.dir, s.Id+".json")
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (st *sessionStore) load(id string) (*Session, error) {
+	if strings.ContainsAny(id, `/\`) {
+		return nil, ErrSessionNotExist
+	}
+	f, err := os.Open(filepath.Join(st.dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrSessionNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Session)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// list 返回所有已保存的场次，按开始时间倒序排列
+func (st *sessionStore) list() ([]*Session, error) {
+	entries, err := os.ReadDir(st.dir)
+	if os.IsNotExist(err) {
+		return []*Session{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		s, err := st.load(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func sortSessions(sessions []*Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartTime.After(sessions[j].StartTime)
+	})
+}
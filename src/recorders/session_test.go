@@ -0,0 +1,174 @@
+package recorders
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/live"
+	livemock "github.com/bililive-go/bililive-go/src/live/mock"
+	"github.com/bililive-go/bililive-go/src/postprocess"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+func TestSessionSegments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	store := newSessionStore(dir)
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+	s := newSession(l, &live.Info{HostName: "host", RoomName: "room"}, store)
+
+	file := filepath.Join(dir, "a.flv")
+	part2 := filepath.Join(dir, "a_P002.flv")
+	empty := filepath.Join(dir, "a_P003.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("123"), 0644))
+	assert.NoError(t, os.WriteFile(part2, []byte("45"), 0644))
+
+	seg := s.startSegment(file, "https://example.com/live.flv")
+	assert.Equal(t, []string{file}, s.Files())
+	// 最后一个文件为空已被删除，分段的时间为解析器开始写入各文件的时间
+	t0 := time.Date(2024, 1, 1, 20, 0, 0, 0, time.Local)
+	starts := []time.Time{t0, t0.Add(time.Hour), t0.Add(2 * time.Hour)}
+	s.finishSegment(seg, []string{file, part2, empty}, starts, SegmentEndReconnect)
+	seg = s.startSegment(filepath.Join(dir, "b.flv"), "https://example.com/live.flv")
+	s.finishSegment(seg, []string{filepath.Join(dir, "b.flv")}, nil, SegmentEndStop)
+	s.end()
+	assert.False(t, s.Active())
+
+	saved, err := store.load(s.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "room", saved.RoomName)
+	assert.Len(t, saved.Segments, 2)
+	assert.Equal(t, file, saved.Segments[0].File)
+	assert.Equal(t, int64(3), saved.Segments[0].Size)
+	assert.Equal(t, SegmentEndSplit, saved.Segments[0].EndReason)
+	assert.True(t, t0.Equal(saved.Segments[0].StartTime))
+	assert.True(t, starts[1].Equal(saved.Segments[0].EndTime))
+	assert.Equal(t, part2, saved.Segments[1].File)
+	assert.True(t, starts[1].Equal(saved.Segments[1].StartTime))
+	assert.Equal(t, SegmentEndReconnect, saved.Segments[1].EndReason)
+	assert.False(t, saved.EndTime.IsZero())
+
+	_, err = store.load("../x")
+	assert.Equal(t, ErrSessionNotExist, err)
+
+	// 紧接着开始的场次不会覆盖上一场的记录
+	assert.NotEqual(t, s.Id, newSession(l, nil, store).Id)
+	var nilSession *Session
+	assert.False(t, nilSession.Active())
+}
+
+func TestSessionConcurrentSave(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := newSessionStore(t.TempDir())
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+	s := newSession(l, nil, store)
+	seg := s.startSegment("a.flv", "")
+
+	// 并发保存时最后写入的是最新的状态
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.setOutputs(seg.File, []string{fmt.Sprintf("a_%d.mp4", i)})
+		}(i)
+	}
+	wg.Wait()
+	saved, err := store.load(s.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, s.Snapshot().Segments[0].Outputs, saved.Segments[0].Outputs)
+}
+
+func TestManagerSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := new(configs.Config)
+	cfg.AppDataPath = t.TempDir()
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: cfg,
+	})
+	m := NewManager(ctx)
+	backup := newRecorder
+	defer func() { newRecorder = backup }()
+	var sessions []*Session
+	newRecorder = func(ctx context.Context, live live.Live, session *Session) (Recorder, error) {
+		sessions = append(sessions, session)
+		r := NewMockRecorder(ctrl)
+		r.EXPECT().Start(gomock.Any()).Return(nil)
+		r.EXPECT().Close()
+		return r, nil
+	}
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+
+	assert.NoError(t, m.AddRecorder(ctx, l))
+	// 重启录制器沿用同一个场次
+	assert.NoError(t, m.RestartRecorder(ctx, l))
+	assert.Len(t, sessions, 2)
+	assert.Same(t, sessions[0], sessions[1])
+	assert.True(t, sessions[0].Active())
+
+	assert.NoError(t, m.RemoveRecorder(ctx, "test"))
+	assert.False(t, sessions[0].Active())
+	all, err := m.GetSessions(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+	s, err := m.GetSession(ctx, sessions[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, sessions[0].Id, s.Id)
+	_, err = m.GetSession(ctx, "none")
+	assert.Equal(t, ErrSessionNotExist, err)
+
+	// 已结束场次的上传状态写入保存的记录
+	status := postprocess.UploadStatus{File: "a.flv", Target: "minio", Key: "a.flv", State: postprocess.UploadUploading}
+	m.(*manager).recordUpload(s.Id, status)
+	status.State = postprocess.UploadSucceeded
+	m.(*manager).recordUpload(s.Id, status)
+	s, err = m.GetSession(ctx, s.Id)
+	assert.NoError(t, err)
+	assert.Len(t, s.Uploads, 1)
+	assert.Equal(t, postprocess.UploadSucceeded, s.Uploads[0].State)
+}
+
+func TestSessionPause(t *testing.T) {
+	s := &Session{}
+	stop := make(chan struct{})
+	assert.False(t, s.Paused())
+	assert.True(t, s.waitResume(stop))
+	assert.True(t, s.pause())
+	assert.False(t, s.pause())
+	assert.True(t, s.Paused())
+
+	resumed := make(chan bool)
+	go func() { resumed <- s.waitResume(stop) }()
+	assert.True(t, s.resume())
+	assert.False(t, s.resume())
+	assert.True(t, <-resumed)
+
+	assert.True(t, s.pause())
+	close(stop)
+	assert.False(t, s.waitResume(stop))
+}
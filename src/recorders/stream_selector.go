@@ -0,0 +1,208 @@
+package recorders
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/live"
+)
+
+const (
+	probeUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/59.0.3071.115 Safari/537.36"
+	// 探测时最多读取的数据量，用于估算吞吐
+	probeMaxBytes = 512 * 1024
+)
+
+// for test
+var probeHttpClient = &http.Client{}
+
+// badHostCache 记录各平台近期出错的 CDN 节点，冷却期内不再优先使用
+type badHostCache struct {
+	lock  sync.Mutex
+	hosts map[string]time.Time // key: platform/host, value: 冷却结束时间
+}
+
+var badHosts = &badHostCache{hosts: make(map[string]time.Time)}
+
+func (c *badHostCache) key(platform, host string) string {
+	return platform + "/" + host
+}
+
+func (c *badHostCache) Mark(platform, host string, cooldown time.Duration) {
+	if cooldown <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.hosts[c.key(platform, host)] = time.Now().Add(cooldown)
+}
+
+func (c *badHostCache) IsBad(platform, host string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := c.key(platform, host)
+	expire, ok := c.hosts[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expire) {
+		delete(c.hosts, key)
+		return false
+	}
+	return true
+}
+
+type streamProbeResult struct {
+	Info       *live.StreamUrlInfo
+	StatusCode int
+	Latency    time.Duration // 首字节耗时
+	Throughput float64       // 字节/秒
+	Err        error
+}
+
+func (r *streamProbeResult) ok() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// streamSelector 对同一次录制可用的多个线路进行探测排序，并在录制失败时依次切换
+type streamSelector struct {
+	platform   string
+	cfg        configs.StreamSelector
+	candidates []*live.StreamUrlInfo
+	next       int
+}
+
+func newStreamSelector(platform string, cfg configs.StreamSelector, infos []*live.StreamUrlInfo) *streamSelector {
+	return &streamSelector{
+		platform:   platform,
+		cfg:        cfg,
+		candidates: infos,
+	}
+}
+
+// Rank 探测所有不在冷却期内的线路，按可用性、吞吐、首字节耗时排序；
+// 处于冷却期或探测失败的线路排在最后，仍作为兜底使用
+func (s *streamSelector) Rank(ctx context.Context) []*streamProbeResult {
+	if !s.cfg.Enable || len(s.candidates) <= 1 {
+		return nil
+	}
+	var (
+		wg      sync.WaitGroup
+		results = make([]*streamProbeResult, len(s.candidates))
+		cooling = make([]*live.StreamUrlInfo, 0)
+	)
+	for i, info := range s.candidates {
+		if badHosts.IsBad(s.platform, info.Url.Host) {
+			cooling = append(cooling, info)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, info *live.StreamUrlInfo) {
+			defer wg.Done()
+			results[i] = probeStream(ctx, info, s.cfg.ProbeTimeout)
+		}(i, info)
+	}
+	wg.Wait()
+
+	probed := make([]*streamProbeResult, 0, len(results))
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+		if !res.ok() {
+			badHosts.Mark(s.platform, res.Info.Url.Host, s.cfg.BadHostCooldown)
+		}
+		probed = append(probed, res)
+	}
+	sort.SliceStable(probed, func(i, j int) bool {
+		a, b := probed[i], probed[j]
+		if a.ok() != b.ok() {
+			return a.ok()
+		}
+		if a.Throughput != b.Throughput {
+			return a.Throughput > b.Throughput
+		}
+		return a.Latency < b.Latency
+	})
+
+	ranked := make([]*live.StreamUrlInfo, 0, len(s.candidates))
+	for _, res := range probed {
+		if res.ok() {
+			ranked = append(ranked, res.Info)
+		}
+	}
+	ranked = append(ranked, cooling...)
+	for _, res := range probed {
+		if !res.ok() {
+			ranked = append(ranked, res.Info)
+		}
+	}
+	s.candidates = ranked
+	return probed
+}
+
+// Next 返回下一个待尝试的线路，全部尝试过后返回 false
+func (s *streamSelector) Next() (*live.StreamUrlInfo, bool) {
+	if s.next >= len(s.candidates) {
+		return nil, false
+	}
+	info := s.candidates[s.next]
+	s.next++
+	return info, true
+}
+
+// MarkBad 将录制失败的线路加入冷却列表
+func (s *streamSelector) MarkBad(info *live.StreamUrlInfo) {
+	badHosts.Mark(s.platform, info.Url.Host, s.cfg.BadHostCooldown)
+}
+
+func probeStream(ctx context.Context, info *live.StreamUrlInfo, timeout time.Duration) *streamProbeResult {
+	res := &streamProbeResult{Info: info}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, info.Url.String(), nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	req.Header.Set("User-Agent", probeUserAgent)
+	for k, v := range info.HeadersForDownloader {
+		req.Header.Set(k, v)
+	}
+	start := time.Now()
+	resp, err := probeHttpClient.Do(req)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return res
+	}
+
+	buf := make([]byte, 32*1024)
+	var total int64
+	n, err := resp.Body.Read(buf)
+	res.Latency = time.Since(start)
+	total += int64(n)
+	for err == nil && total < probeMaxBytes {
+		n, err = resp.Body.Read(buf)
+		total += int64(n)
+	}
+	if err != nil && err != io.EOF && total == 0 {
+		res.Err = err
+		return res
+	}
+	// 包含首字节耗时在内的平均速度
+	res.Throughput = float64(total) / time.Since(start).Seconds()
+	return res
+}
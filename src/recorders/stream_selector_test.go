@@ -0,0 +1,102 @@
+package recorders
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/live"
+)
+
+func newTestStreamInfo(t *testing.T, rawUrl string) *live.StreamUrlInfo {
+	u, err := url.Parse(rawUrl)
+	assert.NoError(t, err)
+	return &live.StreamUrlInfo{Url: u}
+}
+
+func TestStreamSelectorRank(t *testing.T) {
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer forbidden.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write(make([]byte, 1024))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 64*1024))
+	}))
+	defer fast.Close()
+
+	cfg := configs.StreamSelector{
+		Enable:          true,
+		ProbeTimeout:    time.Second,
+		BadHostCooldown: time.Minute,
+	}
+	infos := []*live.StreamUrlInfo{
+		newTestStreamInfo(t, forbidden.URL+"/live.flv"),
+		newTestStreamInfo(t, slow.URL+"/live.flv"),
+		newTestStreamInfo(t, fast.URL+"/live.flv"),
+	}
+	s := newStreamSelector("test-rank", cfg, infos)
+	results := s.Rank(context.Background())
+	assert.Len(t, results, 3)
+
+	var order []*live.StreamUrlInfo
+	for info, ok := s.Next(); ok; info, ok = s.Next() {
+		order = append(order, info)
+	}
+	assert.Equal(t, []*live.StreamUrlInfo{infos[2], infos[1], infos[0]}, order)
+	assert.True(t, badHosts.IsBad("test-rank", infos[0].Url.Host))
+	assert.False(t, badHosts.IsBad("test-rank", infos[2].Url.Host))
+	assert.False(t, badHosts.IsBad("other-platform", infos[0].Url.Host))
+}
+
+func TestStreamSelectorSkipCoolingHosts(t *testing.T) {
+	var probed int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&probed, 1)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := configs.StreamSelector{
+		Enable:          true,
+		ProbeTimeout:    time.Second,
+		BadHostCooldown: time.Minute,
+	}
+	cooling := newTestStreamInfo(t, "http://127.0.0.1:1/live.flv")
+	good := newTestStreamInfo(t, server.URL+"/live.flv")
+	s := newStreamSelector("test-cooling", cfg, []*live.StreamUrlInfo{cooling, good})
+	s.MarkBad(cooling)
+	s.Rank(context.Background())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&probed))
+
+	first, ok := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, good, first)
+	second, ok := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, cooling, second)
+	_, ok = s.Next()
+	assert.False(t, ok)
+}
+
+func TestStreamSelectorDisabled(t *testing.T) {
+	infos := []*live.StreamUrlInfo{
+		newTestStreamInfo(t, "http://127.0.0.1:1/a.flv"),
+		newTestStreamInfo(t, "http://127.0.0.1:1/b.flv"),
+	}
+	s := newStreamSelector("test-disabled", configs.StreamSelector{}, infos)
+	assert.Nil(t, s.Rank(context.Background()))
+	first, _ := s.Next()
+	assert.Equal(t, infos[0], first)
+}
@@ -0,0 +1,67 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/bililive-go/bililive-go/src/pkg/utils"
+)
+
+// pusher 接收 flv 直播流并推送到服务器
+type pusher interface {
+	io.Writer
+	// Close 结束输入并等待推流结束，返回推流过程中的错误
+	Close() error
+}
+
+// for test
+var newPusher = newFFmpegPusher
+
+// ffmpegPusher 使用 ffmpeg 以流复制的方式推流
+type ffmpegPusher struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *bytes.Buffer
+}
+
+func newFFmpegPusher(ctx context.Context, rawUrl string) (pusher, error) {
+	ffmpegPath, err := utils.GetFFmpegPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "flv", "-i", "pipe:0",
+		"-c", "copy",
+		"-f", "flv", rawUrl,
+	)
+	p := &ffmpegPusher{cmd: cmd, stderr: new(bytes.Buffer)}
+	cmd.Stderr = p.stderr
+	if p.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *ffmpegPusher) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+func (p *ffmpegPusher) Close() error {
+	p.stdin.Close()
+	err := p.cmd.Wait()
+	if err != nil {
+		if msg := strings.TrimSpace(p.stderr.String()); msg != "" {
+			lines := strings.Split(msg, "\n")
+			return fmt.Errorf("%w: %s", err, lines[len(lines)-1])
+		}
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/pkg/restream"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+// 推流的状态
+const (
+	StateConnecting = "connecting"
+	StatePushing    = "pushing"
+	StateBackoff    = "backoff"
+)
+
+// for test
+var (
+	minBackoff = time.Second
+	// 订阅结束后等待推流结束的时间，超时后结束 ffmpeg，避免阻塞在写入中
+	closeTimeout = 10 * time.Second
+	// 推流持续超过该时长后认为连接稳定，重置重试间隔
+	stableDuration = time.Minute
+)
+
+// Status 一个直播间的推流状态
+type Status struct {
+	LiveId types.LiveID `json:"live_id"`
+	// Url 推流地址，隐藏了推流密钥
+	Url   string `json:"url"`
+	State string `json:"state"`
+	// Since 进入当前状态的时间
+	Since     time.Time `json:"since"`
+	Retries   int       `json:"retries"`
+	BytesSent int64     `json:"bytes_sent"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type Relay interface {
+	interfaces.Module
+	Status() []Status
+}
+
+func NewRelay(ctx context.Context) Relay {
+	inst := instance.GetInstance(ctx)
+	r := &relay{
+		inst:   inst,
+		status: make(map[types.LiveID]*roomStatus),
+	}
+	inst.Relay = r
+	return r
+}
+
+type relay struct {
+	inst   *instance.Instance
+	lock   sync.Mutex
+	status map[types.LiveID]*roomStatus
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type roomStatus struct {
+	lock      sync.Mutex
+	status    Status
+	bytesSent atomic.Int64
+}
+
+func (s *roomStatus) set(state string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status.State = state
+	s.status.Since = time.Now()
+	if err != nil {
+		s.status.Retries++
+		s.status.LastError = err.Error()
+	}
+}
+
+func (s *roomStatus) snapshot() Status {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st := s.status
+	st.BytesSent = s.bytesSent.Load()
+	return st
+}
+
+// countingWriter 统计推送的字节数
+type countingWriter struct {
+	w     pusher
+	count *atomic.Int64
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.count.Add(int64(n))
+	return n, err
+}
+
+func (r *relay) Start(ctx context.Context) error {
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	reg, ok := r.inst.Restream.(*restream.Registry)
+	if !ok {
+		return nil
+	}
+	for _, room := range r.inst.Config.LiveRooms {
+		if room.Relay != nil && !r.inst.Config.Feature.UseNativeFlvParser {
+			r.inst.Logger.Warnf("relay of %s requires feature.use_native_flv_parser", room.Url)
+		}
+	}
+	reg.OnHub(r.onHub)
+	return nil
+}
+
+func (r *relay) Close(ctx context.Context) {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+}
+
+// onHub 直播间开始录制时开始推流，直到录制场次结束
+func (r *relay) onHub(id types.LiveID, hub *restream.Hub) {
+	l, ok := r.inst.Lives[id]
+	if !ok {
+		return
+	}
+	cfg := r.inst.Config.GetRelay(l.GetRawUrl())
+	if cfg == nil || r.ctx.Err() != nil {
+		return
+	}
+	st := &roomStatus{status: Status{LiveId: id, Url: maskUrl(cfg.Url)}}
+	r.lock.Lock()
+	r.status[id] = st
+	r.lock.Unlock()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run(r.ctx, hub, cfg, st)
+		r.lock.Lock()
+		if r.status[id] == st {
+			delete(r.status, id)
+		}
+		r.lock.Unlock()
+	}()
+}
+
+// run 推流失败后按指数退避重试，转播结束时返回
+func (r *relay) run(ctx context.Context, hub *restream.Hub, cfg *configs.Relay, st *roomStatus) {
+	logger := r.inst.Logger.WithField("relay", st.status.Url)
+	backoff := minBackoff
+	for {
+		sub, err := hub.Subscribe()
+		if err != nil {
+			return
+		}
+		st.set(StateConnecting, nil)
+		start := time.Now()
+		err = r.push(ctx, sub, cfg.Url, st)
+		if ctx.Err() != nil || errors.Is(err, restream.ErrHubClosed) {
+			return
+		}
+		if time.Since(start) > stableDuration {
+			backoff = minBackoff
+		}
+		if err == nil {
+			err = errors.New("push ended unexpectedly")
+		}
+		logger.WithError(err).Warnf("relay failed, retry after %v", backoff)
+		st.set(StateBackoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > cfg.GetMaxBackoff() {
+			backoff = cfg.GetMaxBackoff()
+		}
+	}
+}
+
+// push 把订阅到的直播流推送到 rawUrl，推流出错或转播结束时返回
+func (r *relay) push(ctx context.Context, sub *restream.Subscriber, rawUrl string, st *roomStatus) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p, err := newPusher(ctx, rawUrl)
+	if err != nil {
+		sub.Close()
+		return err
+	}
+	st.set(StatePushing, nil)
+	// ffmpeg 卡住时 Copy 会阻塞在写入中，无法得知订阅已经结束
+	finished, timeout := make(chan struct{}), closeTimeout
+	defer close(finished)
+	go func() {
+		select {
+		case <-finished:
+			return
+		case <-sub.Done():
+		}
+		select {
+		case <-finished:
+		case <-time.After(timeout):
+			cancel()
+		}
+	}()
+	copyErr := sub.Copy(ctx, countingWriter{w: p, count: &st.bytesSent})
+	pushErr := p.Close()
+	if err := sub.Err(); errors.Is(err, restream.ErrHubClosed) {
+		return err
+	}
+	if pushErr != nil {
+		return pushErr
+	}
+	return copyErr
+}
+
+func (r *relay) Status() []Status {
+	r.lock.Lock()
+	res := make([]Status, 0, len(r.status))
+	for _, st := range r.status {
+		res = append(res, st.snapshot())
+	}
+	r.lock.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].LiveId < res[j].LiveId })
+	return res
+}
+
+// maskUrl 隐藏推流地址中的推流密钥（最后一级路径与参数）
+func maskUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	u.RawQuery = ""
+	u.User = nil
+	if dir, file := path.Split(u.Path); file != "" {
+		u.Path, u.RawPath = dir+"***", dir+"***"
+	}
+	return u.String()
+}
@@ -0,0 +1,153 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/live"
+	livemock "github.com/bililive-go/bililive-go/src/live/mock"
+	"github.com/bililive-go/bililive-go/src/pkg/parser"
+	"github.com/bililive-go/bililive-go/src/pkg/restream"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+var errRefused = errors.New("connection refused")
+
+type fakePusher struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+	fail bool
+}
+
+func (p *fakePusher) Write(b []byte) (int, error) {
+	if p.fail {
+		return 0, errRefused
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.buf.Write(b)
+}
+
+func (p *fakePusher) Close() error {
+	if p.fail {
+		return errRefused
+	}
+	return nil
+}
+
+func (p *fakePusher) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.buf.Len()
+}
+
+func TestRelay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backupBackoff, backupPusher := minBackoff, newPusher
+	defer func() { minBackoff, newPusher = backupBackoff, backupPusher }()
+	minBackoff = 10 * time.Millisecond
+	pushers := []*fakePusher{{fail: true}, {}}
+	var urls []string
+	newPusher = func(ctx context.Context, rawUrl string) (pusher, error) {
+		urls = append(urls, rawUrl)
+		p := pushers[0]
+		pushers = pushers[1:]
+		return p, nil
+	}
+	ok := pushers[1]
+
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetRawUrl().Return("https://live.bilibili.com/1").AnyTimes()
+	cfg := configs.NewConfig()
+	cfg.LiveRooms = []configs.LiveRoom{{
+		Url:   "https://live.bilibili.com/1",
+		Relay: &configs.Relay{Url: "rtmp://127.0.0.1/live/secret?token=1"},
+	}}
+	inst := &instance.Instance{
+		Config: cfg,
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+		Lives:  map[types.LiveID]live.Live{"test": l},
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, inst)
+	reg := restream.NewRegistry(ctx)
+	r := NewRelay(ctx)
+	assert.NoError(t, r.Start(ctx))
+	defer r.Close(ctx)
+
+	src := reg.Hub("test").NewSource()
+	src.WriteHeader([]byte{0x46, 0x4c, 0x56, 0x01, 5, 0, 0, 0, 9})
+	// 第一次推流失败，重试后推流成功
+	assert.Eventually(t, func() bool {
+		status := r.Status()
+		return len(status) == 1 && status[0].State == StatePushing && status[0].Retries == 1
+	}, time.Second, 5*time.Millisecond)
+	src.WriteTag(&parser.Tag{Type: 9, Timestamp: 0, Data: []byte{0x17, 1}, KeyFrame: true})
+	assert.Eventually(t, func() bool { return ok.Len() == 13+11+2+4 }, time.Second, 5*time.Millisecond)
+
+	status := r.Status()[0]
+	assert.Equal(t, types.LiveID("test"), status.LiveId)
+	assert.Equal(t, "rtmp://127.0.0.1/live/***", status.Url)
+	assert.Equal(t, errRefused.Error(), status.LastError)
+	assert.Equal(t, int64(13+11+2+4), status.BytesSent)
+	assert.Equal(t, []string{cfg.LiveRooms[0].Relay.Url, cfg.LiveRooms[0].Relay.Url}, urls)
+
+	// 录制场次结束时停止推流
+	reg.Remove("test")
+	assert.Eventually(t, func() bool { return len(r.Status()) == 0 }, time.Second, 5*time.Millisecond)
+}
+
+// stalledPusher 模拟卡住的 ffmpeg，写入一直阻塞到推流被结束
+type stalledPusher struct {
+	ctx context.Context
+}
+
+func (p stalledPusher) Write(b []byte) (int, error) {
+	<-p.ctx.Done()
+	return 0, p.ctx.Err()
+}
+
+func (p stalledPusher) Close() error {
+	return nil
+}
+
+func TestPushStalled(t *testing.T) {
+	backupTimeout, backupPusher := closeTimeout, newPusher
+	defer func() { closeTimeout, newPusher = backupTimeout, backupPusher }()
+	closeTimeout = 10 * time.Millisecond
+	newPusher = func(ctx context.Context, rawUrl string) (pusher, error) {
+		return stalledPusher{ctx: ctx}, nil
+	}
+
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{Config: configs.NewConfig()})
+	hub := restream.NewRegistry(ctx).Hub("test")
+	src := hub.NewSource()
+	src.WriteHeader([]byte{0x46, 0x4c, 0x56, 0x01, 5, 0, 0, 0, 9})
+	sub, err := hub.Subscribe()
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- new(relay).push(context.Background(), sub, "rtmp://127.0.0.1/live/secret", &roomStatus{})
+	}()
+	// 录制场次结束后即使写入阻塞也会结束推流
+	hub.Close()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, restream.ErrHubClosed)
+	case <-time.After(time.Second):
+		t.Fatal("push is still blocked after the hub is closed")
+	}
+}
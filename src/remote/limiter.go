@@ -0,0 +1,85 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// limiter 限制同一个目标所有上传的总带宽
+type limiter struct {
+	lock sync.Mutex
+	rate int64
+	next time.Time
+}
+
+var (
+	limitersLock sync.Mutex
+	limiters     = make(map[string]*limiter)
+)
+
+// getLimiter 返回目标共享的限速器，rate 为 0 时返回 nil
+func getLimiter(target string, rate int64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	limitersLock.Lock()
+	defer limitersLock.Unlock()
+	l, ok := limiters[target]
+	if !ok {
+		l = new(limiter)
+		limiters[target] = l
+	}
+	l.lock.Lock()
+	l.rate = rate
+	l.lock.Unlock()
+	return l
+}
+
+// wait 预留 n 字节的发送时间，在轮到自己之前阻塞
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.lock.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	l.lock.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *limiter
+}
+
+func newLimitedReader(ctx context.Context, r io.Reader, l *limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l}
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > 32<<10 {
+		p = p[:32<<10]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
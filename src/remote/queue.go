@@ -0,0 +1,74 @@
+package remote
+
+import (
+	"context"
+	"sync"
+)
+
+// queue 限制同时上传到同一个目标的文件数
+type queue struct {
+	lock    sync.Mutex
+	size    int
+	running int
+	wake    chan struct{}
+}
+
+var (
+	queuesLock sync.Mutex
+	queues     = make(map[string]*queue)
+)
+
+// getQueue 返回目标的上传队列，size 为 0 时为 1
+func getQueue(target string, size int) *queue {
+	if size <= 0 {
+		size = 1
+	}
+	queuesLock.Lock()
+	defer queuesLock.Unlock()
+	q, ok := queues[target]
+	if !ok {
+		q = &queue{wake: make(chan struct{})}
+		queues[target] = q
+	}
+	q.lock.Lock()
+	q.size = size
+	q.lock.Unlock()
+	return q
+}
+
+func (q *queue) tryAcquire() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.running >= q.size {
+		return false
+	}
+	q.running++
+	return true
+}
+
+func (q *queue) acquire(ctx context.Context) error {
+	for {
+		q.lock.Lock()
+		if q.running < q.size {
+			q.running++
+			q.lock.Unlock()
+			return nil
+		}
+		wake := q.wake
+		q.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+func (q *queue) release() {
+	q.lock.Lock()
+	q.running--
+	// 关闭 channel 唤醒所有等待者重新竞争
+	close(q.wake)
+	q.wake = make(chan struct{})
+	q.lock.Unlock()
+}
@@ -0,0 +1,109 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+)
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// for test
+var (
+	httpClient = http.DefaultClient
+	retryDelay = 5 * time.Second
+)
+
+const defaultRetries = 3
+
+// Logf 接收上传日志
+type Logf func(format string, args ...any)
+
+// Result 上传完成后的远程文件
+type Result struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag,omitempty"`
+}
+
+// Storage 是一种远程存储，Upload 需要能够在失败后重复调用，支持断点续传的协议应从上次中断的位置继续
+type Storage interface {
+	// Upload 将本地文件上传到 key，key 中的目录不存在时自动创建
+	Upload(ctx context.Context, path, key string, logf Logf) (*Result, error)
+}
+
+// options 是创建 Storage 所需的参数
+type options struct {
+	name        string
+	appDataPath string
+	storage     *configs.RemoteStorage
+	// limiter 由同一目标的所有上传共享，可能为 nil
+	limiter *limiter
+}
+
+type builder func(opts *options) (Storage, error)
+
+var builders = make(map[string]builder)
+
+// register 注册一种远程存储的实现，在 init 中调用
+func register(storageType string, b builder) {
+	builders[storageType] = b
+}
+
+// Upload 将本地文件上传到 remote_storages 中名为 target 的存储。
+// 同一目标的上传按 max_uploads 排队，失败后按 retries 重试
+func Upload(ctx context.Context, cfg *configs.Config, target, path, key string, logf Logf) (*Result, error) {
+	storage, ok := cfg.RemoteStorages[target]
+	if !ok {
+		return nil, fmt.Errorf("remote storage %q is not exist", target)
+	}
+	key = strings.TrimPrefix(filepath.ToSlash(key), "/")
+	if key == "" {
+		return nil, errors.New("remote key can not be empty")
+	}
+	b, ok := builders[storage.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown remote storage type %q", storage.Type)
+	}
+	s, err := b(&options{
+		name:        target,
+		appDataPath: cfg.AppDataPath,
+		storage:     &storage,
+		limiter:     getLimiter(target, storage.BandwidthLimit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q := getQueue(target, storage.MaxUploads)
+	if !q.tryAcquire() {
+		logf("waiting for other uploads to %s", target)
+		if err := q.acquire(ctx); err != nil {
+			return nil, err
+		}
+	}
+	defer q.release()
+
+	retries := defaultRetries
+	if storage.Retries != nil {
+		retries = *storage.Retries
+	}
+	for attempt := 0; ; attempt++ {
+		result, err := s.Upload(ctx, path, key, logf)
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			return result, err
+		}
+		logf("failed to upload %s to %s, retry later: %v", path, target, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryDelay * time.Duration(attempt+1)):
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+)
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3Client 实现上传所需的 S3 接口，使用 AWS Signature Version 4 签名
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+}
+
+func newS3Client(cfg *configs.RemoteStorage) (*s3Client, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &s3Client{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		pathStyle: cfg.PathStyle,
+	}, nil
+}
+
+// s3Error 是 S3 返回的错误
+type s3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func isNoSuchUpload(err error) bool {
+	var e *s3Error
+	return errors.As(err, &e) && e.Code == "NoSuchUpload"
+}
+
+func (c *s3Client) objectUrl(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	path := "/" + strings.TrimPrefix(key, "/")
+	if c.pathStyle {
+		path = "/" + c.bucket + path
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(c.endpoint.Path, "/") + path
+	// 使用与签名相同的编码，避免 net/url 保留部分字符导致签名不一致
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = encodeQuery(query)
+	return &u
+}
+
+// do 发送请求，body 为 nil 时 payloadHash 为空字符串的哈希
+func (c *s3Client) do(ctx context.Context, method, key string, query url.Values, header http.Header, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectUrl(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c.sign(req, payloadHash, time.Now())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		e := &s3Error{StatusCode: resp.StatusCode}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if xml.Unmarshal(b, e) != nil || e.Code == "" {
+			e.Message = strings.TrimSpace(string(b))
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+func hashHex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath 按 S3 的要求编码路径，保留 /
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	return strings.Join(segments, "/")
+}
+
+func encodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, escapePath(k)+"="+escapePath(query.Get(k)))
+	}
+	return strings.Join(params, "&")
+}
+
+func base64MD5(sum []byte) string {
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+func (c *s3Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host"}
+	canonicalHeaders := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-md5" || lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			signedHeaders = append(signedHeaders, lk)
+			canonicalHeaders[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	sort.Strings(signedHeaders)
+	var headers strings.Builder
+	for _, h := range signedHeaders {
+		headers.WriteString(h + ":" + canonicalHeaders[h] + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		encodeQuery(req.URL.Query()),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func (c *s3Client) putObject(ctx context.Context, key string, body io.Reader, size int64, md5 []byte) (string, error) {
+	header := http.Header{}
+	header.Set("Content-MD5", base64MD5(md5))
+	resp, err := c.do(ctx, http.MethodPut, key, nil, header, body, size, unsignedPayload)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+func (c *s3Client) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil, 0, hashHex(nil))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadId string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.UploadId == "" {
+		return "", fmt.Errorf("s3: empty upload id")
+	}
+	return result.UploadId, nil
+}
+
+func (c *s3Client) uploadPart(ctx context.Context, key, uploadId string, number int, body io.Reader, size int64, md5 []byte) (string, error) {
+	query := url.Values{
+		"partNumber": {fmt.Sprint(number)},
+		"uploadId":   {uploadId},
+	}
+	header := http.Header{}
+	header.Set("Content-MD5", base64MD5(md5))
+	resp, err := c.do(ctx, http.MethodPut, key, query, header, body, size, unsignedPayload)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *s3Client) completeMultipartUpload(ctx context.Context, key, uploadId string, parts []completedPart) (string, error) {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadId}}, nil,
+		bytes.NewReader(body), int64(len(body)), hashHex(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	// 完成请求即使返回 200 也可能在响应中包含错误
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.Unmarshal(b, &result); err != nil {
+		return "", err
+	}
+	if result.XMLName.Local == "Error" {
+		return "", &s3Error{StatusCode: resp.StatusCode, Code: result.Code, Message: result.Message}
+	}
+	return strings.Trim(result.ETag, `"`), nil
+}
+
+func (c *s3Client) abortMultipartUpload(ctx context.Context, key, uploadId string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadId}}, nil, nil, 0, hashHex(nil))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
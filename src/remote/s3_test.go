@@ -0,0 +1,196 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+)
+
+// fakeS3 实现 path style 的 PutObject 与分片上传
+type fakeS3 struct {
+	sync.Mutex
+	t        *testing.T
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	partPuts int
+	// failPart 大于 0 时该分片第一次上传失败
+	failPart int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	return &fakeS3{t: t, objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+}
+
+func writeS3Error(w http.ResponseWriter, code int, s3Code string) {
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", s3Code, s3Code)
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	assert.True(s.t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ak/"))
+	assert.Equal(s.t, escapePath(r.URL.Path), r.URL.EscapedPath())
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	if digest := r.Header.Get("Content-MD5"); digest != "" {
+		sum := md5.Sum(body)
+		if digest != base64.StdEncoding.EncodeToString(sum[:]) {
+			writeS3Error(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+	}
+	etag := func(b []byte) {
+		sum := md5.Sum(b)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	}
+	switch {
+	case r.Method == http.MethodPut && !query.Has("uploadId"):
+		s.objects[key] = body
+		etag(body)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut:
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		if number == s.failPart {
+			s.failPart = 0
+			writeS3Error(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+		s.partPuts++
+		parts[number] = body
+		etag(body)
+	case r.Method == http.MethodPost:
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var req struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		assert.NoError(s.t, xml.Unmarshal(body, &req))
+		var data, sums []byte
+		for _, part := range req.Parts {
+			data = append(data, parts[part.PartNumber]...)
+			sum := md5.Sum(parts[part.PartNumber])
+			sums = append(sums, sum[:]...)
+		}
+		s.objects[key] = data
+		delete(s.uploads, query.Get("uploadId"))
+		sum := md5.Sum(sums)
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><ETag>"%x-%d"</ETag></CompleteMultipartUploadResult>`, sum, len(req.Parts))
+	case r.Method == http.MethodDelete:
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestUploadS3(t *testing.T) {
+	backup := retryDelay
+	retryDelay = 0
+	defer func() { retryDelay = backup }()
+	fake := newFakeS3(t)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := &configs.Config{
+		AppDataPath: dir,
+		RemoteStorages: map[string]configs.RemoteStorage{
+			"minio": {
+				Type:        configs.RemoteStorageS3,
+				Endpoint:    server.URL,
+				Bucket:      "bucket",
+				AccessKey:   "ak",
+				SecretKey:   "sk",
+				PathStyle:   true,
+				PartSize:    1024,
+				Concurrency: 2,
+			},
+		},
+	}
+	logf := func(format string, args ...any) {}
+
+	small := filepath.Join(dir, "small.flv")
+	assert.NoError(t, os.WriteFile(small, []byte("hello"), 0644))
+	key := "平台/主播 a+b/small.flv"
+	result, err := Upload(context.Background(), cfg, "minio", small, key, logf)
+	assert.NoError(t, err)
+	assert.Equal(t, key, result.Key)
+	assert.Equal(t, []byte("hello"), fake.objects[key])
+
+	// 分片上传失败后重试，只上传失败及之后的分片
+	data := bytes.Repeat([]byte("0123456789"), 500)
+	large := filepath.Join(dir, "large.flv")
+	assert.NoError(t, os.WriteFile(large, data, 0644))
+	cfg.RemoteStorages["minio"] = func(s configs.RemoteStorage) configs.RemoteStorage {
+		s.Concurrency = 1
+		return s
+	}(cfg.RemoteStorages["minio"])
+	fake.failPart = 3
+	result, err = Upload(context.Background(), cfg, "minio", large, "large.flv", logf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, fake.partPuts)
+	assert.Equal(t, data, fake.objects["large.flv"])
+	assert.True(t, strings.HasSuffix(result.ETag, "-5"))
+	entries, _ := os.ReadDir(filepath.Join(dir, "uploads"))
+	assert.Empty(t, entries)
+
+	// 服务端已经没有之前的分片上传时重新开始
+	stat, _ := os.Stat(large)
+	state := newStateFile(dir, "minio", "large2.flv")
+	assert.NoError(t, state.save(&uploadState{
+		Path:     large,
+		Size:     stat.Size(),
+		ModTime:  stat.ModTime(),
+		PartSize: 1024,
+		UploadId: "lost",
+		Parts:    map[int]partMD5{1: {}},
+	}))
+	_, err = Upload(context.Background(), cfg, "minio", large, "large2.flv", logf)
+	assert.NoError(t, err)
+	assert.Equal(t, data, fake.objects["large2.flv"])
+
+	_, err = Upload(context.Background(), cfg, "unknown", large, "large.flv", logf)
+	assert.Error(t, err)
+}
+
+func TestLimiter(t *testing.T) {
+	l := getLimiter("test", 100<<10)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, newLimitedReader(context.Background(), bytes.NewReader(make([]byte, 50<<10)), l))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50<<10), n)
+	// 第一次读取 32KiB 不等待，第二次读取需要等待约 320ms
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	assert.Nil(t, getLimiter("test", 0))
+}
@@ -0,0 +1,307 @@
+package remote
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+)
+
+const (
+	defaultPartSize    = 16 << 20
+	defaultConcurrency = 4
+)
+
+func init() {
+	register(configs.RemoteStorageS3, newS3Storage)
+}
+
+// uploadState 记录未完成的分片上传，任务重试时跳过已上传的分片
+type uploadState struct {
+	Path     string          `json:"path"`
+	Size     int64           `json:"size"`
+	ModTime  time.Time       `json:"mod_time"`
+	PartSize int64           `json:"part_size"`
+	UploadId string          `json:"upload_id"`
+	Parts    map[int]partMD5 `json:"parts"`
+}
+
+type partMD5 struct {
+	ETag string `json:"etag"`
+	MD5  string `json:"md5"`
+}
+
+// stateFile 保存在 AppDataPath/uploads 目录，文件名为目标与远程路径的哈希
+type stateFile string
+
+func newStateFile(appDataPath, target, key string) stateFile {
+	if appDataPath == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(target + "\n" + key))
+	return stateFile(filepath.Join(appDataPath, "uploads", hex.EncodeToString(sum[:16])+".json"))
+}
+
+func (f stateFile) load() *uploadState {
+	if f == "" {
+		return nil
+	}
+	b, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil
+	}
+	s := new(uploadState)
+	if json.Unmarshal(b, s) != nil {
+		return nil
+	}
+	return s
+}
+
+func (f stateFile) save(s *uploadState) error {
+	if f == "" {
+		return nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(string(f)), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := string(f) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(f))
+}
+
+func (f stateFile) remove() {
+	if f != "" {
+		os.Remove(string(f))
+	}
+}
+
+// s3Storage 小于 part_size 的文件直接上传，其他文件使用分片上传
+type s3Storage struct {
+	client *s3Client
+	opts   *options
+}
+
+func newS3Storage(opts *options) (Storage, error) {
+	client, err := newS3Client(opts.storage)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Storage{client: client, opts: opts}, nil
+}
+
+// s3Upload 是一次文件上传
+type s3Upload struct {
+	*s3Storage
+	state stateFile
+	logf  Logf
+}
+
+func (s *s3Storage) partSize() int64 {
+	if s.opts.storage.PartSize > 0 {
+		return s.opts.storage.PartSize
+	}
+	return defaultPartSize
+}
+
+func (s *s3Storage) Upload(ctx context.Context, path, key string, logf Logf) (*Result, error) {
+	u := &s3Upload{
+		s3Storage: s,
+		state:     newStateFile(s.opts.appDataPath, s.opts.name, key),
+		logf:      logf,
+	}
+	return u.upload(ctx, path, key)
+}
+
+func (u *s3Upload) upload(ctx context.Context, path, key string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() <= u.partSize() {
+		return u.putObject(ctx, f, stat.Size(), key)
+	}
+	return u.multipart(ctx, f, stat, path, key)
+}
+
+func fileMD5(r io.Reader) ([]byte, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (u *s3Upload) putObject(ctx context.Context, f *os.File, size int64, key string) (*Result, error) {
+	sum, err := fileMD5(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	body := newLimitedReader(ctx, io.NewSectionReader(f, 0, size), u.opts.limiter)
+	etag, err := u.client.putObject(ctx, key, body, size, sum)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" && !strings.Contains(etag, "-") && etag != hex.EncodeToString(sum) {
+		return nil, fmt.Errorf("%w: local md5 %x, remote etag %s", ErrChecksumMismatch, sum, etag)
+	}
+	return &Result{Key: key, Size: size, ETag: etag}, nil
+}
+
+func (u *s3Upload) multipart(ctx context.Context, f *os.File, stat os.FileInfo, path, key string) (*Result, error) {
+	partSize := u.partSize()
+	count := int((stat.Size() + partSize - 1) / partSize)
+	state := u.state.load()
+	if state != nil && (state.Path != path || state.Size != stat.Size() || !state.ModTime.Equal(stat.ModTime()) || state.PartSize != partSize) {
+		// 文件或分片大小变化后不能继续之前的上传
+		u.client.abortMultipartUpload(ctx, key, state.UploadId)
+		state = nil
+	}
+	if state == nil {
+		uploadId, err := u.client.createMultipartUpload(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		state = &uploadState{
+			Path:     path,
+			Size:     stat.Size(),
+			ModTime:  stat.ModTime(),
+			PartSize: partSize,
+			UploadId: uploadId,
+			Parts:    make(map[int]partMD5),
+		}
+		if err := u.state.save(state); err != nil {
+			return nil, err
+		}
+	} else {
+		u.logf("resume multipart upload of %s, %d/%d parts uploaded", path, len(state.Parts), count)
+	}
+
+	var (
+		lock     sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		numbers  = make(chan int)
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	concurrency := u.opts.storage.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				part, err := u.uploadPart(ctx, f, stat.Size(), key, state.UploadId, number)
+				lock.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("part %d: %w", number, err)
+						cancel()
+					}
+				} else {
+					state.Parts[number] = part
+					err = u.state.save(state)
+				}
+				lock.Unlock()
+				if err == nil {
+					u.logf("uploaded part %d/%d of %s", number, count, path)
+				}
+			}
+		}()
+	}
+feed:
+	for number := 1; number <= count; number++ {
+		lock.Lock()
+		_, done := state.Parts[number]
+		lock.Unlock()
+		if done {
+			continue
+		}
+		select {
+		case numbers <- number:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(numbers)
+	wg.Wait()
+	if firstErr != nil {
+		if isNoSuchUpload(firstErr) {
+			u.state.remove()
+		}
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	parts := make([]completedPart, 0, count)
+	sums := make([]byte, 0, count*md5.Size)
+	for number, part := range state.Parts {
+		parts = append(parts, completedPart{PartNumber: number, ETag: `"` + part.ETag + `"`})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	for _, part := range parts {
+		sum, _ := hex.DecodeString(state.Parts[part.PartNumber].MD5)
+		sums = append(sums, sum...)
+	}
+	etag, err := u.client.completeMultipartUpload(ctx, key, state.UploadId, parts)
+	if err != nil {
+		if isNoSuchUpload(err) {
+			u.state.remove()
+		}
+		return nil, err
+	}
+	u.state.remove()
+	// 分片上传的 ETag 为各分片 md5 拼接后的 md5 加上分片数
+	sum := md5.Sum(sums)
+	if expected := fmt.Sprintf("%x-%d", sum, count); etag != "" && etag != expected {
+		return nil, fmt.Errorf("%w: expected etag %s, remote etag %s", ErrChecksumMismatch, expected, etag)
+	}
+	return &Result{Key: key, Size: stat.Size(), ETag: etag}, nil
+}
+
+func (u *s3Upload) uploadPart(ctx context.Context, f *os.File, fileSize int64, key, uploadId string, number int) (partMD5, error) {
+	offset := int64(number-1) * u.partSize()
+	size := u.partSize()
+	if offset+size > fileSize {
+		size = fileSize - offset
+	}
+	sum, err := fileMD5(io.NewSectionReader(f, offset, size))
+	if err != nil {
+		return partMD5{}, err
+	}
+	body := newLimitedReader(ctx, io.NewSectionReader(f, offset, size), u.opts.limiter)
+	etag, err := u.client.uploadPart(ctx, key, uploadId, number, body, size, sum)
+	if err != nil {
+		return partMD5{}, err
+	}
+	if etag != "" && etag != hex.EncodeToString(sum) {
+		return partMD5{}, fmt.Errorf("%w: local md5 %x, remote etag %s", ErrChecksumMismatch, sum, etag)
+	}
+	return partMD5{ETag: etag, MD5: hex.EncodeToString(sum)}, nil
+}
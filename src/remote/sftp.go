@@ -0,0 +1,139 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+)
+
+func init() {
+	register(configs.RemoteStorageSFTP, newSFTPStorage)
+}
+
+// 建立 SSH 连接与握手的超时时间，避免服务器无响应时一直阻塞上传
+const sftpDialTimeout = 30 * time.Second
+
+func dialSFTP(cfg *configs.RemoteStorage) (*sftp.Client, error) {
+	auths := make([]ssh.AuthMethod, 0, 2)
+	if cfg.PrivateKey != "" {
+		b, err := os.ReadFile(cfg.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auths = append(auths, ssh.Password(cfg.Password))
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host_key: %w", err)
+	}
+	conn, err := ssh.Dial("tcp", cfg.Host, &ssh.ClientConfig{
+		User:            cfg.Username,
+		Auth:            auths,
+		HostKeyCallback: ssh.FixedHostKey(key),
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// sftpStorage 先写入 .part 文件，重试时从 .part 文件的大小继续写入，完成后重命名为目标文件
+type sftpStorage struct {
+	opts *options
+}
+
+func newSFTPStorage(opts *options) (Storage, error) {
+	return &sftpStorage{opts: opts}, nil
+}
+
+func (s *sftpStorage) Upload(ctx context.Context, local, key string, logf Logf) (*Result, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	c, err := dialSFTP(s.opts.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	// 取消时关闭连接，中断正在等待服务器响应的请求
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	target := path.Join(s.opts.storage.Dir, key)
+	if err := c.MkdirAll(path.Dir(target)); err != nil {
+		return nil, err
+	}
+	part := target + ".part"
+	var offset int64
+	if info, err := c.Stat(part); err == nil && info.Size() <= stat.Size() {
+		offset = info.Size()
+		logf("resume uploading %s from %d bytes", local, offset)
+	}
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	remote, err := c.OpenFile(part, flags)
+	if err != nil {
+		return nil, err
+	}
+	_, writeErr := remote.Seek(offset, io.SeekStart)
+	if writeErr == nil {
+		_, writeErr = io.Copy(remote, newLimitedReader(ctx, io.NewSectionReader(f, offset, stat.Size()-offset), s.opts.limiter))
+	}
+	if err := remote.Close(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, writeErr
+	}
+
+	info, err := c.Stat(part)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != stat.Size() {
+		// 大小不一致时删除，下次重新上传
+		c.Remove(part)
+		return nil, fmt.Errorf("%w: local size %d, remote size %d", ErrChecksumMismatch, stat.Size(), info.Size())
+	}
+	// SFTP v3 的 rename 在目标存在时失败
+	if err := c.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := c.Rename(part, target); err != nil {
+		return nil, err
+	}
+	return &Result{Key: target, Size: info.Size()}, nil
+}
@@ -0,0 +1,132 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+)
+
+// fakeSFTP 是使用本地文件系统的 SFTP 服务端
+type fakeSFTP struct{}
+
+func (s *fakeSFTP) listen(t *testing.T) (string, ssh.PublicKey) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(private)
+	assert.NoError(t, err)
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "user" && string(password) == "pass" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	cfg.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(conn, cfg)
+		}
+	}()
+	return l.Addr().String(), signer.PublicKey()
+}
+
+func (s *fakeSFTP) serveConn(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go func() {
+						defer channel.Close()
+						if server, err := sftp.NewServer(channel); err == nil {
+							server.Serve()
+						}
+					}()
+				}
+			}
+		}()
+	}
+}
+
+func TestUploadSFTP(t *testing.T) {
+	addr, hostKey := new(fakeSFTP).listen(t)
+
+	dir := t.TempDir()
+	root := filepath.Join(t.TempDir(), "backup")
+	cfg := &configs.Config{
+		AppDataPath: dir,
+		RemoteStorages: map[string]configs.RemoteStorage{
+			"server": {
+				Type:     configs.RemoteStorageSFTP,
+				Host:     addr,
+				Dir:      filepath.ToSlash(root),
+				Username: "user",
+				Password: "pass",
+				HostKey:  string(ssh.MarshalAuthorizedKey(hostKey)),
+			},
+		},
+	}
+	logf := func(format string, args ...any) {}
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	file := filepath.Join(dir, "a.flv")
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	key := "平台/主播/a.flv"
+	result, err := Upload(context.Background(), cfg, "server", file, key, logf)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.ToSlash(root)+"/"+key, result.Key)
+	b, err := os.ReadFile(filepath.Join(root, key))
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+
+	// 从上次中断时留下的 .part 文件继续上传（保留已上传的部分），并覆盖已存在的文件
+	part := filepath.Join(root, key+".part")
+	uploaded := make([]byte, 40000)
+	assert.NoError(t, os.WriteFile(part, uploaded, 0644))
+	_, err = Upload(context.Background(), cfg, "server", file, key, logf)
+	assert.NoError(t, err)
+	b, err = os.ReadFile(filepath.Join(root, key))
+	assert.NoError(t, err)
+	assert.Equal(t, append(uploaded, data[40000:]...), b)
+	assert.NoFileExists(t, part)
+
+	// 主机密钥不匹配时拒绝连接
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	otherKey, err := ssh.NewPublicKey(other)
+	assert.NoError(t, err)
+	storage := cfg.RemoteStorages["server"]
+	storage.HostKey = string(ssh.MarshalAuthorizedKey(otherKey))
+	_, err = (&sftpStorage{opts: &options{storage: &storage}}).Upload(context.Background(), file, "b.flv", logf)
+	assert.Error(t, err)
+}
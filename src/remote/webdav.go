@@ -0,0 +1,122 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+)
+
+func init() {
+	register(configs.RemoteStorageWebDAV, newWebDAVStorage)
+}
+
+// webdavStorage 先上传为 .part 文件，完成后再移动到目标路径，避免留下不完整的文件。
+// WebDAV 没有通用的断点续传方式，失败后会重新上传整个文件
+type webdavStorage struct {
+	base *url.URL
+	opts *options
+}
+
+func newWebDAVStorage(opts *options) (Storage, error) {
+	base, err := url.Parse(opts.storage.Url)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid webdav url %q", opts.storage.Url)
+	}
+	return &webdavStorage{base: base, opts: opts}, nil
+}
+
+func (s *webdavStorage) url(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.TrimSuffix(s.base.String(), "/") + "/" + strings.Join(segments, "/")
+}
+
+func (s *webdavStorage) do(ctx context.Context, method, key string, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url(key), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if s.opts.storage.Username != "" {
+		req.SetBasicAuth(s.opts.storage.Username, s.opts.storage.Password)
+	}
+	return httpClient.Do(req)
+}
+
+func webdavError(method, key string, resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("webdav: %s %s: unexpected status code %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(b)))
+}
+
+// mkdirAll 逐级创建 key 所在的目录，已存在的目录返回 405
+func (s *webdavStorage) mkdirAll(ctx context.Context, key string) error {
+	dirs := strings.Split(path.Dir(key), "/")
+	for i := range dirs {
+		if dirs[i] == "." || dirs[i] == "" {
+			continue
+		}
+		dir := strings.Join(dirs[:i+1], "/") + "/"
+		resp, err := s.do(ctx, "MKCOL", dir, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return webdavError("MKCOL", dir, resp)
+		}
+	}
+	return nil
+}
+
+func (s *webdavStorage) Upload(ctx context.Context, local, key string, logf Logf) (*Result, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mkdirAll(ctx, key); err != nil {
+		return nil, err
+	}
+
+	part := key + ".part"
+	resp, err := s.do(ctx, http.MethodPut, part, nil, newLimitedReader(ctx, f, s.opts.limiter), stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, webdavError(http.MethodPut, part, resp)
+	}
+
+	header := http.Header{}
+	header.Set("Destination", s.url(key))
+	header.Set("Overwrite", "T")
+	resp, err = s.do(ctx, "MOVE", part, header, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, webdavError("MOVE", part, resp)
+	}
+	return &Result{Key: key, Size: stat.Size()}, nil
+}
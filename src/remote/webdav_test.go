@@ -0,0 +1,148 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+)
+
+// fakeWebDAV 实现上传所需的 MKCOL、PUT 与 MOVE
+type fakeWebDAV struct {
+	sync.Mutex
+	t     *testing.T
+	dirs  map[string]bool
+	files map[string][]byte
+	// failPut 大于 0 时前几次 PUT 失败
+	failPut int
+}
+
+func (s *fakeWebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/dav")
+	switch r.Method {
+	case "MKCOL":
+		name = strings.TrimSuffix(name, "/")
+		if s.dirs[name] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.dirs[path.Dir(name)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.dirs[name] = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		if !s.dirs[path.Dir(name)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if s.failPut > 0 {
+			s.failPut--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.files[name] = body
+		w.WriteHeader(http.StatusCreated)
+	case "MOVE":
+		dest, err := url.Parse(r.Header.Get("Destination"))
+		assert.NoError(s.t, err)
+		assert.Equal(s.t, "T", r.Header.Get("Overwrite"))
+		b, ok := s.files[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.files, name)
+		s.files[strings.TrimPrefix(dest.Path, "/dav")] = b
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestUploadWebDAV(t *testing.T) {
+	backup := retryDelay
+	retryDelay = 0
+	defer func() { retryDelay = backup }()
+	fake := &fakeWebDAV{t: t, dirs: map[string]bool{"/": true}, files: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := &configs.Config{
+		AppDataPath: dir,
+		RemoteStorages: map[string]configs.RemoteStorage{
+			"nas": {
+				Type:     configs.RemoteStorageWebDAV,
+				Url:      server.URL + "/dav/",
+				Username: "user",
+				Password: "pass",
+			},
+		},
+	}
+	logf := func(format string, args ...any) {}
+
+	file := filepath.Join(dir, "a.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("hello"), 0644))
+	key := "平台/主播 a+b/a.flv"
+	fake.failPut = 1
+	result, err := Upload(context.Background(), cfg, "nas", file, key, logf)
+	assert.NoError(t, err)
+	assert.Equal(t, key, result.Key)
+	assert.Equal(t, int64(5), result.Size)
+	assert.Equal(t, map[string][]byte{"/" + key: []byte("hello")}, fake.files)
+
+	// 超过重试次数后返回错误
+	fake.failPut = 10
+	_, err = Upload(context.Background(), cfg, "nas", file, "b.flv", logf)
+	assert.Error(t, err)
+
+	// retries 为 0 时不重试
+	noRetries := 0
+	storage := cfg.RemoteStorages["nas"]
+	storage.Retries = &noRetries
+	cfg.RemoteStorages["nas"] = storage
+	fake.failPut = 1
+	_, err = Upload(context.Background(), cfg, "nas", file, "c.flv", logf)
+	assert.Error(t, err)
+	assert.Equal(t, 0, fake.failPut)
+}
+
+func TestQueue(t *testing.T) {
+	q := getQueue("test", 1)
+	assert.True(t, q.tryAcquire())
+	assert.False(t, q.tryAcquire())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, q.acquire(ctx), context.Canceled)
+
+	acquired := make(chan struct{})
+	go func() {
+		assert.NoError(t, q.acquire(context.Background()))
+		close(acquired)
+	}()
+	q.release()
+	<-acquired
+	q.release()
+	assert.True(t, q.tryAcquire())
+	q.release()
+}
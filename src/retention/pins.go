@@ -0,0 +1,79 @@
+package retention
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// pinStore 记录不会被清理的文件，保存在 AppDataPath/retention/pins.json
+type pinStore struct {
+	lock sync.Mutex
+	file string
+	pins map[string]bool
+}
+
+func newPinStore(appDataPath string) *pinStore {
+	st := &pinStore{pins: make(map[string]bool)}
+	if appDataPath == "" {
+		return st
+	}
+	st.file = filepath.Join(appDataPath, "retention", "pins.json")
+	if b, err := os.ReadFile(st.file); err == nil {
+		var pins []string
+		if json.Unmarshal(b, &pins) == nil {
+			for _, pin := range pins {
+				st.pins[pin] = true
+			}
+		}
+	}
+	return st
+}
+
+func (st *pinStore) list() []string {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	pins := make([]string, 0, len(st.pins))
+	for pin := range st.pins {
+		pins = append(pins, pin)
+	}
+	sort.Strings(pins)
+	return pins
+}
+
+func (st *pinStore) has(path string) bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.pins[path]
+}
+
+func (st *pinStore) set(path string, pinned bool) error {
+	st.lock.Lock()
+	if pinned {
+		st.pins[path] = true
+	} else {
+		delete(st.pins, path)
+	}
+	st.lock.Unlock()
+	return st.save()
+}
+
+func (st *pinStore) save() error {
+	if st.file == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(st.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(st.file), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := st.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.file)
+}
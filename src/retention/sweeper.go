@@ -0,0 +1,359 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/jobs"
+	"github.com/bililive-go/bililive-go/src/recorders"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+var ErrSweeping = errors.New("retention sweep is already running")
+
+// 文件被清理的原因
+const (
+	ReasonMaxAge          = "max_age"
+	ReasonKeepSessions    = "keep_sessions"
+	ReasonMaxRoomSize     = "max_room_size"
+	ReasonMaxPlatformSize = "max_platform_size"
+)
+
+// Deletion 一个将被或已被删除的文件
+type Deletion struct {
+	Path      string       `json:"path"`
+	Size      int64        `json:"size"`
+	SessionId string       `json:"session_id"`
+	LiveId    types.LiveID `json:"live_id"`
+	Platform  string       `json:"platform"`
+	Reason    string       `json:"reason"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// Report 一次清理的结果，DryRun 为 true 时没有删除任何文件
+type Report struct {
+	Time      time.Time   `json:"time"`
+	DryRun    bool        `json:"dry_run"`
+	Deletions []*Deletion `json:"deletions"`
+	// Freed 实际删除（预览时为将要删除）的文件总大小
+	Freed int64 `json:"freed"`
+}
+
+type Sweeper interface {
+	interfaces.Module
+	// Preview 返回按当前规则将会删除的文件，不删除任何文件
+	Preview(ctx context.Context) (*Report, error)
+	Sweep(ctx context.Context) (*Report, error)
+	// LastReport 返回最近一次实际清理的结果，还没有清理过时返回 nil
+	LastReport() *Report
+	GetPins() []string
+	// Pin 设置文件是否固定，固定的文件及其附属文件不会被清理
+	Pin(path string, pinned bool) error
+}
+
+func NewSweeper(ctx context.Context) Sweeper {
+	inst := instance.GetInstance(ctx)
+	s := &sweeper{
+		inst: inst,
+		pins: newPinStore(inst.Config.AppDataPath),
+	}
+	inst.RetentionSweeper = s
+	return s
+}
+
+type sweeper struct {
+	inst     *instance.Instance
+	pins     *pinStore
+	sweeping sync.Mutex
+
+	lock sync.Mutex
+	last *Report
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Start 在第一个检查间隔之后开始清理，给录制器与后处理任务恢复的时间
+func (s *sweeper) Start(ctx context.Context) error {
+	if !s.inst.Config.Retention.Enable {
+		return nil
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			interval := s.inst.Config.Retention.CheckInterval
+			if interval < time.Minute {
+				interval = time.Minute
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+				if _, err := s.Sweep(ctx); err != nil {
+					s.inst.Logger.WithError(err).Error("failed to sweep recorded files")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *sweeper) Close(ctx context.Context) {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *sweeper) GetPins() []string {
+	return s.pins.list()
+}
+
+func (s *sweeper) Pin(path string, pinned bool) error {
+	return s.pins.set(absPath(path), pinned)
+}
+
+func (s *sweeper) LastReport() *Report {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.last
+}
+
+func (s *sweeper) Preview(ctx context.Context) (*Report, error) {
+	deletions, err := s.plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Time: time.Now(), DryRun: true, Deletions: deletions}
+	for _, d := range deletions {
+		report.Freed += d.Size
+	}
+	return report, nil
+}
+
+func (s *sweeper) Sweep(ctx context.Context) (*Report, error) {
+	if !s.sweeping.TryLock() {
+		return nil, ErrSweeping
+	}
+	defer s.sweeping.Unlock()
+	deletions, err := s.plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Time: time.Now(), Deletions: deletions}
+	for _, d := range deletions {
+		if err := os.Remove(d.Path); err != nil && !os.IsNotExist(err) {
+			d.Error = err.Error()
+			s.inst.Logger.WithError(err).Errorf("retention: failed to remove %s", d.Path)
+			continue
+		}
+		report.Freed += d.Size
+		s.inst.Logger.Infof("retention: removed %s (%d bytes, session %s, %s)", d.Path, d.Size, d.SessionId, d.Reason)
+	}
+	s.lock.Lock()
+	s.last = report
+	s.lock.Unlock()
+	return report, nil
+}
+
+type file struct {
+	path      string
+	size      int64
+	protected bool
+}
+
+type candidate struct {
+	session *recorders.Session
+	files   []*file
+	// remain 清理后仍会保留的文件大小
+	remain int64
+	reason string
+}
+
+func (c *candidate) mark(reason string) {
+	if c.reason != "" {
+		return
+	}
+	c.reason = reason
+	c.remain = 0
+	for _, f := range c.files {
+		if f.protected {
+			c.remain += f.size
+		}
+	}
+}
+
+// plan 按场次计算需要删除的文件，进行中的场次、正在后处理、固定的以及太新的文件不会被删除
+func (s *sweeper) plan(ctx context.Context) ([]*Deletion, error) {
+	rm, ok := s.inst.RecorderManager.(recorders.Manager)
+	if !ok {
+		return nil, errors.New("recorder manager is not ready")
+	}
+	sessions, err := rm.GetSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	busy := s.busyFiles(ctx)
+	cfg := s.inst.Config
+	now := time.Now()
+
+	rooms := make(map[types.LiveID][]*candidate)
+	// sessions 按开始时间倒序排列
+	all := make([]*candidate, 0, len(sessions))
+	seen := make(map[string]bool)
+	for _, session := range sessions {
+		if session.EndTime.IsZero() {
+			continue
+		}
+		rule := s.rule(session.LiveId)
+		c := &candidate{session: session}
+		for _, seg := range session.Segments {
+			// 固定或正在后处理的文件连同其附属文件一起保留
+			group := segmentFiles(seg.File)
+			keep := busy[absPath(seg.File)]
+			for _, f := range group {
+				keep = keep || s.pins.has(f.path) || busy[f.path]
+			}
+			for _, f := range group {
+				if seen[f.path] {
+					continue
+				}
+				seen[f.path] = true
+				protected := keep || now.Sub(f.modTime) < rule.MinAge
+				c.files = append(c.files, &file{path: f.path, size: f.size, protected: protected})
+				c.remain += f.size
+			}
+		}
+		if len(c.files) == 0 {
+			continue
+		}
+		rooms[session.LiveId] = append(rooms[session.LiveId], c)
+		all = append(all, c)
+	}
+
+	for liveId, candidates := range rooms {
+		rule := s.rule(liveId)
+		var total int64
+		for i, c := range candidates {
+			if rule.KeepSessions > 0 && i >= rule.KeepSessions {
+				c.mark(ReasonKeepSessions)
+			}
+			if rule.MaxAge > 0 && now.Sub(c.session.EndTime) > rule.MaxAge {
+				c.mark(ReasonMaxAge)
+			}
+			if rule.MaxRoomSize > 0 && total+c.remain > rule.MaxRoomSize {
+				c.mark(ReasonMaxRoomSize)
+			}
+			total += c.remain
+		}
+	}
+	if max := cfg.Retention.MaxPlatformSize; max > 0 {
+		totals := make(map[string]int64)
+		for _, c := range all {
+			platform := c.session.Platform
+			if totals[platform]+c.remain > max {
+				c.mark(ReasonMaxPlatformSize)
+			}
+			totals[platform] += c.remain
+		}
+	}
+
+	deletions := make([]*Deletion, 0)
+	for _, c := range all {
+		if c.reason == "" {
+			continue
+		}
+		for _, f := range c.files {
+			if f.protected {
+				continue
+			}
+			deletions = append(deletions, &Deletion{
+				Path:      f.path,
+				Size:      f.size,
+				SessionId: c.session.Id,
+				LiveId:    c.session.LiveId,
+				Platform:  c.session.Platform,
+				Reason:    c.reason,
+			})
+		}
+	}
+	return deletions, nil
+}
+
+func (s *sweeper) rule(liveId types.LiveID) configs.RetentionRule {
+	if l, ok := s.inst.Lives[liveId]; ok {
+		return s.inst.Config.GetRetentionRule(l.GetRawUrl())
+	}
+	return s.inst.Config.Retention.RetentionRule
+}
+
+// busyFiles 返回等待或正在后处理的文件
+func (s *sweeper) busyFiles(ctx context.Context) map[string]bool {
+	busy := make(map[string]bool)
+	jm, ok := s.inst.JobManager.(jobs.Manager)
+	if !ok {
+		return busy
+	}
+	for _, job := range jm.GetJobs(ctx) {
+		if job.State != jobs.StatePending && job.State != jobs.StateRunning {
+			continue
+		}
+		for _, path := range recorders.PostProcessFiles(job) {
+			busy[absPath(path)] = true
+		}
+	}
+	return busy
+}
+
+type fileInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// segmentFiles 返回分段文件以及同目录下同名的后处理产物，如 a.flv 对应的 a.mp4、a.jpg、a.mp4.sha256
+func segmentFiles(segment string) []*fileInfo {
+	segment = absPath(segment)
+	dir := filepath.Dir(segment)
+	base := filepath.Base(segment)
+	prefix := strings.TrimSuffix(base, filepath.Ext(base)) + "."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	files := make([]*fileInfo, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (name != base && !strings.HasPrefix(name, prefix)) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, &fileInfo{
+			path:    filepath.Join(dir, name),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	return files
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
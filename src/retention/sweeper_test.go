@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/jobs"
+	"github.com/bililive-go/bililive-go/src/recorders"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+func TestSweeper(t *testing.T) {
+	out := t.TempDir()
+	cfg := configs.NewConfig()
+	cfg.AppDataPath = t.TempDir()
+	cfg.Retention.RetentionRule = configs.RetentionRule{}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+		Config: cfg,
+	})
+	recorders.NewManager(ctx)
+	jm := jobs.NewManager(ctx)
+	s := NewSweeper(ctx)
+
+	now := time.Now()
+	old := now.Add(-30 * 24 * time.Hour)
+	writeFile := func(name string, size int, modTime time.Time) string {
+		path := filepath.Join(out, name)
+		assert.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+	addSession := func(id string, liveId types.LiveID, platform string, end time.Time, files ...string) {
+		session := &recorders.Session{
+			Id:        id,
+			LiveId:    liveId,
+			Platform:  platform,
+			StartTime: end.Add(-time.Hour),
+			EndTime:   end,
+		}
+		for _, file := range files {
+			session.Segments = append(session.Segments, &recorders.Segment{File: file})
+		}
+		b, err := json.Marshal(session)
+		assert.NoError(t, err)
+		dir := filepath.Join(cfg.AppDataPath, "sessions")
+		assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, id+".json"), b, 0644))
+	}
+
+	a1 := writeFile("a1.flv", 10, old)
+	a2 := writeFile("a2.flv", 10, old)
+	a3 := writeFile("a3.flv", 10, old)
+	a3mp4 := writeFile("a3.mp4", 10, old)
+	writeFile("a3_P002.flv", 10, old)
+	a4 := writeFile("a4.flv", 10, old)
+	b1 := writeFile("b1.flv", 100, old)
+	addSession("a1", "a", "p", now.Add(-10*24*time.Hour), a1)
+	addSession("a2", "a", "p", now.Add(-5*24*time.Hour), a2)
+	addSession("a3", "a", "p", now.Add(-24*time.Hour), a3)
+	addSession("a4", "a", "p", time.Time{}, a4)
+	addSession("b1", "b", "p", now.Add(-2*24*time.Hour), b1)
+
+	preview := func() map[string]string {
+		report, err := s.Preview(ctx)
+		assert.NoError(t, err)
+		assert.True(t, report.DryRun)
+		result := make(map[string]string)
+		for _, d := range report.Deletions {
+			result[filepath.Base(d.Path)] = d.Reason
+		}
+		return result
+	}
+
+	assert.Empty(t, preview())
+
+	// 进行中的场次不参与计数
+	cfg.Retention.KeepSessions = 2
+	assert.Equal(t, map[string]string{"a1.flv": ReasonKeepSessions}, preview())
+
+	cfg.Retention.KeepSessions = 0
+	cfg.Retention.MaxAge = 72 * time.Hour
+	assert.Equal(t, map[string]string{"a1.flv": ReasonMaxAge, "a2.flv": ReasonMaxAge}, preview())
+
+	// 固定的文件与正在后处理的文件不会被删除
+	assert.NoError(t, s.Pin(a1, true))
+	_, err := jm.Submit(ctx, recorders.PostProcessJob, map[string]any{
+		"files": []map[string]any{{"file": a2}},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, preview())
+	assert.NoError(t, s.Pin(a1, false))
+	assert.Empty(t, s.GetPins())
+
+	// 同名的后处理产物与场次一起统计大小和删除
+	cfg.Retention.MaxAge = 0
+	cfg.Retention.MaxRoomSize = 30
+	assert.Equal(t, map[string]string{"a1.flv": ReasonMaxRoomSize, "b1.flv": ReasonMaxRoomSize}, preview())
+	// 太新的文件保留并计入大小
+	cfg.Retention.MaxRoomSize = 15
+	cfg.Retention.MinAge = time.Hour
+	assert.NoError(t, os.Chtimes(a3mp4, now, now))
+	assert.Equal(t, map[string]string{"a3.flv": ReasonMaxRoomSize, "a1.flv": ReasonMaxRoomSize, "b1.flv": ReasonMaxRoomSize}, preview())
+
+	cfg.Retention.MaxRoomSize = 0
+	cfg.Retention.MaxPlatformSize = 25
+	assert.Equal(t, map[string]string{"b1.flv": ReasonMaxPlatformSize, "a1.flv": ReasonMaxPlatformSize}, preview())
+
+	report, err := s.Sweep(ctx)
+	assert.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, int64(110), report.Freed)
+	assert.Equal(t, report, s.LastReport())
+	assert.NoFileExists(t, a1)
+	assert.NoFileExists(t, b1)
+	assert.FileExists(t, a3)
+	assert.FileExists(t, a4)
+
+	entries, _ := os.ReadDir(out)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"a2.flv", "a3.flv", "a3.mp4", "a3_P002.flv", "a4.flv"}, names)
+}
@@ -0,0 +1,248 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+var (
+	ErrOutsideSchedule    = errors.New("outside of recording schedule")
+	ErrDailyLimitExceeded = errors.New("daily recording duration limit exceeded")
+)
+
+// for test
+var (
+	timeNow       = time.Now
+	checkInterval = 30 * time.Second
+)
+
+// recorderManager 与 listenerManager 分别由 recorders.Manager 与 listeners.Manager 实现
+type recorderManager interface {
+	AddRecorder(ctx context.Context, live live.Live) error
+	RemoveRecorder(ctx context.Context, liveId types.LiveID) error
+	HasRecorder(ctx context.Context, liveId types.LiveID) bool
+	IsManualRecording(ctx context.Context, liveId types.LiveID) bool
+}
+
+type listenerManager interface {
+	HasListener(ctx context.Context, liveId types.LiveID) bool
+}
+
+// RoomStatus 设置了录制时间表的直播间的状态
+type RoomStatus struct {
+	LiveId types.LiveID `json:"live_id"`
+	Url    string       `json:"url"`
+	// Active 当前是否在允许录制的时间段内
+	Active bool `json:"active"`
+	// Recorded 今天已录制的时长（秒）
+	Recorded float64 `json:"recorded"`
+	// Waiting 开播时因时间表未录制，等待时间段开始
+	Waiting bool `json:"waiting"`
+}
+
+type Scheduler interface {
+	interfaces.Module
+	Status() []RoomStatus
+	// AllowRecording 不在时间段内或今天的录制时长已达上限时返回错误
+	AllowRecording(l live.Live) error
+}
+
+type usage struct {
+	day      string
+	recorded time.Duration
+}
+
+func NewScheduler(ctx context.Context) Scheduler {
+	inst := instance.GetInstance(ctx)
+	s := &scheduler{
+		inst:    inst,
+		waiting: make(map[types.LiveID]bool),
+		usages:  make(map[types.LiveID]*usage),
+	}
+	inst.Scheduler = s
+	return s
+}
+
+type scheduler struct {
+	inst      *instance.Instance
+	lock      sync.Mutex
+	waiting   map[types.LiveID]bool
+	usages    map[types.LiveID]*usage
+	lastCheck time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (s *scheduler) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(checkInterval):
+				s.check(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *scheduler) Close(ctx context.Context) {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *scheduler) Status() []RoomStatus {
+	now := timeNow()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := make([]RoomStatus, 0)
+	for id, l := range s.inst.Lives {
+		_, sch := s.inst.Config.GetSchedule(l.GetRawUrl())
+		if sch == nil {
+			continue
+		}
+		res = append(res, RoomStatus{
+			LiveId:   id,
+			Url:      l.GetRawUrl(),
+			Active:   sch.Active(now),
+			Recorded: s.recorded(id, sch.Day(now)).Seconds(),
+			Waiting:  s.waiting[id],
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LiveId < res[j].LiveId })
+	return res
+}
+
+func (s *scheduler) AllowRecording(l live.Live) error {
+	room, sch := s.inst.Config.GetSchedule(l.GetRawUrl())
+	if sch == nil {
+		return nil
+	}
+	now := timeNow()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !sch.Active(now) {
+		s.waiting[l.GetLiveId()] = true
+		return ErrOutsideSchedule
+	}
+	if room.MaxDailyDuration > 0 && s.recorded(l.GetLiveId(), sch.Day(now)) >= room.MaxDailyDuration {
+		s.waiting[l.GetLiveId()] = true
+		return ErrDailyLimitExceeded
+	}
+	return nil
+}
+
+// recorded 返回直播间在 day 这一天已录制的时长，调用时需要持有锁
+func (s *scheduler) recorded(id types.LiveID, day string) time.Duration {
+	if u, ok := s.usages[id]; ok && u.day == day {
+		return u.recorded
+	}
+	return 0
+}
+
+// check 统计录制时长，在时间段结束或达到时长上限时停止录制，在时间段开始时为正在直播的直播间开始录制
+func (s *scheduler) check(ctx context.Context) {
+	rm, ok := s.inst.RecorderManager.(recorderManager)
+	if !ok {
+		return
+	}
+	now := timeNow()
+	s.lock.Lock()
+	elapsed := now.Sub(s.lastCheck)
+	if s.lastCheck.IsZero() || elapsed < 0 || elapsed > 2*checkInterval {
+		// 首次检查或时钟跳变时不计入
+		elapsed = 0
+	}
+	s.lastCheck = now
+	s.lock.Unlock()
+
+	for id, l := range s.inst.Lives {
+		room, sch := s.inst.Config.GetSchedule(l.GetRawUrl())
+		if sch == nil {
+			s.lock.Lock()
+			delete(s.waiting, id)
+			delete(s.usages, id)
+			s.lock.Unlock()
+			continue
+		}
+		day := sch.Day(now)
+		recording := rm.HasRecorder(ctx, id)
+		s.lock.Lock()
+		if recording {
+			u, ok := s.usages[id]
+			if !ok || u.day != day {
+				u = &usage{day: day}
+				s.usages[id] = u
+			}
+			u.recorded += elapsed
+		}
+		exceeded := room.MaxDailyDuration > 0 && s.recorded(id, day) >= room.MaxDailyDuration
+		waiting := s.waiting[id]
+		s.lock.Unlock()
+
+		active := sch.Active(now)
+		switch {
+		case recording && rm.IsManualRecording(ctx, id):
+			// 手动开始的录制不受时间表限制
+		case recording && exceeded:
+			s.stop(ctx, rm, l, "daily recording duration limit exceeded")
+		case recording && !active && room.StopOnWindowClose():
+			s.stop(ctx, rm, l, "recording window closed")
+		case !recording && waiting && active && !exceeded:
+			s.resume(ctx, rm, l)
+		}
+	}
+}
+
+func (s *scheduler) stop(ctx context.Context, rm recorderManager, l live.Live, reason string) {
+	s.inst.Logger.Infof("stop recording %s: %s", l.GetRawUrl(), reason)
+	s.lock.Lock()
+	s.waiting[l.GetLiveId()] = true
+	s.lock.Unlock()
+	if err := rm.RemoveRecorder(ctx, l.GetLiveId()); err != nil {
+		s.inst.Logger.WithError(err).Errorf("failed to stop recording %s", l.GetRawUrl())
+	}
+}
+
+// resume 时间段开始时，为仍在直播的直播间开始录制
+func (s *scheduler) resume(ctx context.Context, rm recorderManager, l live.Live) {
+	s.lock.Lock()
+	delete(s.waiting, l.GetLiveId())
+	s.lock.Unlock()
+	lm, _ := s.inst.ListenerManager.(listenerManager)
+	if lm == nil || !lm.HasListener(ctx, l.GetLiveId()) || !s.isLiving(l) {
+		return
+	}
+	s.inst.Logger.Infof("recording window of %s opened, start recording", l.GetRawUrl())
+	if err := rm.AddRecorder(ctx, l); err != nil {
+		s.inst.Logger.WithError(err).Errorf("failed to start recording %s", l.GetRawUrl())
+	}
+}
+
+func (s *scheduler) isLiving(l live.Live) bool {
+	if s.inst.Cache == nil {
+		return false
+	}
+	obj, err := s.inst.Cache.Get(l)
+	if err != nil {
+		return false
+	}
+	info, ok := obj.(*live.Info)
+	return ok && info.Status
+}
@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/live"
+	livemock "github.com/bililive-go/bililive-go/src/live/mock"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+type fakeModule struct{}
+
+func (fakeModule) Start(ctx context.Context) error { return nil }
+func (fakeModule) Close(ctx context.Context)       {}
+
+type fakeRecorderManager struct {
+	fakeModule
+	recording map[types.LiveID]bool
+}
+
+func (m *fakeRecorderManager) AddRecorder(ctx context.Context, live live.Live) error {
+	m.recording[live.GetLiveId()] = true
+	return nil
+}
+
+func (m *fakeRecorderManager) RemoveRecorder(ctx context.Context, liveId types.LiveID) error {
+	delete(m.recording, liveId)
+	return nil
+}
+
+func (m *fakeRecorderManager) HasRecorder(ctx context.Context, liveId types.LiveID) bool {
+	return m.recording[liveId]
+}
+
+func (m *fakeRecorderManager) IsManualRecording(ctx context.Context, liveId types.LiveID) bool {
+	return false
+}
+
+type fakeListenerManager struct {
+	fakeModule
+}
+
+func (fakeListenerManager) HasListener(ctx context.Context, liveId types.LiveID) bool {
+	return true
+}
+
+func newTestLive(ctrl *gomock.Controller, id, rawUrl string) live.Live {
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID(id)).AnyTimes()
+	l.EXPECT().GetRawUrl().Return(rawUrl).AnyTimes()
+	return l
+}
+
+func TestScheduler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// 2024-01-01 是周一
+	now := time.Date(2024, 1, 1, 19, 0, 0, 0, time.UTC)
+	backup := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = backup }()
+
+	cfg := configs.NewConfig()
+	cfg.LiveRooms = []configs.LiveRoom{
+		{Url: "https://example.com/finish", Schedule: &configs.Schedule{Timezone: "UTC", Windows: []string{"20:00-22:00"}}},
+		{Url: "https://example.com/stop", Schedule: &configs.Schedule{Timezone: "UTC", Windows: []string{"20:00-22:00"}, OnWindowClose: configs.WindowCloseStop}},
+		{Url: "https://example.com/limit", Schedule: &configs.Schedule{MaxDailyDuration: time.Hour}},
+		{Url: "https://example.com/free"},
+	}
+	finish := newTestLive(ctrl, "finish", "https://example.com/finish")
+	stop := newTestLive(ctrl, "stop", "https://example.com/stop")
+	limit := newTestLive(ctrl, "limit", "https://example.com/limit")
+	free := newTestLive(ctrl, "free", "https://example.com/free")
+	cache := gcache.New(4).LRU().Build()
+	for _, l := range []live.Live{finish, stop, limit, free} {
+		cache.Set(l, &live.Info{Live: l, Status: true})
+	}
+	rm := &fakeRecorderManager{recording: map[types.LiveID]bool{"limit": true, "free": true}}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger:          &interfaces.Logger{Logger: logrus.New()},
+		Config:          cfg,
+		Lives:           map[types.LiveID]live.Live{"finish": finish, "stop": stop, "limit": limit, "free": free},
+		Cache:           cache,
+		RecorderManager: rm,
+		ListenerManager: fakeListenerManager{},
+	})
+	s := NewScheduler(ctx).(*scheduler)
+
+	// 时间段外开播时拒绝录制，时间段开始时开始录制
+	assert.Equal(t, ErrOutsideSchedule, s.AllowRecording(finish))
+	assert.Equal(t, ErrOutsideSchedule, s.AllowRecording(stop))
+	assert.NoError(t, s.AllowRecording(limit))
+	assert.NoError(t, s.AllowRecording(free))
+	s.check(ctx)
+	assert.Equal(t, map[types.LiveID]bool{"limit": true, "free": true}, rm.recording)
+
+	for now.Hour() < 20 {
+		now = now.Add(checkInterval)
+		s.check(ctx)
+	}
+	assert.Equal(t, map[types.LiveID]bool{"finish": true, "stop": true, "free": true}, rm.recording)
+	assert.Equal(t, ErrDailyLimitExceeded, s.AllowRecording(limit))
+	status := s.Status()
+	assert.Len(t, status, 3)
+	assert.Equal(t, RoomStatus{LiveId: "limit", Url: "https://example.com/limit", Active: true, Recorded: 3600, Waiting: true}, status[1])
+
+	// 时间段结束时按 on_window_close 处理
+	now = time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)
+	s.check(ctx)
+	assert.Equal(t, map[types.LiveID]bool{"finish": true, "free": true}, rm.recording)
+
+	// 每天重新统计录制时长
+	now = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	s.check(ctx)
+	assert.True(t, rm.recording["limit"])
+	assert.NoError(t, s.AllowRecording(limit))
+}
@@ -21,9 +21,17 @@ import (
 	"github.com/bililive-go/bililive-go/src/configs"
 	"github.com/bililive-go/bililive-go/src/consts"
 	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/jobs"
 	"github.com/bililive-go/bililive-go/src/listeners"
 	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/pkg/bandwidth"
+	"github.com/bililive-go/bililive-go/src/pkg/restream"
+	"github.com/bililive-go/bililive-go/src/pkg/utils"
 	"github.com/bililive-go/bililive-go/src/recorders"
+	"github.com/bililive-go/bililive-go/src/relay"
+	"github.com/bililive-go/bililive-go/src/retention"
+	"github.com/bililive-go/bililive-go/src/scheduler"
+	"github.com/bililive-go/bililive-go/src/storage"
 	"github.com/bililive-go/bililive-go/src/types"
 )
 
@@ -33,7 +41,12 @@ func parseInfo(ctx context.Context, l live.Live) *live.Info {
 	obj, _ := inst.Cache.Get(l)
 	info := obj.(*live.Info)
 	info.Listening = inst.ListenerManager.(listeners.Manager).HasListener(ctx, l.GetLiveId())
-	info.Recording = inst.RecorderManager.(recorders.Manager).HasRecorder(ctx, l.GetLiveId())
+	rm := inst.RecorderManager.(recorders.Manager)
+	info.Recording = rm.HasRecorder(ctx, l.GetLiveId())
+	info.ManualRecording = rm.IsManualRecording(ctx, l.GetLiveId())
+	info.RecordPaused = rm.IsPaused(ctx, l.GetLiveId())
+	info.RecordSuppressed = rm.IsSuppressed(ctx, l.GetLiveId())
+	info.RecordWaiting = rm.IsWaiting(ctx, l.GetLiveId())
 	if info.HostName == "" {
 		info.HostName = "获取失败"
 	}
@@ -64,7 +77,102 @@ func getLive(writer http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	writeJSON(writer, parseInfo(r.Context(), live))
+	// 复制一份，避免修改缓存中的信息
+	info := *parseInfo(r.Context(), live)
+	info.Config = inst.Config.GetRoomConfig(live.GetRawUrl())
+	writeJSON(writer, &info)
+}
+
+// getLiveStreams 返回直播间当前可录制的全部变体，第一个为按线路选择策略将被录制的变体，
+// policy_supported 为 false 时平台没有提供可选的画质
+func getLiveStreams(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	vars := mux.Vars(r)
+	live, ok := inst.Lives[types.LiveID(vars["id"])]
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusNotFound, commonResp{
+			ErrNo:  http.StatusNotFound,
+			ErrMsg: fmt.Sprintf("live id: %s can not find", vars["id"]),
+		})
+		return
+	}
+	variants, err := recorders.GetStreamVariants(r.Context(), live)
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusBadGateway, commonResp{
+			ErrNo:  http.StatusBadGateway,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writeJSON(writer, variants)
+}
+
+// getRestreamHub 返回正在本地转播的直播间，不存在时写入 404
+func getRestreamHub(writer http.ResponseWriter, r *http.Request) (*restream.Hub, bool) {
+	inst := instance.GetInstance(r.Context())
+	id := types.LiveID(mux.Vars(r)["id"])
+	reg, ok := inst.Restream.(*restream.Registry)
+	if !ok || !inst.Config.Restream.Enable {
+		writeJsonWithStatusCode(writer, http.StatusNotFound, commonResp{
+			ErrNo:  http.StatusNotFound,
+			ErrMsg: "restream is not enabled",
+		})
+		return nil, false
+	}
+	hub, ok := reg.Get(id)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusNotFound, commonResp{
+			ErrNo:  http.StatusNotFound,
+			ErrMsg: fmt.Sprintf("live id: %s is not being recorded with the native flv parser", id),
+		})
+		return nil, false
+	}
+	return hub, true
+}
+
+func getLiveRestream(writer http.ResponseWriter, r *http.Request) {
+	hub, ok := getRestreamHub(writer, r)
+	if !ok {
+		return
+	}
+	sub, err := hub.Subscribe()
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusNotFound, commonResp{
+			ErrNo:  http.StatusNotFound,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writer.Header().Set("Content-Type", "video/x-flv")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Access-Control-Allow-Origin", "*")
+	if err := sub.Copy(r.Context(), writer); err != nil && !errors.Is(err, context.Canceled) {
+		instance.GetInstance(r.Context()).Logger.WithError(err).Debugf("restream of %s ended", mux.Vars(r)["id"])
+	}
+}
+
+func getLiveHLS(writer http.ResponseWriter, r *http.Request) {
+	hub, ok := getRestreamHub(writer, r)
+	if !ok {
+		return
+	}
+	if !instance.GetInstance(r.Context()).Config.Restream.HLS {
+		writeJsonWithStatusCode(writer, http.StatusNotFound, commonResp{
+			ErrNo:  http.StatusNotFound,
+			ErrMsg: "hls of restream is not enabled",
+		})
+		return
+	}
+	ffmpegPath, err := utils.GetFFmpegPath(r.Context())
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writer.Header().Set("Access-Control-Allow-Origin", "*")
+	hub.ServeHLS(writer, r, ffmpegPath, mux.Vars(r)["file"])
 }
 
 func parseLiveAction(writer http.ResponseWriter, r *http.Request) {
@@ -104,6 +212,13 @@ func parseLiveAction(writer http.ResponseWriter, r *http.Request) {
 		} else {
 			room.IsListening = false
 		}
+	case "record-start", "record-stop", "split", "pause", "resume":
+		if err := controlRecording(r.Context(), live, vars["action"]); err != nil {
+			resp.ErrNo = http.StatusBadRequest
+			resp.ErrMsg = err.Error()
+			writeJsonWithStatusCode(writer, http.StatusBadRequest, resp)
+			return
+		}
 	default:
 		resp.ErrNo = http.StatusBadRequest
 		resp.ErrMsg = fmt.Sprintf("invalid Action: %s", vars["action"])
@@ -123,6 +238,23 @@ func stopListening(ctx context.Context, liveId types.LiveID) error {
 	return inst.ListenerManager.(listeners.Manager).RemoveListener(ctx, liveId)
 }
 
+// controlRecording 手动控制录制，不改变监控状态
+func controlRecording(ctx context.Context, live live.Live, action string) error {
+	rm := instance.GetInstance(ctx).RecorderManager.(recorders.Manager)
+	switch action {
+	case "record-start":
+		return rm.StartRecording(ctx, live)
+	case "record-stop":
+		return rm.StopRecording(ctx, live.GetLiveId())
+	case "split":
+		return rm.SplitRecorder(ctx, live)
+	case "pause":
+		return rm.PauseRecorder(ctx, live)
+	default:
+		return rm.ResumeRecorder(ctx, live)
+	}
+}
+
 /*
 	Post data example
 
@@ -365,16 +497,380 @@ func applyLiveRoomsByConfig(ctx context.Context, oldConfig *configs.Config) erro
 	return nil
 }
 
+// getSessions 返回录制场次，可以通过 live_id 参数筛选
+func getSessions(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	sessions, err := inst.RecorderManager.(recorders.Manager).GetSessions(r.Context())
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusInternalServerError, commonResp{
+			ErrNo:  http.StatusInternalServerError,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	if liveId := r.URL.Query().Get("live_id"); liveId != "" {
+		filtered := make([]*recorders.Session, 0)
+		for _, s := range sessions {
+			if s.LiveId == types.LiveID(liveId) {
+				filtered = append(filtered, s)
+			}
+		}
+		sessions = filtered
+	}
+	writeJSON(writer, sessions)
+}
+
+func getSession(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	vars := mux.Vars(r)
+	session, err := inst.RecorderManager.(recorders.Manager).GetSession(r.Context(), vars["id"])
+	if err != nil {
+		code := http.StatusInternalServerError
+		if err == recorders.ErrSessionNotExist {
+			code = http.StatusNotFound
+		}
+		writeJsonWithStatusCode(writer, code, commonResp{
+			ErrNo:  code,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writeJSON(writer, session)
+}
+
+// getSessionHighlights 返回场次的活跃度曲线与高能片段
+func getSessionHighlights(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	session, err := inst.RecorderManager.(recorders.Manager).GetSession(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		code := http.StatusInternalServerError
+		if err == recorders.ErrSessionNotExist {
+			code = http.StatusNotFound
+		}
+		writeJsonWithStatusCode(writer, code, commonResp{
+			ErrNo:  code,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writeJSON(writer, map[string]any{
+		"timeline":   session.Timeline,
+		"highlights": session.Highlights,
+	})
+}
+
+// detectSessionHighlights 重新检测场次的高能片段，返回提交的任务
+func detectSessionHighlights(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	session, err := inst.RecorderManager.(recorders.Manager).GetSession(r.Context(), mux.Vars(r)["id"])
+	if err == nil {
+		var job *jobs.Job
+		if job, err = recorders.SubmitHighlight(r.Context(), session.Id); err == nil {
+			writeJSON(writer, job)
+			return
+		}
+	}
+	code := http.StatusInternalServerError
+	if err == recorders.ErrSessionNotExist {
+		code = http.StatusNotFound
+	}
+	writeJsonWithStatusCode(writer, code, commonResp{
+		ErrNo:  code,
+		ErrMsg: err.Error(),
+	})
+}
+
+func getStorageStatus(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	writeJSON(writer, inst.StorageMonitor.(storage.Monitor).Status())
+}
+
+func getScheduleStatus(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	writeJSON(writer, inst.Scheduler.(scheduler.Scheduler).Status())
+}
+
+func getRelayStatus(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	writeJSON(writer, inst.Relay.(relay.Relay).Status())
+}
+
+// limitsStatus 并发数与带宽上限的状态
+type limitsStatus struct {
+	MaxConcurrentRecordings int              `json:"max_concurrent_recordings"`
+	Recordings              int              `json:"recordings"`
+	Waiting                 []types.LiveID   `json:"waiting"`
+	OverBudget              string           `json:"over_budget"`
+	Bandwidth               bandwidth.Status `json:"bandwidth"`
+}
+
+func getLimits(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	rm := inst.RecorderManager.(recorders.Manager)
+	status := limitsStatus{
+		MaxConcurrentRecordings: inst.Config.Limits.MaxConcurrentRecordings,
+		Waiting:                 make([]types.LiveID, 0),
+		OverBudget:              inst.Config.Limits.OverBudget,
+		Bandwidth:               inst.Bandwidth.(*bandwidth.Limiter).Status(),
+	}
+	for id := range inst.Lives {
+		if rm.HasRecorder(r.Context(), id) {
+			status.Recordings++
+		}
+		if rm.IsWaiting(r.Context(), id) {
+			status.Waiting = append(status.Waiting, id)
+		}
+	}
+	sort.Slice(status.Waiting, func(i, j int) bool { return status.Waiting[i] < status.Waiting[j] })
+	writeJSON(writer, status)
+}
+
+func writeRetentionError(writer http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if err == retention.ErrSweeping {
+		code = http.StatusConflict
+	}
+	writeJsonWithStatusCode(writer, code, commonResp{
+		ErrNo:  code,
+		ErrMsg: err.Error(),
+	})
+}
+
+func getRetentionReport(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	writeJSON(writer, inst.RetentionSweeper.(retention.Sweeper).LastReport())
+}
+
+func previewRetention(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	report, err := inst.RetentionSweeper.(retention.Sweeper).Preview(r.Context())
+	if err != nil {
+		writeRetentionError(writer, err)
+		return
+	}
+	writeJSON(writer, report)
+}
+
+func sweepRetention(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	report, err := inst.RetentionSweeper.(retention.Sweeper).Sweep(r.Context())
+	if err != nil {
+		writeRetentionError(writer, err)
+		return
+	}
+	writeJSON(writer, report)
+}
+
+func getRetentionPins(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	writeJSON(writer, inst.RetentionSweeper.(retention.Sweeper).GetPins())
+}
+
+/*
+	{
+	    "path": "/srv/bililive/a.flv"
+	}
+*/
+func pinFile(writer http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRetentionError(writer, err)
+		return
+	}
+	setPin(writer, r, gjson.GetBytes(b, "path").String(), true)
+}
+
+// unpinFile 通过 ?path= 指定要取消固定的文件
+func unpinFile(writer http.ResponseWriter, r *http.Request) {
+	setPin(writer, r, r.URL.Query().Get("path"), false)
+}
+
+func setPin(writer http.ResponseWriter, r *http.Request, path string, pinned bool) {
+	if path == "" {
+		writeJsonWithStatusCode(writer, http.StatusBadRequest, commonResp{
+			ErrNo:  http.StatusBadRequest,
+			ErrMsg: "path is required",
+		})
+		return
+	}
+	inst := instance.GetInstance(r.Context())
+	if err := inst.RetentionSweeper.(retention.Sweeper).Pin(path, pinned); err != nil {
+		writeRetentionError(writer, err)
+		return
+	}
+	writeJSON(writer, commonResp{Data: "OK"})
+}
+
+func writeJobError(writer http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch err {
+	case jobs.ErrJobNotExist:
+		code = http.StatusNotFound
+	case jobs.ErrInvalidJobState:
+		code = http.StatusBadRequest
+	}
+	writeJsonWithStatusCode(writer, code, commonResp{
+		ErrNo:  code,
+		ErrMsg: err.Error(),
+	})
+}
+
+func getJobs(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	list := inst.JobManager.(jobs.Manager).GetJobs(r.Context())
+	if state := r.URL.Query().Get("state"); state != "" {
+		filtered := make([]*jobs.Job, 0)
+		for _, j := range list {
+			if j.State == jobs.State(state) {
+				filtered = append(filtered, j)
+			}
+		}
+		list = filtered
+	}
+	writeJSON(writer, list)
+}
+
+func getJob(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	job, err := inst.JobManager.(jobs.Manager).GetJob(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeJobError(writer, err)
+		return
+	}
+	writeJSON(writer, job)
+}
+
+func getJobLog(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	b, err := inst.JobManager.(jobs.Manager).GetLog(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeJobError(writer, err)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.Write(b)
+}
+
+func cancelJob(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	if err := inst.JobManager.(jobs.Manager).Cancel(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeJobError(writer, err)
+		return
+	}
+	writeJSON(writer, commonResp{Data: "OK"})
+}
+
+func retryJob(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	if err := inst.JobManager.(jobs.Manager).Retry(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeJobError(writer, err)
+		return
+	}
+	writeJSON(writer, commonResp{Data: "OK"})
+}
+
 func getInfo(writer http.ResponseWriter, r *http.Request) {
 	writeJSON(writer, consts.AppInfo)
 }
 
+// outputRoot 文件接口可以访问的输出目录
+type outputRoot struct {
+	Name string
+	Path string
+}
+
+// outputRoots 返回全局的 out_put_path 与直播间生效的其他输出目录，
+// 不在全局目录下的输出目录以 @目录名 的虚拟目录挂载在文件列表的根目录下，重名时加上序号
+func outputRoots(inst *instance.Instance) ([]outputRoot, error) {
+	base, err := filepath.Abs(inst.Config.OutPutPath)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{base: true}
+	var paths []string
+	for _, l := range inst.Lives {
+		path, err := filepath.Abs(inst.Config.GetRoomConfig(l.GetRawUrl()).OutPutPath)
+		if err != nil || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if rel, err := filepath.Rel(base, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			// 已经可以通过全局目录访问
+			continue
+		}
+		paths = append(paths, path)
+	}
+	// 按路径排序，保证配置不变时虚拟目录名称不变
+	sort.Strings(paths)
+	roots := []outputRoot{{Path: base}}
+	names := make(map[string]bool)
+	for _, path := range paths {
+		name := "@" + filepath.Base(path)
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("@%s-%d", filepath.Base(path), i)
+		}
+		names[name] = true
+		roots = append(roots, outputRoot{Name: name, Path: path})
+	}
+	return roots, nil
+}
+
+// resolveOutputPath 将文件接口中的相对路径解析为所在的输出目录与绝对路径，路径不能跳出输出目录
+func resolveOutputPath(inst *instance.Instance, path string) (string, string, error) {
+	roots, err := outputRoots(inst)
+	if err != nil {
+		return "", "", err
+	}
+	base := roots[0].Path
+	first, rest, _ := strings.Cut(strings.TrimPrefix(filepath.ToSlash(path), "/"), "/")
+	for _, root := range roots[1:] {
+		if root.Name == first {
+			base, path = root.Path, rest
+			break
+		}
+	}
+	absPath := filepath.Join(base, filepath.FromSlash(path))
+	if rel, err := filepath.Rel(base, absPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", errors.New("invalid path")
+	}
+	return base, absPath, nil
+}
+
+// serveFiles 提供输出目录中的文件下载，路径规则与 getFileInfo 相同
+func serveFiles(writer http.ResponseWriter, r *http.Request) {
+	base, absPath, err := resolveOutputPath(instance.GetInstance(r.Context()), r.URL.Path)
+	if err != nil {
+		http.NotFound(writer, r)
+		return
+	}
+	rel, _ := filepath.Rel(base, absPath)
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.RawPath = ""
+	switch {
+	case rel != ".":
+		r2.URL.Path = "/" + filepath.ToSlash(rel)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			r2.URL.Path += "/"
+		}
+	case r.URL.Path != "" && !strings.HasSuffix(r.URL.Path, "/"):
+		// 虚拟目录本身，重定向到以 / 结尾的地址，保证目录列表中的相对链接正确
+		http.Redirect(writer, r, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]+"/", http.StatusMovedPermanently)
+		return
+	default:
+		r2.URL.Path = "/"
+	}
+	http.FileServer(http.Dir(base)).ServeHTTP(writer, r2)
+}
+
 func getFileInfo(writer http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	path := vars["path"]
 
 	inst := instance.GetInstance(r.Context())
-	base, err := filepath.Abs(inst.Config.OutPutPath)
+	roots, err := outputRoots(inst)
 	if err != nil {
 		writeJSON(writer, commonResp{
 			ErrMsg: "无效输出目录",
@@ -382,14 +878,8 @@ func getFileInfo(writer http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	absPath, err := filepath.Abs(filepath.Join(base, path))
+	_, absPath, err := resolveOutputPath(inst, path)
 	if err != nil {
-		writeJSON(writer, commonResp{
-			ErrMsg: "无效路径",
-		})
-		return
-	}
-	if !strings.HasPrefix(absPath, base) {
 		writeJSON(writer, commonResp{
 			ErrMsg: "异常路径",
 		})
@@ -429,6 +919,16 @@ func getFileInfo(writer http.ResponseWriter, r *http.Request) {
 			jsonFiles[i].Size = info.Size()
 		}
 	}
+	if strings.Trim(path, "/") == "" {
+		// 其他输出目录作为虚拟目录列在根目录下
+		for _, root := range roots[1:] {
+			f := jsonFile{IsFolder: true, Name: root.Name}
+			if info, err := os.Stat(root.Path); err == nil {
+				f.LastModified = info.ModTime().Unix()
+			}
+			jsonFiles = append(jsonFiles, f)
+		}
+	}
 	json.Files = jsonFiles
 
 	writeJSON(writer, json)
@@ -0,0 +1,150 @@
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/live"
+	livemock "github.com/bililive-go/bililive-go/src/live/mock"
+	"github.com/bililive-go/bililive-go/src/recorders"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+func TestGetLiveStreams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	info := func(rawUrl, codec string, resolution int) *live.StreamUrlInfo {
+		u, _ := url.Parse(rawUrl)
+		return &live.StreamUrlInfo{Url: u, Codec: codec, Resolution: resolution}
+	}
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetRawUrl().Return("https://live.example.com/1").AnyTimes()
+	l.EXPECT().GetStreamInfos().Return([]*live.StreamUrlInfo{
+		info("https://a.example.com/720.flv", live.CodecAVC, 720),
+		info("https://a.example.com/1080.flv", live.CodecAVC, 1080),
+		info("https://b.example.com/1080.flv", live.CodecAVC, 1080),
+	}, nil)
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: new(configs.Config),
+		Lives:  map[types.LiveID]live.Live{"test": l},
+	})
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/lives/"+id+"/streams", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		getLiveStreams(w, mux.SetURLVars(req, map[string]string{"id": id}))
+		return w
+	}
+
+	w := get("test")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp recorders.StreamVariants
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.PolicySupported)
+	if variants := resp.Variants; assert.Len(t, variants, 2) {
+		assert.True(t, variants[0].Selected)
+		assert.Equal(t, 1080, variants[0].Resolution)
+		assert.Equal(t, []string{"a.example.com", "b.example.com"}, variants[0].Hosts)
+		assert.False(t, variants[1].Selected)
+	}
+
+	// 只有一条没有画质信息的线路时线路选择策略不起作用
+	single := livemock.NewMockLive(ctrl)
+	single.EXPECT().GetRawUrl().Return("https://live.example.com/2").AnyTimes()
+	single.EXPECT().GetStreamInfos().Return([]*live.StreamUrlInfo{info("https://a.example.com/live.flv", "", 0)}, nil)
+	instance.GetInstance(ctx).Lives["single"] = single
+	w = get("single")
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp = recorders.StreamVariants{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.PolicySupported)
+	assert.Len(t, resp.Variants, 1)
+
+	w = get("unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOutputRoots(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	global, other := t.TempDir(), t.TempDir()
+	nested := filepath.Join(global, "nested")
+	assert.NoError(t, os.WriteFile(filepath.Join(global, "a.flv"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(other, "b.flv"), []byte("bb"), 0644))
+	cfg := configs.NewConfig()
+	cfg.OutPutPath = global
+	cfg.Platforms = map[string]configs.Overrides{
+		"other.example.com":  {OutPutPath: &other},
+		"nested.example.com": {OutPutPath: &nested},
+	}
+	lives := make(map[types.LiveID]live.Live)
+	for id, rawUrl := range map[string]string{
+		"global": "https://live.example.com/1",
+		"other":  "https://other.example.com/1",
+		"nested": "https://nested.example.com/1",
+	} {
+		l := livemock.NewMockLive(ctrl)
+		l.EXPECT().GetRawUrl().Return(rawUrl).AnyTimes()
+		lives[types.LiveID(id)] = l
+	}
+	inst := &instance.Instance{Config: cfg, Lives: lives}
+	ctx := context.WithValue(context.Background(), instance.Key, inst)
+
+	// 不在全局目录下的输出目录作为虚拟目录列在根目录下
+	roots, err := outputRoots(inst)
+	assert.NoError(t, err)
+	name := "@" + filepath.Base(other)
+	assert.Equal(t, []outputRoot{{Path: global}, {Name: name, Path: other}}, roots)
+
+	list := func(path string) map[string]bool {
+		req := httptest.NewRequest(http.MethodGet, "/api/file/"+path, nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		getFileInfo(w, mux.SetURLVars(req, map[string]string{"path": path}))
+		var resp struct {
+			Files []struct {
+				Name string `json:"name"`
+			} `json:"files"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		names := make(map[string]bool)
+		for _, f := range resp.Files {
+			names[f.Name] = true
+		}
+		return names
+	}
+	assert.Equal(t, map[string]bool{"a.flv": true, name: true}, list(""))
+	assert.Equal(t, map[string]bool{"b.flv": true}, list(name))
+	assert.Empty(t, list(name+"/../.."))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files/"+path, nil).WithContext(ctx)
+		req.URL.Path = path
+		w := httptest.NewRecorder()
+		serveFiles(w, req)
+		return w
+	}
+	w := get("a.flv")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "a", w.Body.String())
+	w = get(name + "/b.flv")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bb", w.Body.String())
+	w = get(name)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, name+"/", w.Header().Get("Location"))
+	assert.Equal(t, http.StatusNotFound, get("../"+filepath.Base(other)+"/b.flv").Code)
+}
@@ -72,7 +72,29 @@ func initMux(ctx context.Context) *mux.Router {
 	apiRoute.HandleFunc("/lives", addLives).Methods("POST")
 	apiRoute.HandleFunc("/lives/{id}", getLive).Methods("GET")
 	apiRoute.HandleFunc("/lives/{id}", removeLive).Methods("DELETE")
+	apiRoute.HandleFunc("/lives/{id}/streams", getLiveStreams).Methods("GET")
+	apiRoute.HandleFunc("/lives/{id}/stream.flv", getLiveRestream).Methods("GET")
+	apiRoute.HandleFunc("/lives/{id}/hls/{file}", getLiveHLS).Methods("GET")
 	apiRoute.HandleFunc("/lives/{id}/{action}", parseLiveAction).Methods("GET")
+	apiRoute.HandleFunc("/sessions", getSessions).Methods("GET")
+	apiRoute.HandleFunc("/sessions/{id}", getSession).Methods("GET")
+	apiRoute.HandleFunc("/sessions/{id}/highlights", getSessionHighlights).Methods("GET")
+	apiRoute.HandleFunc("/sessions/{id}/highlights", detectSessionHighlights).Methods("POST")
+	apiRoute.HandleFunc("/storage", getStorageStatus).Methods("GET")
+	apiRoute.HandleFunc("/schedule", getScheduleStatus).Methods("GET")
+	apiRoute.HandleFunc("/relays", getRelayStatus).Methods("GET")
+	apiRoute.HandleFunc("/limits", getLimits).Methods("GET")
+	apiRoute.HandleFunc("/retention", getRetentionReport).Methods("GET")
+	apiRoute.HandleFunc("/retention/preview", previewRetention).Methods("GET")
+	apiRoute.HandleFunc("/retention/sweep", sweepRetention).Methods("POST")
+	apiRoute.HandleFunc("/retention/pins", getRetentionPins).Methods("GET")
+	apiRoute.HandleFunc("/retention/pins", pinFile).Methods("POST")
+	apiRoute.HandleFunc("/retention/pins", unpinFile).Methods("DELETE")
+	apiRoute.HandleFunc("/jobs", getJobs).Methods("GET")
+	apiRoute.HandleFunc("/jobs/{id}", getJob).Methods("GET")
+	apiRoute.HandleFunc("/jobs/{id}/logs", getJobLog).Methods("GET")
+	apiRoute.HandleFunc("/jobs/{id}/cancel", cancelJob).Methods("POST")
+	apiRoute.HandleFunc("/jobs/{id}/retry", retryJob).Methods("POST")
 	apiRoute.HandleFunc("/file/{path:.*}", getFileInfo).Methods("GET")
 	apiRoute.HandleFunc("/cookies", getLiveHostCookie).Methods("GET")
 	apiRoute.HandleFunc("/cookies", putLiveHostCookie).Methods("PUT")
@@ -82,11 +104,7 @@ func initMux(ctx context.Context) *mux.Router {
 		CORSMiddleware(
 			http.StripPrefix(
 				"/files/",
-				http.FileServer(
-					http.Dir(
-						instance.GetInstance(ctx).Config.OutPutPath,
-					),
-				),
+				http.HandlerFunc(serveFiles),
 			),
 		),
 	)
@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import "syscall"
+
+func getDiskUsage(path string) (DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{
+		Total: uint64(st.Blocks) * uint64(st.Bsize),
+		// 非 root 用户可用的空间
+		Free: uint64(st.Bavail) * uint64(st.Bsize),
+	}, nil
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package storage
+
+import "golang.org/x/sys/windows"
+
+func getDiskUsage(path string) (DiskUsage, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{Total: total, Free: free}, nil
+}
@@ -0,0 +1,356 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/live"
+	"github.com/bililive-go/bililive-go/src/notify"
+	"github.com/bililive-go/bililive-go/src/pkg/utils"
+	"github.com/bililive-go/bililive-go/src/recorders"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+var (
+	ErrInsufficientStorage = errors.New("insufficient storage space")
+	ErrNotSupported        = errors.New("disk usage is not supported on this platform")
+)
+
+// State 磁盘空间的状态
+type State string
+
+const (
+	StateOk       State = "ok"
+	StateWarning  State = "warning"
+	StateCritical State = "critical"
+)
+
+type DiskUsage struct {
+	Total uint64
+	Free  uint64
+}
+
+// DiskStatus 一个输出目录所在磁盘的空间
+type DiskStatus struct {
+	Path      string    `json:"path"`
+	Total     uint64    `json:"total"`
+	Free      uint64    `json:"free"`
+	State     State     `json:"state"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type Status struct {
+	Enable bool `json:"enable"`
+	// State 所有输出目录中最差的状态
+	State State `json:"state"`
+	// Disks 全局与各平台、直播间生效的 out_put_path，按路径排序
+	Disks []DiskStatus `json:"disks"`
+	// Paused 因空间不足被拒绝或停止录制、等待空间恢复后继续的直播间
+	Paused []types.LiveID `json:"paused"`
+}
+
+// for test
+var (
+	diskUsage   = getDiskUsage
+	sendMessage = notify.SendMessage
+)
+
+// recorderManager 与 listenerManager 分别由 recorders.Manager 与 listeners.Manager 实现
+type recorderManager interface {
+	AddRecorder(ctx context.Context, live live.Live) error
+	RemoveRecorder(ctx context.Context, liveId types.LiveID) error
+	HasRecorder(ctx context.Context, liveId types.LiveID) bool
+	IsManualRecording(ctx context.Context, liveId types.LiveID) bool
+}
+
+type listenerManager interface {
+	HasListener(ctx context.Context, liveId types.LiveID) bool
+}
+
+type Monitor interface {
+	interfaces.Module
+	Status() Status
+	// AllowRecording 直播间的输出目录空间不足且优先级低于 protected_priority 时返回 ErrInsufficientStorage
+	AllowRecording(l live.Live) error
+}
+
+func NewMonitor(ctx context.Context) Monitor {
+	inst := instance.GetInstance(ctx)
+	m := &monitor{
+		inst:   inst,
+		disks:  make(map[string]*DiskStatus),
+		paused: make(map[types.LiveID]bool),
+	}
+	inst.StorageMonitor = m
+	return m
+}
+
+type monitor struct {
+	inst *instance.Instance
+	lock sync.Mutex
+	// 以输出目录为键
+	disks  map[string]*DiskStatus
+	paused map[types.LiveID]bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (m *monitor) Start(ctx context.Context) error {
+	if !m.inst.Config.StorageMonitor.Enable {
+		return nil
+	}
+	if _, err := diskUsage(m.inst.Config.OutPutPath); errors.Is(err, ErrNotSupported) {
+		m.inst.Logger.Warn("storage monitor is not supported on this platform")
+		return nil
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.check(ctx)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for {
+			interval := m.inst.Config.StorageMonitor.CheckInterval
+			if interval < time.Second {
+				interval = time.Second
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+				m.check(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *monitor) Close(ctx context.Context) {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.wg.Wait()
+}
+
+func (m *monitor) Status() Status {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s := Status{
+		Enable: m.inst.Config.StorageMonitor.Enable,
+		State:  StateOk,
+		Disks:  make([]DiskStatus, 0, len(m.disks)),
+	}
+	for _, d := range m.disks {
+		s.Disks = append(s.Disks, *d)
+		if severity(d.State) > severity(s.State) {
+			s.State = d.State
+		}
+	}
+	sort.Slice(s.Disks, func(i, j int) bool { return s.Disks[i].Path < s.Disks[j].Path })
+	s.Paused = make([]types.LiveID, 0, len(m.paused))
+	for id := range m.paused {
+		s.Paused = append(s.Paused, id)
+	}
+	sort.Slice(s.Paused, func(i, j int) bool { return s.Paused[i] < s.Paused[j] })
+	return s
+}
+
+func (m *monitor) AllowRecording(l live.Live) error {
+	path := m.outputPath(l)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if d, ok := m.disks[path]; !ok || d.State != StateCritical || m.inst.Config.GetPriority(l.GetRawUrl()) >= m.inst.Config.StorageMonitor.ProtectedPriority {
+		return nil
+	}
+	m.paused[l.GetLiveId()] = true
+	return ErrInsufficientStorage
+}
+
+func severity(s State) int {
+	switch s {
+	case StateCritical:
+		return 2
+	case StateWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// outputPath 返回直播间生效的 out_put_path
+func (m *monitor) outputPath(l live.Live) string {
+	return filepath.Clean(m.inst.Config.GetRoomConfig(l.GetRawUrl()).OutPutPath)
+}
+
+// outputPaths 返回全局与各直播间生效的 out_put_path，可能位于不同的磁盘
+func (m *monitor) outputPaths() map[string]bool {
+	paths := map[string]bool{filepath.Clean(m.inst.Config.OutPutPath): true}
+	for _, l := range m.inst.Lives {
+		paths[m.outputPath(l)] = true
+	}
+	return paths
+}
+
+func (m *monitor) check(ctx context.Context) {
+	paths := m.outputPaths()
+	m.lock.Lock()
+	for path := range m.disks {
+		if !paths[path] {
+			delete(m.disks, path)
+		}
+	}
+	m.lock.Unlock()
+	for path := range paths {
+		if m.checkPath(ctx, path) == StateCritical {
+			m.shed(ctx, path)
+		}
+	}
+	// 空间恢复到 warning 以上时才继续录制，避免在阈值附近反复启停
+	m.resume(ctx)
+}
+
+// checkPath 检查 path 所在磁盘的剩余空间，返回检查后的状态
+func (m *monitor) checkPath(ctx context.Context, path string) State {
+	cfg := m.inst.Config
+	usage, err := diskUsage(path)
+
+	m.lock.Lock()
+	d, ok := m.disks[path]
+	if !ok {
+		d = &DiskStatus{Path: path, State: StateOk}
+		m.disks[path] = d
+	}
+	old := d.State
+	d.CheckedAt = time.Now()
+	if err != nil {
+		// 获取失败时保持之前的状态
+		d.Error = err.Error()
+		m.lock.Unlock()
+		m.inst.Logger.WithError(err).Warnf("failed to get disk usage of %s", path)
+		return old
+	}
+	d.Error = ""
+	d.Total, d.Free = usage.Total, usage.Free
+	switch free := int64(usage.Free); {
+	case free < cfg.StorageMonitor.CriticalFreeSpace:
+		d.State = StateCritical
+	case free < cfg.StorageMonitor.WarningFreeSpace:
+		d.State = StateWarning
+	default:
+		d.State = StateOk
+	}
+	state := d.State
+	m.lock.Unlock()
+
+	if state != old {
+		m.onStateChanged(ctx, path, state, usage)
+	}
+	return state
+}
+
+func (m *monitor) onStateChanged(ctx context.Context, path string, state State, usage DiskUsage) {
+	body := fmt.Sprintf("路径：%s\n剩余空间：%s / %s", path,
+		utils.FormatBytes(int64(usage.Free)), utils.FormatBytes(int64(usage.Total)))
+	var subject string
+	switch state {
+	case StateCritical:
+		m.inst.Logger.Errorf("free space of %s is critical: %d bytes left, low priority recordings will be stopped", path, usage.Free)
+		subject = "磁盘空间严重不足，正在停止低优先级的录制"
+	case StateWarning:
+		m.inst.Logger.Warnf("free space of %s is low: %d bytes left", path, usage.Free)
+		subject = "磁盘空间不足"
+	default:
+		m.inst.Logger.Infof("free space of %s recovered: %d bytes left", path, usage.Free)
+		subject = "磁盘空间已恢复"
+	}
+	if err := sendMessage(ctx, subject, body); err != nil {
+		m.inst.Logger.WithError(err).Error("failed to send storage notification")
+	}
+}
+
+// shed 每次检查停止一个输出到 path 的优先级最低的录制，给正在写入的文件留出结束的空间
+func (m *monitor) shed(ctx context.Context, path string) {
+	rm, ok := m.inst.RecorderManager.(recorderManager)
+	if !ok {
+		return
+	}
+	recording := make([]live.Live, 0)
+	for id, l := range m.inst.Lives {
+		if rm.HasRecorder(ctx, id) && m.outputPath(l) == path {
+			recording = append(recording, l)
+		}
+	}
+	protected := m.inst.Config.StorageMonitor.ProtectedPriority
+	victim, priority, ok := recorders.LowestPriority(m.inst.Config, recording,
+		func(id types.LiveID) bool { return rm.IsManualRecording(ctx, id) },
+		func(p int) bool { return p >= protected })
+	if !ok {
+		return
+	}
+	id := victim.GetLiveId()
+	m.inst.Logger.Warnf("stop recording %s (priority %d) because of insufficient storage", victim.GetRawUrl(), priority)
+	m.lock.Lock()
+	m.paused[id] = true
+	m.lock.Unlock()
+	if err := rm.RemoveRecorder(ctx, id); err != nil {
+		m.inst.Logger.WithError(err).Errorf("failed to stop recording %s", victim.GetRawUrl())
+	}
+}
+
+// resume 为输出目录空间已恢复、仍在直播的暂停直播间重新开始录制
+func (m *monitor) resume(ctx context.Context) {
+	m.lock.Lock()
+	paused := make([]types.LiveID, 0, len(m.paused))
+	for id := range m.paused {
+		l, ok := m.inst.Lives[id]
+		if ok {
+			if d, checked := m.disks[m.outputPath(l)]; checked && d.State != StateOk {
+				continue
+			}
+		}
+		paused = append(paused, id)
+	}
+	m.lock.Unlock()
+	if len(paused) == 0 {
+		return
+	}
+	rm, ok := m.inst.RecorderManager.(recorderManager)
+	if !ok {
+		return
+	}
+	lm, _ := m.inst.ListenerManager.(listenerManager)
+	for _, id := range paused {
+		l, ok := m.inst.Lives[id]
+		if ok && !rm.HasRecorder(ctx, id) && lm != nil && lm.HasListener(ctx, id) && m.isLiving(l) {
+			m.inst.Logger.Infof("resume recording %s", l.GetRawUrl())
+			if err := rm.AddRecorder(ctx, l); err != nil {
+				m.inst.Logger.WithError(err).Errorf("failed to resume recording %s", l.GetRawUrl())
+				continue
+			}
+		}
+		m.lock.Lock()
+		delete(m.paused, id)
+		m.lock.Unlock()
+	}
+}
+
+func (m *monitor) isLiving(l live.Live) bool {
+	if m.inst.Cache == nil {
+		return false
+	}
+	obj, err := m.inst.Cache.Get(l)
+	if err != nil {
+		return false
+	}
+	info, ok := obj.(*live.Info)
+	return ok && info.Status
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluele/gcache"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/bililive-go/bililive-go/src/configs"
+	"github.com/bililive-go/bililive-go/src/instance"
+	"github.com/bililive-go/bililive-go/src/interfaces"
+	"github.com/bililive-go/bililive-go/src/live"
+	livemock "github.com/bililive-go/bililive-go/src/live/mock"
+	"github.com/bililive-go/bililive-go/src/types"
+)
+
+type fakeModule struct{}
+
+func (fakeModule) Start(ctx context.Context) error { return nil }
+func (fakeModule) Close(ctx context.Context)       {}
+
+type fakeRecorderManager struct {
+	fakeModule
+	recording map[types.LiveID]bool
+	manual    map[types.LiveID]bool
+}
+
+func (m *fakeRecorderManager) AddRecorder(ctx context.Context, live live.Live) error {
+	m.recording[live.GetLiveId()] = true
+	return nil
+}
+
+func (m *fakeRecorderManager) RemoveRecorder(ctx context.Context, liveId types.LiveID) error {
+	delete(m.recording, liveId)
+	return nil
+}
+
+func (m *fakeRecorderManager) HasRecorder(ctx context.Context, liveId types.LiveID) bool {
+	return m.recording[liveId]
+}
+
+func (m *fakeRecorderManager) IsManualRecording(ctx context.Context, liveId types.LiveID) bool {
+	return m.manual[liveId]
+}
+
+type fakeListenerManager struct {
+	fakeModule
+}
+
+func (fakeListenerManager) HasListener(ctx context.Context, liveId types.LiveID) bool {
+	return true
+}
+
+func newTestLive(ctrl *gomock.Controller, id, rawUrl string) live.Live {
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(types.LiveID(id)).AnyTimes()
+	l.EXPECT().GetRawUrl().Return(rawUrl).AnyTimes()
+	return l
+}
+
+func TestMonitor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		free     uint64
+		messages []string
+	)
+	backupDiskUsage, backupSendMessage := diskUsage, sendMessage
+	diskUsage = func(path string) (DiskUsage, error) {
+		return DiskUsage{Total: 1000, Free: free}, nil
+	}
+	sendMessage = func(ctx context.Context, subject, body string) error {
+		messages = append(messages, subject)
+		return nil
+	}
+	defer func() { diskUsage, sendMessage = backupDiskUsage, backupSendMessage }()
+
+	cfg := configs.NewConfig()
+	cfg.StorageMonitor.WarningFreeSpace = 500
+	cfg.StorageMonitor.CriticalFreeSpace = 100
+	cfg.LiveRooms = []configs.LiveRoom{
+		{Url: "https://example.com/low", Priority: -1},
+		{Url: "https://example.com/normal"},
+		{Url: "https://example.com/important", Priority: 1},
+	}
+	low := newTestLive(ctrl, "low", "https://example.com/low")
+	normal := newTestLive(ctrl, "normal", "https://example.com/normal")
+	important := newTestLive(ctrl, "important", "https://example.com/important")
+	cache := gcache.New(4).LRU().Build()
+	for _, l := range []live.Live{low, normal, important} {
+		cache.Set(l, &live.Info{Live: l, Status: true})
+	}
+	rm := &fakeRecorderManager{recording: map[types.LiveID]bool{"low": true, "normal": true, "important": true}}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger:          &interfaces.Logger{Logger: logrus.New()},
+		Config:          cfg,
+		Lives:           map[types.LiveID]live.Live{"low": low, "normal": normal, "important": important},
+		Cache:           cache,
+		RecorderManager: rm,
+		ListenerManager: fakeListenerManager{},
+	})
+	m := NewMonitor(ctx).(*monitor)
+
+	free = 800
+	m.check(ctx)
+	assert.Equal(t, StateOk, m.Status().State)
+	assert.Empty(t, messages)
+	assert.NoError(t, m.AllowRecording(low))
+
+	free = 300
+	m.check(ctx)
+	assert.Equal(t, StateWarning, m.Status().State)
+	assert.Equal(t, []string{"磁盘空间不足"}, messages)
+	assert.NoError(t, m.AllowRecording(low))
+
+	// 每次检查只停止一个优先级最低的录制，受保护的直播间继续录制
+	free = 50
+	m.check(ctx)
+	assert.Equal(t, StateCritical, m.Status().State)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, map[types.LiveID]bool{"normal": true, "important": true}, rm.recording)
+	m.check(ctx)
+	assert.Equal(t, map[types.LiveID]bool{"important": true}, rm.recording)
+	m.check(ctx)
+	assert.Equal(t, map[types.LiveID]bool{"important": true}, rm.recording)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, ErrInsufficientStorage, m.AllowRecording(low))
+	assert.NoError(t, m.AllowRecording(important))
+	assert.Equal(t, []types.LiveID{"low", "normal"}, m.Status().Paused)
+
+	// 回到 warning 时不恢复，避免在阈值附近反复启停
+	free = 300
+	m.check(ctx)
+	assert.Equal(t, map[types.LiveID]bool{"important": true}, rm.recording)
+
+	free = 800
+	m.check(ctx)
+	assert.Equal(t, map[types.LiveID]bool{"low": true, "normal": true, "important": true}, rm.recording)
+	assert.Empty(t, m.Status().Paused)
+	assert.Equal(t, "磁盘空间已恢复", messages[len(messages)-1])
+}
+
+func TestMonitorOutputPaths(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	free := map[string]uint64{"/mnt/disk1": 800, "/mnt/disk2": 800}
+	backupDiskUsage, backupSendMessage := diskUsage, sendMessage
+	diskUsage = func(path string) (DiskUsage, error) {
+		return DiskUsage{Total: 1000, Free: free[path]}, nil
+	}
+	sendMessage = func(ctx context.Context, subject, body string) error { return nil }
+	defer func() { diskUsage, sendMessage = backupDiskUsage, backupSendMessage }()
+
+	cfg := configs.NewConfig()
+	cfg.AppDataPath = ""
+	cfg.OutPutPath = "/mnt/disk1"
+	cfg.StorageMonitor.WarningFreeSpace = 500
+	cfg.StorageMonitor.CriticalFreeSpace = 100
+	disk2 := "/mnt/disk2/"
+	cfg.Platforms = map[string]configs.Overrides{"other.com": {OutPutPath: &disk2}}
+	cfg.LiveRooms = []configs.LiveRoom{{Url: "https://example.com/a"}, {Url: "https://other.com/b"}, {Url: "https://example.com/c"}}
+	a := newTestLive(ctrl, "a", "https://example.com/a")
+	b := newTestLive(ctrl, "b", "https://other.com/b")
+	c := newTestLive(ctrl, "c", "https://example.com/c")
+	rm := &fakeRecorderManager{
+		recording: map[types.LiveID]bool{"a": true, "b": true, "c": true},
+		manual:    map[types.LiveID]bool{"c": true},
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger:          &interfaces.Logger{Logger: logrus.New()},
+		Config:          cfg,
+		Lives:           map[types.LiveID]live.Live{"a": a, "b": b, "c": c},
+		Cache:           gcache.New(4).LRU().Build(),
+		RecorderManager: rm,
+		ListenerManager: fakeListenerManager{},
+	})
+	m := NewMonitor(ctx).(*monitor)
+
+	// 只停止输出到空间不足的磁盘上的录制
+	free["/mnt/disk2"] = 50
+	m.check(ctx)
+	status := m.Status()
+	assert.Equal(t, StateCritical, status.State)
+	assert.Len(t, status.Disks, 2)
+	assert.Equal(t, "/mnt/disk1", status.Disks[0].Path)
+	assert.Equal(t, StateOk, status.Disks[0].State)
+	assert.Equal(t, StateCritical, status.Disks[1].State)
+	assert.Equal(t, map[types.LiveID]bool{"a": true, "c": true}, rm.recording)
+	assert.NoError(t, m.AllowRecording(a))
+	assert.Equal(t, ErrInsufficientStorage, m.AllowRecording(b))
+
+	// 手动开始的录制不会被停止
+	free["/mnt/disk1"] = 50
+	m.check(ctx)
+	m.check(ctx)
+	assert.Equal(t, map[types.LiveID]bool{"c": true}, rm.recording)
+}